@@ -0,0 +1,789 @@
+// Package config describes the configuration file of ghmgr, along with
+// the environment variables overriding it and its validation.
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// target.type values
+const (
+	TargetGitHub = "github"
+	TargetGitLab = "gitlab"
+	TargetGitea  = "gitea"
+)
+
+// source.type values
+const (
+	SourceGitHub      = "github"
+	SourceBitbucket   = "bitbucket"
+	SourceURLs        = "urls"
+	SourceAzureDevOps = "azuredevops"
+)
+
+// target.on_exists values
+const (
+	OnExistsFail     = "fail"
+	OnExistsSkip     = "skip"
+	OnExistsPush     = "push"
+	OnExistsRecreate = "recreate"
+)
+
+// git.protocol values
+const (
+	ProtocolSSH   = "ssh"
+	ProtocolHTTPS = "https"
+)
+
+// ProxyDirect is the value of source.proxy and target.proxy reaching an
+// endpoint without a proxy, whatever the HTTPS_PROXY variable.
+const ProxyDirect = "direct"
+
+// git.clone_mode values
+const (
+	CloneModeDisk   = "disk"
+	CloneModeMemory = "memory"
+)
+
+// git.transfer_mode values
+const (
+	TransferModeClone  = "clone"
+	TransferModeImport = "import"
+	TransferModeNative = "native"
+)
+
+// source.content rule modes
+const (
+	ContentPrepend = "prepend"
+	ContentAppend  = "append"
+	ContentReplace = "replace"
+	ContentRegex   = "regex"
+)
+
+// source.tombstone.mode values
+const (
+	TombstoneReadme = "readme"
+	TombstoneBranch = "branch"
+)
+
+// source.content.method values
+const (
+	ContentMethodAPI = "api"
+	ContentMethodGit = "git"
+)
+
+// git.commit_messages operations, the commits created by the tool
+const (
+	CommitContent    = "content"
+	CommitCodeowners = "codeowners"
+	CommitPages      = "pages"
+	CommitSubmodules = "submodules"
+	CommitWorkflows  = "workflows"
+	CommitSecurity   = "security"
+	CommitRevert     = "revert"
+	CommitTombstone  = "tombstone"
+)
+
+// CommitOperations are the keys of git.commit_messages.
+var CommitOperations = []string{CommitContent, CommitCodeowners, CommitPages, CommitSubmodules, CommitWorkflows, CommitSecurity, CommitRevert, CommitTombstone}
+
+// git.signing_format values
+const (
+	SigningGPG = "gpg"
+	SigningSSH = "ssh"
+)
+
+// failure_policy values
+const (
+	FailureContinue  = "continue"
+	FailureAbortRepo = "abort_repo"
+	FailureAbortRun  = "abort_run"
+)
+
+// migrate.pull_requests values
+const (
+	PullRequestsAuto   = "auto"
+	PullRequestsIssues = "issues"
+)
+
+// migrate.attribution values
+const (
+	AttributionHeader      = "header"
+	AttributionPlaceholder = "placeholder"
+)
+
+// notification events
+const (
+	EventStart   = "start"
+	EventFailure = "failure"
+	EventSummary = "summary"
+)
+
+// notification types
+const (
+	NotifySlack   = "slack"
+	NotifyTeams   = "teams"
+	NotifyWebhook = "webhook"
+)
+
+// repository visibilities
+const (
+	VisibilityPublic   = "public"
+	VisibilityPrivate  = "private"
+	VisibilityInternal = "internal"
+)
+
+// log.format values
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+type Configuration struct {
+	DryRun        bool `yaml:"dry_run"`
+	Concurrency   int
+	StateFile     string `yaml:"state_file"`
+	OverridesFile string `yaml:"overrides_file"`
+	ManifestFile  string `yaml:"manifest_file"`
+	AuditLog      string `yaml:"audit_log"`
+	Verify        bool
+	Retry         struct {
+		Attempts int
+		Delay    time.Duration
+	}
+	Report struct {
+		Path   string
+		Format string
+	}
+	ProgressInterval time.Duration     `yaml:"progress_interval"`
+	UserMap          map[string]string `yaml:"user_map"`
+	TeamMap          map[string]string `yaml:"team_map"`
+	RateLimit        struct {
+		Retries int
+	} `yaml:"rate_limit"`
+	HTTP          HTTPSettings
+	Throttle      Throttle
+	Timeouts      Timeouts
+	Notifications []Notification
+	Log           struct {
+		Level   string
+		Format  string
+		File    string
+		PerRepo bool `yaml:"per_repo"`
+	}
+	Sync struct {
+		Force bool
+	}
+	Rename struct {
+		Map    map[string]string
+		Prefix string
+		Suffix string
+	}
+	Migrate struct {
+		Labels            bool
+		Teams             bool
+		Collaborators     bool
+		UnmappedLogins    bool `yaml:"unmapped_logins"`
+		Issues            bool
+		PullRequests      string `yaml:"pull_requests"`
+		PreserveNumbers   bool   `yaml:"preserve_numbers"`
+		RewriteReferences bool   `yaml:"rewrite_references"`
+		Discussions       bool
+		Attribution       string
+		AttributionTokens string `yaml:"attribution_tokens"`
+		Scrub             Scrub
+		Webhooks          bool
+		Protections       bool
+		Rulesets          bool
+		TagProtections    bool              `yaml:"tag_protections"`
+		SignedTags        bool              `yaml:"signed_tags"`
+		StatusCheckMap    map[string]string `yaml:"status_check_map"`
+		Releases          bool
+		Wikis             bool
+		Pages             bool
+		PagesRedirect     bool `yaml:"pages_redirect"`
+		OrgSettings       bool `yaml:"org_settings"`
+		CommunityFiles    bool `yaml:"community_files"`
+		DeployKeys        bool `yaml:"deploy_keys"`
+		Autolinks         bool
+		CustomProperties  bool `yaml:"custom_properties"`
+		Security          bool
+		Watchers          bool
+		WatchersIssue     bool `yaml:"watchers_issue"`
+		Environments      bool
+		Secrets           bool
+		SecretsFile       string `yaml:"secrets_file"`
+		SecretsPrompt     bool   `yaml:"secrets_prompt"`
+		Workflows         bool
+		Submodules        bool
+		Codeowners        bool
+		Forks             bool
+		WorkflowRules     string            `yaml:"workflow_rules"`
+		WebhookURLMap     map[string]string `yaml:"webhook_url_map"`
+	}
+	Preflight struct {
+		Enabled       bool
+		MaxSizeMB     int `yaml:"max_size_mb"`
+		MaxFileSizeMB int `yaml:"max_file_size_mb"`
+		MaxBranches   int `yaml:"max_branches"`
+	}
+	// Safety guards the force pushes, the deletions, the archives and the
+	// lockdowns: they require ConfirmDestructive and, for each repository,
+	// a pattern of Allow matching owner/name or else a confirmation.
+	Safety struct {
+		ConfirmDestructive bool `yaml:"confirm_destructive"`
+		Allow              []string
+	}
+	Lock    Lock
+	Storage struct {
+		S3     S3Storage
+		Clones bool
+	}
+	Export struct {
+		Storage            Storage `yaml:",inline"`
+		BatchSize          int     `yaml:"batch_size"`
+		LockRepositories   bool    `yaml:"lock_repositories"`
+		ExcludeAttachments bool    `yaml:"exclude_attachments"`
+	}
+	// Server is the rest api of the server command, requiring the bearer
+	// Token when set.
+	Server struct {
+		Token string
+	}
+	Steps   []string
+	Waves   Waves
+	Hooks   Hooks
+	Source  Source
+	Target  Target
+	Targets []TargetRoute
+	// FailurePolicy tells by step what a failure of the step does: go on
+	// with the next steps, abort the repository or abort the whole run.
+	FailurePolicy map[string]string `yaml:"failure_policy"`
+	// Route limits the run to the repositories routed to one of Targets,
+	// set for each of them by the pipeline.
+	Route string `yaml:"-"`
+	Git   Git
+}
+
+type Source struct {
+	URL           string
+	UploadURL     string `yaml:"upload_url"`
+	APIVersion    string `yaml:"api_version"`
+	Proxy         string
+	Token         string
+	TokenEnv      string  `yaml:"token_env"`
+	TokenFile     string  `yaml:"token_file"`
+	TokenKeyring  Keyring `yaml:"token_keyring"`
+	Organization  string
+	User          string
+	App           AppAuth
+	Insecure      bool
+	CABundle      string `yaml:"ca_bundle"`
+	CacheDir      string `yaml:"cache_dir"`
+	Type          string
+	Username      string
+	URLs          []string
+	URLsFile      string `yaml:"urls_file"`
+	NamePattern   string `yaml:"name_pattern"`
+	Only          []string
+	Ignore        []string
+	Include       []string
+	Exclude       []string
+	SkipArchived  bool   `yaml:"skip_archived"`
+	SkipForks     bool   `yaml:"skip_forks"`
+	MaxSizeMB     int    `yaml:"max_size_mb"`
+	PushedAfter   string `yaml:"pushed_after"`
+	Topics        []string
+	Archive       bool
+	PageSize      int `yaml:"page_size"`
+	Limit         int
+	Content       ContentUpdate
+	Lockdown      Lockdown
+	Tombstone     Tombstone
+	Organizations []SourceOrganization
+}
+
+// SourceOrganization is one of the organizations of a run migrating
+// several of them, along with the target and the rename settings of its
+// repositories, the global ones by default.
+type SourceOrganization struct {
+	Name   string
+	Target string
+	Prefix string
+	Suffix string
+}
+
+// UnmarshalYAML also accepts the name alone.
+func (o *SourceOrganization) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&o.Name); err == nil {
+		return nil
+	}
+	type plain SourceOrganization
+	return unmarshal((*plain)(o))
+}
+
+// ForOrganization is the configuration of the run of one of
+// source.organizations. The state file and the report are suffixed with
+// its name, the repositories of several organizations may share names.
+func (c *Configuration) ForOrganization(o SourceOrganization) *Configuration {
+	n := *c
+	n.Source.Organizations = nil
+	n.Source.Organization = o.Name
+	if o.Target != "" {
+		n.Target.Organization = o.Target
+	}
+	if o.Prefix != "" {
+		n.Rename.Prefix = o.Prefix
+	}
+	if o.Suffix != "" {
+		n.Rename.Suffix = o.Suffix
+	}
+	n.StateFile = suffixPath(c.StateFile, o.Name)
+	n.Report.Path = suffixPath(c.Report.Path, o.Name)
+	return &n
+}
+
+// Storage is where the files of a run are stored, an S3 compatible bucket
+// when s3.bucket is set, the path directory otherwise.
+type Storage struct {
+	Path string
+	S3   S3Storage
+}
+
+// S3Storage is a bucket of AWS S3 or of a compatible service (MinIO, the
+// interoperability api of Google Cloud Storage) given by endpoint. The keys
+// default to the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY variables.
+type S3Storage struct {
+	Bucket    string
+	Region    string
+	Endpoint  string
+	Prefix    string
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+func (s S3Storage) Enabled() bool {
+	return s.Bucket != ""
+}
+
+// TargetRoute is one of the targets of a run spreading the repositories
+// over several organizations, along with the rules routing them to it: the
+// patterns of their names, as source.include, and their topics.
+type TargetRoute struct {
+	Name         string
+	URL          string
+	Token        string
+	Organization string
+	Include      []string
+	Topics       []string
+	Default      bool
+}
+
+// ForRoute is the configuration of the run of one of targets, its
+// organization, url and token replacing the ones of target. The state file
+// and the report are suffixed with its name.
+func (c *Configuration) ForRoute(r TargetRoute) *Configuration {
+	n := *c
+	n.Route = r.Name
+	n.Target.Organization = r.Organization
+	if r.URL != "" {
+		// the upload url of target is the one of its instance
+		n.Target.URL, n.Target.UploadURL = r.URL, ""
+	}
+	if r.Token != "" {
+		n.Target.Token = r.Token
+	}
+	n.StateFile = suffixPath(c.StateFile, r.Name)
+	n.Report.Path = suffixPath(c.Report.Path, r.Name)
+	return &n
+}
+
+// suffixPath inserts -suffix before the extension of path, e.g.
+// report-org.json.
+func suffixPath(path, suffix string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + suffix + ext
+}
+
+type Target struct {
+	URL           string
+	UploadURL     string `yaml:"upload_url"`
+	APIVersion    string `yaml:"api_version"`
+	Proxy         string
+	Token         string
+	TokenEnv      string  `yaml:"token_env"`
+	TokenFile     string  `yaml:"token_file"`
+	TokenKeyring  Keyring `yaml:"token_keyring"`
+	Organization  string
+	App           AppAuth
+	Insecure      bool
+	CABundle      string `yaml:"ca_bundle"`
+	OnExists      string `yaml:"on_exists"`
+	Type          string
+	Settings      RepoSettings
+	VisibilityMap map[string]string `yaml:"visibility_map"`
+	Init          EmptyInit
+	// TagTopics adds the migrated and migrated-from-<organization> topics
+	// to the repositories, for the audits.
+	TagTopics bool `yaml:"tag_topics"`
+}
+
+// EmptyInit initializes the targets of the empty source repositories, from
+// a template repository (owner/name) or with a first commit.
+type EmptyInit struct {
+	Template  string
+	AutoInit  bool `yaml:"auto_init"`
+	Gitignore string
+	License   string
+}
+
+func (i EmptyInit) Enabled() bool {
+	return i.Template != "" || i.AutoInit || i.Gitignore != "" || i.License != ""
+}
+
+type Git struct {
+	ClonePath         string `yaml:"clone_path"`
+	RemoteName        string `yaml:"remote_name"`
+	CrtFile           string `yaml:"ctr_file"`
+	Protocol          string
+	SSHAgent          bool `yaml:"ssh_agent"`
+	Passphrase        string
+	Mirror            bool
+	CloneMode         string `yaml:"clone_mode"`
+	TransferMode      string `yaml:"transfer_mode"`
+	MemoryLimitMB     int    `yaml:"memory_limit_mb"`
+	KeepClones        bool   `yaml:"keep_clones"`
+	LFS               bool   `yaml:"lfs"`
+	LFSURL            string `yaml:"lfs_url"`
+	Author            string `yaml:"commit_author"`
+	Email             string `yaml:"commit_email"`
+	CommitterName     string `yaml:"committer_name"`
+	CommitterEmail    string `yaml:"committer_email"`
+	CommitMessage     string `yaml:"commit_message"`
+	SigningKey        string `yaml:"signing_key"`
+	SigningPassphrase string `yaml:"signing_passphrase"`
+	SigningFormat     string `yaml:"signing_format"`
+	PushBatchSize     int    `yaml:"push_batch_size"`
+	FetchBatchSize    int    `yaml:"fetch_batch_size"`
+	Depth             int
+	BranchMap         map[string]string `yaml:"branch_map"`
+	CommitMessages    map[string]string `yaml:"commit_messages"`
+	Filter            HistoryFilter
+	Branches          []string
+	Tags              []string
+	RefSpecs          []string `yaml:"refspecs"`
+}
+
+// HistoryFilter removes files from the history of the repositories before
+// they are pushed, e.g. the ones over the size limit of the target, and
+// maps the commit authors to the accounts of the target.
+type HistoryFilter struct {
+	MaxFileSizeMB int `yaml:"max_file_size_mb"`
+	Paths         []string
+	Mailmap       string
+	EmailDomains  map[string]string `yaml:"email_domains"`
+}
+
+func (f HistoryFilter) Enabled() bool {
+	return f.MaxFileSizeMB > 0 || len(f.Paths) > 0 || f.Mailmap != "" || len(f.EmailDomains) > 0
+}
+
+// SelectsRefs reports whether only some of the refs are transferred in
+// mirror mode.
+func (g Git) SelectsRefs() bool {
+	return len(g.RefSpecs) > 0 || len(g.Branches) > 0 || len(g.Tags) > 0
+}
+
+// UseHTTPS reports whether the repositories are cloned and pushed over
+// https instead of ssh.
+func (g Git) UseHTTPS() bool {
+	return g.Protocol == ProtocolHTTPS
+}
+
+// AppAuth authenticates as an installation of a GitHub App instead of
+// using a personal access token.
+type AppAuth struct {
+	ID             int64
+	InstallationID int64  `yaml:"installation_id"`
+	PrivateKey     string `yaml:"private_key"`
+}
+
+func (a AppAuth) Enabled() bool {
+	return a.ID != 0
+}
+
+// Hooks are shell commands run with the metadata of the repository in the
+// environment: before and after each repository, and as steps of their own
+// named after the keys of steps.
+type Hooks struct {
+	PreRepo  string `yaml:"pre_repo"`
+	PostRepo string `yaml:"post_repo"`
+	Steps    map[string]string
+}
+
+// HTTPSettings tunes the connections to the source and the target.
+type HTTPSettings struct {
+	Timeout         time.Duration
+	Retries         int
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"`
+}
+
+// Throttle bounds what a run takes from the instances, e.g. to migrate
+// during business hours.
+type Throttle struct {
+	MaxClones            int `yaml:"max_clones"`
+	MaxBandwidthMB       int `yaml:"max_bandwidth_mb"`
+	APIRequestsPerMinute int `yaml:"api_requests_per_minute"`
+}
+
+// Lock keeps two runs from writing to the same target organization at
+// once: a file of the Path directory, or a file of the Repository of the
+// target organization, is held by the run and refreshed until it ends. A
+// lock not refreshed for StaleAfter is stale and taken over.
+type Lock struct {
+	Path       string
+	Repository string
+	StaleAfter time.Duration `yaml:"stale_after"`
+}
+
+func (l Lock) Enabled() bool {
+	return l.Path != "" || l.Repository != ""
+}
+
+// Timeouts bound the processing of each repository, none by default: the
+// whole repository, its clone, its push and each of its api steps.
+type Timeouts struct {
+	Repo  time.Duration
+	Clone time.Duration
+	Push  time.Duration
+	Step  time.Duration
+}
+
+// Notification posts the events of a run to a chat or a webhook, template
+// replaces the default payload of the type.
+type Notification struct {
+	Type     string
+	URL      string
+	Events   []string
+	Template string
+}
+
+// ContentUpdate are the files of the source repositories updated once
+// migrated, usually with a deprecation notice. path and message are a
+// shorthand for a prepend rule.
+type ContentUpdate struct {
+	Path    string
+	Message string
+	Rules   []ContentRule
+	Method  string
+}
+
+// ContentRule applies a template to a file: prepended, appended, replacing
+// the whole file or replacing the matches of pattern in regex mode.
+type ContentRule struct {
+	Path     string
+	Mode     string
+	Template string
+	Pattern  string
+}
+
+func (c ContentUpdate) Enabled() bool {
+	return c.Path != "" || len(c.Rules) > 0
+}
+
+func (c ContentUpdate) AllRules() []ContentRule {
+	var rules []ContentRule
+	if c.Path != "" {
+		rules = append(rules, ContentRule{Path: c.Path, Mode: ContentPrepend, Template: c.Message + "<br><br>"})
+	}
+	return append(rules, c.Rules...)
+}
+
+// Scrub redacts the email addresses, the hostnames and the patterns of the
+// titles and bodies of the issues, pull requests, discussions and comments
+// before they are posted on the target, e.g. when an internal instance is
+// migrated to github.com. The hostnames match their subdomains too.
+type Scrub struct {
+	Emails      bool
+	Hostnames   []string
+	Patterns    []ScrubPattern
+	Replacement string
+}
+
+// ScrubPattern is a regular expression scrubbed with its own replacement,
+// which can refer to its groups, or the one of the scrub.
+type ScrubPattern struct {
+	Pattern     string
+	Replacement string
+}
+
+func (s Scrub) Enabled() bool {
+	return s.Emails || len(s.Hostnames) > 0 || len(s.Patterns) > 0
+}
+
+// Lockdown makes the source repositories read-only once migrated, short of
+// archiving them: the write permissions of the teams and the collaborators
+// are lowered to pull, the description points to the target and an issue
+// announcing the move is pinned. The texts are templates like the content
+// ones.
+type Lockdown struct {
+	Permissions bool
+	Description string
+	Issue       LockdownIssue
+}
+
+// LockdownIssue is the issue pinned on the source repositories.
+type LockdownIssue struct {
+	Title string
+	Body  string
+}
+
+func (l Lockdown) Enabled() bool {
+	return l.Permissions || l.Description != "" || l.Issue.Title != ""
+}
+
+// Tombstone leaves a page telling that the source repositories moved to
+// the target, once locked down: in readme mode the file of path, README.md
+// by default, is replaced on the default branch; in branch mode the page is
+// the only file of branch, a new default branch without history, the other
+// branches being kept. The template is expanded like the content ones.
+type Tombstone struct {
+	Mode     string
+	Template string
+	Path     string
+	Branch   string
+}
+
+func (t Tombstone) Enabled() bool {
+	return t.Mode != ""
+}
+
+// Waves split the migration into waves run one after the other, from the
+// groups or from the dependencies of the repositories, the forks and the
+// submodules following the repositories they depend on. Confirm asks
+// before each wave after the first one.
+type Waves struct {
+	Groups       []Wave
+	Dependencies bool
+	Confirm      bool
+}
+
+// Wave is one of waves.groups, holding the repositories matching one of the
+// Include patterns, as source.include, or carrying one of the Topics.
+type Wave struct {
+	Name    string
+	Include []string
+	Topics  []string
+	// Team owns the repositories of the wave that have no team of their
+	// own, granted TeamPermission.
+	Team           string
+	TeamPermission string `yaml:"team_permission"`
+}
+
+// The permissions of an owner team.
+const (
+	TeamAdmin    = "admin"
+	TeamMaintain = "maintain"
+)
+
+func (w Waves) Enabled() bool {
+	return len(w.Groups) > 0 || w.Dependencies
+}
+
+// HasTeams reports whether one of the groups names an owner team.
+func (w Waves) HasTeams() bool {
+	for _, g := range w.Groups {
+		if g.Team != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// RepoOverride replaces the global configuration for a single repository.
+type RepoOverride struct {
+	Name        string
+	Visibility  string
+	Description *string
+	SkipSteps   []string `yaml:"skip_steps"`
+	Target      string
+	// Team is the slug of the team of the target owning the repository,
+	// granted TeamPermission, admin by default.
+	Team           string
+	TeamPermission string `yaml:"team_permission"`
+}
+
+type RepoSettings struct {
+	Private             *bool
+	HasIssues           *bool    `yaml:"has_issues"`
+	HasWiki             *bool    `yaml:"has_wiki"`
+	HasProjects         *bool    `yaml:"has_projects"`
+	AllowMergeCommit    *bool    `yaml:"allow_merge_commit"`
+	AllowSquashMerge    *bool    `yaml:"allow_squash_merge"`
+	AllowRebaseMerge    *bool    `yaml:"allow_rebase_merge"`
+	DeleteBranchOnMerge *bool    `yaml:"delete_branch_on_merge"`
+	VulnerabilityAlerts *bool    `yaml:"vulnerability_alerts"`
+	Homepage            *string  `yaml:"homepage"`
+	Topics              []string `yaml:"topics"`
+}
+
+// Load reads the configuration file, or directory, with the values of
+// profile, the environment variables taking precedence over them.
+func Load(path, profile string) (*Configuration, error) {
+	content, err := readProfile(path, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Configuration{}
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, err
+	}
+
+	applyEnvironment(c)
+	if err := resolveTokens(c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// EnvOrDefault returns the value of the environment variable key, or def
+// when it is not set.
+func EnvOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// applyEnvironment overrides the values of the configuration file, so the
+// tokens do not need to be stored in it.
+func applyEnvironment(c *Configuration) {
+	overrides := map[string]*string{
+		"GHMGR_SOURCE_URL":          &c.Source.URL,
+		"GHMGR_SOURCE_TOKEN":        &c.Source.Token,
+		"GHMGR_SOURCE_ORGANIZATION": &c.Source.Organization,
+		"GHMGR_SOURCE_USER":         &c.Source.User,
+		"GHMGR_TARGET_URL":          &c.Target.URL,
+		"GHMGR_TARGET_TOKEN":        &c.Target.Token,
+		"GHMGR_TARGET_ORGANIZATION": &c.Target.Organization,
+		"GHMGR_CLONE_PATH":          &c.Git.ClonePath,
+		"GHMGR_CRT_FILE":            &c.Git.CrtFile,
+		"GHMGR_SSH_PASSPHRASE":      &c.Git.Passphrase,
+		"GHMGR_SERVER_TOKEN":        &c.Server.Token,
+	}
+
+	for key, field := range overrides {
+		*field = EnvOrDefault(key, *field)
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// compilePattern accepts either a regular expression, when the pattern
+// starts with ^ or is enclosed in slashes, or a glob such as legacy-*.
+func compilePattern(p string) (*regexp.Regexp, error) {
+	switch {
+	case len(p) > 1 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/"):
+		return regexp.Compile(p[1 : len(p)-1])
+	case strings.HasPrefix(p, "^"):
+		return regexp.Compile(p)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range p {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// CompilePatterns compiles the patterns of source.include and
+// source.exclude.
+func CompilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := compilePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// profilesKey is the section of a configuration file holding its profiles
+const profilesKey = "profiles"
+
+// readProfile returns the yaml of the configuration of path with profile
+// applied. A file can hold named profiles under profiles, each one
+// overriding the values of the rest of the file; the sections are merged
+// key by key and the lists replaced. A directory holds a file per profile,
+// <profile>.yml, overriding its config.yml the same way when there is one.
+// Without profiles the file is read as is.
+func readProfile(path, profile string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return readProfileDir(path, profile)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	raw, ok := doc[profilesKey]
+	if !ok {
+		if profile != "" {
+			return nil, fmt.Errorf("profile %s: %s has no profiles", profile, path)
+		}
+		return content, nil
+	}
+	delete(doc, profilesKey)
+
+	profiles, ok := raw.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must map the names of the profiles to their values", profilesKey)
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, fmt.Sprint(name))
+	}
+	overrides, ok := profiles[profile]
+	if !ok {
+		return nil, unknownProfile(profile, names)
+	}
+	values, ok := overrides.(map[interface{}]interface{})
+	if !ok && overrides != nil {
+		return nil, fmt.Errorf("%s.%s: must be a section", profilesKey, profile)
+	}
+	return yaml.Marshal(mergeYAML(doc, values))
+}
+
+// readProfileDir merges the file of profile over the config.yml of dir.
+func readProfileDir(dir, profile string) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if name := strings.TrimSuffix(filepath.Base(f), ".yml"); name != "config" {
+			names = append(names, name)
+		}
+	}
+	if profile == "" || profile == "config" {
+		return nil, unknownProfile(profile, names)
+	}
+
+	doc := map[interface{}]interface{}{}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "config.yml"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("config.yml: %v", err)
+	}
+
+	content, err = ioutil.ReadFile(filepath.Join(dir, profile+".yml"))
+	if os.IsNotExist(err) {
+		return nil, unknownProfile(profile, names)
+	}
+	if err != nil {
+		return nil, err
+	}
+	values := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("%s.yml: %v", profile, err)
+	}
+	return yaml.Marshal(mergeYAML(doc, values))
+}
+
+func unknownProfile(profile string, names []string) error {
+	sort.Strings(names)
+	if profile == "" {
+		return fmt.Errorf("a profile must be selected with --profile, one of %s", strings.Join(names, ", "))
+	}
+	return fmt.Errorf("profile %s: not found, the profiles are %s", profile, strings.Join(names, ", "))
+}
+
+// mergeYAML sets the values of overrides into base, the sections of both
+// being merged recursively.
+func mergeYAML(base, overrides map[interface{}]interface{}) map[interface{}]interface{} {
+	for k, v := range overrides {
+		if from, ok := base[k].(map[interface{}]interface{}); ok {
+			if to, ok := v.(map[interface{}]interface{}); ok {
+				base[k] = mergeYAML(from, to)
+				continue
+			}
+		}
+		base[k] = v
+	}
+	return base
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profilesFile = `
+source:
+  organization: acme
+  token: source-token
+target:
+  token: target-token
+migrate:
+  labels: true
+  issues: true
+profiles:
+  staging:
+    target:
+      organization: acme-staging
+  production:
+    target:
+      organization: acme-new
+    migrate:
+      issues: false
+`
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "config.yml", profilesFile)
+
+	c, err := Load(path, "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Target.Organization != "acme-new" || c.Target.Token != "target-token" {
+		t.Errorf("target = %s with %q, want acme-new with the shared token", c.Target.Organization, c.Target.Token)
+	}
+	if !c.Migrate.Labels || c.Migrate.Issues {
+		t.Errorf("migrate.labels = %v, migrate.issues = %v, want true and false", c.Migrate.Labels, c.Migrate.Issues)
+	}
+
+	if c, err := Load(path, "staging"); err != nil || c.Target.Organization != "acme-staging" || !c.Migrate.Issues {
+		t.Errorf("staging: %v, %+v", err, c)
+	}
+	if _, err := Load(path, ""); err == nil || !strings.Contains(err.Error(), "production, staging") {
+		t.Errorf("no profile: %v, want the profiles listed", err)
+	}
+	if _, err := Load(path, "qa"); err == nil || !strings.Contains(err.Error(), "profile qa: not found") {
+		t.Errorf("unknown profile: %v", err)
+	}
+}
+
+func TestLoadProfileDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "config.yml", "source:\n  organization: acme\nmigrate:\n  labels: true\n")
+	writeFile(t, dir, "staging.yml", "target:\n  organization: acme-staging\n")
+
+	c, err := Load(dir, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Source.Organization != "acme" || c.Target.Organization != "acme-staging" || !c.Migrate.Labels {
+		t.Errorf("staging = %+v", c)
+	}
+	if _, err := Load(dir, ""); err == nil || !strings.Contains(err.Error(), "one of staging") {
+		t.Errorf("no profile: %v, want the profiles listed", err)
+	}
+}
+
+func TestLoadWithoutProfiles(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "config.yml", "source:\n  organization: acme\n")
+	if c, err := Load(path, ""); err != nil || c.Source.Organization != "acme" {
+		t.Errorf("Load = %v, %v", c, err)
+	}
+	if _, err := Load(path, "staging"); err == nil {
+		t.Error("a profile of a file without profiles was loaded")
+	}
+}
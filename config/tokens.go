@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Keyring is an entry of the keyring of the operating system, read with
+// security on macOS and secret-tool on Linux.
+type Keyring struct {
+	Service string
+	Account string
+}
+
+func (k Keyring) Enabled() bool {
+	return k.Service != ""
+}
+
+func lookupKeyring(k Keyring) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", k.Service, "-a", k.Account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", k.Service, "account", k.Account)
+	default:
+		return "", fmt.Errorf("the keyring of %s is not supported", runtime.GOOS)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", cmd.Path, err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("no password for the service %s and the account %s", k.Service, k.Account)
+	}
+	return token, nil
+}
+
+// resolveToken reads the token of prefix from the environment variable of
+// token_env, the file of token_file or the keyring entry of token_keyring,
+// unless the token is given in the file or by GHMGR_*_TOKEN.
+func resolveToken(prefix string, token *string, env, file string, keyring Keyring) error {
+	n := 0
+	for _, set := range []bool{env != "", file != "", keyring.Enabled()} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("%s.token_env, %s.token_file and %s.token_keyring cannot be used together", prefix, prefix, prefix)
+	}
+	if *token != "" || n == 0 {
+		return nil
+	}
+
+	switch {
+	case env != "":
+		*token = os.Getenv(env)
+		if *token == "" {
+			return fmt.Errorf("%s.token_env: %s is not set", prefix, env)
+		}
+	case file != "":
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("%s.token_file: %v", prefix, err)
+		}
+		*token = strings.TrimSpace(string(content))
+	default:
+		t, err := lookupKeyring(keyring)
+		if err != nil {
+			return fmt.Errorf("%s.token_keyring: %v", prefix, err)
+		}
+		*token = t
+	}
+	return nil
+}
+
+func resolveTokens(c *Configuration) error {
+	if err := resolveToken("source", &c.Source.Token, c.Source.TokenEnv, c.Source.TokenFile, c.Source.TokenKeyring); err != nil {
+		return err
+	}
+	return resolveToken("target", &c.Target.Token, c.Target.TokenEnv, c.Target.TokenFile, c.Target.TokenKeyring)
+}
+
+// Secrets are the tokens, keys and passphrases of the configuration, the
+// passwords of the proxies included, to be redacted from the logs and the
+// reports.
+func (c *Configuration) Secrets() []string {
+	secrets := []string{c.Source.Token, c.Target.Token, c.Git.Passphrase, c.Git.SigningPassphrase,
+		c.Storage.S3.SecretKey, c.Export.Storage.S3.SecretKey, c.Server.Token}
+	for _, r := range c.Targets {
+		secrets = append(secrets, r.Token)
+	}
+	for _, p := range []string{c.Source.Proxy, c.Target.Proxy} {
+		if u, err := url.Parse(p); err == nil && u.User != nil {
+			pass, _ := u.User.Password()
+			secrets = append(secrets, pass)
+		}
+	}
+
+	var res []string
+	for _, s := range secrets {
+		if s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
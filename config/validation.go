@@ -0,0 +1,805 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type validationErrors []string
+
+func (v *validationErrors) add(format string, args ...interface{}) {
+	*v = append(*v, fmt.Sprintf(format, args...))
+}
+
+func (v validationErrors) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(v, "\n  - ")
+}
+
+func validateURL(errs *validationErrors, field, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add("%s: %q is not a valid http(s) URL", field, value)
+	}
+}
+
+// validateProxy checks that the proxy is an http(s) or socks5 URL, or
+// direct.
+func validateProxy(errs *validationErrors, field, value string) {
+	if value == "" || value == ProxyDirect {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+		errs.add("%s: %q must be an http(s) or socks5 URL, or %s", field, value, ProxyDirect)
+	}
+}
+
+// validateAPIVersion checks that the api version is a date, the versions
+// of the GitHub api being named after their release.
+func validateAPIVersion(errs *validationErrors, field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		errs.add("%s: %q must be a date like 2022-11-28", field, value)
+	}
+}
+
+func validateRequired(errs *validationErrors, field, value string) {
+	if strings.TrimSpace(value) == "" {
+		errs.add("%s: is required", field)
+	}
+}
+
+func validateFile(errs *validationErrors, field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := os.Stat(value); err != nil {
+		errs.add("%s: %v", field, err)
+	}
+}
+
+func validateAuth(errs *validationErrors, prefix, token string, app AppAuth) {
+	if !app.Enabled() {
+		validateRequired(errs, prefix+".token", token)
+		return
+	}
+	if token != "" {
+		errs.add("%s.token and %s.app cannot be used together", prefix, prefix)
+	}
+	if app.InstallationID == 0 {
+		errs.add("%s.app.installation_id is required", prefix)
+	}
+	validateRequired(errs, prefix+".app.private_key", app.PrivateKey)
+	validateFile(errs, prefix+".app.private_key", app.PrivateKey)
+}
+
+// validateBitbucket rejects the options that rely on the GitHub api of the
+// source.
+func validateBitbucket(errs *validationErrors, c *Configuration) {
+	validateRequired(errs, "source.url", c.Source.URL)
+	if len(c.Source.Organizations) == 0 {
+		validateRequired(errs, "source.organization", c.Source.Organization)
+	}
+	if c.Source.App.Enabled() {
+		errs.add("source.app: a bitbucket source requires a token")
+	}
+	if c.Git.UseHTTPS() {
+		validateRequired(errs, "source.username", c.Source.Username)
+	}
+	rejectUnsupported(errs, "a bitbucket source", c, []option{
+		{"source.upload_url", c.Source.UploadURL != ""},
+		{"source.api_version", c.Source.APIVersion != ""},
+		{"source.user", c.Source.User != ""},
+		{"source.max_size_mb", c.Source.MaxSizeMB > 0},
+		{"source.pushed_after", c.Source.PushedAfter != ""},
+		{"source.topics", len(c.Source.Topics) > 0},
+		{"waves.dependencies", c.Waves.Dependencies},
+		{"source.archive", c.Source.Archive},
+		{"source.content", c.Source.Content.Enabled()},
+		{"source.lockdown", c.Source.Lockdown.Enabled()},
+		{"source.tombstone", c.Source.Tombstone.Enabled()},
+		{"preflight.enabled", c.Preflight.Enabled},
+		{"target.tag_topics", c.Target.TagTopics},
+	})
+}
+
+func validateURLs(errs *validationErrors, c *Configuration) {
+	if len(c.Source.URLs) == 0 && c.Source.URLsFile == "" {
+		errs.add("source.urls: is required, or source.urls_file")
+	}
+	validateFile(errs, "source.urls_file", c.Source.URLsFile)
+	if c.Git.UseHTTPS() {
+		validateRequired(errs, "source.token", c.Source.Token)
+	}
+	rejectUnsupported(errs, "a url list source", c, []option{
+		{"source.cache_dir", c.Source.CacheDir != ""},
+		{"source.upload_url", c.Source.UploadURL != ""},
+		{"source.api_version", c.Source.APIVersion != ""},
+		{"source.organization", c.Source.Organization != ""},
+		{"source.organizations", len(c.Source.Organizations) > 0},
+		{"source.user", c.Source.User != ""},
+		{"source.app", c.Source.App.Enabled()},
+		{"source.max_size_mb", c.Source.MaxSizeMB > 0},
+		{"source.pushed_after", c.Source.PushedAfter != ""},
+		{"source.topics", len(c.Source.Topics) > 0},
+		{"waves.dependencies", c.Waves.Dependencies},
+		{"source.archive", c.Source.Archive},
+		{"source.content", c.Source.Content.Enabled()},
+		{"source.lockdown", c.Source.Lockdown.Enabled()},
+		{"source.tombstone", c.Source.Tombstone.Enabled()},
+		{"preflight.enabled", c.Preflight.Enabled},
+		{"target.tag_topics", c.Target.TagTopics},
+	})
+}
+
+// validateAzureDevOps rejects the options that rely on the GitHub api of
+// the source, source.url defaulting to Azure DevOps Services.
+func validateAzureDevOps(errs *validationErrors, c *Configuration) {
+	if len(c.Source.Organizations) == 0 {
+		validateRequired(errs, "source.organization", c.Source.Organization)
+	}
+	if c.Source.App.Enabled() {
+		errs.add("source.app: an azure devops source requires a token")
+	}
+	if p := c.Source.NamePattern; p != "" && !strings.Contains(p, "{repo}") {
+		errs.add("source.name_pattern: %q must contain {repo}", p)
+	}
+	rejectUnsupported(errs, "an azure devops source", c, []option{
+		{"source.upload_url", c.Source.UploadURL != ""},
+		{"source.api_version", c.Source.APIVersion != ""},
+		{"source.user", c.Source.User != ""},
+		{"source.pushed_after", c.Source.PushedAfter != ""},
+		{"source.topics", len(c.Source.Topics) > 0},
+		{"waves.dependencies", c.Waves.Dependencies},
+		{"source.archive", c.Source.Archive},
+		{"source.content", c.Source.Content.Enabled()},
+		{"source.lockdown", c.Source.Lockdown.Enabled()},
+		{"source.tombstone", c.Source.Tombstone.Enabled()},
+		{"preflight.enabled", c.Preflight.Enabled},
+		{"target.tag_topics", c.Target.TagTopics},
+	})
+}
+
+// validateTargets checks the routes of targets, the repositories routed to
+// none of them being left out.
+func validateTargets(errs *validationErrors, c *Configuration) {
+	seen := map[string]bool{}
+	defaults := 0
+	for i, r := range c.Targets {
+		field := fmt.Sprintf("targets[%d]", i)
+		validateRequired(errs, field+".name", r.Name)
+		validateRequired(errs, field+".organization", r.Organization)
+		validateURL(errs, field+".url", r.URL)
+		if seen[r.Name] {
+			errs.add("targets: %q is listed twice", r.Name)
+		}
+		seen[r.Name] = true
+		if _, err := CompilePatterns(r.Include); err != nil {
+			errs.add("%s.include: %v", field, err)
+		}
+		if r.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		errs.add("targets: only one of them can be the default one")
+	}
+}
+
+// validateNative rejects the options of git.transfer_mode native that copy
+// what the transfer moves along with the repository, or that rely on the
+// source repository, which no longer exists afterwards.
+func validateNative(errs *validationErrors, c *Configuration) {
+	if (c.Target.Type != "" && c.Target.Type != TargetGitHub) || (c.Source.Type != "" && c.Source.Type != SourceGitHub) {
+		errs.add("git.transfer_mode: %s requires a github source and target", TransferModeNative)
+	}
+	if !strings.EqualFold(strings.TrimSuffix(c.Source.URL, "/"), strings.TrimSuffix(c.Target.URL, "/")) {
+		errs.add("git.transfer_mode: %s requires source.url and target.url to be the same instance", TransferModeNative)
+	}
+	if c.Target.OnExists == OnExistsPush {
+		errs.add("target.on_exists: %s is not supported with git.transfer_mode %s", OnExistsPush, TransferModeNative)
+	}
+	m := c.Migrate
+	for _, o := range []option{
+		{"migrate.labels", m.Labels},
+		{"migrate.collaborators", m.Collaborators},
+		{"migrate.issues", m.Issues},
+		{"migrate.pull_requests", m.PullRequests != ""},
+		{"migrate.discussions", m.Discussions},
+		{"migrate.webhooks", m.Webhooks},
+		{"migrate.protections", m.Protections},
+		{"migrate.rulesets", m.Rulesets},
+		{"migrate.tag_protections", m.TagProtections},
+		{"migrate.signed_tags", m.SignedTags},
+		{"migrate.releases", m.Releases},
+		{"migrate.wikis", m.Wikis},
+		{"migrate.pages", m.Pages},
+		{"migrate.deploy_keys", m.DeployKeys},
+		{"migrate.autolinks", m.Autolinks},
+		{"migrate.security", m.Security},
+		{"migrate.environments", m.Environments},
+		{"migrate.secrets", m.Secrets},
+		{"migrate.forks", m.Forks},
+		{"migrate.watchers", m.Watchers},
+		{"source.archive", c.Source.Archive},
+		{"source.content", c.Source.Content.Enabled()},
+		{"source.lockdown", c.Source.Lockdown.Enabled()},
+		{"source.tombstone", c.Source.Tombstone.Enabled()},
+		{"git.filter", c.Git.Filter.Enabled()},
+		{"verify", c.Verify},
+	} {
+		if o.enabled {
+			errs.add("%s: is not supported with git.transfer_mode %s, the transfer moves the repository", o.field, TransferModeNative)
+		}
+	}
+}
+
+type option struct {
+	field   string
+	enabled bool
+}
+
+// rejectUnsupported reports the options that are enabled although kind,
+// a provider other than GitHub, does not support them, the steps relying
+// on the GitHub api of both sides included.
+func rejectUnsupported(errs *validationErrors, kind string, c *Configuration, options []option) {
+	m := c.Migrate
+	options = append(options, []option{
+		{"migrate.labels", m.Labels},
+		{"migrate.teams", m.Teams},
+		{"migrate.collaborators", m.Collaborators},
+		{"migrate.issues", m.Issues},
+		{"migrate.pull_requests", m.PullRequests != ""},
+		{"migrate.discussions", m.Discussions},
+		{"migrate.webhooks", m.Webhooks},
+		{"migrate.protections", m.Protections},
+		{"migrate.rulesets", m.Rulesets},
+		{"migrate.tag_protections", m.TagProtections},
+		{"migrate.signed_tags", m.SignedTags},
+		{"migrate.releases", m.Releases},
+		{"migrate.wikis", m.Wikis},
+		{"migrate.pages", m.Pages},
+		{"migrate.org_settings", m.OrgSettings},
+		{"migrate.community_files", m.CommunityFiles},
+		{"migrate.deploy_keys", m.DeployKeys},
+		{"migrate.autolinks", m.Autolinks},
+		{"migrate.custom_properties", m.CustomProperties},
+		{"migrate.security", m.Security},
+		{"migrate.watchers", m.Watchers},
+		{"migrate.environments", m.Environments},
+		{"migrate.secrets", m.Secrets},
+		{"migrate.workflows", m.Workflows},
+		{"migrate.submodules", m.Submodules},
+		{"migrate.codeowners", m.Codeowners},
+		{"migrate.forks", m.Forks},
+		{"verify", c.Verify},
+	}...)
+	for _, o := range options {
+		if o.enabled {
+			errs.add("%s: is not supported by %s", o.field, kind)
+		}
+	}
+}
+
+func validateWaves(errs *validationErrors, w Waves) {
+	if len(w.Groups) > 0 && w.Dependencies {
+		errs.add("waves.groups and waves.dependencies cannot be used together")
+	}
+	if w.Confirm && !w.Enabled() {
+		errs.add("waves.confirm: requires waves.groups or waves.dependencies")
+	}
+	seen := map[string]bool{}
+	for i, g := range w.Groups {
+		field := fmt.Sprintf("waves.groups[%d]", i)
+		validateRequired(errs, field+".name", g.Name)
+		if seen[g.Name] {
+			errs.add("waves.groups: %q is listed twice", g.Name)
+		}
+		seen[g.Name] = true
+		if _, err := CompilePatterns(g.Include); err != nil {
+			errs.add("%s.include: %v", field, err)
+		}
+		if len(g.Include) == 0 && len(g.Topics) == 0 {
+			errs.add("%s: requires include or topics", field)
+		}
+		if err := ValidTeamPermission(g.TeamPermission); err != nil {
+			errs.add("%s.team_permission: %v", field, err)
+		}
+		if g.TeamPermission != "" && g.Team == "" {
+			errs.add("%s.team_permission: requires team", field)
+		}
+	}
+}
+
+// ValidTeamPermission checks the permission of an owner team.
+func ValidTeamPermission(p string) error {
+	switch p {
+	case "", TeamAdmin, TeamMaintain:
+		return nil
+	}
+	return fmt.Errorf("%q must be %s or %s", p, TeamAdmin, TeamMaintain)
+}
+
+// validateGitLab rejects the options that rely on the GitHub api of the
+// target.
+func validateGitLab(errs *validationErrors, c *Configuration) {
+	validateRequired(errs, "target.url", c.Target.URL)
+	if c.Target.App.Enabled() {
+		errs.add("target.app: a gitlab target requires a token")
+	}
+	rejectUnsupported(errs, "a gitlab target", c, []option{
+		{"target.upload_url", c.Target.UploadURL != ""},
+		{"waves.groups.team", c.Waves.HasTeams()},
+		{"lock.repository", c.Lock.Repository != ""},
+		{"target.api_version", c.Target.APIVersion != ""},
+		{"target.init.template", c.Target.Init.Template != ""},
+		{"target.init.gitignore", c.Target.Init.Gitignore != ""},
+		{"target.init.license", c.Target.Init.License != ""},
+		{"target.tag_topics", c.Target.TagTopics},
+	})
+}
+
+// validateGitea rejects the options that rely on the GitHub api of the
+// target, the topics being set by the gitea target itself.
+func validateGitea(errs *validationErrors, c *Configuration) {
+	validateRequired(errs, "target.url", c.Target.URL)
+	if c.Target.App.Enabled() {
+		errs.add("target.app: a gitea target requires a token")
+	}
+	rejectUnsupported(errs, "a gitea target", c, []option{
+		{"target.upload_url", c.Target.UploadURL != ""},
+		{"waves.groups.team", c.Waves.HasTeams()},
+		{"lock.repository", c.Lock.Repository != ""},
+		{"target.api_version", c.Target.APIVersion != ""},
+		{"target.init.template", c.Target.Init.Template != ""},
+	})
+}
+
+// Validate reports every problem found in the configuration at once,
+// instead of failing on the first one in the middle of a run.
+func (c *Configuration) Validate() error {
+	var errs validationErrors
+
+	if c.Source.Type != SourceURLs {
+		validateAuth(&errs, "source", c.Source.Token, c.Source.App)
+	}
+	if c.Source.Organization != "" && c.Source.User != "" {
+		errs.add("source.organization and source.user cannot be used together")
+	}
+	if len(c.Source.Organizations) > 0 && (c.Source.Organization != "" || c.Source.User != "") {
+		errs.add("source.organizations cannot be used with source.organization or source.user")
+	}
+	if len(c.Source.Organizations) > 0 && c.ManifestFile != "" {
+		errs.add("manifest_file cannot be used with source.organizations")
+	}
+	seen := map[string]bool{}
+	for i, o := range c.Source.Organizations {
+		validateRequired(&errs, fmt.Sprintf("source.organizations[%d].name", i), o.Name)
+		if seen[strings.ToLower(o.Name)] {
+			errs.add("source.organizations: %q is listed twice", o.Name)
+		}
+		seen[strings.ToLower(o.Name)] = true
+	}
+	if c.Source.User != "" && c.Migrate.OrgSettings {
+		errs.add("migrate.org_settings: a user account has no organization settings")
+	}
+	if c.Source.User != "" && c.Migrate.CommunityFiles {
+		errs.add("migrate.community_files: a user account has no community health files")
+	}
+	validateURL(&errs, "source.url", c.Source.URL)
+	validateURL(&errs, "source.upload_url", c.Source.UploadURL)
+	validateAPIVersion(&errs, "source.api_version", c.Source.APIVersion)
+	if c.Source.Limit < 0 {
+		errs.add("source.limit: must not be negative")
+	}
+	if c.Source.PageSize < 0 || c.Source.PageSize > 100 {
+		errs.add("source.page_size: %d must be between 1 and 100", c.Source.PageSize)
+	}
+	validateFile(&errs, "source.ca_bundle", c.Source.CABundle)
+	validateProxy(&errs, "source.proxy", c.Source.Proxy)
+
+	validateAuth(&errs, "target", c.Target.Token, c.Target.App)
+	if len(c.Targets) == 0 {
+		validateRequired(&errs, "target.organization", c.Target.Organization)
+	}
+	validateTargets(&errs, c)
+	validateURL(&errs, "target.url", c.Target.URL)
+	validateURL(&errs, "target.upload_url", c.Target.UploadURL)
+	validateAPIVersion(&errs, "target.api_version", c.Target.APIVersion)
+	validateFile(&errs, "target.ca_bundle", c.Target.CABundle)
+	validateProxy(&errs, "target.proxy", c.Target.Proxy)
+	switch c.Source.Type {
+	case "", SourceGitHub:
+	case SourceBitbucket:
+		validateBitbucket(&errs, c)
+	case SourceURLs:
+		validateURLs(&errs, c)
+	case SourceAzureDevOps:
+		validateAzureDevOps(&errs, c)
+	default:
+		errs.add("source.type: %q must be %s, %s, %s or %s", c.Source.Type, SourceGitHub, SourceBitbucket, SourceURLs, SourceAzureDevOps)
+	}
+	if c.Source.NamePattern != "" && c.Source.Type != SourceAzureDevOps {
+		errs.add("source.name_pattern: requires source.type %s", SourceAzureDevOps)
+	}
+	switch c.Target.Type {
+	case "", TargetGitHub:
+	case TargetGitLab:
+		validateGitLab(&errs, c)
+	case TargetGitea:
+		validateGitea(&errs, c)
+	default:
+		errs.add("target.type: %q must be %s, %s or %s", c.Target.Type, TargetGitHub, TargetGitLab, TargetGitea)
+	}
+	switch c.Target.OnExists {
+	case "", OnExistsFail, OnExistsSkip, OnExistsPush, OnExistsRecreate:
+	default:
+		errs.add("target.on_exists: %q must be %s, %s, %s or %s", c.Target.OnExists, OnExistsFail, OnExistsSkip, OnExistsPush, OnExistsRecreate)
+	}
+
+	if t := c.Target.Init.Template; t != "" {
+		if strings.Count(t, "/") != 1 || strings.HasPrefix(t, "/") || strings.HasSuffix(t, "/") {
+			errs.add("target.init.template: %q must be formatted as owner/name", t)
+		}
+		if c.Target.Init.AutoInit || c.Target.Init.Gitignore != "" || c.Target.Init.License != "" {
+			errs.add("target.init.template: cannot be used with auto_init, gitignore or license")
+		}
+	}
+
+	var visibilities []string
+	for from := range c.Target.VisibilityMap {
+		visibilities = append(visibilities, from)
+	}
+	sort.Strings(visibilities)
+	for _, from := range visibilities {
+		for _, v := range []string{from, c.Target.VisibilityMap[from]} {
+			switch v {
+			case VisibilityPublic, VisibilityPrivate, VisibilityInternal:
+			default:
+				errs.add("target.visibility_map: %q must be %s, %s or %s", v, VisibilityPublic, VisibilityPrivate, VisibilityInternal)
+			}
+		}
+	}
+
+	validateRequired(&errs, "git.clone_path", c.Git.ClonePath)
+	validateRequired(&errs, "git.remote_name", c.Git.RemoteName)
+	switch c.Git.Protocol {
+	case "", ProtocolSSH:
+		if c.Git.TransferMode == TransferModeImport && !c.Migrate.Wikis && c.Source.Content.Method != ContentMethodGit {
+			// nothing is cloned
+			break
+		}
+		if c.Git.TransferMode == TransferModeNative {
+			break
+		}
+		if c.Git.SSHAgent {
+			if os.Getenv("SSH_AUTH_SOCK") == "" {
+				errs.add("git.ssh_agent: SSH_AUTH_SOCK is not set, no ssh agent is running")
+			}
+			break
+		}
+		validateRequired(&errs, "git.ctr_file", c.Git.CrtFile)
+		validateFile(&errs, "git.ctr_file", c.Git.CrtFile)
+	case ProtocolHTTPS:
+	default:
+		errs.add("git.protocol: %q must be %s or %s", c.Git.Protocol, ProtocolSSH, ProtocolHTTPS)
+	}
+
+	validateURL(&errs, "git.lfs_url", c.Git.LFSURL)
+	validateFile(&errs, "overrides_file", c.OverridesFile)
+	validateFile(&errs, "manifest_file", c.ManifestFile)
+	validateWaves(&errs, c.Waves)
+	validateFile(&errs, "migrate.secrets_file", c.Migrate.SecretsFile)
+	validateFile(&errs, "migrate.workflow_rules", c.Migrate.WorkflowRules)
+	validateFile(&errs, "git.filter.mailmap", c.Git.Filter.Mailmap)
+	switch c.Git.CloneMode {
+	case "", CloneModeDisk, CloneModeMemory:
+	default:
+		errs.add("git.clone_mode: %q must be %s or %s", c.Git.CloneMode, CloneModeDisk, CloneModeMemory)
+	}
+	switch c.Git.TransferMode {
+	case "", TransferModeClone:
+	case TransferModeImport:
+		if c.Target.Type != "" && c.Target.Type != TargetGitHub {
+			errs.add("git.transfer_mode: %s requires a github target", TransferModeImport)
+		}
+		if c.Source.Type == SourceURLs {
+			validateRequired(&errs, "source.token", c.Source.Token)
+		}
+	case TransferModeNative:
+		validateNative(&errs, c)
+	default:
+		errs.add("git.transfer_mode: %q must be %s, %s or %s", c.Git.TransferMode, TransferModeClone, TransferModeImport, TransferModeNative)
+	}
+
+	if c.Source.Content.Path != "" {
+		validateRequired(&errs, "source.content.message", c.Source.Content.Message)
+	}
+	for i, r := range c.Source.Content.Rules {
+		field := fmt.Sprintf("source.content.rules[%d]", i)
+		validateRequired(&errs, field+".path", r.Path)
+		switch r.Mode {
+		case "", ContentPrepend, ContentAppend, ContentReplace:
+		case ContentRegex:
+			if _, err := regexp.Compile(r.Pattern); err != nil || r.Pattern == "" {
+				errs.add("%s.pattern: must be a valid regular expression", field)
+			}
+		default:
+			errs.add("%s.mode: %q must be %s, %s, %s or %s", field, r.Mode, ContentPrepend, ContentAppend, ContentReplace, ContentRegex)
+		}
+	}
+	if c.Source.Lockdown.Issue.Body != "" {
+		validateRequired(&errs, "source.lockdown.issue.title", c.Source.Lockdown.Issue.Title)
+	}
+	switch t := c.Source.Tombstone; t.Mode {
+	case "":
+		if t.Template != "" || t.Path != "" || t.Branch != "" {
+			errs.add("source.tombstone.mode: is required, %s or %s", TombstoneReadme, TombstoneBranch)
+		}
+	case TombstoneReadme, TombstoneBranch:
+		if t.Mode != TombstoneBranch && t.Branch != "" {
+			errs.add("source.tombstone.branch: requires the %s mode", TombstoneBranch)
+		}
+	default:
+		errs.add("source.tombstone.mode: %q must be %s or %s", t.Mode, TombstoneReadme, TombstoneBranch)
+	}
+	if c.Source.Content.Enabled() {
+		validateRequired(&errs, "git.commit_author", c.Git.Author)
+		validateRequired(&errs, "git.commit_email", c.Git.Email)
+	}
+	switch c.Source.Content.Method {
+	case "", ContentMethodAPI, ContentMethodGit:
+	default:
+		errs.add("source.content.method: %q must be %s or %s", c.Source.Content.Method, ContentMethodAPI, ContentMethodGit)
+	}
+	validateFile(&errs, "git.signing_key", c.Git.SigningKey)
+	validateCommits(&errs, c.Git)
+
+	if f := c.Report.Format; f != "" && f != "json" && f != "csv" && f != "markdown" {
+		errs.add("report.format: %q must be json, csv or markdown", f)
+	}
+
+	if c.Retry.Attempts < 0 {
+		errs.add("retry.attempts: must not be negative")
+	}
+
+	if c.Concurrency < 0 {
+		errs.add("concurrency: must not be negative")
+	}
+	var branches []string
+	for from := range c.Git.BranchMap {
+		branches = append(branches, from)
+	}
+	sort.Strings(branches)
+	targets := map[string]string{}
+	for _, from := range branches {
+		to := c.Git.BranchMap[from]
+		if to == "" {
+			errs.add("git.branch_map: %s has no new name", from)
+		} else if other, ok := targets[to]; ok {
+			errs.add("git.branch_map: %s and %s are both renamed to %s", other, from, to)
+		}
+		targets[to] = from
+	}
+	if len(c.Git.BranchMap) > 0 && (c.Git.TransferMode == TransferModeImport || c.Git.TransferMode == TransferModeNative) {
+		errs.add("git.branch_map: not supported with git.transfer_mode %s", c.Git.TransferMode)
+	}
+	if c.Git.SelectsRefs() {
+		switch {
+		case c.Git.TransferMode == TransferModeImport || c.Git.TransferMode == TransferModeNative:
+			errs.add("git.refspecs, git.branches and git.tags: not supported with git.transfer_mode %s", c.Git.TransferMode)
+		case !c.Git.Mirror:
+			errs.add("git.refspecs, git.branches and git.tags: require git.mirror, only the default branch is pushed otherwise")
+		}
+	}
+	if len(c.Git.RefSpecs) > 0 && (len(c.Git.Branches) > 0 || len(c.Git.Tags) > 0) {
+		errs.add("git.refspecs: cannot be used along with git.branches and git.tags")
+	}
+	for _, spec := range c.Git.RefSpecs {
+		// the refs are renamed by git.branch_map rather than by the specs
+		parts := strings.Split(strings.TrimPrefix(spec, "+"), ":")
+		if len(parts) != 2 || parts[0] != parts[1] || !strings.HasPrefix(parts[0], "refs/") {
+			errs.add("git.refspecs: %q must be refs/...:refs/... with the same name on both sides", spec)
+		}
+	}
+	if c.Git.Depth < 0 {
+		errs.add("git.depth: must not be negative")
+	}
+	if c.Git.PushBatchSize < 0 {
+		errs.add("git.push_batch_size: must not be negative")
+	}
+	if c.Git.FetchBatchSize < 0 {
+		errs.add("git.fetch_batch_size: must not be negative")
+	}
+	if c.Git.FetchBatchSize > 0 && !c.Git.Mirror {
+		errs.add("git.fetch_batch_size: requires git.mirror")
+	}
+	if c.Throttle.MaxClones < 0 {
+		errs.add("throttle.max_clones: must not be negative")
+	}
+	if c.Throttle.MaxBandwidthMB < 0 {
+		errs.add("throttle.max_bandwidth_mb: must not be negative")
+	}
+	if c.Throttle.MaxBandwidthMB > 0 && !c.Git.UseHTTPS() {
+		errs.add("throttle.max_bandwidth_mb: requires git.protocol %s", ProtocolHTTPS)
+	}
+	if c.Throttle.APIRequestsPerMinute < 0 {
+		errs.add("throttle.api_requests_per_minute: must not be negative")
+	}
+	if c.Lock.Path != "" && c.Lock.Repository != "" {
+		errs.add("lock.path and lock.repository cannot be used together")
+	}
+	if c.Lock.StaleAfter < 0 {
+		errs.add("lock.stale_after: must not be negative")
+	}
+	if c.Lock.StaleAfter > 0 && !c.Lock.Enabled() {
+		errs.add("lock.stale_after: requires lock.path or lock.repository")
+	}
+	timeouts := []struct {
+		field string
+		d     time.Duration
+	}{{"repo", c.Timeouts.Repo}, {"clone", c.Timeouts.Clone}, {"push", c.Timeouts.Push}, {"step", c.Timeouts.Step}}
+	for _, t := range timeouts {
+		if t.d < 0 {
+			errs.add("timeouts.%s: must not be negative", t.field)
+		}
+	}
+
+	if p := c.Migrate.PullRequests; p != "" && p != PullRequestsAuto && p != PullRequestsIssues {
+		errs.add("migrate.pull_requests: %q must be %q or %q", p, PullRequestsAuto, PullRequestsIssues)
+	}
+
+	switch a := c.Migrate.Attribution; a {
+	case "", AttributionHeader:
+	case AttributionPlaceholder:
+		if c.Migrate.AttributionTokens == "" {
+			errs.add("migrate.attribution_tokens: is required by the %q attribution", a)
+		}
+	default:
+		errs.add("migrate.attribution: %q must be %q or %q", a, AttributionHeader, AttributionPlaceholder)
+	}
+	validateFile(&errs, "migrate.attribution_tokens", c.Migrate.AttributionTokens)
+
+	if c.Migrate.PreserveNumbers && !c.Migrate.Issues {
+		errs.add("migrate.preserve_numbers: requires migrate.issues")
+	}
+	if c.Migrate.RewriteReferences && !c.Migrate.Issues && c.Migrate.PullRequests == "" && !c.Migrate.Discussions {
+		errs.add("migrate.rewrite_references: requires migrate.issues, migrate.pull_requests or migrate.discussions")
+	}
+	if c.Migrate.Scrub.Enabled() && !c.Migrate.Issues && c.Migrate.PullRequests == "" && !c.Migrate.Discussions {
+		errs.add("migrate.scrub: requires migrate.issues, migrate.pull_requests or migrate.discussions")
+	}
+	for i, h := range c.Migrate.Scrub.Hostnames {
+		if h == "" || strings.ContainsAny(h, "/:@ ") {
+			errs.add("migrate.scrub.hostnames[%d]: %q must be a hostname", i, h)
+		}
+	}
+	for i, p := range c.Migrate.Scrub.Patterns {
+		if _, err := regexp.Compile(p.Pattern); err != nil || p.Pattern == "" {
+			errs.add("migrate.scrub.patterns[%d].pattern: must be a valid regular expression", i)
+		}
+	}
+	var steps []string
+	for step := range c.FailurePolicy {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	for _, step := range steps {
+		switch p := c.FailurePolicy[step]; p {
+		case FailureContinue, FailureAbortRepo, FailureAbortRun:
+		default:
+			errs.add("failure_policy.%s: %q must be %s, %s or %s", step, p, FailureContinue, FailureAbortRepo, FailureAbortRun)
+		}
+	}
+	if c.Migrate.WatchersIssue && !c.Migrate.Watchers {
+		errs.add("migrate.watchers_issue: requires migrate.watchers")
+	}
+
+	if c.Source.PushedAfter != "" {
+		if _, err := time.Parse("2006-01-02", c.Source.PushedAfter); err != nil {
+			errs.add("source.pushed_after: %q must be formatted as YYYY-MM-DD", c.Source.PushedAfter)
+		}
+	}
+
+	if c.Git.Filter.Enabled() {
+		if c.Git.TransferMode == TransferModeImport {
+			errs.add("git.filter: is not supported with git.transfer_mode %s", TransferModeImport)
+		}
+		if c.Verify {
+			errs.add("verify: the refs rewritten by git.filter cannot be compared with the source")
+		}
+	}
+
+	for _, p := range []struct {
+		field    string
+		patterns []string
+	}{
+		{"source.include", c.Source.Include},
+		{"source.exclude", c.Source.Exclude},
+		{"git.filter.paths", c.Git.Filter.Paths},
+		{"git.branches", c.Git.Branches},
+		{"git.tags", c.Git.Tags},
+		{"safety.allow", c.Safety.Allow},
+	} {
+		if _, err := CompilePatterns(p.patterns); err != nil {
+			errs.add("%s: %v", p.field, err)
+		}
+	}
+
+	for i, n := range c.Notifications {
+		field := fmt.Sprintf("notifications[%d]", i)
+		switch n.Type {
+		case NotifySlack, NotifyTeams, NotifyWebhook:
+		default:
+			errs.add("%s.type: %q must be %s, %s or %s", field, n.Type, NotifySlack, NotifyTeams, NotifyWebhook)
+		}
+		validateRequired(&errs, field+".url", n.URL)
+		validateURL(&errs, field+".url", n.URL)
+		for _, e := range n.Events {
+			if e != EventStart && e != EventFailure && e != EventSummary {
+				errs.add("%s.events: %q must be %s, %s or %s", field, e, EventStart, EventFailure, EventSummary)
+			}
+		}
+		if _, err := template.New(field).Parse(n.Template); err != nil {
+			errs.add("%s.template: %v", field, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateCommits checks the identities, the signing and the message
+// templates of the commits created by the tool.
+func validateCommits(errs *validationErrors, g Git) {
+	switch g.SigningFormat {
+	case "", SigningGPG, SigningSSH:
+	default:
+		errs.add("git.signing_format: %q must be %s or %s", g.SigningFormat, SigningGPG, SigningSSH)
+	}
+	if g.SigningKey != "" {
+		validateRequired(errs, "git.commit_author", g.Author)
+		validateRequired(errs, "git.commit_email", g.Email)
+	}
+	if g.CommitterName != "" {
+		validateRequired(errs, "git.committer_email", g.CommitterEmail)
+	}
+	if g.CommitterEmail != "" {
+		validateRequired(errs, "git.committer_name", g.CommitterName)
+	}
+	if _, err := template.New("").Parse(g.CommitMessage); err != nil {
+		errs.add("git.commit_message: %v", err)
+	}
+
+	var ops []string
+	for op := range g.CommitMessages {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		found := false
+		for _, o := range CommitOperations {
+			found = found || o == op
+		}
+		if !found {
+			errs.add("git.commit_messages: %q must be one of %v", op, CommitOperations)
+			continue
+		}
+		if _, err := template.New("").Parse(g.CommitMessages[op]); err != nil {
+			errs.add("git.commit_messages.%s: %v", op, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfiguration() *Configuration {
+	c := &Configuration{}
+	c.Source.Token = "source-token"
+	c.Source.Organization = "acme"
+	c.Target.Token = "target-token"
+	c.Target.Organization = "acme-new"
+	c.Git.ClonePath = "/tmp"
+	c.Git.RemoteName = "target"
+	c.Git.Protocol = ProtocolHTTPS
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfiguration().Validate(); err != nil {
+		t.Fatalf("valid configuration: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Configuration)
+		want   []string
+	}{
+		{"owner", func(c *Configuration) { c.Source.User = "someone" }, []string{"source.organization and source.user cannot be used together"}},
+		{"url", func(c *Configuration) { c.Source.URL = "github.example.com" }, []string{"source.url"}},
+		{"page size", func(c *Configuration) { c.Source.PageSize = 101 }, []string{"source.page_size: 101 must be between 1 and 100"}},
+		{"lock", func(c *Configuration) { c.Lock.Path, c.Lock.Repository = "/tmp", "locks" }, []string{"lock.path"}},
+		{"stale lock", func(c *Configuration) { c.Lock.StaleAfter = time.Hour }, []string{"lock.stale_after"}},
+		{"scrub", func(c *Configuration) {
+			c.Migrate.Issues = true
+			c.Migrate.Scrub.Patterns = []ScrubPattern{{Pattern: "a("}}
+		}, []string{"migrate.scrub.patterns[0].pattern"}},
+		{"failure policy", func(c *Configuration) { c.FailurePolicy = map[string]string{"webhooks": "ignore"} }, []string{"failure_policy.webhooks"}},
+		{"every error", func(c *Configuration) { c.Target.Organization, c.Git.RemoteName = "", "" }, []string{"target.organization", "git.remote_name"}},
+	}
+	for _, tt := range tests {
+		c := validConfiguration()
+		tt.change(c)
+		err := c.Validate()
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: %v, want %q", tt.name, err, want)
+			}
+		}
+	}
+}
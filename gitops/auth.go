@@ -0,0 +1,97 @@
+// Package gitops clones, fetches and pushes the repositories with go-git,
+// and transfers their Git LFS objects.
+package gitops
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// Auth authenticates the git operations. The ssh key is loaded once and
+// shared by every worker, so the passphrase is asked a single time.
+type Auth struct {
+	cfg  config.Git
+	once sync.Once
+	ssh  transport.AuthMethod
+	err  error
+}
+
+func NewAuth(cfg config.Git) *Auth {
+	return &Auth{cfg: cfg}
+}
+
+// InstallTransport replaces the default https client of go-git, so the
+// instances are reached with the same tls settings of the api.
+func InstallTransport(rt http.RoundTripper) {
+	client.InstallProtocol("https", githttp.NewClient(&http.Client{Transport: rt}))
+}
+
+// URL is the git URL of a repository according to git.protocol.
+func URL(cfg config.Git, r *gh.Repository) string {
+	if cfg.UseHTTPS() {
+		return r.GetCloneURL()
+	}
+	return r.GetSSHURL()
+}
+
+// Method authenticates with the key file over ssh, or with the token of
+// the side (source or target) being accessed over https. The username is
+// only checked by some servers, such as Bitbucket.
+func (a *Auth) Method(tokens oauth2.TokenSource, username string, l *log.Entry) (transport.AuthMethod, error) {
+	if a.cfg.UseHTTPS() {
+		t, err := tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		if username == "" {
+			username = "x-access-token"
+		}
+		return &githttp.BasicAuth{Username: username, Password: t.AccessToken}, nil
+	}
+
+	a.once.Do(func() {
+		a.ssh, a.err = loadSSHAuth(a.cfg, l)
+	})
+	return a.ssh, a.err
+}
+
+func loadSSHAuth(cfg config.Git, l *log.Entry) (transport.AuthMethod, error) {
+	if cfg.SSHAgent {
+		l.Info("using the ssh agent...")
+		return ssh.NewSSHAgentAuth("git")
+	}
+
+	l.WithField("file", cfg.CrtFile).Info("using the public key...")
+	auth, err := ssh.NewPublicKeysFromFile("git", cfg.CrtFile, cfg.Passphrase)
+	if err == nil || cfg.Passphrase != "" {
+		return auth, err
+	}
+
+	// the key may be encrypted, ask for the passphrase when possible
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("%s: %v (set git.passphrase or GHMGR_SSH_PASSPHRASE for encrypted keys)", cfg.CrtFile, err)
+	}
+	fmt.Fprintf(os.Stderr, "passphrase for %s: ", cfg.CrtFile)
+	passphrase, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("no passphrase was given")
+	}
+	return ssh.NewPublicKeysFromFile("git", cfg.CrtFile, string(passphrase))
+}
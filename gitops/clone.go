@@ -0,0 +1,255 @@
+package gitops
+
+import (
+	"context"
+	"os"
+
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+	git "gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+const defaultMemoryLimitMB = 100
+
+// InMemory reports whether a repository of sizeKB, as reported by the api,
+// is cloned in memory, the bigger ones fall back to the disk.
+func InMemory(cfg config.Git, sizeKB int) bool {
+	if cfg.CloneMode != config.CloneModeMemory {
+		return false
+	}
+	limit := cfg.MemoryLimitMB
+	if limit <= 0 {
+		limit = defaultMemoryLimitMB
+	}
+	return sizeKB <= limit*1024
+}
+
+// Init creates an empty bare repository.
+func Init(path string, memoryStorage bool) (*git.Repository, error) {
+	if memoryStorage {
+		return git.Init(memory.NewStorage(), nil)
+	}
+	return git.PlainInit(path, true)
+}
+
+// Clone clones URL in memory or to path, a clone left by a previous run
+// being updated instead. Without mirror, only branch is cloned, the default
+// branch when it is empty.
+func Clone(ctx context.Context, cfg config.Git, URL, path, branch string, memoryStorage bool, auth transport.AuthMethod, progress sideband.Progress) (*git.Repository, error) {
+	if !memoryStorage {
+		g, err := git.PlainOpen(path)
+		if err == nil {
+			return g, updateClone(ctx, cfg, g, auth, progress)
+		}
+		if err != git.ErrRepositoryNotExists {
+			return nil, err
+		}
+	}
+
+	if cfg.Mirror {
+		g, err := Init(path, memoryStorage)
+		if err != nil {
+			return nil, err
+		}
+		return g, MirrorFetch(ctx, cfg, g, URL, auth, progress)
+	}
+
+	opts := &git.CloneOptions{
+		URL:      URL,
+		Auth:     auth,
+		Progress: progress,
+	}
+	if branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(branch)
+	}
+	if memoryStorage {
+		return git.CloneContext(ctx, memory.NewStorage(), nil, opts)
+	}
+	return git.PlainCloneContext(ctx, path, true, opts)
+}
+
+// updateClone fetches the new commits of the source into an existing clone,
+// moving the branch of HEAD like a new clone would.
+func updateClone(ctx context.Context, cfg config.Git, g *git.Repository, auth transport.AuthMethod, progress sideband.Progress) error {
+	opts := &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		Auth:       auth,
+		Tags:       git.AllTags,
+		Progress:   progress,
+	}
+	if cfg.Mirror {
+		remote, err := g.Remote(git.DefaultRemoteName)
+		if err != nil {
+			return err
+		}
+		specs, tags, err := mirrorRefSpecs(cfg, g, remote.Config().URLs[0], auth)
+		if err != nil {
+			return err
+		}
+		opts.RefSpecs, opts.Tags = specs, tags
+		return fetchBatches(ctx, cfg, g, opts)
+	}
+
+	err := g.FetchContext(ctx, opts)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	head, err := g.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+	branch := head.Target()
+	remote, err := g.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch.Short()), true)
+	if err != nil {
+		return err
+	}
+	return g.Storer.SetReference(plumbing.NewHashReference(branch, remote.Hash()))
+}
+
+// Cleanup removes a clone once it is no longer needed, unless
+// git.keep_clones is set.
+func Cleanup(cfg config.Git, path string, l *log.Entry) {
+	if cfg.KeepClones {
+		return
+	}
+	if err := os.RemoveAll(path); err != nil {
+		l.WithField("path", path).WithError(err).Warn("the clone could not be removed")
+	}
+}
+
+// MirrorRefSpecs are the namespaces transferred in mirror mode, the
+// refs/pull/* namespace is read-only on GitHub and cannot be pushed.
+var MirrorRefSpecs = []gitconfig.RefSpec{
+	"+refs/heads/*:refs/heads/*",
+	"+refs/tags/*:refs/tags/*",
+	"+refs/notes/*:refs/notes/*",
+}
+
+// mirrorRefSpecs are the specs fetched in mirror mode: the refs of URL that
+// git.refspecs, git.branches and git.tags select, one by one, or the
+// mirrored namespaces. The tags are then only the selected ones. With
+// git.fetch_batch_size, the refs of the namespaces are listed too, and the
+// ones g already holds at the same commit, e.g. fetched by an interrupted
+// run, are left out.
+func mirrorRefSpecs(cfg config.Git, g *git.Repository, URL string, auth transport.AuthMethod) ([]gitconfig.RefSpec, git.TagMode, error) {
+	f, err := NewRefFilter(cfg)
+	if err != nil || f == nil && cfg.FetchBatchSize <= 0 {
+		return MirrorRefSpecs, git.AllTags, err
+	}
+	refs, err := ListRemote(URL, auth)
+	if err != nil {
+		return nil, git.NoTags, err
+	}
+
+	var names []string
+	for _, r := range refs {
+		name := r.Name()
+		if r.Type() != plumbing.HashReference || !f.Match(name.String()) || f == nil && !mirrored(name) {
+			continue
+		}
+		if local, err := g.Reference(name, false); err == nil && local.Hash() == r.Hash() {
+			continue
+		}
+		names = append(names, name.String())
+	}
+	return ExactRefSpecs(names), git.NoTags, nil
+}
+
+// mirrored reports whether the ref is in one of the mirrored namespaces.
+func mirrored(name plumbing.ReferenceName) bool {
+	for _, s := range MirrorRefSpecs {
+		if s.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchBatches fetches the specs of opts at once or, with
+// git.fetch_batch_size, in batches of that many: the objects and the refs
+// of each batch are kept when a later one fails, so the next run only
+// fetches the rest.
+func fetchBatches(ctx context.Context, cfg config.Git, g *git.Repository, opts *git.FetchOptions) error {
+	size := cfg.FetchBatchSize
+	if size <= 0 {
+		size = len(opts.RefSpecs)
+	}
+	for i := 0; i < len(opts.RefSpecs); i += size {
+		end := i + size
+		if end > len(opts.RefSpecs) {
+			end = len(opts.RefSpecs)
+		}
+		o := *opts
+		o.RefSpecs = opts.RefSpecs[i:end]
+		err := g.FetchContext(ctx, &o)
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return err
+		}
+	}
+	return nil
+}
+
+// MirrorFetch fetches the mirrored namespaces of URL into g, or the refs
+// selected by git.refspecs, git.branches and git.tags.
+func MirrorFetch(ctx context.Context, cfg config.Git, g *git.Repository, URL string, auth transport.AuthMethod, progress sideband.Progress) error {
+	_, err := g.CreateRemote(&gitconfig.RemoteConfig{
+		Name:  git.DefaultRemoteName,
+		URLs:  []string{URL},
+		Fetch: MirrorRefSpecs,
+	})
+	if err != nil {
+		return err
+	}
+
+	specs, tags, err := mirrorRefSpecs(cfg, g, URL, auth)
+	if err != nil {
+		return err
+	}
+	return fetchBatches(ctx, cfg, g, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   specs,
+		Auth:       auth,
+		Tags:       tags,
+		Progress:   progress,
+	})
+}
+
+// CloneOrigin tells whether there is a clone at path and returns the url
+// of its origin remote, empty when it has none.
+func CloneOrigin(path string) (bool, string, error) {
+	g, err := git.PlainOpen(path)
+	if err == git.ErrRepositoryNotExists {
+		return false, "", nil
+	}
+	if err != nil {
+		return true, "", err
+	}
+	remote, err := g.Remote(git.DefaultRemoteName)
+	if err == git.ErrRemoteNotFound || err == nil && len(remote.Config().URLs) == 0 {
+		return true, "", nil
+	}
+	if err != nil {
+		return true, "", err
+	}
+	return true, remote.Config().URLs[0], nil
+}
+
+// ListRemote returns the refs of the repository at URL without cloning it,
+// none when it is empty.
+func ListRemote(URL string, auth transport.AuthMethod) ([]*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{URL},
+	})
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err == transport.ErrEmptyRemoteRepository {
+		return nil, nil
+	}
+	return refs, err
+}
@@ -0,0 +1,293 @@
+package gitops
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+
+	"github.com/leocomelli/ghmgr/config"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+var emptyTree = plumbing.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+
+// historyFilter rewrites the commits of a clone without the files matching
+// git.filter and with the authors of the mailmap. The rewritten objects are
+// memoized by their original hash, so the history shared by several refs
+// is only rewritten once.
+type historyFilter struct {
+	s       storer.EncodedObjectStorer
+	maxSize int64
+	paths   []*regexp.Regexp
+	mailmap *Mailmap
+	commits map[plumbing.Hash]plumbing.Hash
+	trees   map[string]plumbing.Hash
+	removed map[string]bool
+	mapped  map[string]bool
+}
+
+// FilterHistory removes the files bigger than max_file_size_mb or matching
+// the paths of git.filter from every commit, maps the authors, committers
+// and taggers with mailmap, then moves the refs of the clone to the
+// rewritten commits. The signatures of the rewritten commits and tags are
+// dropped, they would no longer be valid. It returns the paths removed and
+// the identities mapped.
+func FilterHistory(g *git.Repository, cfg config.HistoryFilter, mailmap *Mailmap) ([]string, []string, error) {
+	paths, err := config.CompilePatterns(cfg.Paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	f := &historyFilter{
+		s:       g.Storer,
+		maxSize: int64(cfg.MaxFileSizeMB) * 1024 * 1024,
+		paths:   paths,
+		mailmap: mailmap,
+		commits: map[plumbing.Hash]plumbing.Hash{},
+		trees:   map[string]plumbing.Hash{},
+		removed: map[string]bool{},
+		mapped:  map[string]bool{},
+	}
+
+	refs, err := g.References()
+	if err != nil {
+		return nil, nil, err
+	}
+	var list []*plumbing.Reference
+	err = refs.ForEach(func(r *plumbing.Reference) error {
+		if r.Type() == plumbing.HashReference {
+			list = append(list, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, r := range list {
+		h, err := f.object(r.Hash())
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", r.Name(), err)
+		}
+		if h == r.Hash() {
+			continue
+		}
+		if err := g.Storer.SetReference(plumbing.NewHashReference(r.Name(), h)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return sortedKeys(f.removed), sortedKeys(f.mapped), nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// identity maps a signature with the mailmap, it reports whether it changed.
+func (f *historyFilter) identity(s *object.Signature) bool {
+	name, email := f.mailmap.Map(s.Name, s.Email)
+	if name == s.Name && email == s.Email {
+		return false
+	}
+	f.mapped[fmt.Sprintf("%s <%s> -> %s <%s>", s.Name, s.Email, name, email)] = true
+	s.Name, s.Email = name, email
+	return true
+}
+
+// filtersFiles reports whether the trees are rewritten, not only the
+// identities.
+func (f *historyFilter) filtersFiles() bool {
+	return f.maxSize > 0 || len(f.paths) > 0
+}
+
+// object rewrites the commit or the annotated tag h, the refs may point to
+// other objects, which are kept.
+func (f *historyFilter) object(h plumbing.Hash) (plumbing.Hash, error) {
+	o, err := f.s.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return h, err
+	}
+
+	switch o.Type() {
+	case plumbing.CommitObject:
+		return f.commit(h)
+	case plumbing.TagObject:
+		t, err := object.DecodeTag(f.s, o)
+		if err != nil {
+			return h, err
+		}
+		target, err := f.object(t.Target)
+		if err != nil {
+			return h, err
+		}
+		tagger := f.identity(&t.Tagger)
+		if target == t.Target && !tagger {
+			return h, nil
+		}
+		t.Target = target
+		t.PGPSignature = ""
+		return f.store(t)
+	}
+	return h, nil
+}
+
+// commit rewrites h after its parents, walking the history with a stack
+// instead of recursion.
+func (f *historyFilter) commit(h plumbing.Hash) (plumbing.Hash, error) {
+	stack := []plumbing.Hash{h}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if _, ok := f.commits[top]; ok {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		c, err := object.GetCommit(f.s, top)
+		if err != nil {
+			return h, err
+		}
+		pending := false
+		for _, p := range c.ParentHashes {
+			if _, ok := f.commits[p]; !ok {
+				stack = append(stack, p)
+				pending = true
+			}
+		}
+		if pending {
+			continue
+		}
+
+		n, err := f.rewriteCommit(c)
+		if err != nil {
+			return h, err
+		}
+		f.commits[top] = n
+		stack = stack[:len(stack)-1]
+	}
+	return f.commits[h], nil
+}
+
+func (f *historyFilter) rewriteCommit(c *object.Commit) (plumbing.Hash, error) {
+	tree := c.TreeHash
+	if f.filtersFiles() {
+		var err error
+		if tree, err = f.tree(c.TreeHash, ""); err != nil {
+			return c.Hash, err
+		}
+	}
+	n := *c
+	changed := tree != c.TreeHash
+	changed = f.identity(&n.Author) || changed
+	changed = f.identity(&n.Committer) || changed
+
+	parents := make([]plumbing.Hash, len(c.ParentHashes))
+	for i, p := range c.ParentHashes {
+		parents[i] = f.commits[p]
+		changed = changed || parents[i] != p
+	}
+	if !changed {
+		return c.Hash, nil
+	}
+
+	n.TreeHash = tree
+	n.ParentHashes = parents
+	n.PGPSignature = ""
+	return f.store(&n)
+}
+
+// tree rewrites the tree h found at dir, the paths being matched from the
+// root of the repository.
+func (f *historyFilter) tree(h plumbing.Hash, dir string) (plumbing.Hash, error) {
+	key := h.String()
+	if len(f.paths) > 0 {
+		key = dir + "\x00" + key
+	}
+	if n, ok := f.trees[key]; ok {
+		return n, nil
+	}
+
+	t, err := object.GetTree(f.s, h)
+	if err != nil {
+		return h, err
+	}
+
+	changed := false
+	var entries []object.TreeEntry
+	for _, e := range t.Entries {
+		p := path.Join(dir, e.Name)
+
+		switch {
+		case e.Mode == filemode.Dir:
+			n, err := f.tree(e.Hash, p)
+			if err != nil {
+				return h, err
+			}
+			if n == emptyTree && e.Hash != emptyTree {
+				// every file of the directory was removed
+				changed = true
+				continue
+			}
+			if n != e.Hash {
+				changed = true
+				e.Hash = n
+			}
+		case e.Mode == filemode.Submodule:
+		default:
+			drop, err := f.drop(e.Hash, p)
+			if err != nil {
+				return h, err
+			}
+			if drop {
+				f.removed[p] = true
+				changed = true
+				continue
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	n := h
+	if changed {
+		n, err = f.store(&object.Tree{Entries: entries})
+		if err != nil {
+			return h, err
+		}
+	}
+	f.trees[key] = n
+	return n, nil
+}
+
+func (f *historyFilter) drop(h plumbing.Hash, p string) (bool, error) {
+	for _, re := range f.paths {
+		if re.MatchString(p) {
+			return true, nil
+		}
+	}
+	if f.maxSize <= 0 {
+		return false, nil
+	}
+	size, err := f.s.EncodedObjectSize(h)
+	return size > f.maxSize, err
+}
+
+type encoder interface {
+	Encode(plumbing.EncodedObject) error
+}
+
+func (f *historyFilter) store(e encoder) (plumbing.Hash, error) {
+	o := f.s.NewEncodedObject()
+	if err := e.Encode(o); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return f.s.SetEncodedObject(o)
+}
@@ -0,0 +1,184 @@
+// Package gittest serves git repositories kept in memory for the tests.
+// go-git clones, fetches and pushes them in the process through the
+// gittest:// scheme, so no git binary nor network is involved.
+package gittest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// Scheme is the scheme of the URLs of the repositories.
+const Scheme = "gittest"
+
+var (
+	install sync.Once
+	mu      sync.Mutex
+	servers = map[string]*Server{}
+	next    int
+)
+
+// loader finds the repositories of the servers by the host of the URL.
+type loader struct{}
+
+func (loader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	mu.Lock()
+	s := servers[ep.Host]
+	mu.Unlock()
+	if s == nil {
+		return nil, transport.ErrRepositoryNotFound
+	}
+	r := s.repo(ep.Path)
+	if r == nil {
+		return nil, transport.ErrRepositoryNotFound
+	}
+	return r.Storer, nil
+}
+
+// Server is a host of repositories, unregistered at the end of the test.
+type Server struct {
+	t     testing.TB
+	host  string
+	mu    sync.Mutex
+	repos map[string]*git.Repository
+}
+
+// NewServer registers a host serving the repositories created with Create.
+func NewServer(t testing.TB) *Server {
+	install.Do(func() {
+		client.InstallProtocol(Scheme, server.NewServer(loader{}))
+	})
+
+	mu.Lock()
+	next++
+	s := &Server{t: t, host: fmt.Sprintf("git%d.test", next), repos: map[string]*git.Repository{}}
+	servers[s.host] = s
+	mu.Unlock()
+
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(servers, s.host)
+		mu.Unlock()
+	})
+	return s
+}
+
+func repoPath(owner, name string) string {
+	return strings.ToLower(fmt.Sprintf("/%s/%s.git", owner, name))
+}
+
+func (s *Server) repo(path string) *git.Repository {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasSuffix(path, ".git") {
+		path += ".git"
+	}
+	return s.repos[strings.ToLower(path)]
+}
+
+// URL is the URL of a repository, the clone url of the fake GitHub api.
+func (s *Server) URL(owner, name string) string {
+	return fmt.Sprintf("%s://%s/%s/%s.git", Scheme, s.host, owner, name)
+}
+
+// Create creates an empty repository, the one the pushes of a migration
+// reach.
+func (s *Server) Create(owner, name string) *git.Repository {
+	g, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		// Create is also called by the handlers of the fake api
+		s.t.Errorf("gittest: %v", err)
+		return nil
+	}
+	s.mu.Lock()
+	s.repos[repoPath(owner, name)] = g
+	s.mu.Unlock()
+	return g
+}
+
+// Repo returns a repository created on the server, nil when it does not
+// exist.
+func (s *Server) Repo(owner, name string) *git.Repository {
+	return s.repo(repoPath(owner, name))
+}
+
+// Commit commits the files on a branch of a repository, created when it
+// does not exist yet, and returns the sha of the commit.
+func (s *Server) Commit(owner, name, branch string, files map[string]string) string {
+	g := s.Repo(owner, name)
+	if g == nil {
+		g = s.Create(owner, name)
+	}
+	w, err := g.Worktree()
+	if err != nil {
+		s.t.Fatalf("gittest: %v", err)
+	}
+
+	// HEAD stays on the first branch committed, the default one
+	if head, err := g.Storer.Reference(plumbing.HEAD); err == nil {
+		if _, err := g.Reference(head.Target(), true); err == nil {
+			defer g.Storer.SetReference(head)
+		}
+	}
+
+	ref := plumbing.NewBranchReferenceName(branch)
+	if _, err := g.Reference(ref, true); err == nil {
+		if err := w.Checkout(&git.CheckoutOptions{Branch: ref, Force: true}); err != nil {
+			s.t.Fatalf("gittest: %v", err)
+		}
+	} else if err := g.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, ref)); err != nil {
+		s.t.Fatalf("gittest: %v", err)
+	}
+
+	for file, content := range files {
+		f, err := w.Filesystem.Create(file)
+		if err != nil {
+			s.t.Fatalf("gittest: %v", err)
+		}
+		f.Write([]byte(content))
+		f.Close()
+		if _, err := w.Add(file); err != nil {
+			s.t.Fatalf("gittest: %v", err)
+		}
+	}
+
+	sig := &object.Signature{Name: "gittest", Email: "gittest@example.com", When: time.Unix(1500000000, 0)}
+	h, err := w.Commit("update "+branch, &git.CommitOptions{Author: sig, Committer: sig})
+	if err != nil {
+		s.t.Fatalf("gittest: %v", err)
+	}
+	return h.String()
+}
+
+// Refs returns the sha of each reference of a repository, HEAD apart.
+func (s *Server) Refs(owner, name string) map[string]string {
+	refs := map[string]string{}
+	g := s.Repo(owner, name)
+	if g == nil {
+		return refs
+	}
+	iter, err := g.References()
+	if err != nil {
+		s.t.Fatalf("gittest: %v", err)
+	}
+	iter.ForEach(func(r *plumbing.Reference) error {
+		if r.Type() == plumbing.HashReference {
+			refs[r.Name().String()] = r.Hash().String()
+		}
+		return nil
+	})
+	return refs
+}
@@ -0,0 +1,271 @@
+package gitops
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+const (
+	lfsMediaType    = "application/vnd.git-lfs+json"
+	lfsPointerLimit = 1024
+	lfsBatchSize    = 100
+)
+
+// LFSObject is an object referenced by a git-lfs pointer file.
+type LFSObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+type lfsBatchRequest struct {
+	Operation string      `json:"operation"`
+	Transfers []string    `json:"transfers"`
+	Objects   []LFSObject `json:"objects"`
+}
+
+type lfsBatchResponse struct {
+	Objects []struct {
+		LFSObject
+		Actions map[string]lfsAction `json:"actions"`
+		Error   *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// LFSEndpoint is the lfs api of a repository, e.g. its clone url followed
+// by /info/lfs.
+type LFSEndpoint struct {
+	URL    string
+	Tokens oauth2.TokenSource
+	Client *http.Client
+}
+
+// parseLFSPointer reads the oid and size of a git-lfs pointer file.
+func parseLFSPointer(content []byte) (LFSObject, bool) {
+	var o LFSObject
+	if !bytes.HasPrefix(content, []byte("version https://git-lfs.github.com/spec/")) {
+		return o, false
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "oid":
+			o.OID = strings.TrimPrefix(parts[1], "sha256:")
+		case "size":
+			o.Size, _ = strconv.ParseInt(parts[1], 10, 64)
+		}
+	}
+
+	return o, o.OID != "" && o.Size > 0
+}
+
+// FindLFSObjects reads the pointer files of every blob of g.
+func FindLFSObjects(g *git.Repository) ([]LFSObject, error) {
+	blobs, err := g.BlobObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var objects []LFSObject
+	err = blobs.ForEach(func(b *object.Blob) error {
+		if b.Size > lfsPointerLimit {
+			return nil
+		}
+		r, err := b.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if o, ok := parseLFSPointer(content); ok && !seen[o.OID] {
+			seen[o.OID] = true
+			objects = append(objects, o)
+		}
+		return nil
+	})
+
+	return objects, err
+}
+
+// UsesLFS looks for lfs filters in the .gitattributes of HEAD, to detect
+// repositories whose objects would be left behind.
+func UsesLFS(g *git.Repository) bool {
+	head, err := g.Head()
+	if err != nil {
+		return false
+	}
+	c, err := g.CommitObject(head.Hash())
+	if err != nil {
+		return false
+	}
+	f, err := c.File(".gitattributes")
+	if err != nil {
+		return false
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(content, "filter=lfs")
+}
+
+func lfsBatch(ctx context.Context, e LFSEndpoint, operation string, objects []LFSObject) (*lfsBatchResponse, error) {
+	body, err := json.Marshal(&lfsBatchRequest{
+		Operation: operation,
+		Transfers: []string{"basic"},
+		Objects:   objects,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", e.URL+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	token, err := e.Tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth("x-access-token", token.AccessToken)
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lfs batch %s on %s: %s", operation, e.URL, resp.Status)
+	}
+
+	res := &lfsBatchResponse{}
+	return res, json.NewDecoder(resp.Body).Decode(res)
+}
+
+func lfsDo(ctx context.Context, client *http.Client, method string, a lfsAction, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, a.Href, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range a.Header {
+		req.Header.Set(k, v)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("lfs %s %s: %s", method, a.Href, resp.Status)
+	}
+	return resp, nil
+}
+
+// TransferLFS copies the objects from the source to the target endpoint,
+// by batches of 100. The objects already on the target are not uploaded.
+func TransferLFS(ctx context.Context, source, target LFSEndpoint, objects []LFSObject) error {
+	for i := 0; i < len(objects); i += lfsBatchSize {
+		end := i + lfsBatchSize
+		if end > len(objects) {
+			end = len(objects)
+		}
+		if err := transferLFSObjects(ctx, source, target, objects[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func transferLFSObjects(ctx context.Context, source, target LFSEndpoint, objects []LFSObject) error {
+	downloads, err := lfsBatch(ctx, source, "download", objects)
+	if err != nil {
+		return err
+	}
+	hrefs := map[string]lfsAction{}
+	for _, o := range downloads.Objects {
+		if o.Error != nil {
+			return fmt.Errorf("lfs object %s is not available on the source: %s", o.OID, o.Error.Message)
+		}
+		hrefs[o.OID] = o.Actions["download"]
+	}
+
+	uploads, err := lfsBatch(ctx, target, "upload", objects)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range uploads.Objects {
+		if o.Error != nil {
+			return fmt.Errorf("lfs object %s cannot be uploaded: %s", o.OID, o.Error.Message)
+		}
+		upload, ok := o.Actions["upload"]
+		if !ok {
+			// the object already exists on the target
+			continue
+		}
+
+		resp, err := lfsDo(ctx, source.Client, "GET", hrefs[o.OID], nil, 0)
+		if err != nil {
+			return err
+		}
+		up, err := lfsDo(ctx, target.Client, "PUT", upload, resp.Body, o.Size)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		up.Body.Close()
+
+		if verify, ok := o.Actions["verify"]; ok {
+			body, _ := json.Marshal(&o.LFSObject)
+			if verify.Header == nil {
+				verify.Header = map[string]string{}
+			}
+			verify.Header["Content-Type"] = lfsMediaType
+			v, err := lfsDo(ctx, target.Client, "POST", verify, bytes.NewReader(body), int64(len(body)))
+			if err != nil {
+				return err
+			}
+			v.Body.Close()
+		}
+	}
+
+	return nil
+}
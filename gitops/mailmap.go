@@ -0,0 +1,119 @@
+package gitops
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Mailmap maps the names and the emails of the commit authors, after the
+// format of the .mailmap file of git, then the domains of the emails left.
+type Mailmap struct {
+	byNameEmail map[string]identity
+	byEmail     map[string]identity
+	domains     map[string]string
+}
+
+type identity struct {
+	name, email string
+}
+
+// LoadMailmap reads the mailmap file at path, when there is one, along with
+// the domains mapping the old domains of the emails to the new ones.
+func LoadMailmap(path string, domains map[string]string) (*Mailmap, error) {
+	m := &Mailmap{byNameEmail: map[string]identity{}, byEmail: map[string]identity{}, domains: map[string]string{}}
+	for from, to := range domains {
+		m.domains[strings.ToLower(from)] = to
+	}
+	if path == "" {
+		return m, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := m.parse(f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// parse reads the lines of a mailmap, one of:
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+func (m *Mailmap) parse(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var names, emails []string
+		for strings.Contains(line, "<") {
+			open := strings.Index(line, "<")
+			end := strings.Index(line, ">")
+			if end < open {
+				return fmt.Errorf("line %d: unbalanced brackets", n)
+			}
+			names = append(names, strings.TrimSpace(line[:open]))
+			emails = append(emails, strings.TrimSpace(line[open+1:end]))
+			line = line[end+1:]
+		}
+
+		switch len(emails) {
+		case 1:
+			if names[0] == "" {
+				return fmt.Errorf("line %d: a single email needs a proper name", n)
+			}
+			m.byEmail[strings.ToLower(emails[0])] = identity{name: names[0]}
+		case 2:
+			proper := identity{name: names[0], email: emails[0]}
+			if names[1] != "" {
+				m.byNameEmail[strings.ToLower(emails[1]+"\x00"+names[1])] = proper
+			} else {
+				m.byEmail[strings.ToLower(emails[1])] = proper
+			}
+		default:
+			return fmt.Errorf("line %d: expected one or two emails", n)
+		}
+	}
+	return s.Err()
+}
+
+// Map returns the proper name and email of a commit identity, the entries
+// naming the commit name winning over the ones of the email only.
+func (m *Mailmap) Map(name, email string) (string, string) {
+	if m == nil {
+		return name, email
+	}
+	p, ok := m.byNameEmail[strings.ToLower(email+"\x00"+name)]
+	if !ok {
+		p, ok = m.byEmail[strings.ToLower(email)]
+	}
+	if ok {
+		if p.name != "" {
+			name = p.name
+		}
+		if p.email != "" {
+			email = p.email
+		}
+	}
+
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		if to, ok := m.domains[strings.ToLower(email[i+1:])]; ok {
+			email = email[:i+1] + to
+		}
+	}
+	return name, email
+}
@@ -0,0 +1,73 @@
+package gitops
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/leocomelli/ghmgr/config"
+)
+
+// reservedNames are the device names of Windows, which no file can have,
+// with or without an extension.
+var reservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// maxPath is the length from which the paths need the long form on
+// Windows, MAX_PATH less the room of a file name for the directories.
+const maxPath = 248
+
+// ClonePath is the directory of the clone of a repository in
+// git.clone_path, a local or a network (UNC) path.
+func ClonePath(cfg config.Git, name string) string {
+	return LongPath(filepath.Join(cfg.ClonePath, SafeName(name)))
+}
+
+// SafeName makes a repository name a valid file name on every OS, so the
+// clones kept in the storage are portable: the characters Windows rejects
+// become _, as do the trailing dots and spaces it drops, and a device name
+// gets a _ before its extension.
+func SafeName(name string) string {
+	b := []rune(name)
+	for i, c := range b {
+		if c < 32 || strings.ContainsRune(`<>:"/\|?*`, c) {
+			b[i] = '_'
+		}
+	}
+	for i := len(b) - 1; i >= 0 && (b[i] == '.' || b[i] == ' '); i-- {
+		b[i] = '_'
+	}
+	safe := string(b)
+
+	base := safe
+	if i := strings.Index(safe, "."); i >= 0 {
+		base = safe[:i]
+	}
+	if reservedNames[strings.ToLower(base)] {
+		safe = base + "_" + safe[len(base):]
+	}
+	if safe == "" {
+		safe = "_"
+	}
+	return safe
+}
+
+// LongPath returns the extended-length form of a path on Windows when it
+// is longer than MAX_PATH allows, \\?\C:\... or \\?\UNC\server\share\...
+// for a network path, and the path itself on the other OSes.
+func LongPath(path string) string {
+	if runtime.GOOS != "windows" || len(path) < maxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,21 @@
+package gitops
+
+import "testing"
+
+func TestSafeName(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"api", "api"},
+		{"api.go", "api.go"},
+		{"a:b|c", "a_b_c"},
+		{"trailing. ", "trailing__"},
+		{"con", "con_"},
+		{"COM1.txt", "COM1_.txt"},
+		{"console", "console"},
+		{"", "_"},
+	}
+	for _, tt := range tests {
+		if got := SafeName(tt.name); got != tt.want {
+			t.Errorf("SafeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package gitops
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// ExpandRefSpecs lists one spec per ref of g matched by specs, one spec
+// after the other, rename giving the name of each ref on the remote when
+// set. Empty specs mean the default push of the branches.
+func ExpandRefSpecs(g *git.Repository, specs []gitconfig.RefSpec, rename func(plumbing.ReferenceName) plumbing.ReferenceName) ([]gitconfig.RefSpec, error) {
+	if len(specs) == 0 {
+		specs = []gitconfig.RefSpec{gitconfig.DefaultPushRefSpec}
+	}
+
+	var names []plumbing.ReferenceName
+	iter, err := g.References()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(r *plumbing.Reference) error {
+		if r.Type() == plumbing.HashReference {
+			names = append(names, r.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	var expanded []gitconfig.RefSpec
+	for _, s := range specs {
+		force := ""
+		if s.IsForceUpdate() {
+			force = "+"
+		}
+		for _, n := range names {
+			if !s.Match(n) {
+				continue
+			}
+			dst := s.Dst(n)
+			if rename != nil {
+				dst = rename(dst)
+			}
+			expanded = append(expanded, gitconfig.RefSpec(fmt.Sprintf("%s%s:%s", force, n, dst)))
+		}
+	}
+	return expanded, nil
+}
+
+// BatchRefSpecs splits the expanded specs into batches of at most size
+// refs, a batch never mixing the branches and the tags, so the branches go
+// before the tags and no single push exceeds the pack size limit of the
+// server.
+func BatchRefSpecs(specs []gitconfig.RefSpec, size int) [][]gitconfig.RefSpec {
+	var batches [][]gitconfig.RefSpec
+	var batch []gitconfig.RefSpec
+	namespace := ""
+	for _, s := range specs {
+		ns := refNamespace(s.Src())
+		if len(batch) == size || len(batch) > 0 && ns != namespace {
+			batches = append(batches, batch)
+			batch = nil
+		}
+		batch, namespace = append(batch, s), ns
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// refNamespace is refs/heads of refs/heads/main.
+func refNamespace(ref string) string {
+	parts := strings.SplitN(ref, "/", 3)
+	if len(parts) < 3 {
+		return ref
+	}
+	return parts[0] + "/" + parts[1]
+}
@@ -0,0 +1,123 @@
+package gitops
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/leocomelli/ghmgr/config"
+	git "gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// RefFilter selects the refs transferred in mirror mode after git.refspecs
+// or the patterns of git.branches and git.tags, matched against the short
+// names of the refs.
+type RefFilter struct {
+	specs    []gitconfig.RefSpec
+	branches []*regexp.Regexp
+	tags     []*regexp.Regexp
+}
+
+// NewRefFilter returns nil when every ref is transferred.
+func NewRefFilter(cfg config.Git) (*RefFilter, error) {
+	if !cfg.SelectsRefs() {
+		return nil, nil
+	}
+	f := &RefFilter{}
+	for _, s := range cfg.RefSpecs {
+		spec := gitconfig.RefSpec(s)
+		if err := spec.Validate(); err != nil {
+			return nil, fmt.Errorf("git.refspecs: %q: %v", s, err)
+		}
+		f.specs = append(f.specs, spec)
+	}
+	var err error
+	if f.branches, err = config.CompilePatterns(cfg.Branches); err != nil {
+		return nil, fmt.Errorf("git.branches: %v", err)
+	}
+	if f.tags, err = config.CompilePatterns(cfg.Tags); err != nil {
+		return nil, fmt.Errorf("git.tags: %v", err)
+	}
+	return f, nil
+}
+
+// Match reports whether the ref is transferred. Without git.refspecs, the
+// notes are always, the branches and the tags when their patterns are
+// empty or match them.
+func (f *RefFilter) Match(ref string) bool {
+	if f == nil {
+		return true
+	}
+	name := plumbing.ReferenceName(ref)
+	if len(f.specs) > 0 {
+		for _, s := range f.specs {
+			if s.Match(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case name.IsBranch():
+		return len(f.branches) == 0 || matchAny(f.branches, name.Short())
+	case name.IsTag():
+		return len(f.tags) == 0 || matchAny(f.tags, name.Short())
+	}
+	return strings.HasPrefix(ref, "refs/notes/")
+}
+
+func matchAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Remote lists the refs of URL the filter selects.
+func (f *RefFilter) Remote(URL string, auth transport.AuthMethod) ([]string, error) {
+	refs, err := ListRemote(URL, auth)
+	if err != nil {
+		return nil, err
+	}
+	return f.names(refs), nil
+}
+
+// Local lists the refs of the clone the filter selects, a clone kept by a
+// previous run may hold other ones.
+func (f *RefFilter) Local(g *git.Repository) ([]string, error) {
+	iter, err := g.References()
+	if err != nil {
+		return nil, err
+	}
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(r *plumbing.Reference) error {
+		refs = append(refs, r)
+		return nil
+	})
+	return f.names(refs), err
+}
+
+func (f *RefFilter) names(refs []*plumbing.Reference) []string {
+	var names []string
+	for _, r := range refs {
+		if r.Type() == plumbing.HashReference && f.Match(r.Name().String()) {
+			names = append(names, r.Name().String())
+		}
+	}
+	return names
+}
+
+// ExactRefSpecs returns one forced spec per ref, keeping its name.
+func ExactRefSpecs(refs []string) []gitconfig.RefSpec {
+	specs := make([]gitconfig.RefSpec, 0, len(refs))
+	for _, r := range refs {
+		specs = append(specs, gitconfig.RefSpec("+"+r+":"+r))
+	}
+	return specs
+}
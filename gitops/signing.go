@@ -0,0 +1,205 @@
+package gitops
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/leocomelli/ghmgr/config"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Signer signs the commits created by the tool, returning the armored
+// signature of the encoded commit.
+type Signer interface {
+	Sign(commit io.Reader) (string, error)
+}
+
+// LoadSigner reads the private key of git.signing_key, decrypted with
+// git.signing_passphrase: an armored gpg key, or an ssh key with
+// git.signing_format ssh. It is nil without git.signing_key.
+func LoadSigner(cfg config.Git) (Signer, error) {
+	if cfg.SigningKey == "" {
+		return nil, nil
+	}
+	if cfg.SigningFormat == config.SigningSSH {
+		return loadSSHSigner(cfg)
+	}
+	return loadGPGSigner(cfg)
+}
+
+type gpgSigner struct {
+	key *openpgp.Entity
+}
+
+func loadGPGSigner(cfg config.Git) (Signer, error) {
+	f, err := os.Open(cfg.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, fmt.Errorf("git.signing_key: %v", err)
+	}
+	if len(keys) == 0 || keys[0].PrivateKey == nil {
+		return nil, fmt.Errorf("git.signing_key: no private key found")
+	}
+	key := keys[0]
+	if key.PrivateKey.Encrypted {
+		if err := key.PrivateKey.Decrypt([]byte(cfg.SigningPassphrase)); err != nil {
+			return nil, fmt.Errorf("git.signing_key: %v", err)
+		}
+	}
+	return &gpgSigner{key}, nil
+}
+
+func (s *gpgSigner) Sign(commit io.Reader) (string, error) {
+	var b bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&b, s.key, commit, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// sshSigner signs in the sshsig format of ssh-keygen -Y sign, with the git
+// namespace, as git does with gpg.format ssh.
+type sshSigner struct {
+	key ssh.Signer
+}
+
+func loadSSHSigner(cfg config.Git) (Signer, error) {
+	content, err := ioutil.ReadFile(cfg.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	var key ssh.Signer
+	if cfg.SigningPassphrase != "" {
+		key, err = ssh.ParsePrivateKeyWithPassphrase(content, []byte(cfg.SigningPassphrase))
+	} else {
+		key, err = ssh.ParsePrivateKey(content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git.signing_key: %v", err)
+	}
+	return &sshSigner{key}, nil
+}
+
+const (
+	sshsigMagic     = "SSHSIG"
+	sshsigNamespace = "git"
+	sshsigHash      = "sha512"
+)
+
+func (s *sshSigner) Sign(commit io.Reader) (string, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, commit); err != nil {
+		return "", err
+	}
+
+	signed := struct {
+		Namespace string
+		Reserved  string
+		Hash      string
+		Digest    string
+	}{sshsigNamespace, "", sshsigHash, string(h.Sum(nil))}
+	data := append([]byte(sshsigMagic), ssh.Marshal(signed)...)
+
+	var sig *ssh.Signature
+	var err error
+	if a, ok := s.key.(ssh.AlgorithmSigner); ok && s.key.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = a.SignWithAlgorithm(rand.Reader, data, ssh.SigAlgoRSASHA2512)
+	} else {
+		sig, err = s.key.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	blob := struct {
+		Version   uint32
+		PublicKey string
+		Namespace string
+		Reserved  string
+		Hash      string
+		Signature string
+	}{1, string(s.key.PublicKey().Marshal()), sshsigNamespace, "", sshsigHash, string(ssh.Marshal(sig))}
+	encoded := base64.StdEncoding.EncodeToString(append([]byte(sshsigMagic), ssh.Marshal(blob)...))
+
+	var b strings.Builder
+	b.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		b.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	b.WriteString(encoded + "\n-----END SSH SIGNATURE-----\n")
+	return b.String(), nil
+}
+
+// SignCommit signs the commit, which becomes a new object: the head of the
+// repository is moved to it when it pointed to the commit. The new hash is
+// returned.
+func SignCommit(g *git.Repository, hash plumbing.Hash, signer Signer) (plumbing.Hash, error) {
+	c, err := g.CommitObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	unsigned := &plumbing.MemoryObject{}
+	if err := c.EncodeWithoutSignature(unsigned); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	r, err := unsigned.Reader()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if c.PGPSignature, err = signer.Sign(r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	obj := g.Storer.NewEncodedObject()
+	if err := c.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	signed, err := g.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	head, err := g.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if head.Hash() == hash {
+		ref := plumbing.NewHashReference(head.Name(), signed)
+		if err := g.Storer.SetReference(ref); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	return signed, nil
+}
+
+// EncodeCommit is the raw object of a commit as git encodes it, the
+// content signed for the commits of the api.
+func EncodeCommit(c *object.Commit) ([]byte, error) {
+	obj := &plumbing.MemoryObject{}
+	if err := c.EncodeWithoutSignature(obj); err != nil {
+		return nil, err
+	}
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
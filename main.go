@@ -2,305 +2,154 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
+	"flag"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
-	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/pipeline"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/oauth2"
-	git "gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/config"
-	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
-	yaml "gopkg.in/yaml.v2"
 )
 
-const (
-	fileName      = "config.yml"
-	commitMessage = "updated %s"
-)
-
-type Configuration struct {
-	Source struct {
-		URL          string
-		Token        string
-		Organization string
-		Instance     *gh.Client
-		Only         []string
-		Ignore       []string
-		Archive      bool
-		Content      struct {
-			Path    string
-			Message string
-		}
-	}
-	Target struct {
-		URL          string
-		Token        string
-		Organization string
-		Instance     *gh.Client
-	}
-	Git struct {
-		ClonePath  string `yaml:"clone_path"`
-		RemoteName string `yaml:"remote_name"`
-		CrtFile    string `yaml:"ctr_file"`
-		Author     string `yaml:"commit_author"`
-		Email      string `yaml:"commit_email"`
-	}
-}
-
-func newGithubClient(token, URL string) *gh.Client {
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}}
-	ctx := context.WithValue(oauth2.NoContext, oauth2.HTTPClient, client)
-	tc := oauth2.NewClient(ctx, ts)
+const fileName = "config.yml"
 
-	if URL == "" {
-		return gh.NewClient(tc)
-	}
-	c, err := gh.NewEnterpriseClient(URL, URL, tc)
-	if err != nil {
-		log.Fatal(err)
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ghmgr <command> [subcommand] [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range pipeline.Commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.Name, c.Description)
 	}
-	return c
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "run 'ghmgr <command> -h' to list the flags of a command")
 }
 
-func loadConfiguration(configPath string) (*Configuration, error) {
-	content, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		return nil, err
-	}
-
-	c := &Configuration{}
-	yaml.Unmarshal(content, c)
-
-	return c, nil
+// handleSignals stops the commands after the repositories in progress on
+// the first SIGINT or SIGTERM, and cancels them on the second one. Either
+// way the state file, the report and the summary are still written.
+func handleSignals() (context.Context, <-chan struct{}) {
+	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		log.WithField("signal", sig.String()).Warn("shutting down after the current repositories, interrupt again to abort them...")
+		close(stop)
+
+		sig = <-signals
+		log.WithField("signal", sig.String()).Warn("aborting the current repositories...")
+		cancel()
+	}()
+
+	return ctx, stop
 }
 
 func main() {
-	cfg, err := loadConfiguration(fileName)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	cfg.Source.Instance = newGithubClient(cfg.Source.Token, cfg.Source.URL)
-	cfg.Target.Instance = newGithubClient(cfg.Target.Token, cfg.Target.URL)
-
-	log.WithField("url", cfg.Source.URL).Warn("source github")
-	log.WithField("url", cfg.Target.URL).Warn("target github")
-
-	repos, err := listRepositoriesByOrg(cfg)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(pipeline.ExitConfig)
+	}
+
+	cmd := pipeline.FindCommand(os.Args[1])
+	if cmd == nil {
+		usage()
+		os.Exit(pipeline.ExitConfig)
+	}
+
+	// the flags only follow the subcommand, e.g. report diff
+	args, subcommand := os.Args[2:], ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		args, subcommand = args[1:], args[0]
+	}
+
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	configPath := fs.String("config", config.EnvOrDefault("GHMGR_CONFIG", fileName), "path of the configuration file or directory (GHMGR_CONFIG)")
+	profile := fs.String("profile", config.EnvOrDefault("GHMGR_PROFILE", ""), "profile of the configuration, e.g. staging (GHMGR_PROFILE)")
+	only := fs.String("only", "", "comma separated list of the only repositories to process")
+	skip := fs.String("skip", "", "comma separated list of repositories to skip")
+	limit := fs.Int("limit", 0, "process only the first N repositories, e.g. for a smoke test")
+	manifest := fs.String("manifest", "", "csv or yaml file listing the repositories to process instead of the source ones")
+	dryRun := fs.Bool("dry-run", false, "list what would be done without performing any write operation")
+	interactive := fs.Bool("interactive", false, "confirm the repositories before any write operation")
+	retryFailed := fs.Bool("retry-failed", false, "process only the repositories that failed in the previous run")
+	scheduleExpr := fs.String("schedule", "", "cron expression to run the sync repeatedly, e.g. \"0 2 * * *\"")
+	healthAddr := fs.String("health-addr", "", "address of the health endpoint in the scheduled mode, e.g. :8080")
+	metricsAddr := fs.String("metrics-addr", "", "address of the prometheus metrics endpoint, e.g. :9090")
+	deleteTargets := fs.Bool("delete-targets", false, "delete the repositories created on the target with the rollback command")
+	events := fs.String("events", "", "file the events of the steps are appended to as json lines, - for the standard output")
+	serve := fs.String("serve", "", "address of the dashboard of the migrate command or of the api of the server command, e.g. :8080")
+	force := fs.Bool("force", false, "do not ask for the confirmation of the unmigrate command")
+	confirm := fs.String("confirm", "", "token confirming the destructive operations, as printed by the plan or a previous run")
+	breakLock := fs.Bool("break-lock", false, "remove the lock of the target organization held by another run")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error")
+	logFormat := fs.String("log-format", "", "log format: text or json")
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		os.Exit(pipeline.ExitSucceeded)
+	} else if err != nil {
+		os.Exit(pipeline.ExitConfig)
+	}
+
+	cfg, err := config.Load(*configPath, *profile)
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	log.WithField("amount", len(repos)).Info("some repositories was found")
-	log.WithField("names", cfg.Source.Ignore).Info("ignoring some repositories")
-	log.WithField("names", cfg.Source.Only).Info("only this repositories")
-
-	for i, repo := range repos {
-		log.WithField("name", *repo.Name).WithField("index", fmt.Sprintf("%d/%d", i+1, len(repos))).
-			Info("processing a repository")
-
-		r, err := createRepo(cfg, repo)
-		if err != nil {
-			log.Error(err)
-			continue
-		}
-
-		err = cloneAndPush(cfg, repo, *r.SSHURL)
-		if err != nil {
-			log.Error(err)
-			continue
-		}
-
-		if cfg.Source.Content.Path != "" {
-			err := updateContent(cfg, r)
-			if err != nil {
-				log.Error(err)
-			}
-		}
-
-		if cfg.Source.Archive {
-			archiveRepo(cfg, repo)
-			if err != nil {
-				log.Error(err)
-			}
-		}
-		log.Info("done =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-")
+		fail(&pipeline.ConfigError{Err: err})
 	}
-}
-
-func contains(sl []string, v string) bool {
-	for _, vv := range sl {
-		if vv == v {
-			return true
-		}
-	}
-	return false
-}
 
-func listRepositoriesByOrg(cfg *Configuration) ([]*gh.Repository, error) {
-	source := cfg.Source
-	opts := &gh.RepositoryListByOrgOptions{
-		ListOptions: gh.ListOptions{PerPage: 30},
+	if *logLevel != "" {
+		cfg.Log.Level = *logLevel
 	}
-
-	var candidates []*gh.Repository
-	for {
-		repos, resp, err := source.Instance.Repositories.ListByOrg(context.Background(), source.Organization, opts)
-
-		if err != nil {
-			return nil, err
-		}
-		candidates = append(candidates, repos...)
-		if resp.NextPage == 0 {
-			break
-		}
-		opts.Page = resp.NextPage
+	if *logFormat != "" {
+		cfg.Log.Format = *logFormat
 	}
-
-	var allRepos []*gh.Repository
-	for _, r := range candidates {
-
-		if len(cfg.Source.Only) > 0 {
-			if contains(cfg.Source.Only, *r.Name) {
-				allRepos = append(allRepos, r)
-			}
-			// Only and Ignore does not work together
-			continue
-		}
-
-		if !contains(cfg.Source.Ignore, *r.Name) {
-			allRepos = append(allRepos, r)
-		}
+	if err := pipeline.SetupLogging(cfg); err != nil {
+		fail(&pipeline.ConfigError{Err: err})
 	}
+	ctx, stop := handleSignals()
 
-	return allRepos, nil
-}
-
-func createRepo(cfg *Configuration, repo *gh.Repository) (*gh.Repository, error) {
-	ctx := context.Background()
-
-	opts := &gh.Repository{
-		Name:             repo.Name,
-		Description:      repo.Description,
-		Homepage:         repo.Homepage,
-		Private:          repo.Private,
-		HasIssues:        gh.Bool(false),
-		HasProjects:      gh.Bool(false),
-		HasWiki:          gh.Bool(false),
-		AllowRebaseMerge: gh.Bool(false),
-		AllowSquashMerge: gh.Bool(false),
+	if *dryRun {
+		cfg.DryRun = true
 	}
-
-	r, _, err := cfg.Target.Instance.Repositories.Create(ctx, cfg.Target.Organization, opts)
-	if err != nil {
-		return nil, err
+	if *only != "" {
+		cfg.Source.Only = strings.Split(*only, ",")
 	}
-
-	log.WithField("url", *r.URL).Info("a new repository was created successfully")
-
-	return r, nil
-}
-
-func cloneAndPush(cfg *Configuration, source *gh.Repository, targetURL string) error {
-
-	log.WithField("file", cfg.Git.CrtFile).Info("using the public key...")
-	auth, err := ssh.NewPublicKeysFromFile("git", cfg.Git.CrtFile, "")
-	if err != nil {
-		return err
+	if *skip != "" {
+		cfg.Source.Ignore = append(cfg.Source.Ignore, strings.Split(*skip, ",")...)
 	}
-
-	log.WithField("url", *source.SSHURL).Info("cloning the repository...")
-
-	g, err := git.PlainClone(fmt.Sprintf("%s/%s", cfg.Git.ClonePath, *source.Name), true, &git.CloneOptions{
-		URL:  *source.SSHURL,
-		Auth: auth,
-	})
-
-	if err != nil {
-		return err
+	if *limit > 0 {
+		cfg.Source.Limit = *limit
 	}
-
-	log.WithField("remote", targetURL).Info("adding a new remote...")
-
-	_, err = g.CreateRemote(&config.RemoteConfig{
-		Name: cfg.Git.RemoteName,
-		URLs: []string{targetURL},
-	})
-	if err != nil {
-		return err
+	if *manifest != "" {
+		cfg.ManifestFile = *manifest
 	}
 
-	log.WithField("remote", targetURL).Info("pushing to the new remote...")
-
-	err = g.Push(&git.PushOptions{
-		RemoteName: cfg.Git.RemoteName,
-		Auth:       auth,
+	err = pipeline.Execute(ctx, cfg, pipeline.Options{
+		Command:       cmd.Name,
+		RetryFailed:   *retryFailed,
+		Interactive:   *interactive,
+		Schedule:      *scheduleExpr,
+		HealthAddr:    *healthAddr,
+		MetricsAddr:   *metricsAddr,
+		DeleteTargets: *deleteTargets,
+		Force:         *force,
+		Confirm:       *confirm,
+		BreakLock:     *breakLock,
+		Serve:         *serve,
+		Events:        *events,
+		Subcommand:    subcommand,
+		Stop:          stop,
 	})
 	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func updateContent(cfg *Configuration, repo *gh.Repository) error {
-	ctx := context.Background()
-	source := cfg.Source
-
-	c, _, _, err := source.Instance.Repositories.GetContents(ctx, source.Organization, *repo.Name, source.Content.Path, &gh.RepositoryContentGetOptions{})
-	if err != nil {
-		return err
-	}
-
-	content, err := c.GetContent()
-	if err != nil {
-		return err
-	}
-
-	log.WithField("filename", source.Content.Path).Info("updating the content...")
-
-	newMessage := strings.Replace(source.Content.Message, "{{url}}", *repo.HTMLURL, -1)
-
-	repositoryContentsOptions := &gh.RepositoryContentFileOptions{
-		Message:   gh.String(fmt.Sprintf(commitMessage, source.Content.Path)),
-		Content:   []byte(fmt.Sprintf("%s<br><br>%s", newMessage, content)),
-		SHA:       gh.String(c.GetSHA()),
-		Committer: &gh.CommitAuthor{Name: gh.String(cfg.Git.Author), Email: gh.String(cfg.Git.Email)},
-	}
-
-	_, _, err = source.Instance.Repositories.UpdateFile(ctx, source.Organization, *repo.Name, source.Content.Path, repositoryContentsOptions)
-	if err != nil {
-		log.Fatal(err)
+		fail(err)
 	}
-
-	return nil
 }
 
-func archiveRepo(cfg *Configuration, repo *gh.Repository) error {
-	ctx := context.Background()
-	source := cfg.Source
-
-	opts := &gh.Repository{
-		Archived: gh.Bool(true),
-	}
-
-	log.WithField("name", *repo.Name).Info("archiving the repository...")
-
-	_, _, err := source.Instance.Repositories.Edit(ctx, source.Organization, *repo.Name, opts)
-	if err != nil {
-		return err
-	}
-
-	return nil
+// fail logs the error and exits with its code: 2 when some repositories
+// failed, 3 for a wrong configuration, 1 otherwise.
+func fail(err error) {
+	log.Error(err)
+	os.Exit(pipeline.ExitCode(err))
 }
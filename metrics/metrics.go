@@ -0,0 +1,156 @@
+// Package metrics exposes the counters of the runs in the prometheus text
+// format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Metric is a family of counters, gauges or histograms in the prometheus
+// text format, each series identified by its label values.
+type Metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]float64
+	counts map[string][]uint64
+	sums   map[string]float64
+}
+
+var durationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+var (
+	Repos = &Metric{name: "ghmgr_repositories_total", kind: "counter", labels: []string{"status"},
+		help: "Repositories processed, by final status."}
+	APIRequests = &Metric{name: "ghmgr_api_requests_total", kind: "counter", labels: []string{"instance", "code"},
+		help: "Requests sent to the GitHub API."}
+	RateLimitRemaining = &Metric{name: "ghmgr_rate_limit_remaining", kind: "gauge", labels: []string{"instance"},
+		help: "Requests left in the current rate limit window."}
+	GitDuration = &Metric{name: "ghmgr_git_duration_seconds", kind: "histogram", labels: []string{"operation"},
+		help: "Duration of the git clones, fetches and pushes.", buckets: durationBuckets}
+
+	all = []*Metric{Repos, APIRequests, RateLimitRemaining, GitDuration}
+)
+
+func (m *Metric) key(values []string) string {
+	pairs := make([]string, len(m.labels))
+	for i, l := range m.labels {
+		pairs[i] = fmt.Sprintf("%s=%q", l, values[i])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *Metric) Add(v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.values == nil {
+		m.values = map[string]float64{}
+	}
+	m.values[m.key(labels)] += v
+}
+
+func (m *Metric) Set(v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.values == nil {
+		m.values = map[string]float64{}
+	}
+	m.values[m.key(labels)] = v
+}
+
+func (m *Metric) Observe(v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counts == nil {
+		m.counts, m.sums = map[string][]uint64{}, map[string]float64{}
+	}
+	k := m.key(labels)
+	if _, ok := m.counts[k]; !ok {
+		m.counts[k] = make([]uint64, len(m.buckets)+1)
+	}
+	for i, b := range m.buckets {
+		if v <= b {
+			m.counts[k][i]++
+		}
+	}
+	m.counts[k][len(m.buckets)]++
+	m.sums[k] += v
+}
+
+func (m *Metric) Since(start time.Time, labels ...string) {
+	m.Observe(time.Since(start).Seconds(), labels...)
+}
+
+func series(name, labels, extra string) string {
+	switch {
+	case labels == "" && extra == "":
+		return name
+	case labels == "":
+		return name + "{" + extra + "}"
+	case extra == "":
+		return name + "{" + labels + "}"
+	}
+	return name + "{" + labels + "," + extra + "}"
+}
+
+func (m *Metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	var keys []string
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	for k := range m.counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if m.kind != "histogram" {
+			fmt.Fprintf(w, "%s %g\n", series(m.name, k, ""), m.values[k])
+			continue
+		}
+		counts := m.counts[k]
+		for i, b := range m.buckets {
+			fmt.Fprintf(w, "%s %d\n", series(m.name+"_bucket", k, fmt.Sprintf("le=%q", fmt.Sprint(b))), counts[i])
+		}
+		fmt.Fprintf(w, "%s %d\n", series(m.name+"_bucket", k, `le="+Inf"`), counts[len(m.buckets)])
+		fmt.Fprintf(w, "%s %g\n", series(m.name+"_sum", k, ""), m.sums[k])
+		fmt.Fprintf(w, "%s %d\n", series(m.name+"_count", k, ""), counts[len(m.buckets)])
+	}
+}
+
+// Handler serves the metrics.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range all {
+		m.write(w)
+	}
+}
+
+// Serve serves the metrics on addr/metrics in the background.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", Handler)
+	go func() {
+		log.WithField("addr", addr).Info("serving the metrics endpoint")
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.WithError(err).Error("the metrics endpoint stopped")
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/leocomelli/ghmgr/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// the keys of the files kept in storage.s3
+const (
+	stateKey  = "state/%s"
+	reportKey = "reports/%s"
+	cloneKey  = "clones/%s.tar.gz"
+)
+
+// restoreFile downloads the state file or the report of a previous run,
+// on another runner, when there is no local one.
+func restoreFile(cfg *migration, key, path string) error {
+	if cfg.artifacts == nil || path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return nil
+	}
+	found, err := cfg.artifacts.Get(cfg.runContext(), fmt.Sprintf(key, filepath.Base(path)), path)
+	if err != nil {
+		return fmt.Errorf("restoring %s: %v", path, err)
+	}
+	if found {
+		log.WithField("file", path).Info("the file was restored from the storage")
+	}
+	return nil
+}
+
+// storeFile uploads the state file or the report, a failure is only
+// logged as the local file is still there.
+func storeFile(cfg *migration, key, path string) {
+	if cfg.artifacts == nil || path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	cfg.artifactsMu.Lock()
+	defer cfg.artifactsMu.Unlock()
+
+	k := fmt.Sprintf(key, filepath.Base(path))
+	if err := cfg.artifacts.Put(cfg.runContext(), k, path); err != nil {
+		log.WithField("file", path).WithError(err).Warn("the file could not be stored")
+	}
+}
+
+// restoreClone extracts the clone stored by a previous run into path when
+// there is no local one, so it is updated instead of cloned again. It
+// reports whether the clone was restored.
+func restoreClone(cfg *migration, path string, l *log.Entry) bool {
+	if cfg.artifacts == nil || !cfg.Storage.Clones {
+		return false
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return false
+	}
+	found, err := storage.GetDir(cfg.runContext(), cfg.artifacts, fmt.Sprintf(cloneKey, filepath.Base(path)), path)
+	if err != nil {
+		l.WithError(err).Warn("the clone could not be restored from the storage, cloning again")
+		return false
+	}
+	if found {
+		l.WithField("path", path).Info("the clone was restored from the storage")
+	}
+	return found
+}
+
+// storeClone uploads the clone at path before it is cleaned up, the clones
+// in memory are not stored.
+func storeClone(cfg *migration, path string, l *log.Entry) {
+	if cfg.artifacts == nil || !cfg.Storage.Clones {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	key := fmt.Sprintf(cloneKey, filepath.Base(path))
+	if err := storage.PutDir(cfg.runContext(), cfg.artifacts, key, path); err != nil {
+		l.WithError(err).Warn("the clone could not be stored")
+		return
+	}
+	l.WithField("location", cfg.artifacts.Location(key)).Info("the clone was stored")
+}
@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	attributionHeader = "> originally created by @%s on %s (%s)\n\n%s"
+	// the placeholder accounts keep the origin out of sight, for the tools
+	// reclaiming them
+	attributionMarker = "%s\n\n<!-- originally created by @%s on %s (%s) -->"
+)
+
+// the source url of an attribution header, or of a marker ending the body
+var (
+	attributionHeaderURL = regexp.MustCompile(`^> originally created by @\S+ on \S+ \((.+?)\)\n`)
+	attributionMarkerURL = regexp.MustCompile(`<!-- originally created by @\S+ on \S+ \((.+?)\) -->$`)
+)
+
+// attributionClients are the target clients posting on behalf of each
+// source login, authenticated with the token of its account on the target
+// or of a placeholder account created for it.
+type attributionClients map[string]*gh.Client
+
+// loadAttribution reads migrate.attribution_tokens, a map of source logins
+// to target tokens.
+func loadAttribution(cfg *migration) (attributionClients, error) {
+	content, err := ioutil.ReadFile(cfg.Migrate.AttributionTokens)
+	if err != nil {
+		return nil, err
+	}
+	tokens := map[string]string{}
+	if err := yaml.UnmarshalStrict(content, &tokens); err != nil {
+		return nil, err
+	}
+
+	clients := attributionClients{}
+	for login, token := range tokens {
+		c, _, err := github.NewClient(targetEndpoint(cfg), token, config.AppAuth{}, apiHTTPClient(cfg, "target", cfg.Target.Transport))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", login, err)
+		}
+		clients[login] = c
+	}
+	return clients, nil
+}
+
+// attribute returns the client creating an issue, pull request or comment
+// of login and its body. With the placeholder attribution, the accounts of
+// migrate.attribution_tokens post as themselves, the origin being kept in a
+// hidden marker; everything else is posted by the target token with an
+// attribution header. The references to the source are rewritten with
+// migrate.rewrite_references, then migrate.scrub redacts the body, the
+// origin included.
+func attribute(cfg *migration, login string, created time.Time, URL, body string) (*gh.Client, string) {
+	return attributeWith(cfg, login, created, URL, body, "")
+}
+
+// attributeWith is attribute with extra appended to the body as is, the
+// references being rewritten before, e.g. for links kept on the source.
+func attributeWith(cfg *migration, login string, created time.Time, URL, body, extra string) (*gh.Client, string) {
+	body = rewriteReferences(cfg, URL, body) + extra
+	date := created.Format("2006-01-02")
+	if c, ok := cfg.attribution[login]; ok {
+		return c, cfg.scrubber.scrub(fmt.Sprintf(attributionMarker, body, login, date, URL))
+	}
+	return cfg.Target.Instance, cfg.scrubber.scrub(fmt.Sprintf(attributionHeader, login, date, URL, body))
+}
+
+// attributedURL is the url of the source item an attributed body was posted
+// for, as migrate.scrub left it, empty for a body posted otherwise.
+func attributedURL(body string) string {
+	if m := attributionHeaderURL.FindStringSubmatch(body); m != nil {
+		return m[1]
+	}
+	if m := attributionMarkerURL.FindStringSubmatch(body); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// attributionURL is the source url of the attribution the item of login
+// created at URL is posted with, as attributedURL finds it.
+func attributionURL(cfg *migration, login string, created time.Time, URL string) string {
+	_, body := attribute(cfg, login, created, URL, "")
+	return attributedURL(body)
+}
@@ -0,0 +1,221 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/gitops"
+	log "github.com/sirupsen/logrus"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// auditEntry is a line of the audit log: a write of the api or a push,
+// along with what undoing it requires.
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	Side       string    `json:"side"`
+	Actor      string    `json:"actor,omitempty"`
+	Action     string    `json:"action"`
+	URL        string    `json:"url"`
+	Status     int       `json:"status,omitempty"`
+	Repository string    `json:"repository,omitempty"`
+	// Correlation is the id of the attempt of the repository the write
+	// belongs to
+	Correlation string `json:"correlation_id,omitempty"`
+	// Resource is the api url of the created or changed resource, ID its
+	// id
+	Resource string `json:"resource,omitempty"`
+	ID       int64  `json:"id,omitempty"`
+	// SHA is the one of the commit or of the file written, PreviousSHA the
+	// one of the file replaced
+	SHA         string                 `json:"sha,omitempty"`
+	PreviousSHA string                 `json:"previous_sha,omitempty"`
+	Changes     map[string]interface{} `json:"changes,omitempty"`
+	// Refs are the refs pushed with their hash
+	Refs map[string]string `json:"refs,omitempty"`
+}
+
+// auditLog appends the entries to audit_log as json, one per line. A nil
+// value silently ignores every call, as the event stream.
+type auditLog struct {
+	mu     sync.Mutex
+	file   *os.File
+	actors map[string]string
+	redact func(string) string
+}
+
+// openAudit opens audit_log, appended to by every run, and resolves the
+// accounts acting on each side. It is nil without audit_log.
+func openAudit(cfg *migration) (*auditLog, error) {
+	if cfg.AuditLog == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(cfg.AuditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	a := &auditLog{file: f, actors: map[string]string{}, redact: cfg.redactor.redact}
+	if cfg.Source.Type == "" || cfg.Source.Type == config.SourceGitHub {
+		a.actors["source"] = auditActor(cfg, cfg.Source.Instance, cfg.Source.App)
+	}
+	if cfg.Target.Type == "" || cfg.Target.Type == config.TargetGitHub {
+		a.actors["target"] = auditActor(cfg, cfg.Target.Instance, cfg.Target.App)
+	}
+	return a, nil
+}
+
+// auditActor is the login of the token, or the app of an installation,
+// which has no user.
+func auditActor(cfg *migration, client *gh.Client, app config.AppAuth) string {
+	if app.Enabled() {
+		return fmt.Sprintf("app/%d", app.ID)
+	}
+	u, _, err := client.Users.Get(cfg.runContext(), "")
+	if err != nil {
+		log.WithError(err).Warn("the account of the token is not known, the audit entries will not tell it")
+		return ""
+	}
+	return u.GetLogin()
+}
+
+func (a *auditLog) write(e auditEntry) {
+	if a == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.Actor = a.actors[e.Side]
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append([]byte(a.redact(string(b))), '\n')); err != nil {
+		log.WithError(err).Warn("the audit entry could not be written")
+	}
+}
+
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// repoPath finds the repository of the api urls under /repos.
+var repoPath = regexp.MustCompile(`/repos/([^/]+/[^/]+)`)
+
+// auditedFields are the fields of the request bodies recorded as the
+// changes, the booleans being recorded too, e.g. archived.
+var auditedFields = []string{"name", "default_branch", "visibility"}
+
+// auditTransport records the successful writes of an instance to the audit
+// log of the run.
+type auditTransport struct {
+	cfg  *migration
+	side string
+	base http.RoundTripper
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cfg.audit == nil || req.Method == "GET" || req.Method == "HEAD" || req.Method == "OPTIONS" {
+		return t.base.RoundTrip(req)
+	}
+
+	var body map[string]interface{}
+	if req.GetBody != nil {
+		if r, err := req.GetBody(); err == nil {
+			json.NewDecoder(r).Decode(&body)
+			r.Close()
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, err
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(content))
+
+	e := auditEntry{Side: t.side, Action: req.Method, URL: req.URL.String(), Status: resp.StatusCode, Correlation: correlationOf(req.Context())}
+	if m := repoPath.FindStringSubmatch(req.URL.Path); m != nil {
+		e.Repository = m[1]
+	}
+	var res struct {
+		ID       int64  `json:"id"`
+		SHA      string `json:"sha"`
+		URL      string `json:"url"`
+		FullName string `json:"full_name"`
+		Commit   struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	if json.Unmarshal(content, &res) == nil {
+		e.Resource, e.ID = res.URL, res.ID
+		if e.Repository == "" {
+			e.Repository = res.FullName
+		}
+		e.SHA = res.SHA
+		if res.Commit.SHA != "" {
+			e.SHA = res.Commit.SHA
+		}
+	}
+	if sha, ok := body["sha"].(string); ok && (req.Method == "PUT" || req.Method == "DELETE") {
+		e.PreviousSHA = sha
+	}
+	for k, v := range body {
+		if _, ok := v.(bool); ok || contains(auditedFields, k) {
+			if e.Changes == nil {
+				e.Changes = map[string]interface{}{}
+			}
+			e.Changes[k] = v
+		}
+	}
+	t.cfg.audit.write(e)
+	return resp, nil
+}
+
+// auditPush records a successful push of opts to the remote of a
+// repository, given with its owner.
+func auditPush(cfg *migration, side, repo string, g *git.Repository, opts *git.PushOptions) {
+	if cfg.audit == nil {
+		return
+	}
+	name := opts.RemoteName
+	if name == "" {
+		name = git.DefaultRemoteName
+	}
+	var URL string
+	if r, err := g.Remote(name); err == nil && len(r.Config().URLs) > 0 {
+		URL = r.Config().URLs[0]
+	}
+
+	expanded, err := gitops.ExpandRefSpecs(g, opts.RefSpecs, nil)
+	if err != nil {
+		log.WithError(err).Warn("listing the refs pushed for the audit log")
+	}
+	refs := map[string]string{}
+	for _, s := range expanded {
+		src := plumbing.ReferenceName(s.Src())
+		if r, err := g.Reference(src, true); err == nil {
+			refs[s.Dst(src).String()] = r.Hash().String()
+		}
+	}
+	cfg.audit.write(auditEntry{Side: side, Action: "PUSH", URL: URL, Repository: repo, Correlation: correlationOf(cfg.runContext()), Refs: refs})
+}
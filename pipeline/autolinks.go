@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// autolink is an autolink reference of a repository, e.g. JIRA- linking
+// JIRA-123 to the issue tracker, go-github does not know them yet.
+type autolink struct {
+	KeyPrefix      string `json:"key_prefix"`
+	URLTemplate    string `json:"url_template"`
+	IsAlphanumeric *bool  `json:"is_alphanumeric,omitempty"`
+}
+
+func migrateAutolinks(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	var links []autolink
+	for page := 1; ; page++ {
+		var ll []autolink
+		resp, err := github.Request(ctx, cfg.Source.Instance, "GET", fmt.Sprintf("repos/%s/%s/autolinks?per_page=100&page=%d", cfg.Source.Organization, *source.Name, page), "", nil, &ll)
+		if err != nil {
+			return err
+		}
+		links = append(links, ll...)
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+
+	l.WithField("amount", len(links)).Info("migrating the autolinks...")
+
+	for _, a := range links {
+		resp, err := github.Request(ctx, cfg.Target.Instance, "POST", fmt.Sprintf("repos/%s/%s/autolinks", cfg.Target.Organization, *target.Name), "", a, nil)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+				l.WithField("key_prefix", a.KeyPrefix).Info("the autolink already exists, skipping")
+				continue
+			}
+			return fmt.Errorf("autolink %s: %v", a.KeyPrefix, err)
+		}
+
+		l.WithField("key_prefix", a.KeyPrefix).WithField("url_template", a.URLTemplate).Info("an autolink was migrated successfully")
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// targetBranch is the name of a source branch on the target, according to
+// git.branch_map.
+func targetBranch(cfg *migration, branch string) string {
+	if b, ok := cfg.Git.BranchMap[branch]; ok {
+		return b
+	}
+	return branch
+}
+
+// targetRef is the name of a source ref on the target, only the branches
+// being renamed.
+func targetRef(cfg *migration, ref string) string {
+	n := plumbing.ReferenceName(ref)
+	if !n.IsBranch() {
+		return ref
+	}
+	return plumbing.NewBranchReferenceName(targetBranch(cfg, n.Short())).String()
+}
+
+// renameRef renames the pushed refs with git.branch_map, nil without it.
+func renameRef(cfg *migration) func(plumbing.ReferenceName) plumbing.ReferenceName {
+	if len(cfg.Git.BranchMap) == 0 {
+		return nil
+	}
+	return func(n plumbing.ReferenceName) plumbing.ReferenceName {
+		return plumbing.ReferenceName(targetRef(cfg, n.String()))
+	}
+}
+
+// alignDefaultBranch makes the default branch of the source, renamed by
+// git.branch_map, the default one of the target once pushed: the target
+// takes the first branch pushed otherwise.
+func alignDefaultBranch(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	if source.GetDefaultBranch() == "" {
+		return nil
+	}
+	if !cfg.refs.Match("refs/heads/" + source.GetDefaultBranch()) {
+		l.WithField("default_branch", source.GetDefaultBranch()).Warn("the default branch is not selected by git.branches, the target keeps its own")
+		return nil
+	}
+	branch := targetBranch(cfg, source.GetDefaultBranch())
+	if err := cfg.Target.Provider.SetDefaultBranch(cfg.runContext(), *target.Name, branch); err != nil {
+		return fmt.Errorf("setting the default branch %s: %v", branch, err)
+	}
+	target.DefaultBranch = gh.String(branch)
+	l.WithField("default_branch", branch).Info("the default branch was set")
+	return nil
+}
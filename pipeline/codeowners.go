@@ -0,0 +1,235 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// the locations of the CODEOWNERS file, in the order GitHub looks for them
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// ownerResolver maps the owners of a CODEOWNERS file to the target and
+// checks that each of them exists there, the lookups being cached for the
+// repository.
+type ownerResolver struct {
+	cfg      *migration
+	resolved map[string]bool
+}
+
+func newOwnerResolver(cfg *migration) *ownerResolver {
+	return &ownerResolver{cfg: cfg, resolved: map[string]bool{}}
+}
+
+// mapOwner returns the owner as it must be written on the target: the
+// users of the user_map and the teams of the source organization are
+// mapped, the emails and the teams of other organizations are kept.
+func (o *ownerResolver) mapOwner(owner string) string {
+	if !strings.HasPrefix(owner, "@") {
+		return owner
+	}
+	name := owner[1:]
+	if i := strings.Index(name, "/"); i >= 0 {
+		if !strings.EqualFold(name[:i], o.cfg.Source.Organization) {
+			return owner
+		}
+		return "@" + o.cfg.Target.Organization + "/" + mapTeam(o.cfg, name[i+1:])
+	}
+	return "@" + mapUser(o.cfg, name)
+}
+
+// exists reports whether the mapped owner is a user or a team of the target
+// organization. The emails cannot be checked and are considered resolved.
+func (o *ownerResolver) exists(owner string) (bool, error) {
+	if !strings.HasPrefix(owner, "@") {
+		return true, nil
+	}
+	if ok, found := o.resolved[owner]; found {
+		return ok, nil
+	}
+
+	ctx := o.cfg.runContext()
+	name := owner[1:]
+	var resp *gh.Response
+	var err error
+	if i := strings.Index(name, "/"); i >= 0 {
+		if !strings.EqualFold(name[:i], o.cfg.Target.Organization) {
+			o.resolved[owner] = false
+			return false, nil
+		}
+		resp, err = github.Request(ctx, o.cfg.Target.Instance, "GET", fmt.Sprintf("orgs/%s/teams/%s", o.cfg.Target.Organization, name[i+1:]), "", nil, &gh.Team{})
+	} else {
+		_, resp, err = o.cfg.Target.Instance.Users.Get(ctx, name)
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		o.resolved[owner] = false
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	o.resolved[owner] = true
+	return true, nil
+}
+
+// codeownersLine splits a line of a CODEOWNERS file into its pattern and
+// its owners, both empty for the blank and comment lines.
+func codeownersLine(line string) (string, []string) {
+	if i := strings.Index(line, "#"); i >= 0 && (i == 0 || line[i-1] != '\\') {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+// rewrite maps the owners of content, keeping the patterns, comments and
+// spacing of the lines left unchanged.
+func (o *ownerResolver) rewrite(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		_, owners := codeownersLine(line)
+		for _, owner := range owners {
+			if mapped := o.mapOwner(owner); mapped != owner {
+				line = replaceField(line, owner, mapped)
+			}
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replaceField replaces the whitespace separated field from of line.
+func replaceField(line, from, to string) string {
+	fields := strings.SplitAfter(line, " ")
+	for i, f := range fields {
+		if strings.TrimRight(f, " \t") == from {
+			fields[i] = to + f[len(from):]
+		}
+	}
+	return strings.Join(fields, "")
+}
+
+// unresolved returns the owners of content, already mapped, that do not
+// exist on the target, in the order of the file.
+func (o *ownerResolver) unresolved(content string) ([]string, error) {
+	var missing []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(content, "\n") {
+		_, owners := codeownersLine(line)
+		for _, owner := range owners {
+			mapped := o.mapOwner(owner)
+			if seen[mapped] {
+				continue
+			}
+			seen[mapped] = true
+			ok, err := o.exists(mapped)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", mapped, err)
+			}
+			if !ok {
+				missing = append(missing, mapped)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// getCodeowners returns the first CODEOWNERS file found on ref, nil when
+// the repository has none.
+func getCodeowners(cfg *migration, client *gh.Client, owner, repo, ref string) (*gh.RepositoryContent, string, error) {
+	opts := &gh.RepositoryContentGetOptions{Ref: ref}
+	for _, file := range codeownersPaths {
+		c, _, resp, err := client.Repositories.GetContents(cfg.runContext(), owner, repo, file, opts)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if c == nil {
+			continue
+		}
+		content, err := c.GetContent()
+		return c, content, err
+	}
+	return nil, "", nil
+}
+
+func reportUnresolvedOwners(cfg *migration, repo string, owners []string, l *log.Entry) {
+	for _, owner := range owners {
+		cfg.Results.UnresolvedOwner(repo, owner)
+		l.WithField("owner", owner).Warn("the code owner does not exist on the target, the rules using it will be ignored")
+	}
+}
+
+// migrateCodeowners maps the users and teams of the CODEOWNERS file of the
+// target default branch with a follow-up commit, then reports the owners
+// that do not exist on the target.
+func migrateCodeowners(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	// the default branch is only known once pushed
+	target, err := cfg.Target.Provider.Get(ctx, *target.Name)
+	if err != nil {
+		return err
+	}
+	c, content, err := getCodeowners(cfg, cfg.Target.Instance, cfg.Target.Organization, *target.Name, target.GetDefaultBranch())
+	if err != nil || c == nil {
+		return err
+	}
+
+	o := newOwnerResolver(cfg)
+	if rewritten := o.rewrite(content); rewritten != content {
+		file := c.GetPath()
+		message, err := commitMessage(cfg, config.CommitCodeowners, []string{file}, source, target)
+		if err != nil {
+			return err
+		}
+		options := fileOptions(cfg, message, []byte(rewritten), c.GetSHA(), target.GetDefaultBranch())
+		if err := commitFile(cfg, cfg.Target.Instance, cfg.Target.Organization, *target.Name, file, options); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		l.WithField("filename", file).Info("the code owners were rewritten successfully")
+	}
+
+	missing, err := o.unresolved(content)
+	if err != nil {
+		return err
+	}
+	reportUnresolvedOwners(cfg, *source.Name, missing, l)
+	return nil
+}
+
+// planCodeowners reports the owners of the CODEOWNERS file of the source
+// that would not exist on the target, so they can be created or mapped
+// before the migration.
+func planCodeowners(cfg *migration, repo *gh.Repository, l *log.Entry) {
+	c, content, err := getCodeowners(cfg, cfg.Source.Instance, cfg.Source.Organization, *repo.Name, repo.GetDefaultBranch())
+	if err != nil {
+		l.WithError(err).Error("[plan] the code owners could not be read")
+		return
+	}
+	if c == nil {
+		return
+	}
+
+	missing, err := newOwnerResolver(cfg).unresolved(content)
+	if err != nil {
+		l.WithError(err).Error("[plan] the code owners could not be checked")
+		return
+	}
+	l = l.WithField("filename", c.GetPath())
+	for _, owner := range missing {
+		cfg.Results.UnresolvedOwner(*repo.Name, owner)
+		l.WithField("owner", owner).Warn("[plan] the code owner would not exist on the target")
+	}
+	l.WithField("unresolved", len(missing)).Info("[plan] the code owners would be rewritten")
+}
@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+func collaboratorPermission(u *gh.User) string {
+	if u.Permissions == nil {
+		return "pull"
+	}
+	p := *u.Permissions
+	switch {
+	case p["admin"]:
+		return "admin"
+	case p["push"]:
+		return "push"
+	}
+	return "pull"
+}
+
+// listCollaborators returns the direct collaborators of the source
+// repository along with their permissions.
+func listCollaborators(cfg *migration, source *gh.Repository) ([]*gh.User, error) {
+	opts := &gh.ListCollaboratorsOptions{
+		Affiliation: "direct",
+		ListOptions: gh.ListOptions{PerPage: 100},
+	}
+
+	var users []*gh.User
+	for {
+		uu, resp, err := cfg.Source.Instance.Repositories.ListCollaborators(cfg.runContext(), cfg.Source.Organization, *source.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, uu...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return users, nil
+}
+
+// keepUnmappedLogin tells whether the collaborators missing from user_map
+// are added with their source login: on the same instance, where it is the
+// same person, or with migrate.unmapped_logins.
+func keepUnmappedLogin(cfg *migration) bool {
+	if cfg.Migrate.UnmappedLogins {
+		return true
+	}
+	return strings.EqualFold(strings.TrimSuffix(cfg.Source.URL, "/"), strings.TrimSuffix(cfg.Target.URL, "/"))
+}
+
+func migrateCollaborators(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	users, err := listCollaborators(cfg, source)
+	if err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(users)).Info("migrating the collaborators...")
+
+	var failed []string
+	for _, u := range users {
+		login, mapped := lookupUser(cfg, u.GetLogin())
+		if !mapped {
+			cfg.Results.Unmapped(*source.Name, u.GetLogin())
+			if !keepUnmappedLogin(cfg) {
+				l.WithField("user", u.GetLogin()).Warn("the user is not in the user_map, the collaborator was not added")
+				continue
+			}
+			l.WithField("user", u.GetLogin()).Warn("the user is not in the user_map, using the same login on the target")
+		}
+
+		permission := collaboratorPermission(u)
+		_, err := cfg.Target.Instance.Repositories.AddCollaborator(ctx, cfg.Target.Organization, *target.Name, login, &gh.RepositoryAddCollaboratorOptions{
+			Permission: permission,
+		})
+		if err != nil {
+			l.WithField("user", login).WithError(err).Warn("the collaborator could not be added")
+			failed = append(failed, login)
+			continue
+		}
+
+		l.WithField("user", login).WithField("permission", permission).Info("a collaborator was added successfully")
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d collaborators could not be added: %v", len(failed), failed)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Command is one of the commands of the command line, each running on the
+// repositories selected by the source filters. The server command has no
+// run, each of its migrations listing its own repositories.
+type Command struct {
+	Name        string
+	Description string
+	run         func(cfg *migration, repos []*gh.Repository) error
+}
+
+// Commands are the commands accepted by Execute.
+var Commands = []*Command{
+	{"plan", "list what would be migrated without performing any write operation", runPlan},
+	{"doctor", "check the tokens, the git credentials of both sides and the clone path before a migration", runDoctor},
+	{"estimate", "predict the api calls, the data transferred and the duration of the migration, with the rate limit budgets of both tokens", runEstimate},
+	{"migrate", "migrate the repositories from the source to the target", runMigrate},
+	{"verify", "compare the branches, tags and default branch of source and target, 'verify settings' the drift of their settings", runVerify},
+	{"sync", "push the new commits of the source to the repositories already migrated", runSync},
+	{"archive", "archive the source repositories", runArchive},
+	{"notice", "update the content of the source repositories already migrated, lock them down and archive them, without cloning them, 'notice preview' the diffs of the content", runNotice},
+	{"rollback", "unarchive the source repositories of the state file, --delete-targets deletes the created ones", runRollback},
+	{"unmigrate", "delete the targets created by the run of the state file or json report, revert the content of the sources and unarchive them", runUnmigrate},
+	{"report", "print the completed steps of each repository from the state file, 'report diff' the drift of the targets as json", runReport},
+	{"export", "store the migration archives of the source repositories in export.path or export.s3", runExport},
+	{"server", "serve a rest api on --serve migrating the repositories asked for, one migration at a time", nil},
+}
+
+// FindCommand returns nil when there is no command with that name.
+func FindCommand(name string) *Command {
+	for _, c := range Commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func runPlan(cfg *migration, repos []*gh.Repository) error {
+	waves, err := planWaves(cfg, repos)
+	if err != nil {
+		return fmt.Errorf("planning the waves: %v", err)
+	}
+	if cfg.Waves.Enabled() {
+		logWaves(waves)
+	}
+	printPlan(cfg, flattenWaves(waves))
+	return nil
+}
+
+func runVerify(cfg *migration, repos []*gh.Repository) error {
+	if (cfg.Target.Type != "" && cfg.Target.Type != config.TargetGitHub) || (cfg.Source.Type != "" && cfg.Source.Type != config.SourceGitHub) {
+		return errors.New("the verify command is only supported between GitHub instances")
+	}
+
+	switch cfg.subcommand {
+	case "":
+	case "settings":
+		return runSettingsDrift(cfg, repos)
+	default:
+		return fmt.Errorf("unknown verify subcommand %q, must be settings", cfg.subcommand)
+	}
+
+	failed := 0
+	for _, repo := range repos {
+		if cfg.stopping() {
+			break
+		}
+		v, err := verifyRepo(cfg, repo)
+		if err != nil {
+			return err
+		}
+
+		status := "PASS"
+		if !v.Passed() {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("%-4s %-40s %d refs\n", status, v.Repo, v.Refs)
+		for _, p := range v.Problems {
+			fmt.Printf("     - %s\n", p)
+		}
+	}
+
+	if failed > 0 {
+		return partialError(failed, len(repos), "%d of %d repositories failed the verification", failed, len(repos))
+	}
+	return nil
+}
+
+func runArchive(cfg *migration, repos []*gh.Repository) error {
+	for _, repo := range repos {
+		if cfg.stopping() {
+			break
+		}
+		l := log.WithField("repo", *repo.Name)
+
+		if cfg.DryRun {
+			l.Info("[plan] the source repository would be archived")
+			continue
+		}
+
+		// with a state file, only the repositories migrated and verified are archived
+		if cfg.State != nil && (!cfg.State.Done(*repo.Name, stepPush) || cfg.Verify && !cfg.State.Done(*repo.Name, stepVerify)) {
+			l.Warn("the repository was not migrated and verified, not archiving the source")
+			continue
+		}
+
+		if err := runStep(cfg, *repo.Name, stepArchive, l, func() error { return archiveRepo(cfg, repo, l) }); err != nil {
+			abortOn(cfg, *repo.Name, err)
+		}
+	}
+	return cfg.abort.Err()
+}
+
+func runReport(cfg *migration, repos []*gh.Repository) error {
+	switch cfg.subcommand {
+	case "":
+	case "diff":
+		return runDiff(cfg, repos)
+	default:
+		return fmt.Errorf("unknown report subcommand %q, must be diff", cfg.subcommand)
+	}
+
+	if cfg.State == nil {
+		return errors.New("the report command requires the state_file option")
+	}
+
+	for _, repo := range repos {
+		var steps []string
+		if s, ok := cfg.State.Repos[*repo.Name]; ok {
+			for step := range s.Steps {
+				steps = append(steps, step)
+			}
+		}
+		sort.Strings(steps)
+
+		fmt.Printf("%-40s %s\n", *repo.Name, strings.Join(steps, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/gitops"
+	"github.com/leocomelli/ghmgr/provider/github"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// defaultCommitMessages are the messages of the commits without
+// git.commit_message nor git.commit_messages.
+var defaultCommitMessages = map[string]string{
+	config.CommitRevert:    "reverted {{.Files}}",
+	config.CommitTombstone: "moved to {{.TargetURL}}",
+}
+
+const defaultCommitMessage = "updated {{.Files}}"
+
+// commitVars are the variables of the commit message templates.
+type commitVars struct {
+	Operation     string
+	Files         string
+	Repo          string
+	Target        string
+	TargetURL     string
+	DefaultBranch string
+	Date          string
+}
+
+// commitMessage is the message of a commit of the operation, from
+// git.commit_messages, git.commit_message or the default one.
+func commitMessage(cfg *migration, op string, files []string, source, target *gh.Repository) (string, error) {
+	text, ok := cfg.Git.CommitMessages[op]
+	if !ok && cfg.Git.CommitMessage != "" {
+		text = cfg.Git.CommitMessage
+	} else if !ok {
+		if text, ok = defaultCommitMessages[op]; !ok {
+			text = defaultCommitMessage
+		}
+	}
+
+	t, err := template.New(op).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = t.Execute(&b, commitVars{
+		Operation:     op,
+		Files:         strings.Join(files, ", "),
+		Repo:          source.GetName(),
+		Target:        target.GetName(),
+		TargetURL:     target.GetHTMLURL(),
+		DefaultBranch: source.GetDefaultBranch(),
+		Date:          time.Now().Format("2006-01-02"),
+	})
+	return b.String(), err
+}
+
+// commitAuthors are the author and the committer of the commits made with
+// the contents api, git.commit_author by default, nil without it.
+func commitAuthors(cfg *migration) (author, committer *gh.CommitAuthor) {
+	if cfg.Git.Author == "" {
+		return nil, nil
+	}
+	author = &gh.CommitAuthor{Name: gh.String(cfg.Git.Author), Email: gh.String(cfg.Git.Email)}
+	if cfg.Git.CommitterName == "" {
+		return author, author
+	}
+	return author, &gh.CommitAuthor{Name: gh.String(cfg.Git.CommitterName), Email: gh.String(cfg.Git.CommitterEmail)}
+}
+
+// commitSignatures are the author and the committer of the commits made
+// with git.
+func commitSignatures(cfg *migration) (author, committer *object.Signature) {
+	now := time.Now()
+	author = &object.Signature{Name: cfg.Git.Author, Email: cfg.Git.Email, When: now}
+	if cfg.Git.CommitterName == "" {
+		return author, author
+	}
+	return author, &object.Signature{Name: cfg.Git.CommitterName, Email: cfg.Git.CommitterEmail, When: now}
+}
+
+// fileOptions are the options of a commit of the contents api.
+func fileOptions(cfg *migration, message string, content []byte, sha, branch string) *gh.RepositoryContentFileOptions {
+	options := &gh.RepositoryContentFileOptions{
+		Message: gh.String(message),
+		Content: content,
+	}
+	if sha != "" {
+		options.SHA = gh.String(sha)
+	}
+	if branch != "" {
+		options.Branch = gh.String(branch)
+	}
+	options.Author, options.Committer = commitAuthors(cfg)
+	return options
+}
+
+// commitFile creates or updates a file in one commit of the contents api
+// or, with git.signing_key, of the git data api, the commit being signed.
+func commitFile(cfg *migration, client *gh.Client, owner, repo, path string, options *gh.RepositoryContentFileOptions) error {
+	signer, err := gitops.LoadSigner(cfg.Git)
+	if err != nil {
+		return err
+	}
+	if signer != nil {
+		content := string(options.Content)
+		return signedCommit(cfg, signer, client, owner, repo, path, &content, options)
+	}
+
+	if options.SHA == nil {
+		_, _, err = client.Repositories.CreateFile(cfg.runContext(), owner, repo, path, options)
+	} else {
+		_, _, err = client.Repositories.UpdateFile(cfg.runContext(), owner, repo, path, options)
+	}
+	return err
+}
+
+// removeFile deletes a file like commitFile.
+func removeFile(cfg *migration, client *gh.Client, owner, repo, path string, options *gh.RepositoryContentFileOptions) error {
+	signer, err := gitops.LoadSigner(cfg.Git)
+	if err != nil {
+		return err
+	}
+	if signer != nil {
+		return signedCommit(cfg, signer, client, owner, repo, path, nil, options)
+	}
+
+	_, _, err = client.Repositories.DeleteFile(cfg.runContext(), owner, repo, path, options)
+	return err
+}
+
+// commitIdentity is the author or the committer of a commit of the git
+// data api.
+type commitIdentity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date"`
+}
+
+// signedCommit commits the file, deleted when content is nil, on the
+// branch of the options with the git data api, which the contents api
+// lacks: the signature is computed over the commit as git encodes it, the
+// commit returned by the api must have the same hash to be verified.
+func signedCommit(cfg *migration, signer gitops.Signer, client *gh.Client, owner, repo, path string, content *string, options *gh.RepositoryContentFileOptions) error {
+	ctx := cfg.runContext()
+
+	branch := options.GetBranch()
+	if branch == "" {
+		r, _, err := client.Repositories.Get(ctx, owner, repo)
+		if err != nil {
+			return err
+		}
+		branch = r.GetDefaultBranch()
+	}
+	ref, _, err := client.Git.GetRef(ctx, owner, repo, "heads/"+branch)
+	if err != nil {
+		return err
+	}
+	parent := ref.GetObject().GetSHA()
+	base, _, err := client.Git.GetCommit(ctx, owner, repo, parent)
+	if err != nil {
+		return err
+	}
+
+	// a null sha deletes the file
+	entry := map[string]interface{}{"path": path, "mode": "100644", "type": "blob", "sha": nil}
+	if content != nil {
+		delete(entry, "sha")
+		entry["content"] = *content
+	}
+	var tree struct {
+		SHA string `json:"sha"`
+	}
+	body := map[string]interface{}{"base_tree": base.GetTree().GetSHA(), "tree": []interface{}{entry}}
+	if _, err := github.Request(ctx, client, "POST", fmt.Sprintf("repos/%s/%s/git/trees", owner, repo), "", body, &tree); err != nil {
+		return fmt.Errorf("tree: %v", err)
+	}
+
+	// the api keeps the dates to the second
+	author, committer := commitSignatures(cfg)
+	author.When = author.When.UTC().Truncate(time.Second)
+	committer.When = author.When
+	c := &object.Commit{
+		Author:       *author,
+		Committer:    *committer,
+		Message:      options.GetMessage(),
+		TreeHash:     plumbing.NewHash(tree.SHA),
+		ParentHashes: []plumbing.Hash{plumbing.NewHash(parent)},
+	}
+	raw, err := gitops.EncodeCommit(c)
+	if err != nil {
+		return err
+	}
+	if c.PGPSignature, err = signer.Sign(bytes.NewReader(raw)); err != nil {
+		return fmt.Errorf("signing: %v", err)
+	}
+	signed := &plumbing.MemoryObject{}
+	if err := c.Encode(signed); err != nil {
+		return err
+	}
+
+	req := struct {
+		Message   string         `json:"message"`
+		Tree      string         `json:"tree"`
+		Parents   []string       `json:"parents"`
+		Author    commitIdentity `json:"author"`
+		Committer commitIdentity `json:"committer"`
+		Signature string         `json:"signature"`
+	}{
+		Message:   c.Message,
+		Tree:      tree.SHA,
+		Parents:   []string{parent},
+		Author:    commitIdentity{author.Name, author.Email, author.When.Format(time.RFC3339)},
+		Committer: commitIdentity{committer.Name, committer.Email, committer.When.Format(time.RFC3339)},
+		Signature: c.PGPSignature,
+	}
+	var created struct {
+		SHA string `json:"sha"`
+	}
+	if _, err := github.Request(ctx, client, "POST", fmt.Sprintf("repos/%s/%s/git/commits", owner, repo), "", req, &created); err != nil {
+		return fmt.Errorf("commit: %v", err)
+	}
+	if created.SHA != signed.Hash().String() {
+		return fmt.Errorf("the commit %s differs from the one signed, %s, not updating %s", created.SHA, signed.Hash(), branch)
+	}
+
+	_, _, err = client.Git.UpdateRef(ctx, owner, repo, &gh.Reference{
+		Ref:    gh.String("heads/" + branch),
+		Object: &gh.GitObject{SHA: gh.String(created.SHA)},
+	}, false)
+	return err
+}
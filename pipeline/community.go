@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// communityRepo is the repository holding the community health files of
+// an organization: the default issue templates, the workflow templates and
+// the profile README.
+const communityRepo = ".github"
+
+// stepCommunity is the step of communityRepo in the report.
+const stepCommunity = "community_files"
+
+// withoutCommunityRepo leaves communityRepo out of the repositories, merged
+// by migrate.community_files instead of being migrated.
+func withoutCommunityRepo(cfg *migration, repos []*gh.Repository) []*gh.Repository {
+	var kept []*gh.Repository
+	for _, r := range repos {
+		if r.GetName() == communityRepo {
+			log.WithField("name", communityRepo).Info("the repository is merged by migrate.community_files rather than migrated")
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// treeBlobs lists the files of the default branch of a repository with
+// their blob sha, none for an empty repository.
+func treeBlobs(cfg *migration, client *gh.Client, owner string, repo *gh.Repository) (map[string]string, error) {
+	tree, resp, err := client.Git.GetTree(cfg.runContext(), owner, repo.GetName(), repo.GetDefaultBranch(), true)
+	if resp != nil && (resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusNotFound) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("the tree of %s is too large to be listed", repo.GetName())
+	}
+	blobs := map[string]string{}
+	for _, e := range tree.Entries {
+		// the symbolic links and the submodules are not files
+		if e.GetType() == "blob" && e.GetMode() != "120000" {
+			blobs[e.GetPath()] = e.GetSHA()
+		}
+	}
+	return blobs, nil
+}
+
+// migrateCommunityFiles merges the .github repository of the source
+// organization into the one of the target, created when missing, once
+// before the repositories: the missing files are committed, the identical
+// ones skipped and the ones that differ kept and reported as conflicts.
+func migrateCommunityFiles(cfg *migration) error {
+	l := log.WithField("name", communityRepo)
+
+	source, resp, err := cfg.Source.Instance.Repositories.Get(cfg.runContext(), cfg.Source.Organization, communityRepo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		l.Info("the source organization has no community health files")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("community files: %v", err)
+	}
+
+	cfg.Results.Start(communityRepo)
+	err = mergeCommunityFiles(cfg, source, l)
+	cfg.Results.Finish(communityRepo, err)
+	if err != nil {
+		return fmt.Errorf("community files: %v", err)
+	}
+	return nil
+}
+
+func mergeCommunityFiles(cfg *migration, source *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	src, tgt := cfg.Source, cfg.Target
+
+	target, err := tgt.Provider.Get(ctx, communityRepo)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		// the name must stay .github, whatever the rename settings
+		opts := &gh.Repository{Name: gh.String(communityRepo), Description: source.Description, Private: source.Private}
+		if target, err = tgt.Provider.Create(ctx, source, opts, ""); err != nil {
+			return err
+		}
+		l.WithField("url", target.GetHTMLURL()).Info("the community health repository was created on the target")
+	}
+	cfg.Results.SetTargetURL(communityRepo, target.GetHTMLURL())
+
+	files, err := treeBlobs(cfg, src.Instance, src.Organization, source)
+	if err != nil {
+		return err
+	}
+	existing, err := treeBlobs(cfg, tgt.Instance, tgt.Organization, target)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	added, conflicts := 0, 0
+	for _, path := range paths {
+		if cfg.stopping() {
+			break
+		}
+		sha := files[path]
+		switch existing[path] {
+		case sha:
+			continue
+		case "":
+		default:
+			conflicts++
+			cfg.Results.Fail(communityRepo, stepCommunity, fmt.Errorf("%s differs on the target, it was kept", path))
+			l.WithField("path", path).Warn("the community file differs on the target, it was kept")
+			continue
+		}
+
+		blob, _, err := src.Instance.Git.GetBlob(ctx, src.Organization, communityRepo, sha)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		// the api wraps the encoded content
+		content, err := base64.StdEncoding.DecodeString(strings.Replace(blob.GetContent(), "\n", "", -1))
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		message := fmt.Sprintf("Migrate %s from %s", path, src.Organization)
+		if err := commitFile(cfg, tgt.Instance, tgt.Organization, communityRepo, path, fileOptions(cfg, message, content, "", "")); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		added++
+	}
+
+	cfg.Results.Step(communityRepo, stepCommunity)
+	l.WithField("added", added).WithField("conflicts", conflicts).Info("the community health files were merged")
+	return nil
+}
@@ -0,0 +1,315 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/gitops"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// The content of a repository found on the target, compared with the one
+// of the source.
+const (
+	collisionEmpty     = "empty"
+	collisionSame      = "same content"
+	collisionDifferent = "different content"
+)
+
+// collision is a repository whose name is already taken on the target.
+type collision struct {
+	Repo    string
+	Target  string
+	Content string
+	// Conflict tells the repository would fail with target.on_exists.
+	Conflict   bool
+	Suggestion string
+	// Rename is a free name on the target for a different repository.
+	Rename string
+}
+
+// conflictReport is what the target organization tells before any
+// repository is created.
+type conflictReport struct {
+	Collisions []*collision
+	// Capacity lists the limits of the plan of the organization the
+	// migration would exceed, Warnings the ones it may.
+	Capacity []string
+	Warnings []string
+}
+
+func (r *conflictReport) conflicts() int {
+	n := len(r.Capacity)
+	for _, c := range r.Collisions {
+		if c.Conflict {
+			n++
+		}
+	}
+	return n
+}
+
+// checkConflicts looks for the names already taken on the target and the
+// limits of the plan of the organization once, before the repositories,
+// rather than failing them one by one at creation time.
+func checkConflicts(cfg *migration, repos []*gh.Repository) error {
+	r, err := findConflicts(cfg, repos)
+	if err != nil {
+		return fmt.Errorf("looking for conflicts on the target: %v", err)
+	}
+	for _, w := range r.Warnings {
+		log.WithField("organization", cfg.Target.Organization).Warn(w)
+	}
+	n := r.conflicts()
+	if n == 0 {
+		log.WithField("collisions", len(r.Collisions)).Info("no conflict was found on the target")
+		return nil
+	}
+	printConflicts(r, os.Stdout)
+	return &ConfigError{fmt.Errorf("%d conflicts were found on the target, nothing was created", n)}
+}
+
+// planConflicts prints the conflict report without failing the plan.
+func planConflicts(cfg *migration, repos []*gh.Repository) {
+	r, err := findConflicts(cfg, repos)
+	if err != nil {
+		log.WithError(err).Error("[plan] the conflicts on the target could not be checked")
+		return
+	}
+	for _, w := range r.Warnings {
+		log.WithField("organization", cfg.Target.Organization).Warn("[plan] " + w)
+	}
+	if n := r.conflicts(); n > 0 {
+		log.WithField("conflicts", n).Warn("[plan] the migration would stop on the conflicts found on the target")
+	}
+	if len(r.Collisions) > 0 || len(r.Capacity) > 0 {
+		printConflicts(r, os.Stdout)
+	}
+}
+
+func findConflicts(cfg *migration, repos []*gh.Repository) (*conflictReport, error) {
+	ctx := cfg.runContext()
+	r := &conflictReport{}
+
+	// the names of the migration are not free for the suggestions
+	taken := map[string]bool{}
+	for _, repo := range repos {
+		taken[strings.ToLower(targetName(cfg, *repo.Name))] = true
+	}
+
+	created, private := 0, 0
+	for _, repo := range repos {
+		name := *repo.Name
+		// a repository created by a previous run is expected on the target
+		if cfg.State.Done(name, stepCreate) {
+			continue
+		}
+		tn := targetName(cfg, name)
+		existing, err := cfg.Target.Provider.Get(ctx, tn)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", tn, err)
+		}
+		if existing == nil {
+			created++
+			if repoOptions(cfg, repo).GetPrivate() {
+				private++
+			}
+			continue
+		}
+
+		l := log.WithField("name", name).WithField("target", existing.GetFullName())
+		content, err := compareContent(cfg, repo, existing, l)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", tn, err)
+		}
+		c := &collision{Repo: name, Target: existing.GetName(), Content: content}
+		switch cfg.Target.OnExists {
+		case config.OnExistsSkip, config.OnExistsRecreate:
+			l.WithField("content", content).WithField("on_exists", cfg.Target.OnExists).Info("the repository already exists on the target")
+			continue
+		case config.OnExistsPush:
+			c.Conflict = content == collisionDifferent
+		default:
+			c.Conflict = true
+		}
+		switch content {
+		case collisionSame:
+			c.Suggestion = "target.on_exists: " + config.OnExistsSkip
+		case collisionEmpty:
+			c.Suggestion = "target.on_exists: " + config.OnExistsPush
+		default:
+			rename, err := freeName(cfg, tn, taken)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", tn, err)
+			}
+			if rename != "" {
+				c.Rename, c.Suggestion = rename, "rename.map: "+rename
+			}
+		}
+		if !c.Conflict {
+			c.Suggestion = ""
+		}
+		r.Collisions = append(r.Collisions, c)
+	}
+
+	if created > 0 && (cfg.Target.Type == "" || cfg.Target.Type == config.TargetGitHub) {
+		if err := checkCapacity(cfg, created, private, r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// compareContent tells whether the repository found on the target is
+// empty, holds every branch and tag of the source at the same commits or
+// anything else.
+func compareContent(cfg *migration, source, target *gh.Repository, l *log.Entry) (string, error) {
+	auth, err := gitAuth(cfg, cfg.Source.Tokens, cfg.Source.Username, l)
+	if err != nil {
+		return "", err
+	}
+	targetAuth := auth
+	if useHTTPS(cfg) {
+		if targetAuth, err = gitAuth(cfg, cfg.Target.Tokens, "", l); err != nil {
+			return "", err
+		}
+	}
+
+	targetRefs, err := gitops.ListRemote(repoURL(cfg, target), targetAuth)
+	if err != nil {
+		return "", err
+	}
+	if len(targetRefs) == 0 {
+		return collisionEmpty, nil
+	}
+	sourceRefs, err := gitops.ListRemote(repoURL(cfg, source), auth)
+	if err != nil {
+		return "", err
+	}
+
+	heads := refHashes(targetRefs)
+	for ref, hash := range refHashes(sourceRefs) {
+		if heads[ref] != hash {
+			return collisionDifferent, nil
+		}
+	}
+	return collisionSame, nil
+}
+
+// refHashes keeps the branches and the tags of the refs.
+func refHashes(refs []*plumbing.Reference) map[string]string {
+	hashes := map[string]string{}
+	for _, r := range refs {
+		if r.Name().IsBranch() || r.Name().IsTag() {
+			hashes[r.Name().String()] = r.Hash().String()
+		}
+	}
+	return hashes
+}
+
+// freeName suggests a name for a repository whose name is taken on the
+// target by a different one: the name followed by the source owner, or by
+// a number. It is empty when none of them is free.
+func freeName(cfg *migration, name string, taken map[string]bool) (string, error) {
+	owner := repoOwner(cfg)
+	var candidates []string
+	if owner != "" {
+		candidates = append(candidates, name+"-"+strings.ToLower(owner))
+	}
+	for i := 2; i <= 9; i++ {
+		candidates = append(candidates, fmt.Sprintf("%s-%d", name, i))
+	}
+
+	for _, n := range candidates {
+		if taken[strings.ToLower(n)] {
+			continue
+		}
+		existing, err := cfg.Target.Provider.Get(cfg.runContext(), n)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			taken[strings.ToLower(n)] = true
+			return n, nil
+		}
+	}
+	return "", nil
+}
+
+// checkCapacity compares the repositories to create with the plan of the
+// target organization, which only its owners can read: nothing is checked
+// when it is missing.
+func checkCapacity(cfg *migration, created, private int, r *conflictReport) error {
+	var org struct {
+		OwnedPrivateRepos int `json:"owned_private_repos"`
+		Plan              *struct {
+			Name         string `json:"name"`
+			Seats        int    `json:"seats"`
+			FilledSeats  int    `json:"filled_seats"`
+			PrivateRepos int    `json:"private_repos"`
+		} `json:"plan"`
+	}
+	if _, err := github.Request(cfg.runContext(), cfg.Target.Instance, "GET", "orgs/"+cfg.Target.Organization, "", nil, &org); err != nil {
+		return err
+	}
+	if org.Plan == nil {
+		log.WithField("organization", cfg.Target.Organization).Info("the plan of the target organization is not visible, its limits are not checked")
+		return nil
+	}
+
+	p := org.Plan
+	if p.PrivateRepos > 0 && org.OwnedPrivateRepos+private > p.PrivateRepos {
+		r.Capacity = append(r.Capacity, fmt.Sprintf("the %s plan allows %d private repositories, %d exist and %d would be created",
+			p.Name, p.PrivateRepos, org.OwnedPrivateRepos, private))
+	}
+	if p.Seats > 0 && p.FilledSeats >= p.Seats && (cfg.Migrate.Teams || cfg.Migrate.Collaborators) {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("the %d seats of the %s plan are filled, the members and collaborators needing a new one will not be added",
+			p.Seats, p.Name))
+	}
+	log.WithField("plan", p.Name).WithField("repositories", created).WithField("private", private).
+		Info("the plan of the target organization was checked")
+	return nil
+}
+
+// printConflicts writes the conflict report, with the rename.map of the
+// suggested names.
+func printConflicts(r *conflictReport, w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nREPOSITORY\tTARGET\tCONTENT\tCONFLICT\tSUGGESTION")
+	renames := map[string]string{}
+	for _, c := range r.Collisions {
+		conflict := "no"
+		if c.Conflict {
+			conflict = "yes"
+			if c.Rename != "" {
+				renames[c.Repo] = c.Rename
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Repo, c.Target, c.Content, conflict, c.Suggestion)
+	}
+	tw.Flush()
+
+	for _, c := range r.Capacity {
+		fmt.Fprintf(w, "capacity: %s\n", c)
+	}
+
+	if len(renames) == 0 {
+		return
+	}
+	names := make([]string, 0, len(renames))
+	for n := range renames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "\nrename:\n  map:")
+	for _, n := range names {
+		fmt.Fprintf(w, "    %s: %s\n", n, renames[n])
+	}
+}
@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// templateNow is the clock of the {{date}} of the templates.
+var templateNow = time.Now
+
+// expandTemplate replaces the {{variables}} of a template.
+func expandTemplate(template string, source, target *gh.Repository) string {
+	return strings.NewReplacer(
+		"{{url}}", target.GetHTMLURL(),
+		"{{target_url}}", target.GetHTMLURL(),
+		"{{name}}", target.GetName(),
+		"{{date}}", templateNow().Format("2006-01-02"),
+		"{{default_branch}}", source.GetDefaultBranch(),
+	).Replace(template)
+}
+
+// applyContentRule does not add the text twice, when a previous run
+// already updated the file.
+func applyContentRule(rule config.ContentRule, content, text string) (string, error) {
+	switch rule.Mode {
+	case config.ContentAppend:
+		if strings.HasSuffix(content, text) {
+			return content, nil
+		}
+		return content + text, nil
+	case config.ContentReplace:
+		return text, nil
+	case config.ContentRegex:
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(content, text), nil
+	}
+	if strings.HasPrefix(content, text) {
+		return content, nil
+	}
+	return text + content, nil
+}
+
+// sourceContent returns the file of a rule on the default branch of the
+// source, with an empty sha when it is missing and the rule creates it.
+func sourceContent(cfg *migration, rule config.ContentRule, source *gh.Repository) (string, string, error) {
+	src := cfg.Source
+	c, _, resp, err := src.Instance.Repositories.GetContents(cfg.runContext(), src.Organization, *source.Name, rule.Path, &gh.RepositoryContentGetOptions{})
+	switch {
+	case err == nil:
+		content, err := c.GetContent()
+		return content, c.GetSHA(), err
+	case resp != nil && resp.StatusCode == http.StatusNotFound && rule.Mode != config.ContentRegex:
+		// the file is created
+		return "", "", nil
+	}
+	return "", "", err
+}
+
+func updateContentFile(cfg *migration, rule config.ContentRule, source, target *gh.Repository, l *log.Entry) error {
+	src := cfg.Source
+
+	content, sha, err := sourceContent(cfg, rule, source)
+	if err != nil {
+		return err
+	}
+
+	updated, err := applyContentRule(rule, content, expandTemplate(rule.Template, source, target))
+	if err != nil {
+		return err
+	}
+	if updated == content && sha != "" {
+		l.WithField("filename", rule.Path).Info("the content is already up to date, skipping")
+		return nil
+	}
+
+	l.WithField("filename", rule.Path).WithField("mode", rule.Mode).Info("updating the content...")
+
+	message, err := commitMessage(cfg, config.CommitContent, []string{rule.Path}, source, target)
+	if err != nil {
+		return err
+	}
+	options := fileOptions(cfg, message, []byte(updated), sha, "")
+	if err := commitFile(cfg, src.Instance, src.Organization, *source.Name, rule.Path, options); err != nil {
+		return fmt.Errorf("%s: %v", rule.Path, err)
+	}
+	return nil
+}
+
+// updateContent applies the content rules to the source repository, the
+// templates pointing to the target one.
+func updateContent(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	if cfg.Source.Content.Method == config.ContentMethodGit {
+		return commitContent(cfg, source, target, l)
+	}
+	for _, rule := range cfg.Source.Content.AllRules() {
+		if err := updateContentFile(cfg, rule, source, target, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
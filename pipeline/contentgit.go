@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/gitops"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	git "gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// contentBranch receives the commit when the default branch is protected,
+// a pull request proposing it.
+const contentBranch = "ghmgr/migration-notice"
+
+func readFile(fs billy.Filesystem, path string) (string, bool, error) {
+	f, err := fs.Open(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	content, err := ioutil.ReadAll(f)
+	return string(content), true, err
+}
+
+func writeFile(fs billy.Filesystem, path, content string) error {
+	f, err := fs.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(content)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// commitContent applies the content rules to a clone of the source default
+// branch in one commit, authored by git.commit_author and pushed to the
+// default branch, or proposed in a pull request when it is protected.
+func commitContent(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	branch := source.GetDefaultBranch()
+
+	auth, err := gitAuth(cfg, cfg.Source.Tokens, cfg.Source.Username, l)
+	if err != nil {
+		return err
+	}
+
+	fs := memfs.New()
+	g, err := git.CloneContext(ctx, memory.NewStorage(), fs, &git.CloneOptions{
+		URL:           repoURL(cfg, source),
+		Auth:          auth,
+		ReferenceName: plumbing.NewBranchReferenceName(branch),
+		SingleBranch:  true,
+		Depth:         cfg.Git.Depth,
+	})
+	if err != nil {
+		return err
+	}
+	w, err := g.Worktree()
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, rule := range cfg.Source.Content.AllRules() {
+		content, exists, err := readFile(fs, rule.Path)
+		if err != nil {
+			return err
+		}
+		if !exists && rule.Mode == config.ContentRegex {
+			return fmt.Errorf("%s: file not found", rule.Path)
+		}
+
+		updated, err := applyContentRule(rule, content, expandTemplate(rule.Template, source, target))
+		if err != nil {
+			return err
+		}
+		if updated == content && exists {
+			continue
+		}
+		if err := writeFile(fs, rule.Path, updated); err != nil {
+			return err
+		}
+		if _, err := w.Add(rule.Path); err != nil {
+			return err
+		}
+		paths = append(paths, rule.Path)
+	}
+
+	if len(paths) == 0 {
+		l.Info("the content is already up to date, skipping")
+		return nil
+	}
+
+	signer, err := gitops.LoadSigner(cfg.Git)
+	if err != nil {
+		return err
+	}
+	message, err := commitMessage(cfg, config.CommitContent, paths, source, target)
+	if err != nil {
+		return err
+	}
+	author, committer := commitSignatures(cfg)
+	hash, err := w.Commit(message, &git.CommitOptions{
+		Author:    author,
+		Committer: committer,
+	})
+	if err != nil {
+		return err
+	}
+	if signer != nil {
+		if _, err := gitops.SignCommit(g, hash, signer); err != nil {
+			return fmt.Errorf("signing: %v", err)
+		}
+	}
+
+	b, _, err := cfg.Source.Instance.Repositories.GetBranch(ctx, cfg.Source.Organization, *source.Name, branch)
+	if err != nil {
+		return err
+	}
+	push := branch
+	if b.GetProtected() {
+		push = contentBranch
+	}
+
+	l.WithField("branch", push).WithField("files", paths).Info("pushing the content update...")
+	opts := &git.PushOptions{
+		Auth:     auth,
+		RefSpecs: []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/heads/%s", branch, push))},
+	}
+	err = g.PushContext(ctx, opts)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	if err == nil {
+		auditPush(cfg, "source", cfg.Source.Organization+"/"+*source.Name, g, opts)
+	}
+
+	if push == branch {
+		return nil
+	}
+
+	pr, _, err := cfg.Source.Instance.PullRequests.Create(ctx, cfg.Source.Organization, *source.Name, &gh.NewPullRequest{
+		Title: gh.String(message),
+		Head:  gh.String(contentBranch),
+		Base:  gh.String(branch),
+		Body:  gh.String(fmt.Sprintf("The repository was migrated to %s.", target.GetHTMLURL())),
+	})
+	if err != nil {
+		return fmt.Errorf("pull request: %v", err)
+	}
+	l.WithField("url", pr.GetHTMLURL()).Info("the default branch is protected, a pull request was opened")
+	return nil
+}
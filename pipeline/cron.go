@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a standard five field cron expression: minute, hour, day of
+// the month, month and day of the week, each one accepting *, lists,
+// ranges and steps (e.g. "*/15 2-4 * * 1,3").
+type schedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	anyDom, anyDow                bool
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step, part = s, part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is out of the range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func parseSchedule(expr string) (*schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: expected 5 fields, found %d", expr, len(fields))
+	}
+
+	// like Vixie cron, a stepped * (e.g. */2) still leaves the day
+	// unrestricted for the other day field
+	s := &schedule{anyDom: strings.HasPrefix(fields[2], "*"), anyDow: strings.HasPrefix(fields[4], "*")}
+	targets := []*map[int]bool{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	ranges := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	for i, f := range fields {
+		values, err := parseCronField(f, ranges[i][0], ranges[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", expr, err)
+		}
+		*targets[i] = values
+	}
+	// both 0 and 7 are sunday
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	// e.g. the 30th of february
+	if _, ok := s.next(time.Now()); !ok {
+		return nil, fmt.Errorf("schedule %q: never matches", expr)
+	}
+	return s, nil
+}
+
+func (s *schedule) matchDay(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	// like cron, either day field matches when both are restricted
+	return dom || dow
+}
+
+// next returns the first time matching the schedule after t, false when
+// none does in the next five years.
+func (s *schedule) next(t time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hour[t.Hour()]:
+			// the next hour of the zone, which may not be a whole
+			// number of hours away from UTC
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// a thursday
+	from := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 10, 1, 12, 15, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2026, 10, 2, 2, 0, 0, 0, time.UTC)},
+		{"0 2 * * 1", time.Date(2026, 10, 5, 2, 0, 0, 0, time.UTC)},
+		// either day field matches when both are restricted
+		{"0 2 10 * 1", time.Date(2026, 10, 5, 2, 0, 0, 0, time.UTC)},
+		// a stepped * leaves the day of the month unrestricted: the
+		// mondays on the odd days only
+		{"0 2 */2 * 1", time.Date(2026, 10, 5, 2, 0, 0, 0, time.UTC)},
+		{"0 2 */2 * 2", time.Date(2026, 10, 13, 2, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := parseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got, _ := s.next(from); !got.Equal(tt.want) {
+			t.Errorf("%s: next = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	// the hours of a zone half an hour away from UTC
+	ist := time.FixedZone("IST", 5*3600+1800)
+	s, err := parseSchedule("0 14 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.next(time.Date(2026, 10, 1, 12, 10, 0, 0, ist))
+	if want := time.Date(2026, 10, 1, 14, 0, 0, 0, ist); !got.Equal(want) {
+		t.Errorf("0 14 * * * in IST: next = %s, want %s", got, want)
+	}
+
+	// the days that never come
+	for _, expr := range []string{"0 0 31 2 *", "0 0 30 2 *", "0 0 31 4,6 *"} {
+		if _, err := parseSchedule(expr); err == nil || !strings.Contains(err.Error(), expr) {
+			t.Errorf("%s: err = %v, want it rejected", expr, err)
+		}
+	}
+	// the 29th of february still comes, in a leap year
+	if _, err := parseSchedule("0 0 29 2 *"); err != nil {
+		t.Errorf("0 0 29 2 *: %v", err)
+	}
+}
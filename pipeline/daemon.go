@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// health is served by the health endpoint in the scheduled mode.
+type health struct {
+	mu        sync.Mutex
+	Status    string    `json:"status"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	NextRun   time.Time `json:"next_run"`
+}
+
+func (h *health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h)
+}
+
+func (h *health) set(fn func(h *health)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fn(h)
+}
+
+// runScheduled runs the command on every occurrence of the schedule until
+// SIGTERM or SIGINT, listing the repositories again before each run so the
+// new ones are included.
+func runScheduled(cfg *migration, cmd *Command, expr, healthAddr string) error {
+	s, err := parseSchedule(expr)
+	if err != nil {
+		return err
+	}
+
+	h := &health{Status: "waiting"}
+	if healthAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", h)
+		go func() {
+			log.WithField("addr", healthAddr).Info("serving the health endpoint")
+			if err := http.ListenAndServe(healthAddr, mux); err != nil {
+				log.WithError(err).Error("the health endpoint stopped")
+			}
+		}()
+	}
+
+	for {
+		next, ok := s.next(time.Now())
+		if !ok {
+			return fmt.Errorf("schedule %q: never matches", expr)
+		}
+		h.set(func(h *health) { h.Status, h.NextRun = "waiting", next })
+		log.WithField("schedule", expr).WithField("next", next.Format(time.RFC3339)).Info("waiting for the next run")
+
+		select {
+		case <-time.After(time.Until(next)):
+		case <-cfg.stop:
+			log.Info("stopped")
+			return nil
+		case <-cfg.runContext().Done():
+			log.Info("stopped")
+			return nil
+		}
+
+		h.set(func(h *health) { h.Status = "running" })
+		// a run aborted does not abort the next ones
+		cfg.abort = newRunAbort()
+		repos, err := findRepositories(cfg)
+		if err == nil {
+			err = checkDestructive(cfg, cmd.Name, repos, false)
+		}
+		if err == nil {
+			err = withLock(cfg, cmd.Name, func() error { return cmd.run(cfg, repos) })
+		}
+
+		h.set(func(h *health) {
+			h.LastRun, h.LastError = time.Now(), ""
+			if err != nil {
+				h.LastError = err.Error()
+			}
+		})
+		if err != nil {
+			log.WithError(err).Error("the scheduled run failed")
+		}
+	}
+}
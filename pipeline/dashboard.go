@@ -0,0 +1,266 @@
+package pipeline
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errUnknownRepo = errors.New("the repository is not part of the run")
+	errNotFailed   = errors.New("only the failed repositories can be retried")
+)
+
+// dashboard serves the progress of a migration, the page polling the
+// status endpoint, and retries the failed repositories when asked.
+type dashboard struct {
+	cfg   *migration
+	retry func(name string) error
+}
+
+// serveDashboard serves the dashboard on addr until the process exits.
+func serveDashboard(cfg *migration, addr string, retry func(name string) error) {
+	d := &dashboard{cfg: cfg, retry: retry}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.page)
+	mux.HandleFunc("/api/status", d.status)
+	mux.HandleFunc("/api/repositories/", d.retryRepo)
+
+	go func() {
+		log.WithField("addr", addr).Info("serving the dashboard")
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.WithError(err).Error("the dashboard stopped")
+		}
+	}()
+}
+
+func (d *dashboard) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(dashboardPage))
+}
+
+func (d *dashboard) status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.cfg.Progress.snapshot(d.cfg.redactor.redact))
+}
+
+// requestAllowed is the status refusing a request writing to the
+// instances, 0 when it is allowed: never from the page of another site,
+// with the bearer token when set, else only from this host.
+func requestAllowed(token string, r *http.Request) int {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			return http.StatusForbidden
+		}
+	}
+	if token != "" {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return http.StatusUnauthorized
+		}
+		return 0
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// retryRepo handles POST /api/repositories/{name}/retry.
+func (d *dashboard) retryRepo(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/repositories/")
+	if !strings.HasSuffix(rest, "/retry") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if status := requestAllowed(d.cfg.Server.Token, r); status != 0 {
+		http.Error(w, "the retries need server.token, or a request of this host", status)
+		return
+	}
+	name, err := url.PathUnescape(strings.TrimSuffix(rest, "/retry"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch err := d.retry(name); err {
+	case nil:
+		log.WithField("repo", name).Info("the repository was queued again from the dashboard")
+		w.WriteHeader(http.StatusAccepted)
+	case errUnknownRepo:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusConflict)
+	}
+}
+
+// retryQueue runs the repositories retried from the dashboard one at a
+// time, alongside the workers, until the run is stopped.
+type retryQueue struct {
+	cfg     *migration
+	process func(i int) error
+	repos   []*gh.Repository
+	index   map[string]int
+	jobs    chan int
+	done    chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func newRetryQueue(cfg *migration, repos []*gh.Repository, process func(i int) error) *retryQueue {
+	q := &retryQueue{
+		cfg:     cfg,
+		process: process,
+		repos:   repos,
+		index:   map[string]int{},
+		jobs:    make(chan int, len(repos)),
+		done:    make(chan struct{}),
+		pending: map[string]bool{},
+	}
+	for i, repo := range repos {
+		q.index[*repo.Name] = i
+	}
+	go q.run()
+	return q
+}
+
+// add queues a failed repository again.
+func (q *retryQueue) add(name string) error {
+	i, ok := q.index[name]
+	if !ok {
+		return errUnknownRepo
+	}
+	if q.cfg.stopping() {
+		return errors.New("the run is stopping")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[name] || q.cfg.Progress.Status(name) != report.StatusFailed {
+		return errNotFailed
+	}
+	q.pending[name] = true
+	q.cfg.Progress.Queue(name)
+	q.jobs <- i
+	return nil
+}
+
+func (q *retryQueue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case i := <-q.jobs:
+			name := *q.repos[i].Name
+			q.cfg.Results.Retry(name)
+			q.process(i)
+			q.mu.Lock()
+			delete(q.pending, name)
+			q.mu.Unlock()
+		case <-q.cfg.stop:
+			return
+		case <-q.cfg.runContext().Done():
+			return
+		}
+	}
+}
+
+// wait returns once the run is stopped, after the retry in progress.
+func (q *retryQueue) wait() {
+	<-q.done
+}
+
+// dashboardPage renders the status endpoint every two seconds.
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ghmgr</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #24292e; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #e1e4e8; vertical-align: top; }
+.failed { color: #cb2431; } .partial { color: #b08800; } .migrated { color: #22863a; } .running { color: #0366d6; }
+.errors { font-family: monospace; font-size: 0.85em; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>ghmgr</h1>
+<p id="summary"></p>
+<table>
+<thead><tr><th>repository</th><th>status</th><th>step</th><th>duration</th><th>steps</th><th>errors</th><th></th></tr></thead>
+<tbody id="repos"></tbody>
+</table>
+<script>
+function cell(row, text, cls) {
+  var td = row.insertCell();
+  td.textContent = text || "";
+  if (cls) td.className = cls;
+  return td;
+}
+function retry(name) {
+  var token = sessionStorage.getItem("token");
+  fetch("/api/repositories/" + encodeURIComponent(name) + "/retry",
+    {method: "POST", headers: token ? {"Authorization": "Bearer " + token} : {}})
+    .then(function (r) {
+      if (r.status === 401) {
+        token = prompt("server.token");
+        if (token) {
+          sessionStorage.setItem("token", token);
+          retry(name);
+        }
+        return;
+      }
+      if (!r.ok) r.text().then(alert);
+      refresh();
+    });
+}
+function refresh() {
+  fetch("/api/status").then(function (r) { return r.json(); }).then(function (s) {
+    document.getElementById("summary").textContent = s.done + "/" + s.total + " repositories, " + s.failed +
+      " failed, elapsed " + s.elapsed + ", eta " + s.eta + ", " + s.repositories_per_hour + " repositories per hour" +
+      (s.finished ? ", finished" : "");
+    var body = document.getElementById("repos");
+    body.innerHTML = "";
+    (s.repositories || []).forEach(function (r) {
+      var row = body.insertRow();
+      cell(row, r.name);
+      cell(row, r.status, r.status);
+      cell(row, r.step ? r.step + (r.percent ? " " + r.percent + "%" : "") : "");
+      cell(row, r.duration);
+      cell(row, (r.steps || []).join(", "));
+      cell(row, (r.errors || []).join("\n"), "errors");
+      var td = cell(row, "");
+      if (r.status === "failed") {
+        var b = document.createElement("button");
+        b.textContent = "retry";
+        b.onclick = function () { retry(r.name); };
+        td.appendChild(b);
+      }
+    });
+  });
+}
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/leocomelli/ghmgr/config"
+)
+
+func TestDashboardRetryAuthorization(t *testing.T) {
+	tests := []struct {
+		token, remote, origin, authorization string
+		status                               int
+	}{
+		// without server.token, only this host retries
+		{"", "127.0.0.1:1234", "", "", http.StatusAccepted},
+		{"", "192.0.2.1:1234", "", "", http.StatusForbidden},
+		{"s3cr3t", "192.0.2.1:1234", "", "", http.StatusUnauthorized},
+		{"s3cr3t", "192.0.2.1:1234", "", "Bearer wrong", http.StatusUnauthorized},
+		{"s3cr3t", "192.0.2.1:1234", "", "Bearer s3cr3t", http.StatusAccepted},
+		// the pages of the other sites never retry
+		{"", "127.0.0.1:1234", "http://evil.example", "", http.StatusForbidden},
+		{"s3cr3t", "192.0.2.1:1234", "http://evil.example", "Bearer s3cr3t", http.StatusForbidden},
+		{"", "127.0.0.1:1234", "http://example.com", "", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		c := &config.Configuration{}
+		c.Server.Token = tt.token
+		retried := false
+		d := &dashboard{cfg: &migration{Configuration: c}, retry: func(name string) error {
+			retried = name == "api"
+			return nil
+		}}
+
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/api/repositories/api/retry", nil)
+		r.RemoteAddr = tt.remote
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		d.retryRepo(w, r)
+
+		if w.Code != tt.status || retried != (tt.status == http.StatusAccepted) {
+			t.Errorf("token %q, from %s, origin %q, %q: status %d, retried %v, want %d",
+				tt.token, tt.remote, tt.origin, tt.authorization, w.Code, retried, tt.status)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+func migrateDeployKeys(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	opts := &gh.ListOptions{PerPage: 100}
+
+	var keys []*gh.Key
+	for {
+		kk, resp, err := cfg.Source.Instance.Repositories.ListKeys(ctx, cfg.Source.Organization, *source.Name, opts)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, kk...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	l.WithField("amount", len(keys)).Info("migrating the deploy keys...")
+
+	for _, k := range keys {
+		_, resp, err := cfg.Target.Instance.Repositories.CreateKey(ctx, cfg.Target.Organization, *target.Name, &gh.Key{
+			Title:    k.Title,
+			Key:      k.Key,
+			ReadOnly: gh.Bool(k.GetReadOnly()),
+		})
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+				// already added, or used by another repository of the same instance
+				l.WithField("title", k.GetTitle()).WithError(err).Warn("the deploy key cannot be added, skipping")
+				continue
+			}
+			return fmt.Errorf("deploy key %s: %v", k.GetTitle(), err)
+		}
+
+		l.WithField("title", k.GetTitle()).WithField("read_only", k.GetReadOnly()).Info("a deploy key was migrated successfully")
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+)
+
+type branchDiff struct {
+	Branch        string `json:"branch"`
+	SourceCommits int    `json:"source_commits"`
+	TargetCommits int    `json:"target_commits"`
+	Missing       bool   `json:"missing_on_target,omitempty"`
+}
+
+// repoDiff is the drift of a repository between source and target, the
+// trees being the ones of the tip of the default branch.
+type repoDiff struct {
+	Name        string       `json:"name"`
+	Target      string       `json:"target"`
+	Missing     bool         `json:"missing_on_target,omitempty"`
+	Branches    []branchDiff `json:"branches,omitempty"`
+	MissingTags []string     `json:"missing_tags,omitempty"`
+	ExtraTags   []string     `json:"extra_tags,omitempty"`
+	SourceTree  string       `json:"source_tree,omitempty"`
+	TargetTree  string       `json:"target_tree,omitempty"`
+	Drift       bool         `json:"drift"`
+}
+
+// countCommits counts the commits reachable from branch, reading the
+// number of pages of one commit each.
+func countCommits(cfg *migration, client *gh.Client, owner, repo, branch string) (int, error) {
+	opts := &gh.CommitsListOptions{SHA: branch, ListOptions: gh.ListOptions{PerPage: 1}}
+	commits, resp, err := client.Repositories.ListCommits(cfg.runContext(), owner, repo, opts)
+	if err != nil {
+		return 0, err
+	}
+	if resp.LastPage > 0 {
+		return resp.LastPage, nil
+	}
+	return len(commits), nil
+}
+
+func treeSHA(cfg *migration, client *gh.Client, owner, repo, branch string) (string, error) {
+	b, _, err := client.Repositories.GetBranch(cfg.runContext(), owner, repo, branch)
+	if err != nil {
+		return "", err
+	}
+	return b.GetCommit().GetCommit().GetTree().GetSHA(), nil
+}
+
+func diffRepo(cfg *migration, source *gh.Repository) (*repoDiff, error) {
+	src, tgt := cfg.Source, cfg.Target
+	d := &repoDiff{Name: *source.Name, Target: targetName(cfg, *source.Name)}
+
+	target, err := existingRepo(cfg, d.Target)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		d.Missing, d.Drift = true, true
+		return d, nil
+	}
+
+	sourceRefs, err := listRefs(cfg.runContext(), src.Instance, src.Organization, *source.Name)
+	if err != nil {
+		return nil, err
+	}
+	targetRefs, err := listRefs(cfg.runContext(), tgt.Instance, tgt.Organization, d.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []string
+	for ref := range sourceRefs {
+		if strings.HasPrefix(ref, "refs/heads/") && (cfg.Git.Mirror && cfg.refs.Match(ref) || ref == "refs/heads/"+source.GetDefaultBranch()) {
+			branches = append(branches, strings.TrimPrefix(ref, "refs/heads/"))
+		}
+	}
+	sort.Strings(branches)
+
+	for _, b := range branches {
+		bd := branchDiff{Branch: b}
+		bd.SourceCommits, err = countCommits(cfg, src.Instance, src.Organization, *source.Name, b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", b, err)
+		}
+		if _, ok := targetRefs["refs/heads/"+targetBranch(cfg, b)]; ok {
+			bd.TargetCommits, err = countCommits(cfg, tgt.Instance, tgt.Organization, d.Target, targetBranch(cfg, b))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", b, err)
+			}
+		} else {
+			bd.Missing = true
+		}
+		d.Drift = d.Drift || bd.Missing || bd.SourceCommits != bd.TargetCommits
+		d.Branches = append(d.Branches, bd)
+	}
+
+	for ref := range sourceRefs {
+		if _, ok := targetRefs[ref]; !ok && strings.HasPrefix(ref, "refs/tags/") && cfg.refs.Match(ref) {
+			d.MissingTags = append(d.MissingTags, strings.TrimPrefix(ref, "refs/tags/"))
+		}
+	}
+	for ref := range targetRefs {
+		if _, ok := sourceRefs[ref]; !ok && strings.HasPrefix(ref, "refs/tags/") {
+			d.ExtraTags = append(d.ExtraTags, strings.TrimPrefix(ref, "refs/tags/"))
+		}
+	}
+	sort.Strings(d.MissingTags)
+	sort.Strings(d.ExtraTags)
+	// the tags are only pushed in mirror mode
+	if cfg.Git.Mirror {
+		d.Drift = d.Drift || len(d.MissingTags) > 0 || len(d.ExtraTags) > 0
+	}
+
+	if b := source.GetDefaultBranch(); b != "" && sourceRefs["refs/heads/"+b] != "" {
+		d.SourceTree, err = treeSHA(cfg, src.Instance, src.Organization, *source.Name, b)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := targetRefs["refs/heads/"+targetBranch(cfg, b)]; ok {
+			d.TargetTree, err = treeSHA(cfg, tgt.Instance, tgt.Organization, d.Target, targetBranch(cfg, b))
+			if err != nil {
+				return nil, err
+			}
+		}
+		d.Drift = d.Drift || d.SourceTree != d.TargetTree
+	}
+
+	return d, nil
+}
+
+// runDiff prints the drift of the migrated repositories as json: with a
+// state file, the ones pushed by the run only.
+func runDiff(cfg *migration, repos []*gh.Repository) error {
+	if (cfg.Target.Type != "" && cfg.Target.Type != config.TargetGitHub) || (cfg.Source.Type != "" && cfg.Source.Type != config.SourceGitHub) {
+		return errors.New("the report diff command is only supported between GitHub instances")
+	}
+
+	diffs := []*repoDiff{}
+	drifted := 0
+	for _, repo := range repos {
+		if cfg.stopping() {
+			break
+		}
+		if cfg.State != nil && !cfg.State.Done(*repo.Name, stepPush) {
+			continue
+		}
+		d, err := diffRepo(cfg, repo)
+		if err != nil {
+			return fmt.Errorf("%s: %v", *repo.Name, err)
+		}
+		if d.Drift {
+			drifted++
+		}
+		diffs = append(diffs, d)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(diffs); err != nil {
+		return err
+	}
+
+	if drifted > 0 {
+		return fmt.Errorf("%d of %d repositories drifted from the source", drifted, len(diffs))
+	}
+	return nil
+}
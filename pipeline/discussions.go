@@ -0,0 +1,433 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const discussionsQuery = `query($owner: String!, $name: String!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    discussions(first: 25, after: $after, orderBy: {field: CREATED_AT, direction: ASC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        number title body createdAt url locked closed
+        author { login }
+        category { name }
+      }
+    }
+  }
+}`
+
+const discussionCommentsQuery = `query($owner: String!, $name: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    discussion(number: $number) {
+      comments(first: 50, after: $after) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          body createdAt url isAnswer
+          author { login }
+          replies(first: 100) { nodes { body createdAt url author { login } } }
+        }
+      }
+    }
+  }
+}`
+
+const discussionTargetQuery = `query($owner: String!, $name: String!) {
+  repository(owner: $owner, name: $name) {
+    id
+    discussionCategories(first: 100) { nodes { id name } }
+  }
+}`
+
+// the discussions and comments of the target, found by their attribution
+const targetDiscussionsQuery = `query($owner: String!, $name: String!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    discussions(first: 50, after: $after) {
+      pageInfo { hasNextPage endCursor }
+      nodes { id number body closed locked }
+    }
+  }
+}`
+
+const targetDiscussionCommentsQuery = `query($owner: String!, $name: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    discussion(number: $number) {
+      comments(first: 50, after: $after) {
+        pageInfo { hasNextPage endCursor }
+        nodes { id body isAnswer replies(first: 100) { nodes { body } } }
+      }
+    }
+  }
+}`
+
+const (
+	createDiscussionMutation = `mutation($repo: ID!, $category: ID!, $title: String!, $body: String!) {
+  createDiscussion(input: {repositoryId: $repo, categoryId: $category, title: $title, body: $body}) { discussion { id number } }
+}`
+	addDiscussionCommentMutation = `mutation($discussion: ID!, $body: String!, $replyTo: ID) {
+  addDiscussionComment(input: {discussionId: $discussion, body: $body, replyToId: $replyTo}) { comment { id } }
+}`
+	markAnswerMutation      = `mutation($id: ID!) { markDiscussionCommentAsAnswer(input: {id: $id}) { discussion { id } } }`
+	closeDiscussionMutation = `mutation($id: ID!) { closeDiscussion(input: {discussionId: $id}) { discussion { id } } }`
+	lockDiscussionMutation  = `mutation($id: ID!) { lockLockable(input: {lockableId: $id}) { lockedRecord { locked } } }`
+)
+
+type discussionAuthor struct {
+	Login string `json:"login"`
+}
+
+// login is the one of the author, ghost for a deleted account.
+func (a *discussionAuthor) login() string {
+	if a == nil || a.Login == "" {
+		return "ghost"
+	}
+	return a.Login
+}
+
+type discussionPost struct {
+	Body      string            `json:"body"`
+	CreatedAt time.Time         `json:"createdAt"`
+	URL       string            `json:"url"`
+	Author    *discussionAuthor `json:"author"`
+}
+
+type discussion struct {
+	discussionPost
+	Number   int    `json:"number"`
+	Title    string `json:"title"`
+	Locked   bool   `json:"locked"`
+	Closed   bool   `json:"closed"`
+	Category struct {
+		Name string `json:"name"`
+	} `json:"category"`
+}
+
+type discussionComment struct {
+	discussionPost
+	IsAnswer bool `json:"isAnswer"`
+	Replies  struct {
+		Nodes []*discussionPost `json:"nodes"`
+	} `json:"replies"`
+}
+
+// postedDiscussion is a discussion of the target, created by a previous
+// run or attempt.
+type postedDiscussion struct {
+	ID     string `json:"id"`
+	Number int    `json:"number"`
+	Body   string `json:"body"`
+	Closed bool   `json:"closed"`
+	Locked bool   `json:"locked"`
+}
+
+// postedDiscussionComment is a comment of a discussion of the target, with
+// the source urls of its replies.
+type postedDiscussionComment struct {
+	ID       string
+	IsAnswer bool
+	replies  map[string]bool
+}
+
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+func listDiscussions(cfg *migration, repo *gh.Repository) ([]*discussion, error) {
+	vars := map[string]interface{}{"owner": cfg.Source.Organization, "name": *repo.Name}
+	var discussions []*discussion
+	for {
+		var data struct {
+			Repository struct {
+				Discussions struct {
+					PageInfo pageInfo      `json:"pageInfo"`
+					Nodes    []*discussion `json:"nodes"`
+				} `json:"discussions"`
+			} `json:"repository"`
+		}
+		if err := github.GraphQL(cfg.runContext(), cfg.Source.Instance, discussionsQuery, vars, &data); err != nil {
+			return nil, err
+		}
+		d := data.Repository.Discussions
+		discussions = append(discussions, d.Nodes...)
+		if !d.PageInfo.HasNextPage {
+			break
+		}
+		vars["after"] = d.PageInfo.EndCursor
+	}
+	return discussions, nil
+}
+
+// listDiscussionComments lists the comments of a discussion with their
+// first 100 replies.
+func listDiscussionComments(cfg *migration, repo *gh.Repository, number int) ([]*discussionComment, error) {
+	vars := map[string]interface{}{"owner": cfg.Source.Organization, "name": *repo.Name, "number": number}
+	var comments []*discussionComment
+	for {
+		var data struct {
+			Repository struct {
+				Discussion struct {
+					Comments struct {
+						PageInfo pageInfo             `json:"pageInfo"`
+						Nodes    []*discussionComment `json:"nodes"`
+					} `json:"comments"`
+				} `json:"discussion"`
+			} `json:"repository"`
+		}
+		if err := github.GraphQL(cfg.runContext(), cfg.Source.Instance, discussionCommentsQuery, vars, &data); err != nil {
+			return nil, err
+		}
+		c := data.Repository.Discussion.Comments
+		comments = append(comments, c.Nodes...)
+		if !c.PageInfo.HasNextPage {
+			break
+		}
+		vars["after"] = c.PageInfo.EndCursor
+	}
+	return comments, nil
+}
+
+// targetDiscussions are the discussions of the target created by a previous
+// run or attempt, by the source url of their attribution.
+func targetDiscussions(cfg *migration, target *gh.Repository) (map[string]*postedDiscussion, error) {
+	vars := map[string]interface{}{"owner": cfg.Target.Organization, "name": *target.Name}
+	posted := map[string]*postedDiscussion{}
+	for {
+		var data struct {
+			Repository struct {
+				Discussions struct {
+					PageInfo pageInfo            `json:"pageInfo"`
+					Nodes    []*postedDiscussion `json:"nodes"`
+				} `json:"discussions"`
+			} `json:"repository"`
+		}
+		if err := github.GraphQL(cfg.runContext(), cfg.Target.Instance, targetDiscussionsQuery, vars, &data); err != nil {
+			return nil, err
+		}
+		d := data.Repository.Discussions
+		for _, n := range d.Nodes {
+			if u := attributedURL(n.Body); u != "" {
+				posted[u] = n
+			}
+		}
+		if !d.PageInfo.HasNextPage {
+			break
+		}
+		vars["after"] = d.PageInfo.EndCursor
+	}
+	return posted, nil
+}
+
+// targetDiscussionComments are the comments already posted on the target
+// discussion number, by the source url of their attribution.
+func targetDiscussionComments(cfg *migration, target *gh.Repository, number int) (map[string]*postedDiscussionComment, error) {
+	vars := map[string]interface{}{"owner": cfg.Target.Organization, "name": *target.Name, "number": number}
+	posted := map[string]*postedDiscussionComment{}
+	for {
+		var data struct {
+			Repository struct {
+				Discussion struct {
+					Comments struct {
+						PageInfo pageInfo `json:"pageInfo"`
+						Nodes    []struct {
+							ID       string `json:"id"`
+							Body     string `json:"body"`
+							IsAnswer bool   `json:"isAnswer"`
+							Replies  struct {
+								Nodes []struct {
+									Body string `json:"body"`
+								} `json:"nodes"`
+							} `json:"replies"`
+						} `json:"nodes"`
+					} `json:"comments"`
+				} `json:"discussion"`
+			} `json:"repository"`
+		}
+		if err := github.GraphQL(cfg.runContext(), cfg.Target.Instance, targetDiscussionCommentsQuery, vars, &data); err != nil {
+			return nil, err
+		}
+		c := data.Repository.Discussion.Comments
+		for _, n := range c.Nodes {
+			u := attributedURL(n.Body)
+			if u == "" {
+				continue
+			}
+			p := &postedDiscussionComment{ID: n.ID, IsAnswer: n.IsAnswer, replies: map[string]bool{}}
+			for _, r := range n.Replies.Nodes {
+				p.replies[attributedURL(r.Body)] = true
+			}
+			posted[u] = p
+		}
+		if !c.PageInfo.HasNextPage {
+			break
+		}
+		vars["after"] = c.PageInfo.EndCursor
+	}
+	return posted, nil
+}
+
+// discussionTarget returns the id of the target repository and its
+// categories by name, enabling the discussions when they are not.
+func discussionTarget(cfg *migration, target *gh.Repository) (string, map[string]string, error) {
+	ctx := cfg.runContext()
+	body := map[string]interface{}{"has_discussions": true}
+	if _, err := github.Request(ctx, cfg.Target.Instance, "PATCH", fmt.Sprintf("repos/%s/%s", cfg.Target.Organization, *target.Name), "", body, nil); err != nil {
+		return "", nil, fmt.Errorf("enabling the discussions: %v", err)
+	}
+
+	var data struct {
+		Repository struct {
+			ID                   string `json:"id"`
+			DiscussionCategories struct {
+				Nodes []struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"nodes"`
+			} `json:"discussionCategories"`
+		} `json:"repository"`
+	}
+	vars := map[string]interface{}{"owner": cfg.Target.Organization, "name": *target.Name}
+	if err := github.GraphQL(ctx, cfg.Target.Instance, discussionTargetQuery, vars, &data); err != nil {
+		return "", nil, err
+	}
+	categories := map[string]string{}
+	for _, c := range data.Repository.DiscussionCategories.Nodes {
+		categories[strings.ToLower(c.Name)] = c.ID
+	}
+	return data.Repository.ID, categories, nil
+}
+
+// migrateDiscussions copies the discussions with their comments, replies
+// and accepted answers. The api cannot create the categories: a discussion
+// whose category is missing on the target goes to General, its category
+// being told in its body. The discussions of a previous run or attempt only
+// get what is missing on the target.
+func migrateDiscussions(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	discussions, err := listDiscussions(cfg, source)
+	if err != nil {
+		return err
+	}
+	if len(discussions) == 0 {
+		l.Info("the repository has no discussions")
+		return nil
+	}
+
+	repoID, categories, err := discussionTarget(cfg, target)
+	if err != nil {
+		return err
+	}
+
+	migrated, err := targetDiscussions(cfg, target)
+	if err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(discussions)).WithField("migrated", len(migrated)).Info("migrating the discussions...")
+
+	for _, d := range discussions {
+		text := d.Body
+		category, ok := categories[strings.ToLower(d.Category.Name)]
+		if !ok {
+			if category, ok = categories["general"]; !ok {
+				return fmt.Errorf("discussion #%d: the category %s and the General one are missing on the target", d.Number, d.Category.Name)
+			}
+			text = fmt.Sprintf("_category: %s_\n\n%s", d.Category.Name, text)
+			l.WithField("discussion", d.Number).WithField("category", d.Category.Name).Warn("the category is missing on the target, the discussion goes to General")
+		}
+
+		client, body := attribute(cfg, d.Author.login(), d.CreatedAt, d.URL, text)
+		n, resumed := migrated[attributedURL(body)]
+		posted := map[string]*postedDiscussionComment{}
+		if resumed {
+			l.WithField("source", d.Number).WithField("target", n.Number).Info("the discussion was already migrated, resuming its comments")
+			if posted, err = targetDiscussionComments(cfg, target, n.Number); err != nil {
+				return fmt.Errorf("discussion #%d: %v", d.Number, err)
+			}
+		} else {
+			var created struct {
+				CreateDiscussion struct {
+					Discussion *postedDiscussion `json:"discussion"`
+				} `json:"createDiscussion"`
+			}
+			vars := map[string]interface{}{"repo": repoID, "category": category, "title": cfg.scrubber.scrub(d.Title), "body": body}
+			if err := github.GraphQL(ctx, client, createDiscussionMutation, vars, &created); err != nil {
+				return fmt.Errorf("discussion #%d: %v", d.Number, err)
+			}
+			n = created.CreateDiscussion.Discussion
+		}
+		cfg.references.record(*source.Name, d.Number, n.Number)
+
+		comments, err := listDiscussionComments(cfg, source, d.Number)
+		if err != nil {
+			return fmt.Errorf("discussion #%d: %v", d.Number, err)
+		}
+		for _, c := range comments {
+			p := posted[attributionURL(cfg, c.Author.login(), c.CreatedAt, c.URL)]
+			if p == nil {
+				id, err := addDiscussionComment(cfg, n.ID, "", &c.discussionPost)
+				if err != nil {
+					return fmt.Errorf("discussion #%d comment: %v", d.Number, err)
+				}
+				p = &postedDiscussionComment{ID: id}
+			}
+			for _, r := range c.Replies.Nodes {
+				if p.replies[attributionURL(cfg, r.Author.login(), r.CreatedAt, r.URL)] {
+					continue
+				}
+				if _, err := addDiscussionComment(cfg, n.ID, p.ID, r); err != nil {
+					return fmt.Errorf("discussion #%d reply: %v", d.Number, err)
+				}
+			}
+			if c.IsAnswer && !p.IsAnswer {
+				if err := github.GraphQL(ctx, cfg.Target.Instance, markAnswerMutation, map[string]interface{}{"id": p.ID}, nil); err != nil {
+					return fmt.Errorf("discussion #%d answer: %v", d.Number, err)
+				}
+			}
+		}
+
+		if d.Closed && !n.Closed {
+			if err := github.GraphQL(ctx, cfg.Target.Instance, closeDiscussionMutation, map[string]interface{}{"id": n.ID}, nil); err != nil {
+				return fmt.Errorf("discussion #%d: %v", d.Number, err)
+			}
+		}
+		if d.Locked && !n.Locked {
+			if err := github.GraphQL(ctx, cfg.Target.Instance, lockDiscussionMutation, map[string]interface{}{"id": n.ID}, nil); err != nil {
+				return fmt.Errorf("discussion #%d: %v", d.Number, err)
+			}
+		}
+
+		l.WithField("source", d.Number).WithField("target", n.Number).WithField("comments", len(comments)).
+			Info("a discussion was migrated successfully")
+	}
+
+	return nil
+}
+
+// addDiscussionComment posts a comment, or a reply to replyTo, returning
+// its id.
+func addDiscussionComment(cfg *migration, discussion, replyTo string, p *discussionPost) (string, error) {
+	client, body := attribute(cfg, p.Author.login(), p.CreatedAt, p.URL, p.Body)
+	vars := map[string]interface{}{"discussion": discussion, "body": body}
+	if replyTo != "" {
+		vars["replyTo"] = replyTo
+	}
+	var data struct {
+		AddDiscussionComment struct {
+			Comment struct {
+				ID string `json:"id"`
+			} `json:"comment"`
+		} `json:"addDiscussionComment"`
+	}
+	if err := github.GraphQL(cfg.runContext(), client, addDiscussionCommentMutation, vars, &data); err != nil {
+		return "", err
+	}
+	return data.AddDiscussionComment.Comment.ID, nil
+}
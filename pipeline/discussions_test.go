@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github/githubtest"
+	log "github.com/sirupsen/logrus"
+)
+
+// discussionBoard serves the discussions api of a target repository, the
+// comment of failBody failing once.
+type discussionBoard struct {
+	mu          sync.Mutex
+	discussions []map[string]interface{}
+	comments    []map[string]interface{}
+	failBody    string
+}
+
+func newDiscussionBoard(s *githubtest.Server) *discussionBoard {
+	b := &discussionBoard{}
+	s.Handle("PATCH", "repos/acme-new/api", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, map[string]interface{}{})
+	})
+	s.Handle("POST", "api/graphql", func(w http.ResponseWriter, r *http.Request, path string) {
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		data, err := b.answer(req.Query, req.Variables)
+		if err != nil {
+			githubtest.Reply(w, http.StatusOK, map[string]interface{}{"errors": []interface{}{map[string]string{"message": err.Error()}}})
+			return
+		}
+		githubtest.Reply(w, http.StatusOK, map[string]interface{}{"data": data})
+	})
+	return b
+}
+
+func (b *discussionBoard) answer(query string, vars map[string]interface{}) (interface{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	comment := func(id interface{}) map[string]interface{} {
+		for _, c := range b.comments {
+			if c["id"] == id {
+				return c
+			}
+		}
+		return nil
+	}
+	page := map[string]interface{}{"hasNextPage": false}
+
+	switch {
+	case strings.Contains(query, "discussionCategories"):
+		return map[string]interface{}{"repository": map[string]interface{}{
+			"id": "R1", "discussionCategories": map[string]interface{}{"nodes": []interface{}{map[string]string{"id": "C1", "name": "General"}}},
+		}}, nil
+	case strings.Contains(query, "createDiscussion"):
+		d := map[string]interface{}{"id": fmt.Sprintf("D%d", len(b.discussions)+1), "number": len(b.discussions) + 1, "body": vars["body"]}
+		b.discussions = append(b.discussions, d)
+		return map[string]interface{}{"createDiscussion": map[string]interface{}{"discussion": d}}, nil
+	case strings.Contains(query, "addDiscussionComment"):
+		body := vars["body"].(string)
+		if b.failBody != "" && strings.Contains(body, b.failBody) {
+			b.failBody = ""
+			return nil, fmt.Errorf("something went wrong")
+		}
+		c := map[string]interface{}{"id": fmt.Sprintf("DC%d", len(b.comments)+1), "body": body, "replyTo": vars["replyTo"]}
+		b.comments = append(b.comments, c)
+		return map[string]interface{}{"addDiscussionComment": map[string]interface{}{"comment": c}}, nil
+	case strings.Contains(query, "markDiscussionCommentAsAnswer"):
+		comment(vars["id"])["isAnswer"] = true
+		return map[string]interface{}{}, nil
+	case strings.Contains(query, "closeDiscussion"):
+		b.discussions[0]["closed"] = true
+		return map[string]interface{}{}, nil
+	case strings.Contains(query, "comments(first"):
+		var nodes []interface{}
+		for _, c := range b.comments {
+			if c["replyTo"] != nil {
+				continue
+			}
+			var replies []interface{}
+			for _, r := range b.comments {
+				if r["replyTo"] == c["id"] {
+					replies = append(replies, r)
+				}
+			}
+			node := map[string]interface{}{"id": c["id"], "body": c["body"], "isAnswer": c["isAnswer"] == true,
+				"replies": map[string]interface{}{"nodes": replies}}
+			nodes = append(nodes, node)
+		}
+		return map[string]interface{}{"repository": map[string]interface{}{"discussion": map[string]interface{}{
+			"comments": map[string]interface{}{"pageInfo": page, "nodes": nodes},
+		}}}, nil
+	case strings.Contains(query, "discussions(first"):
+		return map[string]interface{}{"repository": map[string]interface{}{
+			"discussions": map[string]interface{}{"pageInfo": page, "nodes": b.discussions},
+		}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %s", query)
+}
+
+// bodies returns the bodies of the comments and replies, in the order they
+// were posted.
+func (b *discussionBoard) bodies() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var bodies []string
+	for _, c := range b.comments {
+		bodies = append(bodies, c["body"].(string))
+	}
+	return bodies
+}
+
+func TestMigrateDiscussionsResume(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	cfg.Migrate.Discussions = true
+	m := newTestMigration(t, cfg)
+
+	post := func(path string) map[string]interface{} {
+		return map[string]interface{}{"body": path, "createdAt": "2020-01-02T10:00:00Z", "url": "https://github.com/acme/api/" + path,
+			"author": map[string]string{"login": "alice"}}
+	}
+	f.source.Handle("POST", "api/graphql", func(w http.ResponseWriter, r *http.Request, path string) {
+		page := map[string]interface{}{"hasNextPage": false}
+		var req struct {
+			Query string `json:"query"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(req.Query, "comments(first") {
+			first, second := post("discussions/1#discussioncomment-1"), post("discussions/1#discussioncomment-3")
+			first["replies"] = map[string]interface{}{"nodes": []interface{}{post("discussions/1#discussioncomment-2")}}
+			second["isAnswer"] = true
+			githubtest.Reply(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"repository": map[string]interface{}{
+				"discussion": map[string]interface{}{"comments": map[string]interface{}{"pageInfo": page, "nodes": []interface{}{first, second}}},
+			}}})
+			return
+		}
+		d := post("discussions/1")
+		d["number"], d["title"], d["closed"], d["category"] = 1, "question", true, map[string]string{"name": "General"}
+		githubtest.Reply(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"repository": map[string]interface{}{
+			"discussions": map[string]interface{}{"pageInfo": page, "nodes": []interface{}{d}},
+		}}})
+	})
+	board := newDiscussionBoard(f.target)
+	// the reply fails, leaving the discussion halfway
+	board.failBody = "discussioncomment-2"
+
+	repo := &gh.Repository{Name: gh.String("api")}
+	if err := migrateDiscussions(m, repo, repo, log.WithField("repo", "api")); err == nil {
+		t.Fatal("the failing reply did not fail the step")
+	}
+	for i := 0; i < 2; i++ {
+		if err := migrateDiscussions(m, repo, repo, log.WithField("repo", "api")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := len(board.discussions); n != 1 {
+		t.Fatalf("%d discussions on the target, want 1", n)
+	}
+	want := []string{"discussioncomment-1", "discussioncomment-2", "discussioncomment-3"}
+	bodies := board.bodies()
+	if len(bodies) != len(want) {
+		t.Fatalf("comments = %q, want %q once", bodies, want)
+	}
+	for i, w := range want {
+		if !strings.Contains(bodies[i], w) {
+			t.Errorf("comment %d = %q, want %s", i, bodies[i], w)
+		}
+	}
+	if board.comments[1]["replyTo"] != board.comments[0]["id"] {
+		t.Errorf("the reply was posted to %v, want %v", board.comments[1]["replyTo"], board.comments[0]["id"])
+	}
+	if board.comments[2]["isAnswer"] != true || board.discussions[0]["closed"] != true {
+		t.Errorf("the answer or the close of the discussion is missing")
+	}
+}
@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/gitops"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// the repository listed on the target to check the git credentials, its
+// absence is the expected answer
+const doctorProbe = "ghmgr-doctor-probe"
+
+type doctorCheck struct {
+	name string
+	run  func(cfg *migration, repos []*gh.Repository) (string, error)
+}
+
+var doctorChecks = []doctorCheck{
+	{"source_api", checkSourceAPI},
+	{"target_api", checkTargetAPI},
+	{"source_git", checkSourceGit},
+	{"target_git", checkTargetGit},
+	{"clone_path", checkClonePath},
+}
+
+// runDoctor checks the access of both sides before a migration is
+// started, every failed check being reported.
+func runDoctor(cfg *migration, repos []*gh.Repository) error {
+	failed := 0
+	for _, c := range doctorChecks {
+		l := log.WithField("check", c.name)
+		msg, err := c.run(cfg, repos)
+		if err != nil {
+			l.WithError(err).Error("the check failed")
+			failed++
+			continue
+		}
+		l.Info(msg)
+	}
+
+	if failed > 0 {
+		return partialError(failed, len(doctorChecks), "%d of %d checks failed", failed, len(doctorChecks))
+	}
+	return nil
+}
+
+// checkSourceAPI reads the organization, the listing of the repositories
+// having run already.
+func checkSourceAPI(cfg *migration, repos []*gh.Repository) (string, error) {
+	if cfg.Source.Type != "" && cfg.Source.Type != config.SourceGitHub || cfg.Source.User != "" {
+		return fmt.Sprintf("the source listed %d repositories", len(repos)), nil
+	}
+	org := cfg.Source.Organization
+	if _, _, err := cfg.Source.Instance.Organizations.Get(cfg.runContext(), org); err != nil {
+		return "", fmt.Errorf("the organization %s cannot be read: %v", org, err)
+	}
+	return fmt.Sprintf("the organization %s can be read, %d repositories listed", org, len(repos)), nil
+}
+
+// checkTargetAPI checks that the target token may create repositories in
+// the target organization: as an owner, or as a member when the members can
+// create repositories.
+func checkTargetAPI(cfg *migration, repos []*gh.Repository) (string, error) {
+	if cfg.Target.Type != "" && cfg.Target.Type != config.TargetGitHub {
+		return fmt.Sprintf("the permissions of a %s target are not checked", cfg.Target.Type), nil
+	}
+	if cfg.Target.App.Enabled() {
+		return "the permissions of a github app installation are not checked", nil
+	}
+	ctx := cfg.runContext()
+	org := cfg.Target.Organization
+
+	user, resp, err := cfg.Target.Instance.Users.Get(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("the target token is not valid: %v", err)
+	}
+	// only the classic tokens tell their scopes
+	if scopes := resp.Header.Get("X-OAuth-Scopes"); scopes != "" && !contains(strings.Split(strings.Replace(scopes, " ", "", -1), ","), "repo") {
+		return "", fmt.Errorf("the target token lacks the repo scope, it has %s", scopes)
+	}
+
+	m, _, err := cfg.Target.Instance.Organizations.GetOrgMembership(ctx, "", org)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a member of the organization %s: %v", user.GetLogin(), org, err)
+	}
+	if m.GetRole() == "admin" {
+		return fmt.Sprintf("%s owns the organization %s", user.GetLogin(), org), nil
+	}
+	// members_can_create_repositories is not known by the client
+	req, err := cfg.Target.Instance.NewRequest("GET", "orgs/"+org, nil)
+	if err != nil {
+		return "", err
+	}
+	var o struct {
+		MembersCanCreate bool `json:"members_can_create_repositories"`
+	}
+	if _, err := cfg.Target.Instance.Do(ctx, req, &o); err != nil {
+		return "", err
+	}
+	if !o.MembersCanCreate {
+		return "", fmt.Errorf("%s is a member of the organization %s, whose members cannot create repositories", user.GetLogin(), org)
+	}
+	return fmt.Sprintf("%s is a member of the organization %s and may create repositories", user.GetLogin(), org), nil
+}
+
+func checkSourceGit(cfg *migration, repos []*gh.Repository) (string, error) {
+	if len(repos) == 0 {
+		return "no repository was selected, the git credentials of the source are not checked", nil
+	}
+	repo := repos[0]
+	auth, err := gitAuth(cfg, cfg.Source.Tokens, cfg.Source.Username, log.WithField("check", "source_git"))
+	if err != nil {
+		return "", err
+	}
+	if _, err := gitops.ListRemote(repoURL(cfg, repo), auth); err != nil {
+		return "", fmt.Errorf("%s: %v", repoURL(cfg, repo), err)
+	}
+	return fmt.Sprintf("the refs of %s can be listed", *repo.Name), nil
+}
+
+// checkTargetGit lists a repository that does not exist on the target: a
+// not found answer proves the credentials were accepted.
+func checkTargetGit(cfg *migration, repos []*gh.Repository) (string, error) {
+	host := cfg.Target.Instance.BaseURL.Host
+	if cfg.Target.Type != "" && cfg.Target.Type != config.TargetGitHub {
+		u, err := url.Parse(cfg.Target.URL)
+		if err != nil {
+			return "", err
+		}
+		host = u.Host
+	}
+	if host == "api.github.com" {
+		host = "github.com"
+	}
+	probe := &gh.Repository{
+		SSHURL:   gh.String(fmt.Sprintf("git@%s:%s/%s.git", host, cfg.Target.Organization, doctorProbe)),
+		CloneURL: gh.String(fmt.Sprintf("https://%s/%s/%s.git", host, cfg.Target.Organization, doctorProbe)),
+	}
+
+	l := log.WithField("check", "target_git")
+	auth, err := gitAuth(cfg, cfg.Source.Tokens, cfg.Source.Username, l)
+	if err == nil && useHTTPS(cfg) {
+		auth, err = gitAuth(cfg, cfg.Target.Tokens, "", l)
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = gitops.ListRemote(repoURL(cfg, probe), auth)
+	if err != nil && err != transport.ErrRepositoryNotFound {
+		return "", fmt.Errorf("%s: %v", repoURL(cfg, probe), err)
+	}
+	return fmt.Sprintf("the git credentials are accepted by %s", host), nil
+}
+
+func checkClonePath(cfg *migration, repos []*gh.Repository) (string, error) {
+	if err := os.MkdirAll(gitops.LongPath(cfg.Git.ClonePath), 0755); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(gitops.LongPath(cfg.Git.ClonePath), ".ghmgr-doctor-")
+	if err != nil {
+		return "", fmt.Errorf("%s is not writable: %v", cfg.Git.ClonePath, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return fmt.Sprintf("%s is writable", cfg.Git.ClonePath), nil
+}
@@ -0,0 +1,187 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// repoSettings are the settings of a repository compared by verify
+// settings, go-github does not know the visibility nor the
+// delete_branch_on_merge fields.
+type repoSettings struct {
+	Visibility          string `json:"visibility"`
+	Private             bool   `json:"private"`
+	HasIssues           bool   `json:"has_issues"`
+	HasProjects         bool   `json:"has_projects"`
+	HasWiki             bool   `json:"has_wiki"`
+	AllowMergeCommit    bool   `json:"allow_merge_commit"`
+	AllowRebaseMerge    bool   `json:"allow_rebase_merge"`
+	AllowSquashMerge    bool   `json:"allow_squash_merge"`
+	DeleteBranchOnMerge bool   `json:"delete_branch_on_merge"`
+}
+
+// settingDrift is a setting of the target that differs from the one the
+// migration gave it.
+type settingDrift struct {
+	Repo     string
+	Setting  string
+	Expected string
+	Target   string
+}
+
+// settingsDrift compares the settings of the target with the ones the
+// migration applies, the ones of the source along with target.settings,
+// target.visibility_map and the overrides, so only the changes made on the
+// target since are reported.
+func settingsDrift(cfg *migration, source *gh.Repository) ([]settingDrift, error) {
+	ctx := cfg.runContext()
+	src, tgt := cfg.Source, cfg.Target
+	name := targetName(cfg, *source.Name)
+
+	var drifts []settingDrift
+	compare := func(setting, expected, target string) {
+		if expected != target {
+			drifts = append(drifts, settingDrift{*source.Name, setting, expected, target})
+		}
+	}
+
+	target, err := existingRepo(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		compare("repository", "present", "missing")
+		return drifts, nil
+	}
+
+	s, t := &repoSettings{}, &repoSettings{}
+	if _, err := github.Request(ctx, src.Instance, "GET", fmt.Sprintf("repos/%s/%s", src.Organization, *source.Name), "", nil, s); err != nil {
+		return nil, err
+	}
+	if _, err := github.Request(ctx, tgt.Instance, "GET", fmt.Sprintf("repos/%s/%s", tgt.Organization, name), "", nil, t); err != nil {
+		return nil, err
+	}
+
+	opts := repoOptions(cfg, source)
+	visibility := repoVisibility(cfg, source)
+	if visibility == "" {
+		visibility = config.VisibilityPublic
+		if opts.GetPrivate() {
+			visibility = config.VisibilityPrivate
+		}
+	}
+	// the instances without internal repositories may omit the visibility
+	if t.Visibility == "" {
+		t.Visibility = config.VisibilityPublic
+		if t.Private {
+			t.Visibility = config.VisibilityPrivate
+		}
+	}
+	compare("visibility", visibility, t.Visibility)
+
+	b := strconv.FormatBool
+	compare("has_issues", b(opts.GetHasIssues()), b(t.HasIssues))
+	compare("has_projects", b(opts.GetHasProjects()), b(t.HasProjects))
+	compare("has_wiki", b(opts.GetHasWiki()), b(t.HasWiki))
+	compare("allow_merge_commit", b(opts.GetAllowMergeCommit()), b(t.AllowMergeCommit))
+	compare("allow_rebase_merge", b(opts.GetAllowRebaseMerge()), b(t.AllowRebaseMerge))
+	compare("allow_squash_merge", b(opts.GetAllowSquashMerge()), b(t.AllowSquashMerge))
+	compare("delete_branch_on_merge", b(*override(&s.DeleteBranchOnMerge, cfg.Target.Settings.DeleteBranchOnMerge)), b(t.DeleteBranchOnMerge))
+
+	sourceTopics, _, err := src.Instance.Repositories.ListAllTopics(ctx, src.Organization, *source.Name)
+	if err != nil {
+		return nil, fmt.Errorf("topics: %v", err)
+	}
+	targetTopicList, _, err := tgt.Instance.Repositories.ListAllTopics(ctx, tgt.Organization, name)
+	if err != nil {
+		return nil, fmt.Errorf("topics: %v", err)
+	}
+	compare("topics", sortedList(targetTopics(cfg, cfg.Target.Settings.Topics, sourceTopics)), sortedList(targetTopicList))
+
+	if cfg.Migrate.Protections {
+		protected, err := listProtectedBranches(cfg, src.Instance, src.Organization, *source.Name)
+		if err != nil {
+			return nil, fmt.Errorf("protections: %v", err)
+		}
+		// without mirror only the default branch is pushed
+		var expected []string
+		for _, branch := range protected {
+			if (cfg.Git.Mirror || branch == source.GetDefaultBranch()) && cfg.refs.Match("refs/heads/"+branch) {
+				expected = append(expected, targetBranch(cfg, branch))
+			}
+		}
+		actual, err := listProtectedBranches(cfg, tgt.Instance, tgt.Organization, name)
+		if err != nil {
+			return nil, fmt.Errorf("protections: %v", err)
+		}
+		compare("protected_branches", sortedList(expected), sortedList(actual))
+	}
+
+	return drifts, nil
+}
+
+// sortedList joins the values in their alphabetical order, - when empty.
+func sortedList(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	values = append([]string{}, values...)
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+// runSettingsDrift prints the settings of the migrated repositories that
+// drifted on the target: with a state file, the ones pushed by the run
+// only.
+func runSettingsDrift(cfg *migration, repos []*gh.Repository) error {
+	var drifts []settingDrift
+	checked, drifted := 0, 0
+	for _, repo := range repos {
+		if cfg.stopping() {
+			break
+		}
+		if cfg.State != nil && !cfg.State.Done(*repo.Name, stepPush) {
+			continue
+		}
+		d, err := settingsDrift(cfg, repo)
+		if err != nil {
+			return fmt.Errorf("%s: %v", *repo.Name, err)
+		}
+		checked++
+		if len(d) > 0 {
+			drifted++
+		}
+		drifts = append(drifts, d...)
+	}
+
+	printSettingsDrift(drifts, os.Stdout)
+	log.WithField("repositories", checked).WithField("drifted", drifted).Info("the settings were compared")
+
+	if drifted > 0 {
+		return partialError(drifted, checked, "%d of %d repositories have settings drifted on the target", drifted, checked)
+	}
+	return nil
+}
+
+// printSettingsDrift writes the drift table, one row per setting.
+func printSettingsDrift(drifts []settingDrift, w io.Writer) {
+	if len(drifts) == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tSETTING\tEXPECTED\tTARGET")
+	for _, d := range drifts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.Repo, d.Setting, d.Expected, d.Target)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,26 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVerifySettings(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	execute(t, cfg, Options{Command: "migrate"})
+	execute(t, cfg, Options{Command: "verify", Subcommand: "settings"})
+
+	// changed on the target after the migration
+	f.target.Repo(targetOrg, "web").Fields["has_issues"] = true
+
+	err := Execute(context.Background(), cfg, Options{Command: "verify", Subcommand: "settings"})
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("verify settings: err = %v, want a partial failure", err)
+	}
+	if partial.Failed != 1 || partial.Total != 2 {
+		t.Errorf("verify settings: %d of %d drifted, want 1 of 2", partial.Failed, partial.Total)
+	}
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/gitops"
+	"github.com/leocomelli/ghmgr/provider/github"
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+)
+
+// the template api is still a preview
+const templatePreview = "application/vnd.github.baptiste-preview+json"
+
+type generateRequest struct {
+	Owner       string `json:"owner"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Private     bool   `json:"private"`
+}
+
+// sourceCheck is what the refs of a source repository tell before it is
+// cloned.
+type sourceCheck struct {
+	// State is one of the report.Source values, empty for a sound
+	// repository.
+	State string
+	// Branch is pushed instead of a default branch that does not exist.
+	Branch string
+}
+
+func (c *sourceCheck) empty() bool {
+	return c.State == report.SourceEmpty || c.State == report.SourceWikiOnly
+}
+
+// inspectSource lists the refs of the source repository. An empty one may
+// still have a wiki and loses its default branch, which does not exist yet;
+// a default branch missing from the refs is replaced by main, master or the
+// first branch. repo is updated accordingly.
+func inspectSource(cfg *migration, repo *gh.Repository, l *log.Entry) (*sourceCheck, error) {
+	auth, err := gitAuth(cfg, cfg.Source.Tokens, cfg.Source.Username, l)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := gitops.ListRemote(repoURL(cfg, repo), auth)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &sourceCheck{}
+	var branches []string
+	for _, r := range refs {
+		if r.Name().IsBranch() {
+			branches = append(branches, r.Name().Short())
+		}
+	}
+	if len(refs) == 0 {
+		check.State = report.SourceEmpty
+		// a missing wiki cannot be listed either
+		if repo.GetHasWiki() {
+			if wiki, err := gitops.ListRemote(wikiURL(repoURL(cfg, repo)), auth); err == nil && len(wiki) > 0 {
+				check.State = report.SourceWikiOnly
+			}
+		}
+		l.WithField("state", check.State).Warn("the source has no refs, it will not be pushed")
+		repo.DefaultBranch = nil
+		return check, nil
+	}
+
+	if len(branches) == 0 || repo.GetDefaultBranch() == "" || contains(branches, repo.GetDefaultBranch()) {
+		return check, nil
+	}
+	sort.Strings(branches)
+	check.Branch = branches[0]
+	for _, b := range []string{"master", "main"} {
+		if contains(branches, b) {
+			check.Branch = b
+		}
+	}
+	check.State = report.SourceMissingDefaultBranch
+	l.WithField("default_branch", repo.GetDefaultBranch()).WithField("branch", check.Branch).
+		Warn("the default branch of the source does not exist, using another branch")
+	repo.DefaultBranch = gh.String(check.Branch)
+	return check, nil
+}
+
+func planSource(cfg *migration, check *sourceCheck, l *log.Entry) {
+	switch {
+	case check.empty() && cfg.Target.Init.Enabled():
+		l.WithField("state", check.State).WithField("template", cfg.Target.Init.Template).Info("[plan] the source is empty, the target would be initialized")
+	case check.empty():
+		l.WithField("state", check.State).Info("[plan] the source is empty, the target would be created without a push")
+	case check.Branch != "":
+		l.WithField("branch", check.Branch).Info("[plan] the default branch of the source does not exist, another branch would be used")
+	}
+}
+
+// initRepo creates the target of an empty source repository from the
+// template of target.init, or with its first commit.
+func initRepo(cfg *migration, source *gh.Repository, l *log.Entry) (*gh.Repository, error) {
+	ctx := cfg.runContext()
+	opts := repoOptions(cfg, source)
+	init := cfg.Target.Init
+
+	if init.Template == "" {
+		opts.AutoInit = gh.Bool(true)
+		if init.Gitignore != "" {
+			opts.GitignoreTemplate = gh.String(init.Gitignore)
+		}
+		if init.License != "" {
+			opts.LicenseTemplate = gh.String(init.License)
+		}
+		r, err := cfg.Target.Provider.Create(ctx, source, opts, repoVisibility(cfg, source))
+		if err != nil {
+			return nil, err
+		}
+		l.WithField("url", r.GetURL()).Info("the source is empty, a new initialized repository was created")
+		return r, nil
+	}
+
+	parts := strings.SplitN(init.Template, "/", 2)
+	req := &generateRequest{
+		Owner:       cfg.Target.Organization,
+		Name:        opts.GetName(),
+		Description: opts.GetDescription(),
+		Private:     opts.GetPrivate(),
+	}
+	r := &gh.Repository{}
+	URL := fmt.Sprintf("repos/%s/%s/generate", parts[0], parts[1])
+	if _, err := github.Request(ctx, cfg.Target.Instance, "POST", URL, templatePreview, req, r); err != nil {
+		return nil, fmt.Errorf("template %s: %v", init.Template, err)
+	}
+	l.WithField("url", r.GetURL()).WithField("template", init.Template).Info("the source is empty, a new repository was created from the template")
+	return r, nil
+}
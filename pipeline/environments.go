@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// the environments api is not covered by go-github
+type environmentList struct {
+	Environments []environment `json:"environments"`
+}
+
+type environment struct {
+	Name            string `json:"name"`
+	ProtectionRules []struct {
+		Type      string `json:"type"`
+		WaitTimer int    `json:"wait_timer"`
+		Reviewers []struct {
+			Type     string `json:"type"`
+			Reviewer struct {
+				Login string `json:"login"`
+				Slug  string `json:"slug"`
+			} `json:"reviewer"`
+		} `json:"reviewers"`
+	} `json:"protection_rules"`
+	DeploymentBranchPolicy *branchPolicy `json:"deployment_branch_policy"`
+}
+
+type branchPolicy struct {
+	ProtectedBranches    bool `json:"protected_branches"`
+	CustomBranchPolicies bool `json:"custom_branch_policies"`
+}
+
+type environmentReviewer struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id"`
+}
+
+type environmentRequest struct {
+	WaitTimer              int                   `json:"wait_timer"`
+	Reviewers              []environmentReviewer `json:"reviewers"`
+	DeploymentBranchPolicy *branchPolicy         `json:"deployment_branch_policy"`
+}
+
+type branchPolicyList struct {
+	BranchPolicies []struct {
+		Name string `json:"name"`
+	} `json:"branch_policies"`
+}
+
+func listEnvironments(cfg *migration, repo *gh.Repository) ([]environment, error) {
+	var envs []environment
+	for page := 1; ; page++ {
+		list := &environmentList{}
+		resp, err := github.Request(cfg.runContext(), cfg.Source.Instance, "GET", fmt.Sprintf("repos/%s/%s/environments?per_page=100&page=%d", cfg.Source.Organization, *repo.Name, page), "", nil, list)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, list.Environments...)
+		if resp.NextPage == 0 {
+			return envs, nil
+		}
+	}
+}
+
+// environmentReviewers maps the reviewers of the source to the ids of the
+// users and teams of the target, the ones not found are reported.
+func environmentReviewers(cfg *migration, source *gh.Repository, env environment, l *log.Entry) []environmentReviewer {
+	ctx := cfg.runContext()
+	reviewers := []environmentReviewer{}
+	for _, rule := range env.ProtectionRules {
+		for _, r := range rule.Reviewers {
+			switch r.Type {
+			case "User":
+				login := mapUser(cfg, r.Reviewer.Login)
+				u, _, err := cfg.Target.Instance.Users.Get(ctx, login)
+				if err != nil {
+					l.WithField("environment", env.Name).WithField("user", login).Warn("the reviewer was not found on the target, skipping")
+					cfg.Results.Unmapped(*source.Name, r.Reviewer.Login)
+					continue
+				}
+				reviewers = append(reviewers, environmentReviewer{Type: r.Type, ID: u.GetID()})
+			case "Team":
+				slug := mapTeam(cfg, r.Reviewer.Slug)
+				t := &gh.Team{}
+				_, err := github.Request(ctx, cfg.Target.Instance, "GET", fmt.Sprintf("orgs/%s/teams/%s", cfg.Target.Organization, slug), "", nil, t)
+				if err != nil {
+					l.WithField("environment", env.Name).WithField("team", slug).Warn("the reviewer was not found on the target, skipping")
+					continue
+				}
+				reviewers = append(reviewers, environmentReviewer{Type: r.Type, ID: t.GetID()})
+			}
+		}
+	}
+	return reviewers
+}
+
+// migrateEnvironments creates the environments of the source with their
+// wait timer, required reviewers and deployment branches. Their secrets
+// are not migrated.
+func migrateEnvironments(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	envs, err := listEnvironments(cfg, source)
+	if err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(envs)).Info("migrating the environments...")
+
+	for _, env := range envs {
+		req := &environmentRequest{
+			Reviewers:              environmentReviewers(cfg, source, env, l),
+			DeploymentBranchPolicy: env.DeploymentBranchPolicy,
+		}
+		for _, rule := range env.ProtectionRules {
+			if rule.Type == "wait_timer" {
+				req.WaitTimer = rule.WaitTimer
+			}
+		}
+
+		name := url.PathEscape(env.Name)
+		_, err := github.Request(ctx, cfg.Target.Instance, "PUT", fmt.Sprintf("repos/%s/%s/environments/%s", cfg.Target.Organization, *target.Name, name), "", req, nil)
+		if err != nil {
+			return fmt.Errorf("environment %s: %v", env.Name, err)
+		}
+
+		if p := env.DeploymentBranchPolicy; p != nil && p.CustomBranchPolicies {
+			if err := migrateBranchPolicies(cfg, source, target, name); err != nil {
+				return fmt.Errorf("environment %s: %v", env.Name, err)
+			}
+		}
+
+		l.WithField("environment", env.Name).WithField("reviewers", len(req.Reviewers)).Info("an environment was migrated successfully")
+	}
+
+	return nil
+}
+
+// migrateBranchPolicies copies the name patterns of the branches allowed to
+// deploy to an environment, name being escaped already.
+func migrateBranchPolicies(cfg *migration, source, target *gh.Repository, name string) error {
+	ctx := cfg.runContext()
+
+	list := &branchPolicyList{}
+	_, err := github.Request(ctx, cfg.Source.Instance, "GET", fmt.Sprintf("repos/%s/%s/environments/%s/deployment-branch-policies?per_page=100", cfg.Source.Organization, *source.Name, name), "", nil, list)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range list.BranchPolicies {
+		body := map[string]string{"name": p.Name}
+		resp, err := github.Request(ctx, cfg.Target.Instance, "POST", fmt.Sprintf("repos/%s/%s/environments/%s/deployment-branch-policies", cfg.Target.Organization, *target.Name, name), "", body, nil)
+		// an existing pattern is answered with a redirect
+		if err != nil && !(resp != nil && resp.StatusCode == http.StatusSeeOther) {
+			return fmt.Errorf("branch policy %s: %v", p.Name, err)
+		}
+	}
+	return nil
+}
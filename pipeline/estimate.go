@@ -0,0 +1,280 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github"
+	"github.com/leocomelli/ghmgr/report"
+)
+
+// the assumptions of the estimate when the throttle options do not tell:
+// the duration of an api call and the bandwidth of the clones and pushes
+const (
+	estimateCallDuration = 300 * time.Millisecond
+	estimateBandwidthMB  = 10
+)
+
+// stepCost is the api calls a step makes for a repository on each side,
+// plus the ones per item copied, e.g. per issue.
+type stepCost struct {
+	source, target         int
+	items                  func(m *report.Metadata) int
+	itemSource, itemTarget int
+}
+
+func countIssues(m *report.Metadata) int       { return m.Issues }
+func countPullRequests(m *report.Metadata) int { return m.PullRequests }
+func countProtections(m *report.Metadata) int  { return m.Protections }
+
+// stepCosts are rough averages of the calls of the steps, the items being
+// the ones the metadata of the source counts.
+var stepCosts = map[string]stepCost{
+	stepOwnerTeam:     {target: 2},
+	stepSettings:      {source: 3, target: 4},
+	stepSecurity:      {source: 5, target: 6},
+	stepVerify:        {source: 1, target: 1},
+	stepWorkflows:     {source: 2, target: 2},
+	stepSubmodules:    {source: 1, target: 2},
+	stepCodeowners:    {source: 1, target: 2},
+	stepWiki:          {source: 1, target: 1},
+	stepPages:         {source: 1, target: 2},
+	stepReleases:      {source: 2, target: 4},
+	stepTeams:         {source: 1, target: 2},
+	stepCollaborators: {source: 1, target: 2},
+	stepProtections:   {source: 1, items: countProtections, itemSource: 1, itemTarget: 1},
+	stepRulesets:      {source: 1, target: 2},
+	stepTagProtection: {source: 1, target: 2},
+	stepSignedTags:    {source: 3, target: 3},
+	stepWebhooks:      {source: 1, target: 2},
+	stepDeployKeys:    {source: 1, target: 2},
+	stepAutolinks:     {source: 1, target: 2},
+	stepProperties:    {source: 1, target: 1},
+	stepEnvironments:  {source: 2, target: 3},
+	stepSecrets:       {source: 2, target: 3},
+	stepLabels:        {source: 1, target: 5},
+	stepIssues:        {source: 1, items: countIssues, itemSource: 1, itemTarget: 3},
+	stepPulls:         {source: 1, items: countPullRequests, itemSource: 2, itemTarget: 3},
+	stepDiscussions:   {source: 2, target: 2},
+	stepWatchers:      {source: 1, target: 1},
+	stepContent:       {source: 2},
+	stepLockdown:      {source: 3},
+	stepTombstone:     {source: 3},
+	stepArchive:       {source: 1},
+}
+
+// repoEstimate is the cost of the migration of a repository.
+type repoEstimate struct {
+	Repo        string
+	SizeKB      int
+	SourceCalls int
+	TargetCalls int
+}
+
+// rateBudget is a rate limit of a token, nil when the instance does not
+// limit the requests.
+type rateBudget struct {
+	Limit     int   `json:"limit"`
+	Remaining int   `json:"remaining"`
+	Reset     int64 `json:"reset"`
+}
+
+// estimateRepo counts the api calls of the steps enabled for the
+// repository, besides the creation and the push.
+func estimateRepo(cfg *migration, repo *gh.Repository) repoEstimate {
+	m := cfg.metadata[*repo.Name]
+	if m == nil {
+		// the size of the listing, without the counts of the items
+		m = &report.Metadata{SizeKB: repo.GetSize()}
+	}
+	e := repoEstimate{Repo: *repo.Name, SizeKB: m.SizeKB}
+
+	if cfg.Git.TransferMode == config.TransferModeNative {
+		// the repository is moved, nothing is cloned
+		e.SizeKB = 0
+		e.SourceCalls, e.TargetCalls = 2, 1
+	} else {
+		// the existence check, the creation and the default branch
+		e.SourceCalls, e.TargetCalls = 1, 3
+	}
+
+	for _, s := range orderedSteps(cfg, *repo.Name) {
+		c, ok := stepCosts[s.name]
+		if !ok {
+			// the hooks of hooks.steps run commands
+			continue
+		}
+		e.SourceCalls += c.source
+		e.TargetCalls += c.target
+		if c.items != nil {
+			n := c.items(m)
+			e.SourceCalls += n * c.itemSource
+			e.TargetCalls += n * c.itemTarget
+		}
+	}
+	return e
+}
+
+// readRateBudgets reads the core and graphql rate limits of the token of a
+// GitHub side, nil for the instances without rate limiting.
+func readRateBudgets(cfg *migration, client *gh.Client) (map[string]*rateBudget, error) {
+	var limits struct {
+		Resources map[string]*rateBudget `json:"resources"`
+	}
+	resp, err := github.Request(cfg.runContext(), client, "GET", "rate_limit", "", nil, &limits)
+	// GitHub Enterprise answers 404 when the rate limiting is disabled
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return limits.Resources, nil
+}
+
+// rateWait is how long the calls wait for the rate limit: none while the
+// remaining budget covers them, then until the reset and an hour per
+// limit of calls beyond.
+func rateWait(b *rateBudget, calls int, now time.Time) time.Duration {
+	if b == nil || calls <= b.Remaining || b.Limit <= 0 {
+		return 0
+	}
+	wait := time.Unix(b.Reset, 0).Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	beyond := calls - b.Remaining
+	return wait + time.Duration((beyond-1)/b.Limit)*time.Hour
+}
+
+// runEstimate prints the rate limit budgets of both tokens, then predicts
+// the api calls, the data transferred and the duration of the migration of
+// the repositories, from their metadata and the steps enabled.
+func runEstimate(cfg *migration, repos []*gh.Repository) error {
+	if cfg.metadata == nil {
+		cfg.metadata = fetchMetadata(cfg, repos)
+	}
+
+	budgets := map[string]map[string]*rateBudget{}
+	sides := []struct {
+		name   string
+		github bool
+		client *gh.Client
+	}{
+		{"source", cfg.Source.Type == "" || cfg.Source.Type == config.SourceGitHub, cfg.Source.Instance},
+		{"target", cfg.Target.Type == "" || cfg.Target.Type == config.TargetGitHub, cfg.Target.Instance},
+	}
+	for _, s := range sides {
+		if !s.github {
+			continue
+		}
+		b, err := readRateBudgets(cfg, s.client)
+		if err != nil {
+			return fmt.Errorf("%s rate limit: %v", s.name, err)
+		}
+		budgets[s.name] = b
+	}
+
+	var estimates []repoEstimate
+	for _, repo := range repos {
+		estimates = append(estimates, estimateRepo(cfg, repo))
+	}
+	printEstimate(cfg, budgets, estimates, time.Now(), os.Stdout)
+	return nil
+}
+
+// printEstimate writes the budgets, the cost of each repository and the
+// totals.
+func printEstimate(cfg *migration, budgets map[string]map[string]*rateBudget, estimates []repoEstimate, now time.Time, w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOKEN\tRESOURCE\tLIMIT\tREMAINING\tRESET")
+	for _, side := range []string{"source", "target"} {
+		b, ok := budgets[side]
+		switch {
+		case !ok:
+			fmt.Fprintf(tw, "%s\t-\t-\t-\tnot a GitHub instance\n", side)
+		case b == nil:
+			fmt.Fprintf(tw, "%s\t-\t-\t-\trate limiting disabled\n", side)
+		default:
+			for _, resource := range []string{"core", "graphql"} {
+				if r := b[resource]; r != nil {
+					fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", side, resource, r.Limit, r.Remaining, time.Unix(r.Reset, 0).Format(time.RFC3339))
+				}
+			}
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	var sizeKB, sourceCalls, targetCalls int
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tSIZE MB\tSOURCE CALLS\tTARGET CALLS")
+	for _, e := range estimates {
+		fmt.Fprintf(tw, "%s\t%.1f\t%d\t%d\n", e.Repo, float64(e.SizeKB)/1024, e.SourceCalls, e.TargetCalls)
+		sizeKB += e.SizeKB
+		sourceCalls += e.SourceCalls
+		targetCalls += e.TargetCalls
+	}
+	fmt.Fprintf(tw, "total\t%.1f\t%d\t%d\n", float64(sizeKB)/1024, sourceCalls, targetCalls)
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	workers := cfg.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	calls := time.Duration(sourceCalls+targetCalls) * estimateCallDuration / time.Duration(workers)
+	if n := cfg.Throttle.APIRequestsPerMinute; n > 0 {
+		// each side has its own throttle
+		busiest := sourceCalls
+		if targetCalls > busiest {
+			busiest = targetCalls
+		}
+		if throttled := time.Duration(busiest) * time.Minute / time.Duration(n); throttled > calls {
+			calls = throttled
+		}
+	}
+	bandwidth, shared := float64(estimateBandwidthMB*workers), false
+	if mb := cfg.Throttle.MaxBandwidthMB; mb > 0 {
+		// the clones and pushes share the bandwidth
+		bandwidth, shared = float64(mb), true
+	}
+	// each repository is cloned from the source then pushed to the target
+	transferMB := 2 * float64(sizeKB) / 1024
+	transfer := time.Duration(transferMB / bandwidth * float64(time.Second))
+
+	wait := rateWait(budgets["source"]["core"], sourceCalls, now)
+	if t := rateWait(budgets["target"]["core"], targetCalls, now); t > wait {
+		wait = t
+	}
+	total := calls + transfer
+	if wait > total {
+		total = wait
+	}
+
+	fmt.Fprintf(w, "api calls: %d on the source, %d on the target\n", sourceCalls, targetCalls)
+	for _, side := range []struct {
+		name  string
+		calls int
+	}{{"source", sourceCalls}, {"target", targetCalls}} {
+		if b := budgets[side.name]["core"]; b != nil && side.calls > b.Remaining {
+			fmt.Fprintf(w, "  the %s calls exceed the %d remaining of its token, the run waits for the resets\n", side.name, b.Remaining)
+		}
+	}
+	via := fmt.Sprintf("at %.0f MB/s", bandwidth)
+	if shared {
+		via = fmt.Sprintf("at the %.0f MB/s of throttle.max_bandwidth_mb", bandwidth)
+	}
+	fmt.Fprintf(w, "data: %.1f MB cloned and pushed, %s\n", transferMB, via)
+	round := time.Minute
+	if total < time.Minute {
+		round = time.Second
+	}
+	fmt.Fprintf(w, "duration: about %s with %d workers\n", total.Round(round), workers)
+}
@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github/githubtest"
+	"github.com/leocomelli/ghmgr/report"
+)
+
+func TestEstimateRepo(t *testing.T) {
+	c := &config.Configuration{}
+	c.Migrate.Issues = true
+	c.Migrate.Protections = true
+	m := &migration{Configuration: c, metadata: map[string]*report.Metadata{
+		"api": {SizeKB: 2048, Issues: 10, Protections: 2},
+	}}
+
+	e := estimateRepo(m, &gh.Repository{Name: gh.String("api")})
+	// the creation, the settings, the protections and the issues
+	if e.SourceCalls != 1+3+(1+2)+(1+10) || e.TargetCalls != 3+4+2+10*3 {
+		t.Errorf("calls = %d on the source and %d on the target", e.SourceCalls, e.TargetCalls)
+	}
+	if e.SizeKB != 2048 {
+		t.Errorf("size = %d KB, want 2048", e.SizeKB)
+	}
+
+	// without metadata, the size of the listing
+	if e := estimateRepo(m, &gh.Repository{Name: gh.String("web"), Size: gh.Int(12)}); e.SizeKB != 12 {
+		t.Errorf("web: size = %d KB, want 12", e.SizeKB)
+	}
+}
+
+func TestRateWait(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	b := &rateBudget{Limit: 5000, Remaining: 100, Reset: now.Add(20 * time.Minute).Unix()}
+	tests := []struct {
+		calls int
+		want  time.Duration
+	}{
+		{100, 0},
+		{101, 20 * time.Minute},
+		{5100, 20 * time.Minute},
+		{5101, 20*time.Minute + time.Hour},
+	}
+	for _, tt := range tests {
+		if got := rateWait(b, tt.calls, now); got != tt.want {
+			t.Errorf("rateWait(%d calls) = %s, want %s", tt.calls, got, tt.want)
+		}
+	}
+	if got := rateWait(nil, 100000, now); got != 0 {
+		t.Errorf("rateWait without rate limiting = %s, want 0", got)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	f.source.Handle("POST", "api/graphql", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+			"repositoryOwner": map[string]interface{}{"repositories": map[string]interface{}{
+				"nodes": []map[string]interface{}{{"name": "api", "diskUsage": 512, "issues": map[string]int{"totalCount": 3}}},
+			}},
+		}})
+	})
+	cfg := f.config(t)
+	cfg.Migrate.Issues = true
+
+	execute(t, cfg, Options{Command: "estimate"})
+	if n := len(f.target.Requests("POST")); n != 0 {
+		t.Errorf("the estimate made %d write requests on the target", n)
+	}
+}
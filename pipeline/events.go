@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the statuses of the events, along with the ones of the report for the
+// repositories once finished
+const (
+	eventQueued    = "queued"
+	eventStarted   = "started"
+	eventCompleted = "completed"
+	eventFailed    = "failed"
+	eventSkipped   = "skipped"
+)
+
+// stepEvent is a line of the event stream: a transition of a step of a
+// repository, or of the repository itself without a step.
+type stepEvent struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Target string    `json:"target"`
+	Repo   string    `json:"repo"`
+	// Correlation is the id of the attempt of the repository, the same in
+	// its logs, report entry and audit entries
+	Correlation string  `json:"correlation_id,omitempty"`
+	Step        string  `json:"step,omitempty"`
+	Status      string  `json:"status"`
+	Duration    float64 `json:"duration_seconds,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// eventStream writes the events of --events as json, one per line. Like
+// the progress, a nil value silently ignores every call.
+type eventStream struct {
+	mu     sync.Mutex
+	w      io.Writer
+	file   *os.File
+	source string
+	target string
+	redact func(string) string
+}
+
+// openEvents opens the file of --events, appended to so the runs of
+// several organizations or targets share it, or the standard output for
+// "-". It is nil without --events.
+func openEvents(cfg *migration, path string) (*eventStream, error) {
+	s := &eventStream{source: cfg.Source.Organization, target: cfg.Target.Organization, redact: cfg.redactor.redact}
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		s.w = os.Stdout
+	default:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		s.w, s.file = f, f
+	}
+	return s, nil
+}
+
+func (s *eventStream) emit(repo, correlation, step, status string, d time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	e := stepEvent{
+		Time:        time.Now().UTC(),
+		Source:      s.source,
+		Target:      s.target,
+		Repo:        repo,
+		Correlation: correlation,
+		Step:        step,
+		Status:      status,
+		Duration:    d.Round(time.Millisecond).Seconds(),
+	}
+	if err != nil {
+		e.Error = s.redact(err.Error())
+	}
+	b, jerr := json.Marshal(e)
+	if jerr != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, werr := s.w.Write(append(b, '\n')); werr != nil {
+		log.WithError(werr).Warn("the event could not be written")
+	}
+}
+
+func (s *eventStream) Close() error {
+	if s == nil || s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
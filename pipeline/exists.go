@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var errRepoSkipped = errors.New("the repository already exists on the target, skipping")
+
+// existingRepo returns nil when the repository does not exist on the target.
+func existingRepo(cfg *migration, name string) (*gh.Repository, error) {
+	return cfg.Target.Provider.Get(cfg.runContext(), name)
+}
+
+// handleExisting applies target.on_exists to a repository found on the
+// target, it returns the repository to reuse or nil when it was deleted.
+func handleExisting(cfg *migration, r *gh.Repository, l *log.Entry) (*gh.Repository, error) {
+	switch cfg.Target.OnExists {
+	case config.OnExistsSkip:
+		return nil, errRepoSkipped
+	case config.OnExistsPush:
+		l.WithField("url", r.GetHTMLURL()).Warn("the repository already exists on the target, reusing it")
+		return r, nil
+	case config.OnExistsRecreate:
+		l.WithField("url", r.GetHTMLURL()).Warn("the repository already exists on the target, deleting it...")
+		if err := cfg.Target.Provider.Delete(cfg.runContext(), r.GetName()); err != nil {
+			return nil, fmt.Errorf("deleting the existing repository: %v", err)
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("the repository %s already exists on the target, set target.on_exists to skip, push or recreate it", r.GetFullName())
+}
+
+// forcePush reports whether the refs replace the ones of an existing
+// repository on the target.
+func forcePush(cfg *migration) bool {
+	return cfg.Target.OnExists == config.OnExistsPush
+}
@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/leocomelli/ghmgr/report"
+)
+
+// the exit codes of the process, according to the error of Execute
+const (
+	ExitSucceeded = 0
+	ExitFatal     = 1
+	ExitPartial   = 2
+	ExitConfig    = 3
+)
+
+// PartialError is returned by the commands that processed every repository
+// but some of them failed.
+type PartialError struct {
+	Failed int
+	Total  int
+	msg    string
+}
+
+func (e *PartialError) Error() string {
+	return e.msg
+}
+
+// partialError returns a PartialError, msg describing the failures.
+func partialError(failed, total int, format string, args ...interface{}) error {
+	return &PartialError{Failed: failed, Total: total, msg: fmt.Sprintf(format, args...)}
+}
+
+// ConfigError is returned when the configuration or the options are wrong,
+// before anything is processed.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode is the exit code of the process for the error of Execute: 0
+// when every repository succeeded, 2 when some of them failed, 3 for a
+// wrong configuration and 1 for the other errors, which stopped the run.
+func ExitCode(err error) int {
+	var partial *PartialError
+	var cfg *ConfigError
+	switch {
+	case err == nil:
+		return ExitSucceeded
+	case errors.As(err, &cfg):
+		return ExitConfig
+	case errors.As(err, &partial):
+		return ExitPartial
+	}
+	return ExitFatal
+}
+
+// combineErrors joins the errors of the runs of several organizations or
+// targets, partial when all of them are, a wrong configuration when one of
+// them is.
+func combineErrors(errs []error, names []string, total int, kind string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	var msgs []string
+	failed, partial, wrong := 0, true, false
+	for i, err := range errs {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", names[i], err))
+		switch e := err.(type) {
+		case *PartialError:
+			failed += e.Failed
+		case *ConfigError:
+			partial, wrong = false, true
+		default:
+			partial = false
+		}
+	}
+	msg := fmt.Errorf("%d of %d %s failed: %s", len(errs), total, kind, strings.Join(msgs, "; "))
+	switch {
+	case wrong:
+		return &ConfigError{msg}
+	case partial:
+		return &PartialError{Failed: failed, msg: msg.Error()}
+	}
+	return msg
+}
+
+// migrateFailures counts the repositories that failed or only partly
+// succeeded, retries from the dashboard included.
+func migrateFailures(cfg *migration) int {
+	n := 0
+	for _, r := range cfg.Progress.snapshot(cfg.redactor.redact).Repos {
+		if r.Status == report.StatusFailed || r.Status == report.StatusPartial {
+			n++
+		}
+	}
+	return n
+}
+
+// printSummary writes the table of the repositories of the run, with their
+// status and their first error.
+func printSummary(cfg *migration, w io.Writer) {
+	s := cfg.Progress.snapshot(cfg.redactor.redact)
+	if len(s.Repos) == 0 {
+		return
+	}
+	counts := map[string]int{}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nREPOSITORY\tSTATUS\tDURATION\tERROR")
+	for _, r := range s.Repos {
+		status := r.Status
+		switch status {
+		case repoStatus(nil):
+			status = report.StatusSucceeded
+		case progressQueued:
+			status = "not processed"
+		}
+		counts[status]++
+		var first string
+		if len(r.Errors) > 0 {
+			first = strings.SplitN(r.Errors[0], "\n", 2)[0]
+			if len(r.Errors) > 1 {
+				first += fmt.Sprintf(" (+%d)", len(r.Errors)-1)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, status, r.Duration, first)
+	}
+	tw.Flush()
+
+	var totals []string
+	for _, status := range []string{report.StatusSucceeded, report.StatusPartial, report.StatusFailed, report.StatusSkipped, "not processed"} {
+		if counts[status] > 0 {
+			totals = append(totals, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	fmt.Fprintf(w, "\n%d repositories: %s\n", len(s.Repos), strings.Join(totals, ", "))
+}
@@ -0,0 +1,199 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/report"
+	"github.com/leocomelli/ghmgr/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	exportPollInterval = 10 * time.Second
+	defaultExportBatch = 100
+)
+
+// runExport requests a migration archive of the source organization for
+// each batch of export.batch_size repositories and stores the tarballs,
+// with a state file, the repositories exported by a previous run are left
+// out.
+func runExport(cfg *migration, repos []*gh.Repository) error {
+	if cfg.Source.Type != "" && cfg.Source.Type != config.SourceGitHub {
+		return errors.New("the export command requires a github source")
+	}
+	if cfg.Source.User != "" {
+		return errors.New("the export command requires a source organization, a user account has no migration archives")
+	}
+	if cfg.Export.Storage.Path == "" && !cfg.Export.Storage.S3.Enabled() && cfg.artifacts == nil {
+		return errors.New("the export command requires export.path, export.s3.bucket or storage.s3.bucket")
+	}
+
+	var pending []*gh.Repository
+	for _, r := range repos {
+		if !cfg.State.Done(*r.Name, stepExported) {
+			pending = append(pending, r)
+		}
+	}
+	size := cfg.Export.BatchSize
+	if size < 1 {
+		size = defaultExportBatch
+	}
+
+	store := cfg.artifacts
+	if cfg.Export.Storage.Path != "" || cfg.Export.Storage.S3.Enabled() {
+		var err error
+		if store, err = storage.New(cfg.Export.Storage); err != nil {
+			return err
+		}
+	}
+	if cfg.Report.Path != "" {
+		cfg.Results = report.New()
+		cfg.Results.Redact = cfg.redactor.redact
+	}
+
+	var failed int
+	for start := 0; start < len(pending); start += size {
+		if cfg.stopping() {
+			break
+		}
+		end := start + size
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+		var names []string
+		for _, r := range batch {
+			names = append(names, *r.Name)
+		}
+		l := log.WithField("organization", cfg.Source.Organization).WithField("repositories", len(names))
+
+		if cfg.DryRun {
+			l.WithField("names", names).Info("[plan] a migration archive would be exported")
+			continue
+		}
+
+		for _, n := range names {
+			cfg.Results.Start(n)
+		}
+		key, err := exportBatch(cfg, store, names, l)
+		for _, n := range names {
+			if err == nil {
+				err = cfg.State.Complete(n, stepExported)
+			}
+			if err == nil {
+				cfg.Results.Step(n, stepExported)
+				cfg.Results.SetTargetURL(n, store.Location(key))
+			}
+			cfg.Results.Finish(n, err)
+		}
+		if err != nil {
+			l.WithError(err).Error("the export failed")
+			failed++
+		}
+	}
+
+	if cfg.Report.Path != "" && !cfg.DryRun {
+		if err := cfg.Results.Write(cfg.Report.Path, cfg.Report.Format); err != nil {
+			return err
+		}
+		log.WithField("file", cfg.Report.Path).Info("the report was written")
+		storeFile(cfg, reportKey, cfg.Report.Path)
+	}
+	storeFile(cfg, stateKey, cfg.StateFile)
+	if failed > 0 {
+		return partialError(failed, len(pending), "%d of the migration archives failed", failed)
+	}
+	return nil
+}
+
+// exportBatch starts the migration of the repositories, waits for its
+// archive and stores it, returning its key.
+func exportBatch(cfg *migration, store storage.Store, names []string, l *log.Entry) (string, error) {
+	ctx := cfg.runContext()
+	migrations := cfg.Source.Instance.Migrations
+	org := cfg.Source.Organization
+
+	m, _, err := migrations.StartMigration(ctx, org, names, &gh.MigrationOptions{
+		LockRepositories:   cfg.Export.LockRepositories,
+		ExcludeAttachments: cfg.Export.ExcludeAttachments,
+	})
+	if err != nil {
+		return "", err
+	}
+	l = l.WithField("migration", m.GetID())
+	l.Info("exporting the migration archive...")
+
+	for m.GetState() != "exported" {
+		select {
+		case <-time.After(exportPollInterval):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		m, _, err = migrations.MigrationStatus(ctx, org, m.GetID())
+		if err != nil {
+			return "", err
+		}
+		if m.GetState() == "failed" {
+			return "", fmt.Errorf("the migration %d failed", m.GetID())
+		}
+		l.WithField("state", m.GetState()).Debug("exporting...")
+	}
+
+	URL, err := migrations.MigrationArchiveURL(ctx, org, m.GetID())
+	if err != nil {
+		return "", err
+	}
+	file, err := downloadArchive(cfg, URL)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file)
+
+	key := fmt.Sprintf("%s/%s-%d.tar.gz", org, time.Now().Format("20060102"), m.GetID())
+	if err := store.Put(ctx, key, file); err != nil {
+		return "", err
+	}
+	l.WithField("location", store.Location(key)).Info("the migration archive was stored")
+	return key, nil
+}
+
+// downloadArchive saves the archive to a temporary file, the url being a
+// signed one that needs no token.
+func downloadArchive(cfg *migration, URL string) (string, error) {
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Transport: cfg.Source.Transport}
+	resp, err := client.Do(req.WithContext(cfg.runContext()))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading the archive: %s", resp.Status)
+	}
+
+	f, err := ioutil.TempFile("", "ghmgr-export-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
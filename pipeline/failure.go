@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/leocomelli/ghmgr/config"
+)
+
+// errStepFailed is returned by runStep for a failed step whose policy lets
+// the next steps run.
+var errStepFailed = errors.New("the step failed")
+
+// coreSteps are the steps without which the repository is not migrated,
+// a failure of theirs never lets the next steps run.
+var coreSteps = []string{stepCreate, stepPush, stepLFS}
+
+// failurePolicy is the failure_policy of step, def when it is not set.
+func failurePolicy(cfg *migration, step, def string) string {
+	if p := cfg.FailurePolicy[step]; p != "" {
+		return p
+	}
+	return def
+}
+
+// stepError is the failure of a step that stops the repository, its
+// failure_policy telling whether the run goes on.
+type stepError struct {
+	step string
+	err  error
+}
+
+func (e *stepError) Error() string { return e.err.Error() }
+func (e *stepError) Unwrap() error { return e.err }
+
+// runAbort is set by the first failure whose policy is abort_run, or by
+// the lock taken over, the workers stop taking repositories once it is.
+type runAbort struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newRunAbort() *runAbort {
+	return &runAbort{done: make(chan struct{})}
+}
+
+// set aborts the run with err, the first failure only; a nil abort is
+// never set.
+func (a *runAbort) set(err error) {
+	if a == nil {
+		return
+	}
+	a.once.Do(func() {
+		a.err = err
+		close(a.done)
+	})
+}
+
+// aborted is closed when the run is aborted, never for a nil abort.
+func (a *runAbort) aborted() <-chan struct{} {
+	if a == nil {
+		return nil
+	}
+	return a.done
+}
+
+// Err is the failure that aborted the run, nil while it is not.
+func (a *runAbort) Err() error {
+	if a == nil {
+		return nil
+	}
+	select {
+	case <-a.done:
+		return a.err
+	default:
+		return nil
+	}
+}
+
+// abortOn aborts the run when err is the failure of a step whose policy is
+// abort_run.
+func abortOn(cfg *migration, repo string, err error) {
+	var se *stepError
+	if !errors.As(err, &se) || failurePolicy(cfg, se.step, config.FailureAbortRepo) != config.FailureAbortRun {
+		return
+	}
+	cfg.abort.set(fmt.Errorf("the run was aborted by the failure policy of the %s step of %s: %v", se.step, repo, se.err))
+}
@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/leocomelli/ghmgr/config"
+)
+
+func TestFailurePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		repos  []string
+		exit   int
+	}{
+		// the next steps run, the repositories are partial
+		{config.FailureContinue, []string{"api", "web"}, ExitPartial},
+		{config.FailureAbortRepo, []string{"api", "web"}, ExitPartial},
+		// the first repository fails, the other one is not processed
+		{config.FailureAbortRun, []string{"api"}, ExitFatal},
+	}
+	for _, tt := range tests {
+		f := newFakes(t, "organization.json")
+		cfg := f.config(t)
+		cfg.Concurrency = 1
+		cfg.Hooks.Steps = map[string]string{"check": "false"}
+		cfg.Steps = []string{"check"}
+		cfg.FailurePolicy = map[string]string{"check": tt.policy}
+
+		err := Execute(context.Background(), cfg, Options{Command: "migrate"})
+		if got := ExitCode(err); got != tt.exit {
+			t.Errorf("%s: exit code %d (%v), want %d", tt.policy, got, err, tt.exit)
+		}
+		if tt.policy == config.FailureAbortRun && (err == nil || !strings.Contains(err.Error(), "the check step of api")) {
+			t.Errorf("%s: %v, want the run aborted by the check step of api", tt.policy, err)
+		}
+		if got := f.target.Repos(targetOrg); !reflect.DeepEqual(got, tt.repos) {
+			t.Errorf("%s: target repositories = %v, want %v", tt.policy, got, tt.repos)
+		}
+	}
+}
+
+func TestCheckFailurePolicy(t *testing.T) {
+	tests := []struct {
+		policy map[string]string
+		want   string
+	}{
+		{map[string]string{stepPush: config.FailureAbortRun, stepWebhooks: config.FailureContinue}, ""},
+		{map[string]string{stepPush: config.FailureContinue}, "failure_policy.pushed"},
+		{map[string]string{"unknown": config.FailureAbortRepo}, `failure_policy: "unknown"`},
+	}
+	for _, tt := range tests {
+		err := checkSteps(&config.Configuration{FailurePolicy: tt.policy})
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%v: %v", tt.policy, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%v: %v, want %q", tt.policy, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+)
+
+func matchAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAttributes(cfg *migration, r *gh.Repository) (bool, error) {
+	source := cfg.Source
+
+	if source.SkipArchived && r.GetArchived() {
+		return false, nil
+	}
+
+	if source.SkipForks && r.GetFork() {
+		return false, nil
+	}
+
+	// the size reported by the API is in kilobytes
+	if source.MaxSizeMB > 0 && r.GetSize() > source.MaxSizeMB*1024 {
+		return false, nil
+	}
+
+	if len(source.Topics) > 0 {
+		found := false
+		for _, t := range r.Topics {
+			found = found || contains(source.Topics, t)
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	if source.PushedAfter != "" {
+		after, err := time.Parse("2006-01-02", source.PushedAfter)
+		if err != nil {
+			return false, fmt.Errorf("invalid pushed_after %q: %v", source.PushedAfter, err)
+		}
+		if r.GetPushedAt().Before(after) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func selectRepo(cfg *migration, name string) (bool, error) {
+	source := cfg.Source
+
+	if len(source.Only) > 0 {
+		// Only does not work together with the other filters
+		return contains(source.Only, name), nil
+	}
+
+	if contains(source.Ignore, name) {
+		return false, nil
+	}
+
+	include, err := config.CompilePatterns(source.Include)
+	if err != nil {
+		return false, err
+	}
+	if len(include) > 0 && !matchAny(include, name) {
+		return false, nil
+	}
+
+	exclude, err := config.CompilePatterns(source.Exclude)
+	if err != nil {
+		return false, err
+	}
+	return !matchAny(exclude, name), nil
+}
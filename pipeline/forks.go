@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// the refs of a new fork are copied asynchronously
+	forkAttempts = 20
+	forkDelay    = 3 * time.Second
+)
+
+type forkRequest struct {
+	Organization      string `json:"organization"`
+	Name              string `json:"name"`
+	DefaultBranchOnly bool   `json:"default_branch_only"`
+}
+
+// forkParents maps the forks of the run to their parent when it is one of
+// the repositories of the run too, the listing does not tell the parent.
+func forkParents(cfg *migration, repos []*gh.Repository) (map[string]string, error) {
+	ctx := cfg.runContext()
+
+	names := map[string]bool{}
+	for _, r := range repos {
+		names[*r.Name] = true
+	}
+
+	parents := map[string]string{}
+	for _, r := range repos {
+		if !r.GetFork() {
+			continue
+		}
+		full, _, err := cfg.Source.Instance.Repositories.Get(ctx, cfg.Source.Organization, *r.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", *r.Name, err)
+		}
+		p := full.GetParent()
+		if strings.EqualFold(p.GetOwner().GetLogin(), cfg.Source.Organization) && names[p.GetName()] {
+			parents[*r.Name] = p.GetName()
+		}
+	}
+	return parents, nil
+}
+
+// orderByForks moves the parents before their forks, so their targets
+// exist first.
+func orderByForks(repos []*gh.Repository, parents map[string]string) []*gh.Repository {
+	deps := map[string][]string{}
+	for fork, parent := range parents {
+		deps[fork] = []string{parent}
+	}
+	return orderByDeps(repos, deps)
+}
+
+// createFork forks the target of the parent into the target repository of
+// source and waits for its refs to be copied.
+func createFork(cfg *migration, source *gh.Repository, parent string, l *log.Entry) (*gh.Repository, error) {
+	ctx := cfg.runContext()
+	tgt := cfg.Target
+
+	req := &forkRequest{Organization: tgt.Organization, Name: targetName(cfg, *source.Name), DefaultBranchOnly: true}
+	r := &gh.Repository{}
+	URL := fmt.Sprintf("repos/%s/%s/forks", tgt.Organization, targetName(cfg, parent))
+	if _, err := github.Request(ctx, tgt.Instance, "POST", URL, "", req, r); err != nil {
+		return nil, err
+	}
+
+	for i := 0; ; i++ {
+		refs, err := listRefs(ctx, tgt.Instance, tgt.Organization, r.GetName())
+		if err == nil && len(refs) > 0 {
+			break
+		}
+		if i == forkAttempts {
+			return nil, fmt.Errorf("the fork %s is not ready yet", r.GetFullName())
+		}
+		time.Sleep(forkDelay)
+	}
+
+	// a fork keeps the visibility of its parent
+	opts := repoOptions(cfg, source)
+	opts.Private = nil
+	if _, _, err := tgt.Instance.Repositories.Edit(ctx, tgt.Organization, r.GetName(), opts); err != nil {
+		return nil, err
+	}
+
+	l.WithField("url", r.GetURL()).WithField("parent", targetName(cfg, parent)).Info("a new fork was created successfully")
+	return r, nil
+}
@@ -0,0 +1,285 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/gitops"
+	"github.com/leocomelli/ghmgr/metrics"
+	"github.com/leocomelli/ghmgr/provider"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	git "gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+func useHTTPS(cfg *migration) bool {
+	return cfg.Git.UseHTTPS()
+}
+
+// installGitTransport replaces the default https client of go-git, so the
+// instances are reached with the same tls settings of the api.
+func installGitTransport(cfg *migration) {
+	if !useHTTPS(cfg) {
+		return
+	}
+	t := provider.NewHostTransport()
+	t.Add(cfg.Source.URL, cfg.Source.Transport)
+	t.Add(cfg.Target.URL, cfg.Target.Transport)
+	if mb := cfg.Throttle.MaxBandwidthMB; mb > 0 {
+		// the clones and pushes share the bandwidth
+		gitops.InstallTransport(provider.NewBandwidthTransport(t, provider.NewLimiter(float64(mb)*1024*1024)))
+		return
+	}
+	gitops.InstallTransport(t)
+}
+
+// repoURL is the git URL of a repository according to git.protocol.
+func repoURL(cfg *migration, r *gh.Repository) string {
+	return gitops.URL(cfg.Git, r)
+}
+
+// gitAuth authenticates the git operations on one side, source or target.
+func gitAuth(cfg *migration, tokens oauth2.TokenSource, username string, l *log.Entry) (transport.AuthMethod, error) {
+	return cfg.auth.Method(tokens, username, l)
+}
+
+func clonePath(cfg *migration, name string) string {
+	return gitops.ClonePath(cfg.Git, name)
+}
+
+// cloneAndPush clones branch instead of the default branch when it is set.
+func cloneAndPush(cfg *migration, source *gh.Repository, targetURL, branch string, l *log.Entry) (*git.Repository, error) {
+	if !gitops.InMemory(cfg.Git, source.GetSize()) {
+		if err := prepareClone(cfg, *source.Name, repoURL(cfg, source), l); err != nil {
+			return nil, err
+		}
+	}
+	return transfer(cfg, repoURL(cfg, source), targetURL, *source.Name, branch, source.GetSize(), l)
+}
+
+// prepareClone removes the clone found on the disk when it cannot be
+// updated: a clone of another repository or, with a state file, one none of
+// its runs recorded, e.g. left by another configuration. A clone restored
+// from the storage is reused. The clone is recorded in the state before it
+// is fetched, so the next run resumes an interrupted one.
+func prepareClone(cfg *migration, name, URL string, l *log.Entry) error {
+	path := clonePath(cfg, name)
+	l = l.WithField("path", path)
+
+	exists, origin, err := gitops.CloneOrigin(path)
+	restored := false
+	if !exists && restoreClone(cfg, path, l) {
+		restored = true
+		exists, origin, err = gitops.CloneOrigin(path)
+	}
+
+	switch {
+	case !exists:
+	case err != nil || origin != URL || !restored && cfg.State != nil && cfg.State.Clone(name) != path:
+		l.Warn("the clone found is not one of this migration, cloning again")
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	default:
+		l.Info("reusing the clone of a previous run, only the new objects are fetched")
+	}
+	return cfg.State.SetClone(name, path)
+}
+
+// cleanupClone removes the clone of the repository, unless
+// git.keep_clones, and its record in the state.
+func cleanupClone(cfg *migration, name string, l *log.Entry) {
+	gitops.Cleanup(cfg.Git, clonePath(cfg, name), l)
+	if cfg.Git.KeepClones {
+		return
+	}
+	if err := cfg.State.SetClone(name, ""); err != nil {
+		l.WithError(err).Warn("the state file could not be updated")
+	}
+}
+
+// transfer clones sourceURL in the clone path of name and pushes it to
+// targetURL, sizeKB is the size reported by the api to choose the storage
+// of the clone.
+func transfer(cfg *migration, sourceURL, targetURL, name, branch string, sizeKB int, l *log.Entry) (*git.Repository, error) {
+	path := clonePath(cfg, name)
+	auth, err := gitAuth(cfg, cfg.Source.Tokens, cfg.Source.Username, l)
+	if err != nil {
+		return nil, err
+	}
+	targetAuth := auth
+	if useHTTPS(cfg) {
+		targetAuth, err = gitAuth(cfg, cfg.Target.Tokens, "", l)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	release := cfg.acquireClone()
+	defer release()
+
+	memoryStorage := gitops.InMemory(cfg.Git, sizeKB)
+	if !memoryStorage {
+		restoreClone(cfg, path, l)
+	}
+	l.WithField("url", sourceURL).WithField("memory", memoryStorage).Info("cloning the repository...")
+
+	progress := cfg.Progress.Writer(name)
+	start := time.Now()
+	ctx, cancel := timeoutContext(cfg.runContext(), cfg.Timeouts.Clone)
+	g, err := gitops.Clone(ctx, cfg.Git, sourceURL, path, branch, memoryStorage, auth, progress)
+	err = timedOut(ctx, "the clone", cfg.Timeouts.Clone, err)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	metrics.GitDuration.Since(start, "clone")
+
+	if cfg.Git.Filter.Enabled() {
+		l.Info("filtering the history...")
+		removed, mapped, err := gitops.FilterHistory(g, cfg.Git.Filter, cfg.mailmap)
+		if err != nil {
+			return nil, fmt.Errorf("filtering the history: %v", err)
+		}
+		for _, p := range removed {
+			l.WithField("filename", p).Warn("the file was removed from the history")
+		}
+		for _, a := range mapped {
+			l.WithField("identity", a).Info("the commit identity was mapped")
+		}
+	}
+
+	l.WithField("remote", targetURL).Info("adding a new remote...")
+
+	remote := &gitconfig.RemoteConfig{
+		Name: cfg.Git.RemoteName,
+		URLs: []string{targetURL},
+	}
+	_, err = g.CreateRemote(remote)
+	if err == git.ErrRemoteExists {
+		if err = g.DeleteRemote(remote.Name); err == nil {
+			_, err = g.CreateRemote(remote)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l.WithField("remote", targetURL).Info("pushing to the new remote...")
+	cfg.Progress.Step(name, "pushing")
+
+	opts := &git.PushOptions{
+		RemoteName: cfg.Git.RemoteName,
+		Auth:       targetAuth,
+		Progress:   progress,
+	}
+	if cfg.Git.Mirror && cfg.refs != nil {
+		refs, err := cfg.refs.Local(g)
+		if err != nil {
+			return nil, err
+		}
+		if len(refs) == 0 {
+			l.Warn("no ref is selected by git.refspecs, git.branches and git.tags, nothing is pushed")
+			return g, nil
+		}
+		l.WithField("refs", len(refs)).Info("pushing the selected refs")
+		opts.RefSpecs = gitops.ExactRefSpecs(refs)
+	} else if cfg.Git.Mirror {
+		opts.RefSpecs = gitops.MirrorRefSpecs
+	} else if forcePush(cfg) || cfg.forks[name] != "" {
+		// the branches of a fork may have diverged from the ones of its parent
+		opts.RefSpecs = []gitconfig.RefSpec{"+refs/heads/*:refs/heads/*"}
+	}
+
+	start = time.Now()
+	ctx, cancel = timeoutContext(cfg.runContext(), cfg.Timeouts.Push)
+	err = push(ctx, cfg, g, opts, name, l)
+	err = timedOut(ctx, "the push", cfg.Timeouts.Push, err)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	metrics.GitDuration.Since(start, "push")
+
+	return g, nil
+}
+
+// push sends the refs of opts at once or, with git.push_batch_size, in
+// batches of that many refs, the branches before the tags. The branches of
+// git.branch_map are pushed under their new name.
+func push(ctx context.Context, cfg *migration, g *git.Repository, opts *git.PushOptions, repo string, l *log.Entry) error {
+	target := cfg.Target.Organization + "/" + targetName(cfg, repo)
+	if cfg.Git.PushBatchSize <= 0 && len(cfg.Git.BranchMap) == 0 {
+		err := g.PushContext(ctx, opts)
+		if err == git.NoErrAlreadyUpToDate {
+			return nil
+		}
+		if err == nil {
+			auditPush(cfg, "target", target, g, opts)
+		}
+		return err
+	}
+
+	specs, err := gitops.ExpandRefSpecs(g, opts.RefSpecs, renameRef(cfg))
+	if err != nil {
+		return fmt.Errorf("listing the refs to push: %v", err)
+	}
+	var renamed []string
+	for _, s := range specs {
+		if src := plumbing.ReferenceName(s.Src()); s.Dst(src) != src {
+			renamed = append(renamed, fmt.Sprintf("%s:%s", src.Short(), s.Dst(src).Short()))
+		}
+	}
+	for _, r := range renamed {
+		l.WithField("branch", r).Info("the branch is pushed under a new name")
+	}
+	cfg.Results.SetRenamedBranches(repo, renamed)
+
+	batches := [][]gitconfig.RefSpec{specs}
+	if cfg.Git.PushBatchSize > 0 {
+		batches = gitops.BatchRefSpecs(specs, cfg.Git.PushBatchSize)
+	}
+	for i, specs := range batches {
+		batch := fmt.Sprintf("%d/%d", i+1, len(batches))
+		if len(batches) > 1 {
+			cfg.Progress.Step(repo, "pushing "+batch)
+			l.WithField("batch", batch).WithField("refs", len(specs)).Info("pushing a batch of refs...")
+		}
+
+		o := *opts
+		o.RefSpecs = specs
+		err := g.PushContext(ctx, &o)
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("pushing the batch %s: %v", batch, err)
+		}
+		if err == nil {
+			auditPush(cfg, "target", target, g, &o)
+		}
+	}
+	return nil
+}
+
+// reopenClone returns the clone of a repository pushed in a previous run,
+// cloning it again when it is no longer available.
+func reopenClone(cfg *migration, URL, path string, sizeKB int, l *log.Entry) (*git.Repository, error) {
+	if !gitops.InMemory(cfg.Git, sizeKB) {
+		restoreClone(cfg, path, l)
+		g, err := git.PlainOpen(path)
+		if err != git.ErrRepositoryNotExists {
+			return g, err
+		}
+	}
+
+	auth, err := gitAuth(cfg, cfg.Source.Tokens, cfg.Source.Username, l)
+	if err != nil {
+		return nil, err
+	}
+	l.WithField("url", URL).Info("cloning the repository again...")
+	return gitops.Clone(cfg.runContext(), cfg.Git, URL, path, "", gitops.InMemory(cfg.Git, sizeKB), auth, nil)
+}
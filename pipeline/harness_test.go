@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/gitops/gittest"
+	"github.com/leocomelli/ghmgr/provider/github/githubtest"
+	log "github.com/sirupsen/logrus"
+)
+
+// fakes are the instances of a test: the source and target GitHub apis,
+// their repositories being served by a single git server.
+type fakes struct {
+	source *githubtest.Server
+	target *githubtest.Server
+	git    *gittest.Server
+}
+
+const (
+	sourceOrg = "acme"
+	targetOrg = "acme-new"
+)
+
+// newFakes starts the fake instances, the source being loaded with the
+// fixture of testdata.
+func newFakes(t *testing.T, fixture string) *fakes {
+	log.SetLevel(log.ErrorLevel)
+
+	f := &fakes{source: githubtest.NewServer(t), target: githubtest.NewServer(t), git: gittest.NewServer(t)}
+	for _, s := range []*githubtest.Server{f.source, f.target} {
+		s.GitURL = f.git.URL
+		s.Commit = f.git.Commit
+	}
+	// the repositories created on the target get their git remote
+	f.target.OnCreate = func(r *githubtest.Repo) { f.git.Create(r.Owner, r.Name) }
+	f.target.AddOrg(targetOrg)
+
+	if err := f.source.LoadFixture(filepath.Join("testdata", fixture)); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// config migrates the organization of the fixture to the target with the
+// defaults, the clones being made in a directory of the test.
+func (f *fakes) config(t *testing.T) *config.Configuration {
+	cfg := &config.Configuration{}
+	cfg.Source.URL = f.source.URL
+	cfg.Source.Token = "source-token"
+	cfg.Source.Organization = sourceOrg
+	cfg.Target.URL = f.target.URL
+	cfg.Target.Token = "target-token"
+	cfg.Target.Organization = targetOrg
+	cfg.Git.Protocol = config.ProtocolHTTPS
+	cfg.Git.ClonePath = t.TempDir()
+	cfg.Git.RemoteName = "target"
+	return cfg
+}
+
+// execute runs a command, failing the test on an error.
+func execute(t *testing.T, cfg *config.Configuration, opts Options) {
+	t.Helper()
+	if err := Execute(context.Background(), cfg, opts); err != nil {
+		t.Fatalf("%s: %v", opts.Command, err)
+	}
+}
+
+// newTestMigration creates the clients of a run without running any
+// command, for the tests of a single step.
+func newTestMigration(t *testing.T, cfg *config.Configuration) *migration {
+	t.Helper()
+	m, err := newMigration(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
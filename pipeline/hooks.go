@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+)
+
+// hookEnv describes the repository to the hook commands. The target url is
+// only known once the repository is created.
+func hookEnv(cfg *migration, source, target *gh.Repository) []string {
+	env := []string{
+		"GHMGR_REPO_NAME=" + source.GetName(),
+		"GHMGR_REPO_SOURCE_URL=" + source.GetHTMLURL(),
+		"GHMGR_REPO_SOURCE_CLONE_URL=" + repoURL(cfg, source),
+		"GHMGR_REPO_SOURCE_OWNER=" + cfg.Source.Organization,
+		"GHMGR_REPO_TARGET_OWNER=" + cfg.Target.Organization,
+		"GHMGR_REPO_TARGET_NAME=" + targetName(cfg, source.GetName()),
+		fmt.Sprintf("GHMGR_REPO_PRIVATE=%t", source.GetPrivate()),
+		"GHMGR_DRY_RUN=" + fmt.Sprint(cfg.DryRun),
+	}
+	if target != nil {
+		env = append(env, "GHMGR_REPO_TARGET_URL="+target.GetHTMLURL(), "GHMGR_REPO_TARGET_CLONE_URL="+repoURL(cfg, target))
+	}
+	return env
+}
+
+// runHook runs command with sh, the output is logged line by line.
+func runHook(cfg *migration, command string, env []string, l *log.Entry) error {
+	cmd := exec.CommandContext(cfg.runContext(), "sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+
+	out, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if line != "" {
+			l.WithField("output", line).Debug("hook")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("hook %q: %v", command, err)
+	}
+	return nil
+}
+
+// preRepoHook runs the pre_repo hook, its failure aborts the repository.
+func preRepoHook(cfg *migration, repo *gh.Repository, l *log.Entry) error {
+	if cfg.Hooks.PreRepo == "" {
+		return nil
+	}
+	l.Debug("running the pre_repo hook")
+	return runHook(cfg, cfg.Hooks.PreRepo, hookEnv(cfg, repo, nil), l)
+}
+
+// postRepoHook runs the post_repo hook along with the outcome of the
+// repository, its failure is only logged.
+func postRepoHook(cfg *migration, repo *gh.Repository, err error, l *log.Entry) {
+	if cfg.Hooks.PostRepo == "" {
+		return
+	}
+
+	env := hookEnv(cfg, repo, nil)
+	switch {
+	case err == errRepoSkipped:
+		env = append(env, "GHMGR_REPO_STATUS="+report.StatusSkipped)
+	case err != nil:
+		env = append(env, "GHMGR_REPO_STATUS="+report.StatusFailed, "GHMGR_REPO_ERROR="+err.Error())
+	default:
+		env = append(env, "GHMGR_REPO_STATUS="+report.StatusSucceeded)
+	}
+
+	l.Debug("running the post_repo hook")
+	if err := runHook(cfg, cfg.Hooks.PostRepo, env, l); err != nil {
+		l.Error(err)
+	}
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const importPollInterval = 10 * time.Second
+
+// importRepo asks the source import api of the target to fetch the source
+// repository over https, the migration host does not clone anything.
+func importRepo(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	migrations := cfg.Target.Instance.Migrations
+
+	t, err := cfg.Source.Tokens.Token()
+	if err != nil {
+		return err
+	}
+	username := cfg.Source.Username
+	if username == "" {
+		username = "x-access-token"
+	}
+
+	l.WithField("url", source.GetCloneURL()).Info("starting the import...")
+	_, _, err = migrations.StartImport(ctx, cfg.Target.Organization, *target.Name, &gh.Import{
+		VCSURL:      gh.String(source.GetCloneURL()),
+		VCS:         gh.String("git"),
+		VCSUsername: gh.String(username),
+		VCSPassword: gh.String(t.AccessToken),
+	})
+	if err != nil {
+		return fmt.Errorf("import: %v", err)
+	}
+
+	lfsSet := false
+	for {
+		select {
+		case <-time.After(importPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		i, _, err := migrations.ImportProgress(ctx, cfg.Target.Organization, *target.Name)
+		if err != nil {
+			return fmt.Errorf("import: %v", err)
+		}
+
+		if i.GetHasLargeFiles() && !lfsSet {
+			// the files over 100MB are only accepted as lfs objects
+			if !cfg.Git.LFS {
+				migrations.CancelImport(ctx, cfg.Target.Organization, *target.Name)
+				return fmt.Errorf("the repository has %d files larger than 100MB, enable git.lfs to import them", i.GetLargeFilesCount())
+			}
+			if _, _, err := migrations.SetLFSPreference(ctx, cfg.Target.Organization, *target.Name, &gh.Import{UseLFS: gh.String("opt_in")}); err != nil {
+				return fmt.Errorf("import: %v", err)
+			}
+			lfsSet = true
+		}
+
+		switch i.GetStatus() {
+		case "complete":
+			l.Info("the repository was imported successfully")
+			return nil
+		case "auth_failed", "error", "detection_needs_auth", "detection_found_nothing", "detection_found_multiple":
+			return fmt.Errorf("import %s: %s %s", i.GetStatus(), i.GetFailedStep(), i.GetMessage())
+		}
+
+		l.WithField("status", i.GetStatus()).WithField("percent", i.GetPercent()).Debug("importing...")
+	}
+}
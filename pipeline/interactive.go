@@ -0,0 +1,70 @@
+package pipeline
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var errAborted = errors.New("migration aborted by the user")
+
+func prompt(r *bufio.Reader, w io.Writer, question string) (string, error) {
+	fmt.Fprint(w, question)
+	answer, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(answer)), nil
+}
+
+// confirmRepos presents the candidate list and lets the user migrate all of
+// them, pick them one by one or abort before any write happens.
+func confirmRepos(cfg *migration, repos []*gh.Repository) ([]*gh.Repository, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errors.New("interactive mode requires a terminal")
+	}
+
+	r := bufio.NewReader(os.Stdin)
+	w := os.Stdout
+
+	fmt.Fprintf(w, "\n%d repositories will be migrated from %s to %s:\n\n", len(repos), cfg.Source.Organization, cfg.Target.Organization)
+	for i, repo := range repos {
+		fmt.Fprintf(w, "  %3d. %s\n", i+1, repo.GetName())
+	}
+	fmt.Fprintln(w)
+
+	for {
+		answer, err := prompt(r, w, "migrate [a]ll, choose [p]er repository or [q]uit? ")
+		if err != nil {
+			return nil, err
+		}
+
+		switch answer {
+		case "a", "all":
+			return repos, nil
+		case "q", "quit":
+			return nil, errAborted
+		case "p", "per":
+			var selected []*gh.Repository
+			for _, repo := range repos {
+				answer, err := prompt(r, w, fmt.Sprintf("migrate %s? [y/N/q] ", repo.GetName()))
+				if err != nil {
+					return nil, err
+				}
+				if answer == "q" {
+					return nil, errAborted
+				}
+				if answer == "y" || answer == "yes" {
+					selected = append(selected, repo)
+				}
+			}
+			return selected, nil
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+func listIssues(cfg *migration, repo *gh.Repository) ([]*gh.Issue, error) {
+	source := cfg.Source
+	opts := &gh.IssueListByRepoOptions{
+		State:       "all",
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: gh.ListOptions{PerPage: 100},
+	}
+
+	var issues []*gh.Issue
+	for {
+		ii, resp, err := source.Instance.Issues.ListByRepo(cfg.runContext(), source.Organization, *repo.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range ii {
+			if i.IsPullRequest() {
+				continue
+			}
+			issues = append(issues, i)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return issues, nil
+}
+
+func listIssueComments(cfg *migration, repo *gh.Repository, number int) ([]*gh.IssueComment, error) {
+	source := cfg.Source
+	opts := &gh.IssueListCommentsOptions{
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: gh.ListOptions{PerPage: 100},
+	}
+
+	var comments []*gh.IssueComment
+	for {
+		cc, resp, err := source.Instance.Issues.ListComments(cfg.runContext(), source.Organization, *repo.Name, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, cc...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return comments, nil
+}
+
+// migratedItems are the target numbers of the issues and pull requests
+// already migrated, by the source url of their attribution.
+type migratedItems map[string]int
+
+// listMigrated finds the issues and pull requests a previous run or attempt
+// created on the target, from the attribution of their body.
+func listMigrated(cfg *migration, target *gh.Repository) (migratedItems, error) {
+	tgt := cfg.Target
+	opts := &gh.IssueListByRepoOptions{State: "all", ListOptions: gh.ListOptions{PerPage: 100}}
+
+	items := migratedItems{}
+	for {
+		ii, resp, err := tgt.Instance.Issues.ListByRepo(cfg.runContext(), tgt.Organization, *target.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range ii {
+			if u := attributedURL(i.GetBody()); u != "" {
+				items[u] = i.GetNumber()
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return items, nil
+}
+
+// find returns the target number of the source item of login created at
+// URL, by the attribution it is posted with.
+func (m migratedItems) find(cfg *migration, login string, created time.Time, URL string) (int, bool) {
+	n, ok := m[attributionURL(cfg, login, created, URL)]
+	return n, ok
+}
+
+// postedComments are the source urls of the comments already posted on the
+// target issue or pull request number.
+func postedComments(cfg *migration, target *gh.Repository, number int) (map[string]bool, error) {
+	tgt := cfg.Target
+	opts := &gh.IssueListCommentsOptions{ListOptions: gh.ListOptions{PerPage: 100}}
+
+	posted := map[string]bool{}
+	for {
+		cc, resp, err := tgt.Instance.Issues.ListComments(cfg.runContext(), tgt.Organization, *target.Name, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cc {
+			if u := attributedURL(c.GetBody()); u != "" {
+				posted[u] = true
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return posted, nil
+}
+
+func migrateIssues(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	if cfg.Migrate.PreserveNumbers {
+		return migrateNumbered(cfg, source, target, l)
+	}
+
+	issues, err := listIssues(cfg, source)
+	if err != nil {
+		return err
+	}
+
+	milestones, err := targetMilestones(cfg, target)
+	if err != nil {
+		return err
+	}
+
+	migrated, err := listMigrated(cfg, target)
+	if err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(issues)).WithField("migrated", len(migrated)).Info("migrating the issues...")
+
+	for _, i := range issues {
+		if _, err := migrateIssue(cfg, source, target, i, milestones, migrated, l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateIssue creates the issue with its comments, it returns its number
+// on the target. An issue found in migrated only gets the comments missing
+// on the target, e.g. after a failure halfway.
+func migrateIssue(cfg *migration, source, target *gh.Repository, i *gh.Issue, milestones map[string]int, migrated migratedItems, l *log.Entry) (int, error) {
+	ctx := cfg.runContext()
+
+	var labels []string
+	for _, lb := range i.Labels {
+		labels = append(labels, lb.GetName())
+	}
+	assignees := mapUsers(cfg, i.Assignees)
+
+	client, body := attribute(cfg, i.GetUser().GetLogin(), i.GetCreatedAt(), i.GetHTMLURL(), i.GetBody())
+	if number, ok := migrated[attributedURL(body)]; ok {
+		l.WithField("source", i.GetNumber()).WithField("target", number).Info("the issue was already migrated, resuming its comments")
+		return number, completeIssue(cfg, source, target, i, number, true, l)
+	}
+
+	req := &gh.IssueRequest{
+		Title:     gh.String(cfg.scrubber.scrub(i.GetTitle())),
+		Body:      gh.String(body),
+		Labels:    &labels,
+		Assignees: &assignees,
+	}
+	if number, ok := milestones[i.GetMilestone().GetTitle()]; ok && i.Milestone != nil {
+		req.Milestone = gh.Int(number)
+	}
+
+	n, _, err := client.Issues.Create(ctx, cfg.Target.Organization, *target.Name, req)
+	if err != nil {
+		return 0, fmt.Errorf("issue #%d: %v", i.GetNumber(), err)
+	}
+	return n.GetNumber(), completeIssue(cfg, source, target, i, n.GetNumber(), false, l)
+}
+
+// completeIssue posts the comments of the issue on its target number, only
+// the missing ones when resumed, then closes it like the source.
+func completeIssue(cfg *migration, source, target *gh.Repository, i *gh.Issue, number int, resumed bool, l *log.Entry) error {
+	ctx := cfg.runContext()
+	cfg.references.record(*source.Name, i.GetNumber(), number)
+
+	comments, err := listIssueComments(cfg, source, i.GetNumber())
+	if err != nil {
+		return fmt.Errorf("issue #%d: %v", i.GetNumber(), err)
+	}
+	posted := map[string]bool{}
+	if resumed {
+		if posted, err = postedComments(cfg, target, number); err != nil {
+			return fmt.Errorf("issue #%d: %v", i.GetNumber(), err)
+		}
+	}
+
+	for _, c := range comments {
+		client, body := attribute(cfg, c.GetUser().GetLogin(), c.GetCreatedAt(), c.GetHTMLURL(), c.GetBody())
+		if posted[attributedURL(body)] {
+			continue
+		}
+		_, _, err := client.Issues.CreateComment(ctx, cfg.Target.Organization, *target.Name, number, &gh.IssueComment{
+			Body: gh.String(body),
+		})
+		if err != nil {
+			return fmt.Errorf("issue #%d comment: %v", i.GetNumber(), err)
+		}
+	}
+
+	if i.GetState() == "closed" {
+		_, _, err := cfg.Target.Instance.Issues.Edit(ctx, cfg.Target.Organization, *target.Name, number, &gh.IssueRequest{
+			State: gh.String("closed"),
+		})
+		if err != nil {
+			return fmt.Errorf("issue #%d: %v", i.GetNumber(), err)
+		}
+	}
+
+	l.WithField("source", i.GetNumber()).WithField("target", number).WithField("comments", len(comments)).
+		Info("an issue was migrated successfully")
+	return nil
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github/githubtest"
+	log "github.com/sirupsen/logrus"
+)
+
+// issueTracker serves the issues and comments of a target repository, the
+// comment of failBody failing once.
+type issueTracker struct {
+	mu       sync.Mutex
+	issues   []map[string]interface{}
+	comments map[int][]map[string]interface{}
+	failBody string
+}
+
+func newIssueTracker(s *githubtest.Server, repo string) *issueTracker {
+	it := &issueTracker{comments: map[int][]map[string]interface{}{}}
+	base := "repos/" + repo + "/issues"
+	s.Handle("GET", base, func(w http.ResponseWriter, r *http.Request, path string) {
+		it.mu.Lock()
+		defer it.mu.Unlock()
+		issues := it.issues
+		if r.URL.Query().Get("direction") == "desc" {
+			issues = nil
+			for i := len(it.issues) - 1; i >= 0; i-- {
+				issues = append(issues, it.issues[i])
+			}
+		}
+		githubtest.Reply(w, http.StatusOK, issues)
+	})
+	s.Handle("POST", base, func(w http.ResponseWriter, r *http.Request, path string) {
+		it.mu.Lock()
+		defer it.mu.Unlock()
+		var i map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&i)
+		i["number"] = len(it.issues) + 1
+		it.issues = append(it.issues, i)
+		githubtest.Reply(w, http.StatusCreated, i)
+	})
+	s.Handle("PATCH", base+"/*", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, map[string]interface{}{})
+	})
+	s.Handle("GET", base+"/*/comments", func(w http.ResponseWriter, r *http.Request, path string) {
+		it.mu.Lock()
+		defer it.mu.Unlock()
+		githubtest.Reply(w, http.StatusOK, it.comments[issueNumber(path)])
+	})
+	s.Handle("POST", base+"/*/comments", func(w http.ResponseWriter, r *http.Request, path string) {
+		it.mu.Lock()
+		defer it.mu.Unlock()
+		var c map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&c)
+		if body, _ := c["body"].(string); it.failBody != "" && strings.Contains(body, it.failBody) {
+			it.failBody = ""
+			githubtest.Reply(w, http.StatusBadGateway, map[string]string{"message": "Bad Gateway"})
+			return
+		}
+		n := issueNumber(path)
+		it.comments[n] = append(it.comments[n], c)
+		githubtest.Reply(w, http.StatusCreated, c)
+	})
+	return it
+}
+
+// bodies returns the bodies of the comments of the issue number.
+func (it *issueTracker) bodies(number int) []string {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	var bodies []string
+	for _, c := range it.comments[number] {
+		bodies = append(bodies, c["body"].(string))
+	}
+	return bodies
+}
+
+func issueNumber(path string) int {
+	segments := strings.Split(path, "/")
+	n, _ := strconv.Atoi(segments[4])
+	return n
+}
+
+// sourceIssue is an issue, or a comment, of the source repository api.
+func sourceIssue(number int, path, body string) map[string]interface{} {
+	return map[string]interface{}{
+		"number":     number,
+		"body":       body,
+		"title":      body,
+		"state":      "open",
+		"html_url":   "https://github.com/acme/api/" + path,
+		"user":       map[string]interface{}{"login": "alice"},
+		"created_at": "2020-01-02T10:00:00Z",
+	}
+}
+
+// stubIssues serves the issues #1 and #2 of api, with two comments each,
+// and a target without milestones where the second comment of #1 fails once.
+func stubIssues(f *fakes) *issueTracker {
+	f.source.Handle("GET", "repos/acme/api/issues", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, []map[string]interface{}{
+			sourceIssue(1, "issues/1", "first"),
+			sourceIssue(2, "issues/2", "second"),
+		})
+	})
+	f.source.Handle("GET", "repos/acme/api/issues/*/comments", func(w http.ResponseWriter, r *http.Request, path string) {
+		n := issueNumber(path)
+		githubtest.Reply(w, http.StatusOK, []map[string]interface{}{
+			sourceIssue(n, "issues/"+strconv.Itoa(n)+"#issuecomment-1", "one"),
+			sourceIssue(n, "issues/"+strconv.Itoa(n)+"#issuecomment-2", "two"),
+		})
+	})
+	f.target.Handle("GET", "repos/acme-new/api/milestones", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, []interface{}{})
+	})
+	tracker := newIssueTracker(f.target, "acme-new/api")
+	// the second comment of the first issue fails, as the step halfway
+	tracker.failBody = "issues/1#issuecomment-2"
+	return tracker
+}
+
+func TestMigrateIssuesResume(t *testing.T) {
+	for _, preserve := range []bool{false, true} {
+		f := newFakes(t, "organization.json")
+		cfg := f.config(t)
+		cfg.Migrate.Issues = true
+		cfg.Migrate.PreserveNumbers = preserve
+		m := newTestMigration(t, cfg)
+		tracker := stubIssues(f)
+
+		repo := &gh.Repository{Name: gh.String("api")}
+		if err := migrateIssues(m, repo, repo, log.WithField("repo", "api")); err == nil {
+			t.Fatalf("preserve_numbers %v: the failing comment did not fail the step", preserve)
+		}
+		if err := migrateIssues(m, repo, repo, log.WithField("repo", "api")); err != nil {
+			t.Fatalf("preserve_numbers %v: %v", preserve, err)
+		}
+		// the step is complete, running it again creates nothing
+		if err := migrateIssues(m, repo, repo, log.WithField("repo", "api")); err != nil {
+			t.Fatalf("preserve_numbers %v: %v", preserve, err)
+		}
+
+		if n := len(tracker.issues); n != 2 {
+			t.Fatalf("preserve_numbers %v: %d issues on the target, want 2", preserve, n)
+		}
+		for number := 1; number <= 2; number++ {
+			bodies := tracker.bodies(number)
+			if len(bodies) != 2 || !strings.Contains(bodies[0], "issuecomment-1") || !strings.Contains(bodies[1], "issuecomment-2") {
+				t.Errorf("preserve_numbers %v: #%d: comments = %q, want the two comments once, in order", preserve, number, bodies)
+			}
+		}
+	}
+}
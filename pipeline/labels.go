@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+func listLabels(ctx context.Context, client *gh.Client, owner, repo string) ([]*gh.Label, error) {
+	opts := &gh.ListOptions{PerPage: 100}
+
+	var labels []*gh.Label
+	for {
+		ll, resp, err := client.Issues.ListLabels(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, ll...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return labels, nil
+}
+
+func listMilestones(ctx context.Context, client *gh.Client, owner, repo string) ([]*gh.Milestone, error) {
+	opts := &gh.MilestoneListOptions{
+		State:       "all",
+		ListOptions: gh.ListOptions{PerPage: 100},
+	}
+
+	var milestones []*gh.Milestone
+	for {
+		mm, resp, err := client.Issues.ListMilestones(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, mm...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return milestones, nil
+}
+
+// targetMilestones indexes the milestone numbers of the target repository
+// by title, so issues can reference them regardless of their source number.
+func targetMilestones(cfg *migration, target *gh.Repository) (map[string]int, error) {
+	milestones, err := listMilestones(cfg.runContext(), cfg.Target.Instance, cfg.Target.Organization, *target.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := map[string]int{}
+	for _, m := range milestones {
+		numbers[m.GetTitle()] = m.GetNumber()
+	}
+	return numbers, nil
+}
+
+func migrateLabels(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	labels, err := listLabels(ctx, cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listLabels(ctx, cfg.Target.Instance, cfg.Target.Organization, *target.Name)
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, lb := range existing {
+		names[lb.GetName()] = true
+	}
+
+	l.WithField("amount", len(labels)).Info("migrating the labels...")
+
+	for _, lb := range labels {
+		label := &gh.Label{
+			Name:        lb.Name,
+			Color:       lb.Color,
+			Description: lb.Description,
+		}
+
+		if names[lb.GetName()] {
+			_, _, err = cfg.Target.Instance.Issues.EditLabel(ctx, cfg.Target.Organization, *target.Name, lb.GetName(), label)
+		} else {
+			_, _, err = cfg.Target.Instance.Issues.CreateLabel(ctx, cfg.Target.Organization, *target.Name, label)
+		}
+		if err != nil {
+			return fmt.Errorf("label %s: %v", lb.GetName(), err)
+		}
+	}
+
+	milestones, err := listMilestones(ctx, cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return err
+	}
+
+	numbers, err := targetMilestones(cfg, target)
+	if err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(milestones)).Info("migrating the milestones...")
+
+	for _, m := range milestones {
+		if _, ok := numbers[m.GetTitle()]; ok {
+			continue
+		}
+
+		_, _, err := cfg.Target.Instance.Issues.CreateMilestone(ctx, cfg.Target.Organization, *target.Name, &gh.Milestone{
+			Title:       m.Title,
+			Description: m.Description,
+			DueOn:       m.DueOn,
+			State:       m.State,
+		})
+		if err != nil {
+			return fmt.Errorf("milestone %s: %v", m.GetTitle(), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/gitops"
+	log "github.com/sirupsen/logrus"
+	git "gopkg.in/src-d/go-git.v4"
+)
+
+func targetLFSEndpoint(cfg *migration, target *gh.Repository) gitops.LFSEndpoint {
+	if cfg.Git.LFSURL != "" {
+		return gitops.LFSEndpoint{
+			URL:    fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(cfg.Git.LFSURL, "/"), cfg.Target.Organization, *target.Name),
+			Tokens: cfg.Target.Tokens,
+			Client: &http.Client{Transport: cfg.Target.Transport},
+		}
+	}
+	return gitops.LFSEndpoint{URL: target.GetCloneURL() + "/info/lfs", Tokens: cfg.Target.Tokens, Client: &http.Client{Transport: cfg.Target.Transport}}
+}
+
+// migrateLFS reads the pointers from g, the clone just pushed, or from the
+// clone of a previous run when g is nil.
+func migrateLFS(cfg *migration, g *git.Repository, source, target *gh.Repository, l *log.Entry) error {
+	if g == nil {
+		var err error
+		g, err = reopenClone(cfg, repoURL(cfg, source), clonePath(cfg, *source.Name), source.GetSize(), l)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !cfg.Git.LFS {
+		if gitops.UsesLFS(g) {
+			return fmt.Errorf("the repository uses Git LFS, enable git.lfs to transfer its objects")
+		}
+		return nil
+	}
+
+	objects, err := gitops.FindLFSObjects(g)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+
+	l.WithField("objects", len(objects)).Info("transferring the lfs objects...")
+
+	sourceEndpoint := gitops.LFSEndpoint{URL: source.GetCloneURL() + "/info/lfs", Tokens: cfg.Source.Tokens, Client: &http.Client{Transport: cfg.Source.Transport}}
+	targetEndpoint := targetLFSEndpoint(cfg, target)
+
+	if err := gitops.TransferLFS(cfg.runContext(), sourceEndpoint, targetEndpoint, objects); err != nil {
+		return err
+	}
+
+	l.WithField("objects", len(objects)).Info("the lfs objects were transferred successfully")
+	return nil
+}
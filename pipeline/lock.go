@@ -0,0 +1,400 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/gitops"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultLockStaleAfter is the age of a lock not refreshed from which it is
+// stale, without lock.stale_after.
+const defaultLockStaleAfter = time.Hour
+
+// lockFile is the file of lock.repository holding the lock.
+const lockFile = "ghmgr.lock"
+
+var (
+	errLockHeld = errors.New("the lock is held by another run")
+	errLockLost = errors.New("the lock was taken over by another run")
+)
+
+// lockInfo is the content of the lock, identifying the run holding it.
+type lockInfo struct {
+	Owner     string    `json:"owner"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Command   string    `json:"command"`
+	Target    string    `json:"target"`
+	Started   time.Time `json:"started"`
+	Refreshed time.Time `json:"refreshed"`
+}
+
+func (i *lockInfo) String() string {
+	return fmt.Sprintf("%s@%s (pid %d, %s since %s)", i.Owner, i.Host, i.PID, i.Command, i.Started.Format(time.RFC3339))
+}
+
+// lockStore keeps the lock, the version returned by each call identifying
+// the content written, so a run never overwrites a lock it does not hold.
+type lockStore interface {
+	// create fails with errLockHeld when the lock exists
+	create(ctx context.Context, info *lockInfo) (string, error)
+	// read returns nil when there is no lock
+	read(ctx context.Context) (*lockInfo, string, error)
+	// update fails with errLockLost when the lock is not version anymore
+	update(ctx context.Context, info *lockInfo, version string) (string, error)
+	remove(ctx context.Context, version string) error
+	location() string
+	// local reports whether the pid of the lock can be checked on this host
+	local() bool
+}
+
+// fileLock is a file of lock.path, named after the target host and
+// organization; its version is its content.
+type fileLock struct {
+	path string
+}
+
+func (f *fileLock) create(ctx context.Context, info *lockInfo) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return "", err
+	}
+	content, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		return "", errLockHeld
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		os.Remove(f.path)
+		return "", err
+	}
+	return string(content), file.Close()
+}
+
+func (f *fileLock) read(ctx context.Context) (*lockInfo, string, error) {
+	content, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	info := &lockInfo{}
+	if err := json.Unmarshal(content, info); err != nil {
+		return nil, "", fmt.Errorf("%s: %v", f.path, err)
+	}
+	return info, string(content), nil
+}
+
+func (f *fileLock) update(ctx context.Context, info *lockInfo, version string) (string, error) {
+	if _, current, err := f.read(ctx); err != nil {
+		return "", err
+	} else if current != version {
+		return "", errLockLost
+	}
+	content, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	tmp := f.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return "", err
+	}
+	return string(content), os.Rename(tmp, f.path)
+}
+
+func (f *fileLock) remove(ctx context.Context, version string) error {
+	if _, current, err := f.read(ctx); err != nil || current != version {
+		return err
+	}
+	return os.Remove(f.path)
+}
+
+func (f *fileLock) location() string { return f.path }
+func (f *fileLock) local() bool      { return true }
+
+// repoLock is the ghmgr.lock file of lock.repository in the target
+// organization, created with the repository when missing; its version is
+// the sha of the file, which the contents api checks on every change.
+type repoLock struct {
+	cfg  *migration
+	repo string
+}
+
+func (r *repoLock) create(ctx context.Context, info *lockInfo) (string, error) {
+	tgt := r.cfg.Target
+	_, resp, err := tgt.Instance.Repositories.Get(ctx, tgt.Organization, r.repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		opts := &gh.Repository{Name: gh.String(r.repo), Private: gh.Bool(true), Description: gh.String("locks of the ghmgr runs")}
+		if _, _, err = tgt.Instance.Repositories.Create(ctx, tgt.Organization, opts); err != nil {
+			return "", fmt.Errorf("creating the lock repository %s: %v", r.repo, err)
+		}
+		log.WithField("repository", r.repo).Info("the lock repository was created on the target")
+	} else if err != nil {
+		return "", err
+	}
+
+	content, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	options := &gh.RepositoryContentFileOptions{Message: gh.String("lock: " + info.Command + " by " + info.Owner), Content: content}
+	c, resp, err := tgt.Instance.Repositories.CreateFile(ctx, tgt.Organization, r.repo, lockFile, options)
+	if resp != nil && (resp.StatusCode == http.StatusUnprocessableEntity || resp.StatusCode == http.StatusConflict) {
+		return "", errLockHeld
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.GetContent().GetSHA(), nil
+}
+
+func (r *repoLock) read(ctx context.Context) (*lockInfo, string, error) {
+	tgt := r.cfg.Target
+	c, _, resp, err := tgt.Instance.Repositories.GetContents(ctx, tgt.Organization, r.repo, lockFile, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	content, err := c.GetContent()
+	if err != nil {
+		return nil, "", err
+	}
+	info := &lockInfo{}
+	if err := json.Unmarshal([]byte(content), info); err != nil {
+		return nil, "", fmt.Errorf("%s: %v", r.location(), err)
+	}
+	return info, c.GetSHA(), nil
+}
+
+func (r *repoLock) update(ctx context.Context, info *lockInfo, version string) (string, error) {
+	tgt := r.cfg.Target
+	content, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	options := &gh.RepositoryContentFileOptions{Message: gh.String("lock: refreshed by " + info.Owner), Content: content, SHA: gh.String(version)}
+	c, resp, err := tgt.Instance.Repositories.UpdateFile(ctx, tgt.Organization, r.repo, lockFile, options)
+	if resp != nil && (resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity) {
+		return "", errLockLost
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.GetContent().GetSHA(), nil
+}
+
+func (r *repoLock) remove(ctx context.Context, version string) error {
+	tgt := r.cfg.Target
+	options := &gh.RepositoryContentFileOptions{Message: gh.String("unlock"), SHA: gh.String(version)}
+	_, resp, err := tgt.Instance.Repositories.DeleteFile(ctx, tgt.Organization, r.repo, lockFile, options)
+	if resp != nil && (resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (r *repoLock) location() string {
+	return fmt.Sprintf("%s/%s/%s", r.cfg.Target.Organization, r.repo, lockFile)
+}
+
+func (r *repoLock) local() bool { return false }
+
+// newLockStore returns the store of lock.path or lock.repository.
+func newLockStore(cfg *migration) lockStore {
+	if cfg.Lock.Repository != "" {
+		return &repoLock{cfg: cfg, repo: cfg.Lock.Repository}
+	}
+	host := ""
+	if u, err := url.Parse(targetWebBase(cfg)); err == nil {
+		host = u.Host
+	}
+	name := gitops.SafeName(host + "_" + cfg.Target.Organization + ".lock")
+	return &fileLock{path: gitops.LongPath(filepath.Join(cfg.Lock.Path, name))}
+}
+
+// runLock is the lock held by a run, refreshed in the background until
+// released. The run is aborted when another one takes the lock over.
+type runLock struct {
+	store   lockStore
+	info    *lockInfo
+	version string
+	abort   *runAbort
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func staleAfter(cfg *migration) time.Duration {
+	if cfg.Lock.StaleAfter > 0 {
+		return cfg.Lock.StaleAfter
+	}
+	return defaultLockStaleAfter
+}
+
+// stale reports whether the lock was left by a run that ended without
+// releasing it: not refreshed for lock.stale_after, or held by a process
+// of this host that is not running anymore.
+func stale(cfg *migration, store lockStore, info *lockInfo) bool {
+	if time.Since(info.Refreshed) > staleAfter(cfg) {
+		return true
+	}
+	host, _ := os.Hostname()
+	return store.local() && info.Host == host && info.PID != os.Getpid() && !processRunning(info.PID)
+}
+
+// processRunning reports whether a process of this host has the pid.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// FindProcess always succeeds on unix, where the signal 0 checks it
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// acquireLock takes the lock of the target organization for the command,
+// taking over a stale lock or, with --break-lock, any lock.
+func acquireLock(cfg *migration, command string) (*runLock, error) {
+	ctx := cfg.runContext()
+	store := newLockStore(cfg)
+
+	owner := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	info := &lockInfo{Owner: owner, Host: host, PID: os.Getpid(), Command: command, Target: cfg.Target.Organization, Started: now, Refreshed: now}
+	l := log.WithField("lock", store.location())
+
+	for attempt := 0; attempt < 3; attempt++ {
+		version, err := store.create(ctx, info)
+		if err == nil {
+			l.Debug("the lock was acquired")
+			lock := &runLock{store: store, info: info, version: version, abort: cfg.abort, done: make(chan struct{})}
+			lock.wg.Add(1)
+			go lock.refresh(staleAfter(cfg) / 3)
+			return lock, nil
+		}
+		if err != errLockHeld {
+			return nil, fmt.Errorf("lock: %v", err)
+		}
+
+		held, heldVersion, err := store.read(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("lock: %v", err)
+		}
+		switch {
+		case held == nil:
+			// released meanwhile
+			continue
+		case cfg.breakLock:
+			l.WithField("holder", held.String()).Warn("breaking the lock held by another run")
+		case stale(cfg, store, held):
+			l.WithField("holder", held.String()).Warn("taking over the stale lock of another run")
+		default:
+			return nil, fmt.Errorf("the target organization %s is locked by %s, refreshed at %s; --break-lock removes the lock",
+				cfg.Target.Organization, held, held.Refreshed.Format(time.RFC3339))
+		}
+		if err := store.remove(ctx, heldVersion); err != nil {
+			return nil, fmt.Errorf("lock: %v", err)
+		}
+	}
+	return nil, fmt.Errorf("lock: %v", errLockHeld)
+}
+
+// refresh updates the lock every interval, so the other runs do not take
+// it for a stale one. A lock taken over aborts the run, the workers take
+// no more repositories.
+func (r *runLock) refresh(interval time.Duration) {
+	defer r.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-t.C:
+		}
+
+		r.info.Refreshed = time.Now().UTC()
+		version, err := r.store.update(context.Background(), r.info, r.version)
+		if err == errLockLost {
+			log.WithField("lock", r.store.location()).Error(err)
+			r.abort.set(errLockLost)
+			return
+		}
+		if err != nil {
+			log.WithField("lock", r.store.location()).WithError(err).Error("the lock could not be refreshed")
+			continue
+		}
+		r.version = version
+	}
+}
+
+// release stops the refresh and removes the lock, unless another run took
+// it over meanwhile.
+func (r *runLock) release() {
+	close(r.done)
+	r.wg.Wait()
+	if err := r.store.remove(context.Background(), r.version); err != nil {
+		log.WithField("lock", r.store.location()).WithError(err).Error("the lock could not be released")
+	}
+}
+
+// lockedCommand reports whether the command writes to the repositories,
+// the notice preview and the read-only commands needing no lock.
+func lockedCommand(cfg *migration, command string) bool {
+	switch command {
+	case "migrate", "sync", "archive", "rollback", "unmigrate":
+		return true
+	case "notice":
+		return cfg.subcommand == ""
+	}
+	return false
+}
+
+// withLock runs fn holding the lock of the target organization, when set
+// and the command writes. It fails with errLockLost when another run took
+// the lock over meanwhile.
+func withLock(cfg *migration, command string, fn func() error) error {
+	if !cfg.Lock.Enabled() || cfg.DryRun || !lockedCommand(cfg, command) {
+		return fn()
+	}
+	lock, err := acquireLock(cfg, command)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	err = fn()
+	if cfg.abort.Err() == errLockLost {
+		return errLockLost
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+)
+
+func newLockMigration(t *testing.T, dir string) *migration {
+	c := &config.Configuration{}
+	c.Target.Organization = "acme"
+	c.Lock.Path = dir
+	return &migration{Configuration: c, Target: target{Target: c.Target, Instance: gh.NewClient(nil)}}
+}
+
+func TestLockHeld(t *testing.T) {
+	dir := t.TempDir()
+	first, err := acquireLock(newLockMigration(t, dir), "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := acquireLock(newLockMigration(t, dir), "sync"); err == nil || !strings.Contains(err.Error(), "is locked by") {
+		t.Fatalf("second lock: err = %v, want the organization locked", err)
+	}
+
+	first.release()
+	second, err := acquireLock(newLockMigration(t, dir), "sync")
+	if err != nil {
+		t.Fatalf("lock released: %v", err)
+	}
+	second.release()
+}
+
+func TestLockStale(t *testing.T) {
+	m := newLockMigration(t, t.TempDir())
+	store := newLockStore(m)
+	old := time.Now().Add(-2 * defaultLockStaleAfter)
+	if _, err := store.create(m.runContext(), &lockInfo{Host: "elsewhere", PID: 1, Command: "migrate", Started: old, Refreshed: old}); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := acquireLock(m, "migrate")
+	if err != nil {
+		t.Fatalf("stale lock: %v", err)
+	}
+	defer lock.release()
+	if info, _, _ := store.read(m.runContext()); info == nil || info.PID != os.Getpid() {
+		t.Errorf("lock holder = %v, want this run", info)
+	}
+}
+
+func TestLockBreak(t *testing.T) {
+	dir := t.TempDir()
+	first, err := acquireLock(newLockMigration(t, dir), "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newLockMigration(t, dir)
+	m.breakLock = true
+	second, err := acquireLock(m, "migrate")
+	if err != nil {
+		t.Fatalf("--break-lock: %v", err)
+	}
+
+	// the run whose lock was broken does not remove the new one
+	first.release()
+	content, err := ioutil.ReadFile(newLockStore(m).location())
+	if err != nil {
+		t.Fatalf("lock removed by the previous holder: %v", err)
+	}
+	info := &lockInfo{}
+	if err := json.Unmarshal(content, info); err != nil || !info.Started.Equal(second.info.Started) {
+		t.Errorf("lock = %s, want the one of the second run", content)
+	}
+	second.release()
+}
+
+func TestLockLost(t *testing.T) {
+	dir := t.TempDir()
+	m := newLockMigration(t, dir)
+	m.abort = newRunAbort()
+	m.Lock.StaleAfter = 30 * time.Millisecond
+
+	err := withLock(m, "migrate", func() error {
+		// another run takes the lock over
+		if err := ioutil.WriteFile(newLockStore(m).location(), []byte(`{"owner":"other"}`), 0644); err != nil {
+			return err
+		}
+		select {
+		case <-m.abort.aborted():
+		case <-time.After(5 * time.Second):
+			t.Error("the run was not aborted")
+		}
+		if !m.stopping() {
+			t.Error("the workers would take more repositories")
+		}
+		return nil
+	})
+	if err != errLockLost {
+		t.Errorf("err = %v, want %v", err, errLockLost)
+	}
+}
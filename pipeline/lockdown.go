@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const pinIssueMutation = `mutation($id: ID!) { pinIssue(input: {issueId: $id}) { issue { number } } }`
+
+// lockdownRepo makes the source read-only once migrated with
+// source.lockdown, each of its parts being optional.
+func lockdownRepo(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	lockdown := cfg.Source.Lockdown
+
+	if lockdown.Permissions {
+		if err := lowerPermissions(cfg, source, l); err != nil {
+			return err
+		}
+	}
+
+	if lockdown.Description != "" {
+		description := expandTemplate(lockdown.Description, source, target)
+		_, _, err := cfg.Source.Instance.Repositories.Edit(cfg.runContext(), cfg.Source.Organization, *source.Name, &gh.Repository{
+			Description: gh.String(description),
+		})
+		if err != nil {
+			return fmt.Errorf("description: %v", err)
+		}
+		l.WithField("description", description).Info("the description of the source was updated")
+	}
+
+	if lockdown.Issue.Title != "" {
+		if err := pinLockdownIssue(cfg, source, target, l); err != nil {
+			return fmt.Errorf("lockdown issue: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// lowerPermissions gives the pull permission to the teams and the direct
+// collaborators able to write to the source, but the authenticated user
+// which still has to archive it.
+func lowerPermissions(cfg *migration, source *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	pull := "pull"
+
+	// a user account has no teams
+	if cfg.Source.User == "" {
+		teams, err := listRepoTeams(cfg, source)
+		if err != nil {
+			return fmt.Errorf("teams: %v", err)
+		}
+		for _, t := range teams {
+			if p := t.GetPermission(); p == "pull" || p == "triage" {
+				continue
+			}
+			_, err := cfg.Source.Instance.Teams.AddTeamRepo(ctx, t.GetID(), cfg.Source.Organization, *source.Name, &gh.TeamAddTeamRepoOptions{
+				Permission: pull,
+			})
+			if err != nil {
+				return fmt.Errorf("team %s: %v", t.GetSlug(), err)
+			}
+			l.WithField("team", t.GetSlug()).WithField("permission", t.GetPermission()).Info("the permission of the team was lowered to pull")
+		}
+	}
+
+	me, _, err := cfg.Source.Instance.Users.Get(ctx, "")
+	if err != nil {
+		return fmt.Errorf("authenticated user: %v", err)
+	}
+	users, err := listCollaborators(cfg, source)
+	if err != nil {
+		return fmt.Errorf("collaborators: %v", err)
+	}
+	for _, u := range users {
+		permission := collaboratorPermission(u)
+		if permission == pull || u.GetLogin() == me.GetLogin() {
+			continue
+		}
+		_, err := cfg.Source.Instance.Repositories.AddCollaborator(ctx, cfg.Source.Organization, *source.Name, u.GetLogin(), &gh.RepositoryAddCollaboratorOptions{
+			Permission: pull,
+		})
+		if err != nil {
+			return fmt.Errorf("collaborator %s: %v", u.GetLogin(), err)
+		}
+		l.WithField("user", u.GetLogin()).WithField("permission", permission).Info("the permission of the collaborator was lowered to pull")
+	}
+
+	return nil
+}
+
+// pinLockdownIssue opens the issue announcing the move on the source and
+// pins it, an open issue of the same title being reused when a previous
+// run could not pin it.
+func pinLockdownIssue(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	title := expandTemplate(cfg.Source.Lockdown.Issue.Title, source, target)
+
+	issue, err := findIssue(cfg, source, title)
+	if err != nil {
+		return err
+	}
+	if issue == nil {
+		issue, _, err = cfg.Source.Instance.Issues.Create(ctx, cfg.Source.Organization, *source.Name, &gh.IssueRequest{
+			Title: gh.String(title),
+			Body:  gh.String(expandTemplate(cfg.Source.Lockdown.Issue.Body, source, target)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := github.GraphQL(ctx, cfg.Source.Instance, pinIssueMutation, map[string]interface{}{"id": issue.GetNodeID()}, nil); err != nil {
+		return fmt.Errorf("pinning issue #%d: %v", issue.GetNumber(), err)
+	}
+
+	l.WithField("issue", issue.GetHTMLURL()).Info("the lockdown issue was pinned")
+	return nil
+}
+
+// findIssue returns the open issue of the source with the title, nil when
+// there is none.
+func findIssue(cfg *migration, source *gh.Repository, title string) (*gh.Issue, error) {
+	opts := &gh.IssueListByRepoOptions{State: "open", ListOptions: gh.ListOptions{PerPage: 100}}
+	for {
+		ii, resp, err := cfg.Source.Instance.Issues.ListByRepo(cfg.runContext(), cfg.Source.Organization, *source.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range ii {
+			if !i.IsPullRequest() && i.GetTitle() == title {
+				return i, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/gitops"
+	log "github.com/sirupsen/logrus"
+)
+
+// repoLogHook copies the entries of each repository, those with the repo
+// field, to a file of its own.
+type repoLogHook struct {
+	dir       string
+	formatter log.Formatter
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+func (h *repoLogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *repoLogHook) Fire(e *log.Entry) error {
+	repo, ok := e.Data["repo"].(string)
+	if !ok {
+		return nil
+	}
+	b, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.files[repo]
+	if !ok {
+		f, err = os.OpenFile(filepath.Join(h.dir, gitops.SafeName(repo)+".log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		h.files[repo] = f
+	}
+	_, err = f.Write(b)
+	return err
+}
+
+func logFormatter(format string) log.Formatter {
+	if strings.ToLower(format) == config.LogFormatJSON {
+		return &log.JSONFormatter{}
+	}
+	return &log.TextFormatter{FullTimestamp: true, DisableColors: true}
+}
+
+// SetupLogging applies the log section of the configuration to the
+// standard logger.
+func SetupLogging(cfg *config.Configuration) error {
+	if cfg.Log.Level != "" {
+		level, err := log.ParseLevel(cfg.Log.Level)
+		if err != nil {
+			return fmt.Errorf("log.level: %v", err)
+		}
+		log.SetLevel(level)
+	}
+
+	switch strings.ToLower(cfg.Log.Format) {
+	case "", config.LogFormatText:
+		if cfg.Log.File != "" {
+			log.SetFormatter(logFormatter(config.LogFormatText))
+		}
+	case config.LogFormatJSON:
+		log.SetFormatter(logFormatter(config.LogFormatJSON))
+	default:
+		return fmt.Errorf("log.format: %q must be %s or %s", cfg.Log.Format, config.LogFormatText, config.LogFormatJSON)
+	}
+
+	if cfg.Log.File != "" {
+		f, err := os.OpenFile(cfg.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("log.file: %v", err)
+		}
+		log.SetOutput(f)
+	}
+
+	red := newRedactor(cfg)
+	log.SetFormatter(&redactFormatter{base: log.StandardLogger().Formatter, redactor: red})
+
+	if cfg.Log.PerRepo {
+		if cfg.Report.Path == "" {
+			return fmt.Errorf("log.per_repo: requires report.path, the logs are written next to the report")
+		}
+		dir := filepath.Join(filepath.Dir(cfg.Report.Path), "logs")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("log.per_repo: %v", err)
+		}
+		log.AddHook(&repoLogHook{dir: dir, formatter: &redactFormatter{base: logFormatter(cfg.Log.Format), redactor: red}, files: map[string]*os.File{}})
+	}
+
+	return nil
+}
+
+type correlationKey struct{}
+
+// withCorrelation is a copy of the run for an attempt of a repository, the
+// requests of which carry the correlation id for the audit log.
+func (c *migration) withCorrelation(id string) *migration {
+	rc := *c
+	rc.ctx = context.WithValue(c.runContext(), correlationKey{}, id)
+	return &rc
+}
+
+// correlationOf is the correlation id of the attempt ctx belongs to,
+// empty outside of one.
+func correlationOf(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
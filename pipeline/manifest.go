@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// manifestEntry is a row of the manifest: a repository of the source and
+// the options replacing the global ones for it.
+type manifestEntry struct {
+	Repository     string
+	Name           string
+	Visibility     string
+	Team           string
+	TeamPermission string   `yaml:"team_permission"`
+	SkipSteps      []string `yaml:"skip_steps"`
+}
+
+// manifestColumns are the columns of a csv manifest, repository being the
+// only required one.
+var manifestColumns = []string{"repository", "name", "visibility", "team", "team_permission", "skip_steps"}
+
+// loadManifest reads the repositories of manifest_file, a csv file with a
+// header or a yaml list, adding the options of the rows to the overrides.
+// The repositories are returned in the order of the manifest, nil without
+// one.
+func loadManifest(cfg *migration) ([]string, error) {
+	if cfg.ManifestFile == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(cfg.ManifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []manifestEntry
+	var label func(i int) string
+	switch strings.ToLower(filepath.Ext(cfg.ManifestFile)) {
+	case ".csv":
+		entries, err = parseCSVManifest(content)
+		// the header is the first line
+		label = func(i int) string { return fmt.Sprintf("line %d", i+2) }
+	case ".yml", ".yaml":
+		err = yaml.UnmarshalStrict(content, &entries)
+		label = func(i int) string { return fmt.Sprintf("entry %d", i+1) }
+	default:
+		return nil, fmt.Errorf("%q must be a .csv, .yml or .yaml file", cfg.ManifestFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s lists no repository", cfg.ManifestFile)
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for i, e := range entries {
+		if e.Repository == "" {
+			return nil, fmt.Errorf("%s: repository is required", label(i))
+		}
+		if seen[e.Repository] {
+			return nil, fmt.Errorf("%s: %s is already listed", label(i), e.Repository)
+		}
+		seen[e.Repository] = true
+
+		o := cfg.overrides[e.Repository]
+		if e.Name != "" {
+			o.Name = e.Name
+		}
+		if e.Visibility != "" {
+			o.Visibility = e.Visibility
+		}
+		if e.Team != "" {
+			o.Team = e.Team
+		}
+		if e.TeamPermission != "" {
+			o.TeamPermission = e.TeamPermission
+		}
+		if len(e.SkipSteps) > 0 {
+			o.SkipSteps = e.SkipSteps
+		}
+		if err := checkOverride(cfg, e.Repository, o); err != nil {
+			return nil, fmt.Errorf("%s: %v", label(i), err)
+		}
+		cfg.overrides[e.Repository] = o
+		names = append(names, e.Repository)
+	}
+	return names, nil
+}
+
+// parseCSVManifest reads the rows of a csv manifest, the steps of
+// skip_steps being separated by spaces or semicolons.
+func parseCSVManifest(content []byte) ([]manifestEntry, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, c := range header {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if !contains(manifestColumns, c) {
+			return nil, fmt.Errorf("line 1: unknown column %q, the columns are %s", c, strings.Join(manifestColumns, ", "))
+		}
+		columns[c] = i
+	}
+	if _, ok := columns["repository"]; !ok {
+		return nil, fmt.Errorf("line 1: the repository column is required")
+	}
+
+	var entries []manifestEntry
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		entries = append(entries, manifestEntry{
+			Repository:     value("repository"),
+			Name:           value("name"),
+			Visibility:     value("visibility"),
+			Team:           value("team"),
+			TeamPermission: value("team_permission"),
+			SkipSteps: strings.FieldsFunc(value("skip_steps"), func(r rune) bool {
+				return r == ' ' || r == ';'
+			}),
+		})
+	}
+	return entries, nil
+}
+
+// manifestRepos gets the repositories of the manifest from the source
+// rather than listing all of them, failing before anything is migrated
+// when some of them or of their teams cannot be found.
+func manifestRepos(cfg *migration) ([]*gh.Repository, error) {
+	var repos []*gh.Repository
+	var missing []string
+	for _, name := range cfg.manifest {
+		repo, err := cfg.Source.Provider.Get(cfg.runContext(), name)
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("%s (%v)", name, err))
+			continue
+		}
+		repos = append(repos, repo)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("manifest_file: some repositories were not found on the source: %s", strings.Join(missing, ", "))
+	}
+
+	if !cfg.overrides.hasTeams() || cfg.Target.Type != "" && cfg.Target.Type != config.TargetGitHub {
+		return repos, nil
+	}
+	if err := cfg.teams.load(cfg); err != nil {
+		return nil, fmt.Errorf("listing the teams of the target: %v", err)
+	}
+	for _, name := range cfg.manifest {
+		slug := cfg.overrides[name].Team
+		if _, ok := cfg.teams.get(slug); slug != "" && !ok {
+			missing = append(missing, fmt.Sprintf("%s (%s)", slug, name))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("manifest_file: some teams do not exist on the target: %s", strings.Join(missing, ", "))
+	}
+	return repos, nil
+}
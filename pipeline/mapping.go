@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	gh "github.com/google/go-github/github"
+)
+
+func mapUser(cfg *migration, login string) string {
+	u, _ := lookupUser(cfg, login)
+	return u
+}
+
+// lookupUser also reports whether the login is in the user_map, login is
+// kept as is otherwise.
+func lookupUser(cfg *migration, login string) (string, bool) {
+	if u, ok := cfg.UserMap[login]; ok {
+		return u, true
+	}
+	return login, false
+}
+
+func mapUsers(cfg *migration, users []*gh.User) []string {
+	var logins []string
+	for _, u := range users {
+		logins = append(logins, mapUser(cfg, u.GetLogin()))
+	}
+	return logins
+}
+
+func mapTeam(cfg *migration, slug string) string {
+	if t, ok := cfg.TeamMap[slug]; ok {
+		return t
+	}
+	return slug
+}
+
+func mapTeams(cfg *migration, teams []*gh.Team) []string {
+	var slugs []string
+	for _, t := range teams {
+		slugs = append(slugs, mapTeam(cfg, t.GetSlug()))
+	}
+	return slugs
+}
@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github"
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+)
+
+// metadataPageSize is the number of repositories of a GraphQL request, the
+// nested counts keeping it below the node limit of the api.
+const metadataPageSize = 50
+
+const metadataQuery = `query($owner: String!, $first: Int!, $after: String) {
+  repositoryOwner(login: $owner) {
+    repositories(first: $first, after: $after, ownerAffiliations: OWNER) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        name diskUsage
+        refs(refPrefix: "refs/heads/", first: 0) { totalCount }
+        issues { totalCount }
+        openIssues: issues(states: OPEN) { totalCount }
+        pullRequests { totalCount }
+        openPullRequests: pullRequests(states: OPEN) { totalCount }
+        branchProtectionRules(first: 0) { totalCount }
+        repositoryTopics(first: 20) { nodes { topic { name } } }
+        gitattributes: object(expression: "HEAD:.gitattributes") { ... on Blob { text } }
+      }
+    }
+  }
+}`
+
+type totalCount struct {
+	TotalCount int `json:"totalCount"`
+}
+
+type repoMetadataNode struct {
+	Name             string     `json:"name"`
+	DiskUsage        int        `json:"diskUsage"`
+	Refs             totalCount `json:"refs"`
+	Issues           totalCount `json:"issues"`
+	OpenIssues       totalCount `json:"openIssues"`
+	PullRequests     totalCount `json:"pullRequests"`
+	OpenPullRequests totalCount `json:"openPullRequests"`
+	Protections      totalCount `json:"branchProtectionRules"`
+	Topics           struct {
+		Nodes []struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics"`
+	Gitattributes *struct {
+		Text string `json:"text"`
+	} `json:"gitattributes"`
+}
+
+func (n *repoMetadataNode) metadata() *report.Metadata {
+	m := &report.Metadata{
+		SizeKB:           n.DiskUsage,
+		Branches:         n.Refs.TotalCount,
+		Issues:           n.Issues.TotalCount,
+		OpenIssues:       n.OpenIssues.TotalCount,
+		PullRequests:     n.PullRequests.TotalCount,
+		OpenPullRequests: n.OpenPullRequests.TotalCount,
+		Protections:      n.Protections.TotalCount,
+		LFS:              n.Gitattributes != nil && strings.Contains(n.Gitattributes.Text, "filter=lfs"),
+	}
+	for _, t := range n.Topics.Nodes {
+		m.Topics = append(m.Topics, t.Topic.Name)
+	}
+	return m
+}
+
+// fetchMetadata reads the metadata of the repositories of the source owner
+// with the GraphQL api, metadataPageSize repositories per request, instead
+// of several REST requests per repository. It is nil for the sources other
+// than GitHub, the metadata of a repository being missing when it cannot be
+// read, e.g. a repository of another owner listed by source.user.
+func fetchMetadata(cfg *migration, repos []*gh.Repository) map[string]*report.Metadata {
+	if cfg.Source.Type != "" && cfg.Source.Type != config.SourceGitHub || len(repos) == 0 {
+		return nil
+	}
+	wanted := map[string]bool{}
+	for _, r := range repos {
+		wanted[*r.Name] = true
+	}
+
+	owner := cfg.Source.Organization
+	if cfg.Source.User != "" {
+		owner = cfg.Source.User
+	}
+	if owner == "" {
+		return nil
+	}
+	vars := map[string]interface{}{"owner": owner, "first": metadataPageSize}
+	metadata := map[string]*report.Metadata{}
+	for requests := 1; ; requests++ {
+		var data struct {
+			RepositoryOwner struct {
+				Repositories struct {
+					PageInfo pageInfo            `json:"pageInfo"`
+					Nodes    []*repoMetadataNode `json:"nodes"`
+				} `json:"repositories"`
+			} `json:"repositoryOwner"`
+		}
+		if err := github.GraphQL(cfg.runContext(), cfg.Source.Instance, metadataQuery, vars, &data); err != nil {
+			log.WithError(err).Warn("the metadata of the repositories could not be read with the graphql api")
+			return nil
+		}
+		page := data.RepositoryOwner.Repositories
+		for _, n := range page.Nodes {
+			if wanted[n.Name] {
+				metadata[n.Name] = n.metadata()
+			}
+		}
+		if !page.PageInfo.HasNextPage || len(metadata) == len(wanted) {
+			log.WithField("repositories", len(metadata)).WithField("requests", requests).Info("the metadata of the repositories was read")
+			return metadata
+		}
+		vars["after"] = page.PageInfo.EndCursor
+	}
+}
@@ -0,0 +1,904 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/gitops"
+	"github.com/leocomelli/ghmgr/metrics"
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+	git "gopkg.in/src-d/go-git.v4"
+)
+
+func findRepositories(cfg *migration) ([]*gh.Repository, error) {
+	repos, err := listRepositories(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("amount", len(repos)).Info("some repositories was found")
+
+	if cfg.Route != "" {
+		repos, err = routeRepos(cfg, repos)
+		if err != nil {
+			return nil, err
+		}
+		log.WithField("route", cfg.Route).WithField("amount", len(repos)).Info("some repositories are routed to the target")
+	}
+
+	if cfg.Source.Limit > 0 && len(repos) > cfg.Source.Limit {
+		repos = repos[:cfg.Source.Limit]
+		log.WithField("limit", cfg.Source.Limit).Info("only the first repositories will be processed")
+	}
+
+	if err := checkTargetNames(cfg, repos); err != nil {
+		return nil, err
+	}
+	log.WithField("names", cfg.Source.Ignore).Info("ignoring some repositories")
+	log.WithField("patterns", cfg.Source.Include).Info("including the repositories matching")
+	log.WithField("patterns", cfg.Source.Exclude).Info("excluding the repositories matching")
+	log.WithField("names", cfg.Source.Only).Info("only this repositories")
+
+	return repos, nil
+}
+
+func runMigrate(cfg *migration, repos []*gh.Repository) error {
+	if cfg.Migrate.CommunityFiles {
+		repos = withoutCommunityRepo(cfg, repos)
+	}
+	if cfg.Migrate.Forks {
+		parents, err := forkParents(cfg, repos)
+		if err != nil {
+			return fmt.Errorf("listing the parents of the forks: %v", err)
+		}
+		cfg.forks = parents
+		repos = orderByForks(repos, parents)
+	}
+
+	if cfg.DryRun {
+		return runPlan(cfg, repos)
+	}
+
+	concurrency := cfg.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	if cfg.Report.Path != "" {
+		cfg.Results = report.New()
+		cfg.Results.Redact = cfg.redactor.redact
+	}
+	if (cfg.Results != nil || cfg.Preflight.Enabled) && cfg.metadata == nil {
+		cfg.metadata = fetchMetadata(cfg, repos)
+	}
+
+	if cfg.Preflight.Enabled {
+		if err := checkConflicts(cfg, repos); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Migrate.RewriteReferences {
+		cfg.references = newReferenceIndex(repos)
+	}
+
+	if cfg.Migrate.Teams && cfg.Source.User != "" {
+		log.WithField("user", cfg.Source.User).Warn("a user account has no teams, skipping the teams")
+		cfg.Migrate.Teams = false
+	}
+
+	if cfg.Migrate.Teams {
+		if err := migrateTeams(cfg); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Migrate.OrgSettings {
+		if err := migrateOrgSettings(cfg); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Migrate.CommunityFiles {
+		if err := migrateCommunityFiles(cfg); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Migrate.CustomProperties && cfg.Source.User != "" {
+		log.WithField("user", cfg.Source.User).Warn("a user account has no custom properties, skipping them")
+		cfg.Migrate.CustomProperties = false
+	}
+
+	if cfg.Migrate.CustomProperties {
+		if err := migratePropertySchema(cfg); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Migrate.Secrets {
+		secrets, err := loadSecrets(cfg.Migrate.SecretsFile)
+		if err != nil {
+			return fmt.Errorf("migrate.secrets_file: %v", err)
+		}
+		cfg.secrets = secrets
+	}
+
+	if cfg.Migrate.Attribution == config.AttributionPlaceholder {
+		clients, err := loadAttribution(cfg)
+		if err != nil {
+			return fmt.Errorf("migrate.attribution_tokens: %v", err)
+		}
+		cfg.attribution = clients
+	}
+
+	if f := cfg.Git.Filter; f.Mailmap != "" || len(f.EmailDomains) > 0 {
+		m, err := gitops.LoadMailmap(f.Mailmap, f.EmailDomains)
+		if err != nil {
+			return fmt.Errorf("git.filter.mailmap: %v", err)
+		}
+		cfg.mailmap = m
+	}
+
+	if cfg.Migrate.Workflows {
+		rules, err := loadWorkflowRules(cfg)
+		if err != nil {
+			return fmt.Errorf("migrate.workflow_rules: %v", err)
+		}
+		cfg.workflowRules = rules
+	}
+
+	if cfg.Migrate.Submodules {
+		var err error
+		repos, err = orderBySubmodules(cfg, repos)
+		if err != nil {
+			return fmt.Errorf("ordering the repositories by submodules: %v", err)
+		}
+	}
+
+	waves, err := planWaves(cfg, repos)
+	if err != nil {
+		return fmt.Errorf("planning the waves: %v", err)
+	}
+	if err := checkWaveConfirm(cfg, waves); err != nil {
+		return err
+	}
+	repos = flattenWaves(waves)
+
+	log.WithField("workers", concurrency).Info("starting the migration")
+
+	var names []string
+	for _, repo := range repos {
+		names = append(names, *repo.Name)
+	}
+	cfg.Progress = newProgress(names)
+	cfg.Progress.events = cfg.events
+	cfg.Progress.Run(cfg.ProgressInterval)
+	if cfg.watchProgress != nil {
+		cfg.watchProgress(cfg.Progress)
+	}
+
+	started := time.Now()
+	notify(cfg, Event{
+		Event:   config.EventStart,
+		Message: fmt.Sprintf("migrating %d repositories from %s to %s", len(repos), cfg.Source.Organization, cfg.Target.Organization),
+		Total:   len(repos),
+	})
+
+	var mu sync.Mutex
+	summary := Event{Event: config.EventSummary, Total: len(repos)}
+
+	process := func(i int) error {
+		repo := repos[i]
+		id, err := randomID()
+		if err != nil {
+			return err
+		}
+		rc := cfg.withCorrelation(id)
+		l := log.WithField("repo", *repo.Name).WithField("correlation_id", id)
+		l.WithField("index", fmt.Sprintf("%d/%d", i+1, len(repos))).Info("processing a repository")
+
+		cfg.Results.Start(*repo.Name)
+		cfg.Results.SetCorrelationID(*repo.Name, id)
+		cfg.Results.SetMetadata(*repo.Name, cfg.metadata[*repo.Name])
+		cfg.Progress.Start(*repo.Name, id)
+		err = preRepoHook(rc, repo, l)
+		if err == nil {
+			err = watchRepo(rc, repo, l)
+		}
+		postRepoHook(rc, repo, err, l)
+		if err == errRepoSkipped {
+			cfg.Results.Skip(*repo.Name)
+		} else {
+			cfg.Results.Finish(*repo.Name, err)
+		}
+		cfg.Progress.Finish(*repo.Name, err)
+		storeFile(cfg, stateKey, cfg.StateFile)
+		metrics.Repos.Add(1, repoStatus(err))
+
+		if err != nil && err != errRepoSkipped {
+			notify(cfg, Event{
+				Event:   config.EventFailure,
+				Message: fmt.Sprintf("the migration of %s failed: %v", *repo.Name, err),
+				Repo:    *repo.Name,
+				Error:   err.Error(),
+				Total:   len(repos),
+			})
+		}
+		switch {
+		case err == errRepoSkipped:
+			l.Warn(err)
+		case err != nil:
+			l.Error(err)
+		default:
+			l.Info("done")
+		}
+		return err
+	}
+
+	var retries *retryQueue
+	if cfg.serve != "" {
+		retries = newRetryQueue(cfg, repos, process)
+		serveDashboard(cfg, cfg.serve, retries.add)
+	}
+
+	// the workers go through the repositories of a wave, the next one
+	// starting once the wave is over
+	first := 0
+	for w, wv := range waves {
+		last := first + len(wv.repos)
+		if w > 0 {
+			checkpointWave(cfg, waves[w-1])
+			if cfg.stopping() || !confirmWave(cfg, waves[w-1], wv, summary) {
+				log.WithField("wave", wv.name).Warn("the migration was stopped before the wave")
+				summary.Interrupted += len(repos) - first
+				break
+			}
+		}
+		if len(waves) > 1 {
+			log.WithField("wave", wv.name).WithField("index", fmt.Sprintf("%d/%d", w+1, len(waves))).
+				WithField("repositories", len(wv.repos)).Info("starting the wave")
+		}
+
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for n := 0; n < concurrency; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					if cfg.stopping() {
+						mu.Lock()
+						summary.Interrupted++
+						mu.Unlock()
+						continue
+					}
+					err := process(i)
+
+					mu.Lock()
+					switch {
+					case err == errRepoSkipped:
+						summary.Skipped++
+					case err != nil:
+						summary.Failed++
+					default:
+						summary.Succeeded++
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+
+		for i := first; i < last; i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		first = last
+	}
+	cfg.Progress.Stop()
+
+	summary.Duration = time.Since(started).Round(time.Second).String()
+	summary.Message = fmt.Sprintf("the migration from %s to %s finished in %s: %d succeeded, %d failed, %d skipped",
+		cfg.Source.Organization, cfg.Target.Organization, summary.Duration, summary.Succeeded, summary.Failed, summary.Skipped)
+	if summary.Interrupted > 0 {
+		summary.Message += fmt.Sprintf(", %d not processed", summary.Interrupted)
+	}
+	notify(cfg, summary)
+	log.WithField("succeeded", summary.Succeeded).WithField("failed", summary.Failed).WithField("skipped", summary.Skipped).
+		WithField("interrupted", summary.Interrupted).Info(summary.Message)
+
+	if err := writeReport(cfg); err != nil {
+		return err
+	}
+
+	// the failed repositories can still be retried from the dashboard
+	if retries != nil && summary.Interrupted == 0 {
+		log.WithField("addr", cfg.serve).Info("the migration finished, serving the dashboard until interrupted")
+		retries.wait()
+		if err := writeReport(cfg); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.abort.Err(); err != nil {
+		return err
+	}
+	if summary.Interrupted > 0 {
+		return fmt.Errorf("interrupted, %d repositories were not processed", summary.Interrupted)
+	}
+	if n := migrateFailures(cfg); n > 0 {
+		return partialError(n, len(repos), "%d of %d repositories failed", n, len(repos))
+	}
+	return nil
+}
+
+// writeReport writes the report, when enabled, and stores it along with
+// the state file.
+func writeReport(cfg *migration) error {
+	if cfg.Results != nil {
+		if err := cfg.Results.Write(cfg.Report.Path, cfg.Report.Format); err != nil {
+			return err
+		}
+		log.WithField("file", cfg.Report.Path).Info("the report was written")
+		storeFile(cfg, reportKey, cfg.Report.Path)
+	}
+	storeFile(cfg, stateKey, cfg.StateFile)
+	return nil
+}
+
+func migrateRepo(cfg *migration, repo *gh.Repository, l *log.Entry) error {
+	name := *repo.Name
+
+	var r *gh.Repository
+	var err error
+
+	// the refs of the source tell an empty or broken repository before
+	// anything is created
+	native := cfg.Git.TransferMode == config.TransferModeNative
+	empty, branch := false, ""
+	if !native && !cfg.State.Done(name, stepPush) {
+		check, err := inspectSource(cfg, repo, l)
+		if err != nil {
+			return err
+		}
+		cfg.Results.SetSourceState(name, check.State)
+		empty, branch = check.empty(), check.Branch
+	}
+
+	initialized := false
+	if cfg.State.Done(name, stepCreate) {
+		l.Info("the repository was already created, skipping")
+		r, err = existingRepo(cfg, targetName(cfg, name))
+		if err == nil && r == nil {
+			err = fmt.Errorf("the repository %s was created by a previous run but is missing on the target", targetName(cfg, name))
+		}
+	} else if native {
+		cfg.Progress.Step(name, "transferring")
+		sc, cancel := cfg.withTimeout(cfg.Timeouts.Step)
+		r, err = transferRepo(sc, repo, l)
+		err = timedOut(sc.runContext(), "the transfer", cfg.Timeouts.Step, err)
+		cancel()
+	} else {
+		if cfg.Preflight.Enabled {
+			cfg.Progress.Step(name, "preflight")
+			if err := preflightStep(cfg, repo); err != nil {
+				return err
+			}
+		}
+		cfg.Progress.Step(name, "creating")
+		sc, cancel := cfg.withTimeout(cfg.Timeouts.Step)
+		r, initialized, err = createRepo(sc, repo, empty, l)
+		err = timedOut(sc.runContext(), "the creation", cfg.Timeouts.Step, err)
+		cancel()
+	}
+	if err == errRepoSkipped {
+		return err
+	}
+	if err != nil {
+		return &stepError{stepCreate, err}
+	}
+	if initialized {
+		if err := cfg.State.Complete(name, stepInitialized); err != nil {
+			return err
+		}
+		cfg.Results.Step(name, stepInitialized)
+	}
+	if native {
+		if err := cfg.State.Complete(name, stepTransferred); err != nil {
+			return err
+		}
+		cfg.Results.Step(name, stepTransferred)
+	}
+	if err := cfg.State.Complete(name, stepCreate); err != nil {
+		return err
+	}
+	cfg.Results.Step(name, stepCreate)
+	cfg.Results.SetTargetURL(name, r.GetHTMLURL())
+	if parent := cfg.forks[name]; parent != "" {
+		cfg.Results.SetForkOf(name, cfg.Target.Organization+"/"+targetName(cfg, parent))
+	}
+	for _, s := range orderedSteps(cfg, name) {
+		if s.name == stepOwnerTeam {
+			if err := runStep(cfg, name, s.name, l, func() error { return s.run(cfg, repo, r, l) }); err != nil && err != errStepFailed {
+				return err
+			}
+		}
+	}
+
+	var g *git.Repository
+	if empty {
+		l.Info("the source is empty, nothing to push")
+	} else if !native && !cfg.State.Done(name, stepPush) {
+		if cfg.Git.TransferMode == config.TransferModeImport {
+			cfg.Progress.Step(name, "importing")
+			err = importRepo(cfg, repo, r, l)
+		} else {
+			cfg.Progress.Step(name, "cloning")
+			g, err = cloneAndPush(cfg, repo, repoURL(cfg, r), branch, l)
+		}
+		if err == nil {
+			err = alignDefaultBranch(cfg, repo, r, l)
+		}
+		if err != nil {
+			return &stepError{stepPush, err}
+		}
+		if err := cfg.State.Complete(name, stepPush); err != nil {
+			return err
+		}
+	}
+	if !empty && !native {
+		cfg.Results.Step(name, stepPush)
+	}
+
+	// the importer transfers the lfs objects itself
+	if !empty && !native && !cfg.State.Done(name, stepLFS) && cfg.Git.TransferMode != config.TransferModeImport {
+		cfg.Progress.Step(name, stepLFS)
+		if err := migrateLFS(cfg, g, repo, r, l); err != nil {
+			return &stepError{stepLFS, err}
+		}
+		if err := cfg.State.Complete(name, stepLFS); err != nil {
+			return err
+		}
+	}
+	if g != nil {
+		storeClone(cfg, clonePath(cfg, name), l)
+	}
+	cleanupClone(cfg, name, l)
+
+	// the source is only locked down and archived once the target passed the verification
+	steps := orderedSteps(cfg, name)
+	verified := true
+	for _, s := range steps {
+		verified = verified && s.name != stepVerify
+	}
+	for _, s := range steps {
+		s := s
+		if s.name == stepOwnerTeam {
+			continue
+		}
+		if (s.name == stepLockdown || s.name == stepTombstone || s.name == stepArchive) && !verified {
+			err := fmt.Errorf("the target was not verified, the source is not %s", strings.Replace(s.name, "_", " ", -1))
+			l.WithField("step", s.name).Warn(err)
+			cfg.Results.Fail(name, s.name, err)
+			cfg.Progress.Fail(name, s.name, err)
+			continue
+		}
+		sc, cancel := cfg.withTimeout(cfg.Timeouts.Step)
+		err := runStep(cfg, name, s.name, l, func() error {
+			return timedOut(sc.runContext(), "the step", cfg.Timeouts.Step, s.run(sc, repo, r, l))
+		})
+		cancel()
+		if s.name == stepVerify {
+			verified = err == nil
+		}
+		if err != nil && err != errStepFailed {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runStep executes an optional step unless the state file says it was
+// already completed, logging its error. The error is returned as a
+// stepError when the failure_policy of the step, continue by default, stops
+// the repository; otherwise the next steps run and the returned error only
+// tells the step was not completed.
+func runStep(cfg *migration, repo, step string, l *log.Entry, fn func() error) error {
+	if cfg.State.Done(repo, step) {
+		l.WithField("step", step).Info("step already completed, skipping")
+		cfg.Results.Step(repo, step)
+		cfg.Progress.Skip(repo, step)
+		return nil
+	}
+
+	cfg.Progress.Step(repo, step)
+	if err := fn(); err != nil {
+		l.WithField("step", step).Error(err)
+		cfg.Results.Fail(repo, step, err)
+		cfg.Progress.Fail(repo, step, err)
+		if failurePolicy(cfg, step, config.FailureContinue) != config.FailureContinue {
+			return &stepError{step, fmt.Errorf("the %s step failed, the next steps are not run: %v", step, err)}
+		}
+		return errStepFailed
+	}
+
+	cfg.Results.Step(repo, step)
+	if err := cfg.State.Complete(repo, step); err != nil {
+		l.Error(err)
+	}
+	return nil
+}
+
+// planClone prints the creation, clone and push of the repository.
+func planClone(cfg *migration, repo *gh.Repository, l *log.Entry) {
+	l.WithField("organization", cfg.Target.Organization).WithField("target", targetName(cfg, *repo.Name)).
+		WithField("private", repoOptions(cfg, repo).GetPrivate()).WithField("visibility", repoVisibility(cfg, repo)).
+		Info("[plan] a new repository would be created")
+	if parent := cfg.forks[*repo.Name]; parent != "" {
+		l.WithField("parent", targetName(cfg, parent)).Info("[plan] the repository would be created as a fork of the target of its parent")
+	}
+	if check, err := inspectSource(cfg, repo, l); err != nil {
+		l.WithError(err).Error("[plan] the refs of the source could not be listed")
+	} else {
+		planSource(cfg, check, l)
+	}
+	l.WithField("url", repoURL(cfg, repo)).WithField("path", clonePath(cfg, *repo.Name)).
+		Info("[plan] the repository would be cloned")
+	if cfg.Git.Mirror && cfg.refs != nil {
+		planRefs(cfg, repo, l)
+	}
+	l.WithField("remote", cfg.Git.RemoteName).Info("[plan] the repository would be pushed to the new remote")
+}
+
+// planRefs logs the refs selected by git.refspecs, git.branches and
+// git.tags.
+func planRefs(cfg *migration, repo *gh.Repository, l *log.Entry) {
+	auth, err := gitAuth(cfg, cfg.Source.Tokens, cfg.Source.Username, l)
+	if err != nil {
+		l.WithError(err).Error("[plan] the refs of the source could not be listed")
+		return
+	}
+	refs, err := cfg.refs.Remote(repoURL(cfg, repo), auth)
+	if err != nil {
+		l.WithError(err).Error("[plan] the refs of the source could not be listed")
+		return
+	}
+	l.WithField("refs", len(refs)).Info("[plan] only the selected refs would be transferred")
+}
+
+func printPlan(cfg *migration, repos []*gh.Repository) {
+	log.Warn("dry-run mode, no write operation will be performed")
+	if cfg.metadata == nil {
+		cfg.metadata = fetchMetadata(cfg, repos)
+	}
+	if cfg.Preflight.Enabled {
+		planConflicts(cfg, repos)
+	}
+	planDestructive(cfg, repos)
+
+	if len(cfg.Steps) > 0 {
+		var names []string
+		for _, s := range orderedSteps(cfg, "") {
+			names = append(names, s.name)
+		}
+		log.WithField("steps", strings.Join(names, ",")).Info("[plan] the steps would run in this order")
+	}
+	if cfg.Hooks.PreRepo != "" {
+		log.WithField("command", cfg.Hooks.PreRepo).Info("[plan] the pre_repo hook would run before each repository")
+	}
+	if cfg.Hooks.PostRepo != "" {
+		log.WithField("command", cfg.Hooks.PostRepo).Info("[plan] the post_repo hook would run after each repository")
+	}
+
+	if cfg.Migrate.OrgSettings {
+		log.WithField("organization", cfg.Target.Organization).Info("[plan] the organization settings and webhooks would be copied")
+	}
+	if cfg.Migrate.CommunityFiles {
+		log.WithField("organization", cfg.Target.Organization).Info("[plan] the community health files of the .github repository would be merged")
+	}
+	if cfg.Migrate.CustomProperties {
+		log.WithField("organization", cfg.Target.Organization).Info("[plan] the missing custom property definitions would be copied")
+	}
+
+	for i, repo := range repos {
+		l := log.WithField("name", *repo.Name).WithField("index", fmt.Sprintf("%d/%d", i+1, len(repos)))
+
+		if m := cfg.metadata[*repo.Name]; m != nil {
+			l.WithField("size_kb", m.SizeKB).WithField("branches", m.Branches).WithField("issues", m.Issues).
+				WithField("pull_requests", m.PullRequests).WithField("protections", m.Protections).WithField("lfs", m.LFS).
+				WithField("topics", m.Topics).Info("[plan] the source repository")
+		}
+
+		if cfg.Git.TransferMode == config.TransferModeNative {
+			l.WithField("organization", cfg.Target.Organization).WithField("target", targetName(cfg, *repo.Name)).
+				Info("[plan] the repository would be transferred")
+		} else {
+			planClone(cfg, repo, l)
+		}
+
+		if cfg.Preflight.Enabled {
+			planPreflight(cfg, repo, l)
+		}
+
+		if cfg.Migrate.Security {
+			l.Info("[plan] the security features, the dependabot configuration and the code scanning workflows would be copied")
+		}
+
+		if cfg.Verify {
+			l.Info("[plan] the target refs would be verified")
+		}
+
+		if cfg.Migrate.SignedTags {
+			l.Info("[plan] the signed tags would be checked on the target")
+		}
+
+		if cfg.Migrate.Workflows {
+			l.Info("[plan] the workflows would be rewritten")
+		}
+
+		if cfg.Migrate.Submodules {
+			l.Info("[plan] the submodule urls would be rewritten")
+		}
+
+		if cfg.Migrate.Codeowners {
+			planCodeowners(cfg, repo, l)
+		}
+
+		if cfg.Migrate.Wikis && repo.GetHasWiki() {
+			l.Info("[plan] the wiki would be migrated")
+		}
+
+		if cfg.Migrate.Pages && repo.GetHasPages() {
+			l.WithField("redirect", cfg.Migrate.PagesRedirect).Info("[plan] the pages would be enabled")
+		}
+
+		if cfg.Migrate.Releases {
+			l.Info("[plan] the releases and their assets would be migrated")
+		}
+
+		if cfg.Migrate.Teams {
+			l.Info("[plan] the team permissions would be migrated")
+		}
+
+		if slug, permission := ownerTeam(cfg, repo); slug != "" {
+			l.WithField("team", slug).WithField("permission", permission).Info("[plan] the owner team would be granted its permission once created")
+		}
+
+		if cfg.Migrate.Collaborators {
+			l.Info("[plan] the collaborators would be migrated")
+		}
+
+		if cfg.Migrate.Protections {
+			l.Info("[plan] the branch protections would be migrated")
+		}
+
+		if cfg.Migrate.Rulesets {
+			l.Info("[plan] the rulesets would be migrated")
+		}
+
+		if cfg.Migrate.TagProtections {
+			l.Info("[plan] the tag protections would be migrated")
+		}
+
+		if cfg.Migrate.Webhooks {
+			l.Info("[plan] the webhooks would be migrated")
+		}
+
+		if cfg.Migrate.DeployKeys {
+			l.Info("[plan] the deploy keys would be migrated")
+		}
+
+		if cfg.Migrate.Autolinks {
+			l.Info("[plan] the autolinks would be migrated")
+		}
+
+		if cfg.Migrate.CustomProperties {
+			l.Info("[plan] the custom properties would be migrated")
+		}
+
+		if cfg.Migrate.Environments {
+			l.Info("[plan] the environments would be migrated")
+		}
+
+		if cfg.Migrate.Secrets {
+			l.Info("[plan] the secrets would be created")
+		}
+
+		if cfg.Migrate.Labels {
+			l.Info("[plan] the labels and milestones would be migrated")
+		}
+
+		if cfg.Migrate.Issues {
+			l.WithField("open", repo.GetOpenIssuesCount()).Info("[plan] the issues would be migrated")
+		}
+
+		if cfg.Migrate.PullRequests != "" {
+			l.WithField("mode", cfg.Migrate.PullRequests).Info("[plan] the pull requests would be migrated")
+		}
+
+		if cfg.Migrate.PreserveNumbers {
+			l.Info("[plan] the issues and the pull requests would keep their numbers, the gaps being filled with placeholders")
+		}
+
+		if s := cfg.Migrate.Scrub; s.Enabled() {
+			l.WithField("emails", s.Emails).WithField("hostnames", len(s.Hostnames)).WithField("patterns", len(s.Patterns)).
+				Info("[plan] the titles and bodies would be scrubbed")
+		}
+
+		if cfg.Migrate.Watchers {
+			l.WithField("stargazers", repo.GetStargazersCount()).WithField("issue", cfg.Migrate.WatchersIssue).
+				Info("[plan] the stargazers and watchers would be reported")
+		}
+
+		for _, rule := range cfg.Source.Content.AllRules() {
+			l.WithField("filename", rule.Path).WithField("mode", rule.Mode).Info("[plan] the content would be updated")
+		}
+
+		for _, s := range orderedSteps(cfg, *repo.Name) {
+			if _, ok := cfg.Hooks.Steps[s.name]; ok {
+				l.WithField("step", s.name).Info("[plan] the hook step would run")
+			}
+		}
+
+		if lockdown := cfg.Source.Lockdown; lockdown.Enabled() {
+			l.WithField("permissions", lockdown.Permissions).WithField("description", lockdown.Description != "").
+				WithField("issue", lockdown.Issue.Title != "").Info("[plan] the source repository would be locked down")
+		}
+
+		if tombstone := cfg.Source.Tombstone; tombstone.Enabled() {
+			l.WithField("mode", tombstone.Mode).Info("[plan] the source repository would get the tombstone")
+		}
+
+		if cfg.Source.Archive {
+			l.Info("[plan] the source repository would be archived")
+		}
+	}
+
+	log.WithField("amount", len(repos)).Info("[plan] done, no changes were made")
+}
+
+func contains(sl []string, v string) bool {
+	for _, vv := range sl {
+		if vv == v {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSourceOwner uses the authenticated user as the source when neither
+// source.organization nor source.user is given. The owner of the repositories
+// is kept in source.organization, which is what every API call uses.
+func resolveSourceOwner(cfg *migration) error {
+	if cfg.Source.Organization != "" || (cfg.Source.Type != "" && cfg.Source.Type != config.SourceGitHub) {
+		return nil
+	}
+
+	if cfg.Source.User == "" {
+		u, _, err := cfg.Source.Instance.Users.Get(cfg.runContext(), "")
+		if err != nil {
+			return fmt.Errorf("authenticated user: %v", err)
+		}
+		cfg.Source.User = u.GetLogin()
+	}
+	cfg.Source.Organization = cfg.Source.User
+
+	log.WithField("user", cfg.Source.User).Info("migrating the repositories owned by a user")
+	return nil
+}
+
+func listRepositories(cfg *migration) ([]*gh.Repository, error) {
+	var candidates []*gh.Repository
+	var err error
+	if cfg.manifest != nil {
+		candidates, err = manifestRepos(cfg)
+	} else {
+		candidates, err = cfg.Source.Provider.List(cfg.runContext())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var allRepos []*gh.Repository
+	for _, r := range candidates {
+		ok, err := selectRepo(cfg, *r.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ok, err = matchAttributes(cfg, r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ok {
+			allRepos = append(allRepos, r)
+		}
+	}
+
+	return allRepos, nil
+}
+
+// createRepo also reports whether the target of an empty source was
+// initialized by target.init.
+func createRepo(cfg *migration, repo *gh.Repository, empty bool, l *log.Entry) (*gh.Repository, bool, error) {
+	// the listing does not include the merge settings
+	source, err := cfg.Source.Provider.Get(cfg.runContext(), *repo.Name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing, err := existingRepo(cfg, targetName(cfg, *repo.Name))
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		existing, err = handleExisting(cfg, existing, l)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing != nil {
+			// a rollback never deletes a repository that was not created by the migration
+			cfg.Results.Step(*repo.Name, stepReused)
+			return existing, false, cfg.State.Complete(*repo.Name, stepReused)
+		}
+	}
+
+	if empty && cfg.Target.Init.Enabled() {
+		r, err := initRepo(cfg, source, l)
+		return r, err == nil, err
+	}
+
+	if parent := cfg.forks[*repo.Name]; parent != "" {
+		r, err := createFork(cfg, source, parent, l)
+		if err == nil {
+			return r, false, nil
+		}
+		l.WithField("parent", targetName(cfg, parent)).WithError(err).Warn("the fork could not be created, creating an independent repository")
+	}
+
+	r, err := cfg.Target.Provider.Create(cfg.runContext(), source, repoOptions(cfg, source), repoVisibility(cfg, source))
+	if err != nil {
+		return nil, false, err
+	}
+
+	l.WithField("url", r.GetURL()).Info("a new repository was created successfully")
+
+	return r, false, nil
+}
+
+func archiveRepo(cfg *migration, repo *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	source := cfg.Source
+
+	opts := &gh.Repository{
+		Archived: gh.Bool(true),
+	}
+
+	l.WithField("name", *repo.Name).Info("archiving the repository...")
+
+	_, _, err := source.Instance.Repositories.Edit(ctx, source.Organization, *repo.Name, opts)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// repoStatus is the status label of a finished repository.
+func repoStatus(err error) string {
+	switch {
+	case err == errRepoSkipped:
+		return report.StatusSkipped
+	case err != nil:
+		return report.StatusFailed
+	}
+	return "migrated"
+}
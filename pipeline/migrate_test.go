@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	cfg.Git.Mirror = true
+
+	execute(t, cfg, Options{Command: "migrate"})
+
+	if got, want := f.target.Repos(targetOrg), []string{"api", "web"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("target repositories = %v, want %v", got, want)
+	}
+	for _, name := range []string{"api", "web"} {
+		want := f.git.Refs(sourceOrg, name)
+		if want["refs/heads/main"] == "" {
+			t.Fatalf("%s: the fixture has no main branch", name)
+		}
+		if got := f.git.Refs(targetOrg, name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: target refs = %v, want %v", name, got, want)
+		}
+	}
+
+	api := f.target.Repo(targetOrg, "api")
+	topics := append([]string{}, api.Topics...)
+	sort.Strings(topics)
+	if want := []string{"api", "go"}; !reflect.DeepEqual(topics, want) {
+		t.Errorf("api: topics = %v, want %v", topics, want)
+	}
+	if got := api.Fields["has_wiki"]; got != false {
+		t.Errorf("api: has_wiki = %v, want false", got)
+	}
+	if got := f.target.Repo(targetOrg, "web").Fields["private"]; got != true {
+		t.Errorf("web: private = %v, want true", got)
+	}
+}
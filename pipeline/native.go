@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// the transfer api answers before the repository is moved
+	transferAttempts = 20
+	transferDelay    = 3 * time.Second
+)
+
+type transferRequest struct {
+	NewOwner string `json:"new_owner"`
+	NewName  string `json:"new_name"`
+}
+
+// transferRepo moves the source repository to the target organization with
+// the transfer api of the instance, its issues, pull requests, wiki, stars
+// and watchers along with it; nothing is cloned.
+func transferRepo(cfg *migration, repo *gh.Repository, l *log.Entry) (*gh.Repository, error) {
+	name := targetName(cfg, *repo.Name)
+
+	existing, err := existingRepo(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	// on_exists push is rejected, there is nothing to reuse
+	if existing != nil {
+		if _, err := handleExisting(cfg, existing, l); err != nil {
+			return nil, err
+		}
+	}
+
+	l.WithField("organization", cfg.Target.Organization).WithField("name", name).Info("transferring the repository...")
+	req := &transferRequest{NewOwner: cfg.Target.Organization, NewName: name}
+	URL := fmt.Sprintf("repos/%s/%s/transfer", cfg.Source.Organization, *repo.Name)
+	if _, err := github.Request(cfg.runContext(), cfg.Source.Instance, "POST", URL, "", req, nil); err != nil {
+		return nil, fmt.Errorf("transfer: %v", err)
+	}
+
+	for i := 0; ; i++ {
+		r, err := existingRepo(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			l.WithField("url", r.GetURL()).Info("the repository was transferred successfully")
+			return r, nil
+		}
+		if i == transferAttempts {
+			return nil, fmt.Errorf("the repository %s/%s does not exist yet after the transfer", cfg.Target.Organization, name)
+		}
+		time.Sleep(transferDelay)
+	}
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// runNotice runs the content, lockdown, tombstone and archive steps alone
+// on the repositories already migrated, nothing being cloned, e.g. to add
+// the deprecation notices after the cutover. notice preview only prints the
+// changes of the content.
+func runNotice(cfg *migration, repos []*gh.Repository) error {
+	switch cfg.subcommand {
+	case "":
+	case "preview":
+		return runPreview(cfg, repos)
+	default:
+		return fmt.Errorf("unknown notice subcommand %q, must be preview", cfg.subcommand)
+	}
+
+	if !cfg.Source.Content.Enabled() && !cfg.Source.Lockdown.Enabled() && !cfg.Source.Tombstone.Enabled() && !cfg.Source.Archive {
+		return errors.New("the notice command requires source.content, source.lockdown, source.tombstone or source.archive")
+	}
+
+	failed := 0
+	for _, repo := range repos {
+		if cfg.stopping() {
+			break
+		}
+		name := *repo.Name
+		l := log.WithField("repo", name)
+
+		// with a state file, only the repositories migrated and verified are updated
+		if cfg.State != nil && (!cfg.State.Done(name, stepPush) || cfg.Verify && !cfg.State.Done(name, stepVerify)) {
+			l.Warn("the repository was not migrated and verified, not updating the source")
+			continue
+		}
+
+		target, err := existingRepo(cfg, targetName(cfg, name))
+		if err == nil && target == nil {
+			err = fmt.Errorf("the repository %s is missing on the target", targetName(cfg, name))
+		}
+		if err != nil {
+			l.Error(err)
+			failed++
+			continue
+		}
+
+		repoFailed := false
+		for _, s := range orderedSteps(cfg, name) {
+			s := s
+			if s.name != stepContent && s.name != stepLockdown && s.name != stepTombstone && s.name != stepArchive {
+				continue
+			}
+			if cfg.DryRun {
+				l.WithField("step", s.name).Info("[plan] the step would run on the source repository")
+				continue
+			}
+			err := runStep(cfg, name, s.name, l, func() error { return s.run(cfg, repo, target, l) })
+			if err == nil {
+				continue
+			}
+			abortOn(cfg, name, err)
+			repoFailed = true
+			// unlike the migration, the next steps of the source only run
+			// when the failure_policy of the step says continue
+			if err != errStepFailed || cfg.FailurePolicy[s.name] != config.FailureContinue {
+				break
+			}
+		}
+		if repoFailed {
+			failed++
+		}
+	}
+
+	if err := cfg.abort.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return partialError(failed, len(repos), "%d of %d repositories failed", failed, len(repos))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// Event is the data available to the templates.
+type Event struct {
+	Event       string `json:"event"`
+	Message     string `json:"message"`
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	Repo        string `json:"repo,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Total       int    `json:"total"`
+	Succeeded   int    `json:"succeeded"`
+	Failed      int    `json:"failed"`
+	Skipped     int    `json:"skipped"`
+	Interrupted int    `json:"interrupted,omitempty"`
+	Duration    string `json:"duration,omitempty"`
+}
+
+// notification sends the events to one of the notifications of the
+// configuration.
+type notification config.Notification
+
+func (n notification) wants(event string) bool {
+	return len(n.Events) == 0 || contains(n.Events, event)
+}
+
+func (n notification) payload(e Event) ([]byte, error) {
+	if n.Template != "" {
+		t, err := template.New(n.Type).Parse(n.Template)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		err = t.Execute(&b, e)
+		return b.Bytes(), err
+	}
+
+	switch n.Type {
+	case config.NotifySlack:
+		return json.Marshal(map[string]string{"text": e.Message})
+	case config.NotifyTeams:
+		return json.Marshal(map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  e.Message,
+			"text":     e.Message,
+		})
+	}
+	return json.Marshal(e)
+}
+
+func (n notification) send(e Event) error {
+	body, err := n.payload(e)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// notify sends an event to every notification subscribed to it, a failed
+// notification is only logged.
+func notify(cfg *migration, e Event) {
+	e.Source, e.Target = cfg.Source.Organization, cfg.Target.Organization
+	e.Message, e.Error = cfg.redactor.redact(e.Message), cfg.redactor.redact(e.Error)
+	for _, c := range cfg.Notifications {
+		n := notification(c)
+		if !n.wants(e.Event) {
+			continue
+		}
+		if err := n.send(e); err != nil {
+			log.WithField("type", n.Type).WithField("event", e.Event).WithError(err).Warn("the notification could not be sent")
+		}
+	}
+}
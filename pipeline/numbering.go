@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// placeholderLabel marks the issues created for the numbers of the source
+// that have nothing to migrate.
+const placeholderLabel = "placeholder"
+
+// nextNumber is the number the next issue or pull request created on the
+// target gets, both sharing the numbering.
+func nextNumber(cfg *migration, target *gh.Repository) (int, error) {
+	opts := &gh.IssueListByRepoOptions{
+		State:       "all",
+		Sort:        "created",
+		Direction:   "desc",
+		ListOptions: gh.ListOptions{PerPage: 1},
+	}
+	ii, _, err := cfg.Target.Instance.Issues.ListByRepo(cfg.runContext(), cfg.Target.Organization, *target.Name, opts)
+	if err != nil {
+		return 0, err
+	}
+	if len(ii) == 0 {
+		return 1, nil
+	}
+	return ii[0].GetNumber() + 1, nil
+}
+
+// migrateNumbered creates the issues and the pull requests in the order of
+// their numbers, so each one keeps its number on the target. The numbers
+// of the deleted or transferred issues, of the discussions and of the pull
+// requests left out get a closed placeholder issue. The items below the
+// next number of the target were created by a previous run, only their
+// missing comments are posted.
+func migrateNumbered(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	issues, err := listIssues(cfg, source)
+	if err != nil {
+		return err
+	}
+	var pulls []*gh.PullRequest
+	if cfg.Migrate.PullRequests != "" {
+		if pulls, err = listPullRequests(cfg, source); err != nil {
+			return err
+		}
+	}
+	milestones, err := targetMilestones(cfg, target)
+	if err != nil {
+		return err
+	}
+	migrated, err := listMigrated(cfg, target)
+	if err != nil {
+		return err
+	}
+	// the numbers of the source items found on the target
+	resumable := map[int]bool{}
+
+	items := map[int]func() (int, error){}
+	last := 0
+	for _, i := range issues {
+		i := i
+		items[i.GetNumber()] = func() (int, error) { return migrateIssue(cfg, source, target, i, milestones, migrated, l) }
+		if n, ok := migrated.find(cfg, i.GetUser().GetLogin(), i.GetCreatedAt(), i.GetHTMLURL()); ok && n == i.GetNumber() {
+			resumable[n] = true
+		}
+		if i.GetNumber() > last {
+			last = i.GetNumber()
+		}
+	}
+	for _, pr := range pulls {
+		pr := pr
+		items[pr.GetNumber()] = func() (int, error) { return migratePullRequest(cfg, source, target, pr, migrated, l) }
+		if n, ok := migrated.find(cfg, pr.GetUser().GetLogin(), pr.GetCreatedAt(), pr.GetHTMLURL()); ok && n == pr.GetNumber() {
+			resumable[n] = true
+		}
+		if pr.GetNumber() > last {
+			last = pr.GetNumber()
+		}
+	}
+
+	next, err := nextNumber(cfg, target)
+	if err != nil {
+		return err
+	}
+	if next > 1 {
+		l.WithField("next", next).Warn("the target already has issues, the source ones below the next number are considered migrated")
+	}
+
+	l.WithField("issues", len(issues)).WithField("pull_requests", len(pulls)).WithField("last", last).
+		Info("migrating the issues and the pull requests with their numbers...")
+
+	// the items of a previous run keep their number, their comments are resumed
+	for n := 1; n < next && n <= last; n++ {
+		resume, ok := items[n]
+		if !ok || !resumable[n] {
+			continue
+		}
+		got, err := resume()
+		if err != nil {
+			return err
+		}
+		if got != n {
+			return fmt.Errorf("#%d was migrated as #%d on the target, the numbers were not preserved", n, got)
+		}
+	}
+
+	placeholders := 0
+	for n := next; n <= last; n++ {
+		create, ok := items[n]
+		if !ok {
+			create = func() (int, error) { return createPlaceholder(cfg, source, target, n) }
+			placeholders++
+		}
+		got, err := create()
+		if err != nil {
+			return err
+		}
+		if got != n {
+			return fmt.Errorf("#%d was created as #%d on the target, something else created issues meanwhile and the numbers cannot be preserved", n, got)
+		}
+	}
+
+	l.WithField("placeholders", placeholders).Info("the numbers of the issues and the pull requests were preserved")
+	return nil
+}
+
+// createPlaceholder creates the closed issue keeping the number n.
+func createPlaceholder(cfg *migration, source, target *gh.Repository, n int) (int, error) {
+	ctx := cfg.runContext()
+	tgt := cfg.Target
+	body := fmt.Sprintf("#%d of %s was deleted, transferred, is a discussion or was not migrated. "+
+		"This issue only keeps the numbers of the source.", n, source.GetFullName())
+	i, _, err := tgt.Instance.Issues.Create(ctx, tgt.Organization, *target.Name, &gh.IssueRequest{
+		Title:  gh.String(fmt.Sprintf("Placeholder for #%d", n)),
+		Body:   gh.String(body),
+		Labels: &[]string{placeholderLabel},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("placeholder #%d: %v", n, err)
+	}
+	if _, _, err := tgt.Instance.Issues.Edit(ctx, tgt.Organization, *target.Name, i.GetNumber(), &gh.IssueRequest{State: gh.String("closed")}); err != nil {
+		return 0, fmt.Errorf("placeholder #%d: %v", n, err)
+	}
+	return i.GetNumber(), nil
+}
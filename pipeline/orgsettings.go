@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// orgSettings are the organization settings copied by migrate.org_settings,
+// go-github does not know them yet.
+type orgSettings struct {
+	DefaultRepositoryPermission          *string `json:"default_repository_permission,omitempty"`
+	MembersCanCreateRepositories         *bool   `json:"members_can_create_repositories,omitempty"`
+	MembersCanCreatePublicRepositories   *bool   `json:"members_can_create_public_repositories,omitempty"`
+	MembersCanCreatePrivateRepositories  *bool   `json:"members_can_create_private_repositories,omitempty"`
+	MembersCanCreateInternalRepositories *bool   `json:"members_can_create_internal_repositories,omitempty"`
+	MembersCanForkPrivateRepositories    *bool   `json:"members_can_fork_private_repositories,omitempty"`
+	HasOrganizationProjects              *bool   `json:"has_organization_projects,omitempty"`
+	HasRepositoryProjects                *bool   `json:"has_repository_projects,omitempty"`
+	WebCommitSignoffRequired             *bool   `json:"web_commit_signoff_required,omitempty"`
+}
+
+func listOrgHooks(ctx context.Context, client *gh.Client, org string) ([]*gh.Hook, error) {
+	opts := &gh.ListOptions{PerPage: 100}
+
+	var hooks []*gh.Hook
+	for {
+		hh, resp, err := client.Organizations.ListHooks(ctx, org, opts)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hh...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return hooks, nil
+}
+
+func migrateOrgHooks(cfg *migration) error {
+	hooks, err := listOrgHooks(cfg.runContext(), cfg.Source.Instance, cfg.Source.Organization)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listOrgHooks(cfg.runContext(), cfg.Target.Instance, cfg.Target.Organization)
+	if err != nil {
+		return err
+	}
+	urls := map[string]bool{}
+	for _, h := range existing {
+		if URL, ok := h.Config["url"].(string); ok {
+			urls[URL] = true
+		}
+	}
+
+	log.WithField("amount", len(hooks)).Info("migrating the organization webhooks...")
+
+	for _, h := range hooks {
+		hookConfig := map[string]interface{}{}
+		for k, v := range h.Config {
+			hookConfig[k] = v
+		}
+
+		URL, _ := hookConfig["url"].(string)
+		URL = rewriteHookURL(cfg, URL)
+		hookConfig["url"] = URL
+		if urls[URL] {
+			log.WithField("url", URL).Info("the organization webhook already exists, skipping")
+			continue
+		}
+
+		if secret, ok := hookConfig["secret"].(string); ok && secret == maskedSecret {
+			delete(hookConfig, "secret")
+			log.WithField("url", URL).Warn("the webhook secret cannot be read from the source, it must be set again on the target")
+		}
+
+		_, _, err := cfg.Target.Instance.Organizations.CreateHook(cfg.runContext(), cfg.Target.Organization, &gh.Hook{
+			Name:   gh.String(h.GetName()),
+			Events: h.Events,
+			Active: h.Active,
+			Config: hookConfig,
+		})
+		if err != nil {
+			return fmt.Errorf("organization webhook %d: %v", h.GetID(), err)
+		}
+
+		log.WithField("url", URL).WithField("events", h.Events).Info("an organization webhook was migrated successfully")
+	}
+
+	return nil
+}
+
+// migrateOrgSettings copies the settings and the webhooks of the source
+// organization, once before the repositories.
+func migrateOrgSettings(cfg *migration) error {
+	settings := &orgSettings{}
+	if _, err := github.Request(cfg.runContext(), cfg.Source.Instance, "GET", "orgs/"+cfg.Source.Organization, "", nil, settings); err != nil {
+		return fmt.Errorf("organization settings: %v", err)
+	}
+
+	log.WithField("organization", cfg.Target.Organization).Info("copying the organization settings...")
+	if _, err := github.Request(cfg.runContext(), cfg.Target.Instance, "PATCH", "orgs/"+cfg.Target.Organization, "", settings, nil); err != nil {
+		return fmt.Errorf("organization settings: %v", err)
+	}
+
+	if err := migrateOrgHooks(cfg); err != nil {
+		return err
+	}
+
+	log.WithField("organization", cfg.Target.Organization).Info("the organization settings were copied successfully")
+	return nil
+}
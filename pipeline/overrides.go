@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/leocomelli/ghmgr/config"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// repoOverrides maps a source repository name to the options replacing the
+// global ones for that repository.
+type repoOverrides map[string]config.RepoOverride
+
+func loadOverrides(cfg *migration) (repoOverrides, error) {
+	overrides := repoOverrides{}
+	if cfg.OverridesFile == "" {
+		return overrides, nil
+	}
+	content, err := ioutil.ReadFile(cfg.OverridesFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(content, &overrides); err != nil {
+		return nil, err
+	}
+
+	for name, o := range overrides {
+		if err := checkOverride(cfg, name, o); err != nil {
+			return nil, err
+		}
+	}
+	return overrides, nil
+}
+
+// checkOverride reports the first invalid option of the override of the
+// repository.
+func checkOverride(cfg *migration, name string, o config.RepoOverride) error {
+	switch o.Visibility {
+	case "", config.VisibilityPublic, config.VisibilityPrivate, config.VisibilityInternal:
+	default:
+		return fmt.Errorf("%s.visibility: %q must be %s, %s or %s", name, o.Visibility, config.VisibilityPublic, config.VisibilityPrivate, config.VisibilityInternal)
+	}
+	if o.Target != "" && !hasRoute(cfg, o.Target) {
+		return fmt.Errorf("%s.target: %q is not one of targets", name, o.Target)
+	}
+	if o.Team != "" && cfg.Target.Type != "" && cfg.Target.Type != config.TargetGitHub {
+		return fmt.Errorf("%s.team: not supported with target.type %s", name, cfg.Target.Type)
+	}
+	if err := config.ValidTeamPermission(o.TeamPermission); err != nil {
+		return fmt.Errorf("%s.team_permission: %v", name, err)
+	}
+	for _, step := range o.SkipSteps {
+		_, found := cfg.Hooks.Steps[step]
+		for _, s := range repoSteps {
+			found = found || s.name == step
+		}
+		if !found {
+			return fmt.Errorf("%s.skip_steps: %q is not an optional step", name, step)
+		}
+	}
+	return nil
+}
+
+func hasRoute(cfg *migration, name string) bool {
+	for _, r := range cfg.Targets {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// skipped reports whether the override of the repository skips the step.
+func (o repoOverrides) skipped(repo, step string) bool {
+	return contains(o[repo].SkipSteps, step)
+}
+
+// hasTeams reports whether one of the overrides names an owner team.
+func (o repoOverrides) hasTeams() bool {
+	for _, r := range o {
+		if r.Team != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// the pages api is not covered by go-github for the build types
+type pagesSource struct {
+	Branch string `json:"branch"`
+	Path   string `json:"path,omitempty"`
+}
+
+type pagesSite struct {
+	HTMLURL   string       `json:"html_url,omitempty"`
+	BuildType string       `json:"build_type,omitempty"`
+	Source    *pagesSource `json:"source,omitempty"`
+	CNAME     string       `json:"cname,omitempty"`
+}
+
+const pagesBuildWorkflow = "workflow"
+
+var bodyTagPattern = regexp.MustCompile(`(?i)<body[^>]*>`)
+
+func getPages(cfg *migration, client *gh.Client, owner, repo string) (*pagesSite, error) {
+	site := &pagesSite{}
+	resp, err := github.Request(cfg.runContext(), client, "GET", fmt.Sprintf("repos/%s/%s/pages", owner, repo), "", nil, site)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	return site, err
+}
+
+// migratePages publishes the target repository like the source one, from
+// the same branch and path or built by a workflow. The custom domain is
+// not moved, it can only be used by one repository at a time.
+func migratePages(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	src, err := getPages(cfg, cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		return nil
+	}
+
+	site := &pagesSite{BuildType: src.BuildType}
+	if src.BuildType != pagesBuildWorkflow {
+		site.Source = src.Source
+	}
+
+	l.Info("enabling the pages...")
+	URL := fmt.Sprintf("repos/%s/%s/pages", cfg.Target.Organization, *target.Name)
+	resp, err := github.Request(cfg.runContext(), cfg.Target.Instance, "POST", URL, "", site, nil)
+	if resp != nil && resp.StatusCode == http.StatusConflict {
+		// already enabled by a previous run
+		_, err = github.Request(cfg.runContext(), cfg.Target.Instance, "PUT", URL, "", site, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	if src.CNAME != "" {
+		l.WithField("cname", src.CNAME).Warn("the custom domain of the pages was not moved, set it on the target once released by the source")
+	}
+
+	tgt, err := getPages(cfg, cfg.Target.Instance, cfg.Target.Organization, *target.Name)
+	if err != nil {
+		return err
+	}
+	if tgt == nil {
+		return fmt.Errorf("the pages of %s were not enabled", *target.Name)
+	}
+	cfg.Results.SetPagesURL(*source.Name, tgt.HTMLURL)
+	l.WithField("url", tgt.HTMLURL).Info("the pages were enabled successfully")
+
+	if cfg.Migrate.PagesRedirect {
+		return addPagesNotice(cfg, source, target, src, tgt.HTMLURL, l)
+	}
+	return nil
+}
+
+// addPagesNotice adds a notice linking to the new site at the top of the
+// index page of the source site. The sites built by a workflow have no
+// index page in the repository.
+func addPagesNotice(cfg *migration, source, target *gh.Repository, site *pagesSite, URL string, l *log.Entry) error {
+	if site.Source == nil || site.BuildType == pagesBuildWorkflow {
+		l.Warn("the pages of the source are built by a workflow, no notice was added")
+		return nil
+	}
+
+	ctx := cfg.runContext()
+	src := cfg.Source
+	file := path.Join(strings.TrimPrefix(site.Source.Path, "/"), "index.html")
+	opts := &gh.RepositoryContentGetOptions{Ref: site.Source.Branch}
+
+	c, _, resp, err := src.Instance.Repositories.GetContents(ctx, src.Organization, *source.Name, file, opts)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		l.WithField("filename", file).Warn("the pages of the source have no index page, no notice was added")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content, err := c.GetContent()
+	if err != nil {
+		return err
+	}
+
+	notice := fmt.Sprintf(`<p class="ghmgr-notice">This site has moved to <a href="%s">%s</a>.</p>`, URL, URL)
+	if strings.Contains(content, notice) {
+		return nil
+	}
+	if loc := bodyTagPattern.FindStringIndex(content); loc != nil {
+		content = content[:loc[1]] + "\n" + notice + content[loc[1]:]
+	} else {
+		content = notice + "\n" + content
+	}
+
+	message, err := commitMessage(cfg, config.CommitPages, []string{file}, source, target)
+	if err != nil {
+		return err
+	}
+	options := fileOptions(cfg, message, []byte(content), c.GetSHA(), site.Source.Branch)
+	if err := commitFile(cfg, src.Instance, src.Organization, *source.Name, file, options); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	l.WithField("filename", file).Info("a notice was added to the pages of the source")
+	return nil
+}
@@ -0,0 +1,446 @@
+// Package pipeline runs the commands of ghmgr: it lists the repositories
+// of the source, then migrates, verifies, syncs or archives them. Run is
+// the entry point of the tools embedding the migration.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/gitops"
+	"github.com/leocomelli/ghmgr/metrics"
+	"github.com/leocomelli/ghmgr/provider"
+	"github.com/leocomelli/ghmgr/provider/github"
+	"github.com/leocomelli/ghmgr/report"
+	"github.com/leocomelli/ghmgr/storage"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+// migration is a run of a command: the configuration along with the
+// clients of both sides and what is collected while the repositories are
+// processed.
+type migration struct {
+	*config.Configuration
+	Source        source
+	Target        target
+	Results       *report.Results
+	Progress      *Progress
+	State         *State
+	auth          *gitops.Auth
+	ctx           context.Context
+	stop          <-chan struct{}
+	abort         *runAbort
+	deleteTargets bool
+	force         bool
+	confirm       string
+	breakLock     bool
+	serve         string
+	watchProgress func(p *Progress)
+	events        *eventStream
+	audit         *auditLog
+	subcommand    string
+	overrides     repoOverrides
+	manifest      []string
+	teams         *teamIndex
+	secrets       secretValues
+	attribution   attributionClients
+	forks         map[string]string
+	metadata      map[string]*report.Metadata
+	workflowRules *workflowRules
+	mailmap       *gitops.Mailmap
+	refs          *gitops.RefFilter
+	references    *referenceIndex
+	apiLimiters   map[string]*provider.Limiter
+	clones        chan struct{}
+	artifacts     storage.Store
+	redactor      *redactor
+	scrubber      *scrubber
+	artifactsMu   *sync.Mutex
+}
+
+// source is the source section of the configuration along with its
+// clients.
+type source struct {
+	config.Source
+	Instance  *gh.Client
+	Tokens    oauth2.TokenSource
+	Transport *http.Transport
+	Provider  provider.Source
+}
+
+// target is the target section of the configuration along with its
+// clients.
+type target struct {
+	config.Target
+	Instance  *gh.Client
+	Tokens    oauth2.TokenSource
+	Transport *http.Transport
+	Provider  provider.Target
+}
+
+// Options are the settings of a run given on the command line rather than
+// in the configuration file.
+type Options struct {
+	// Command is the name of one of the Commands, migrate by default.
+	Command string
+	// RetryFailed processes only the repositories that failed in the
+	// previous run, according to the state file.
+	RetryFailed bool
+	// Interactive confirms the repositories before any write operation.
+	Interactive bool
+	// Schedule is a cron expression running the sync command repeatedly,
+	// HealthAddr the address of its health endpoint.
+	Schedule   string
+	HealthAddr string
+	// MetricsAddr is the address of the prometheus metrics endpoint.
+	MetricsAddr string
+	// DeleteTargets makes the rollback command delete the repositories
+	// created on the target.
+	DeleteTargets bool
+	// Force skips the confirmation of the unmigrate command.
+	Force bool
+	// Confirm is the token confirming the destructive operations, when
+	// safety.allow is empty.
+	Confirm string
+	// BreakLock removes the lock of the target organization held by
+	// another run.
+	BreakLock bool
+	// Serve is the address of the dashboard of the migrate command, or of
+	// the rest api of the server command.
+	Serve string
+	// Events is the file the events of the steps are appended to as json
+	// lines, the standard output for "-".
+	Events string
+	// Subcommand is the word following the command, e.g. diff for report.
+	Subcommand string
+	// Stop stops the run after the repositories in progress once closed,
+	// while cancelling the context aborts them.
+	Stop <-chan struct{}
+}
+
+// executeOrganizations runs the command for each of source.organizations
+// in turn, the failure of one not preventing the next ones.
+func executeOrganizations(ctx context.Context, cfg *config.Configuration, opts Options) error {
+	if opts.Schedule != "" {
+		return &ConfigError{errors.New("--schedule is not supported with source.organizations")}
+	}
+	if opts.Serve != "" {
+		return &ConfigError{errors.New("--serve is not supported with source.organizations")}
+	}
+
+	var errs []error
+	var failed []string
+	for _, o := range cfg.Source.Organizations {
+		select {
+		case <-opts.Stop:
+			return fmt.Errorf("interrupted before the organization %s", o.Name)
+		default:
+		}
+
+		c := cfg.ForOrganization(o)
+		l := log.WithField("organization", o.Name).WithField("target", c.Target.Organization)
+		l.Info("processing the organization...")
+		if err := Execute(ctx, c, opts); err != nil {
+			l.WithError(err).Error("the organization failed")
+			errs, failed = append(errs, err), append(failed, o.Name)
+		}
+	}
+	return combineErrors(errs, failed, len(cfg.Source.Organizations), "organizations")
+}
+
+// Run migrates the repositories of the source to the target, as the
+// migrate command does. Cancelling ctx aborts the repositories in
+// progress, the state file and the report are still written.
+func Run(ctx context.Context, cfg *config.Configuration) error {
+	return Execute(ctx, cfg, Options{})
+}
+
+// Execute validates the configuration and runs the command of opts.
+func Execute(ctx context.Context, cfg *config.Configuration, opts Options) error {
+	name := opts.Command
+	if name == "" {
+		name = "migrate"
+	}
+	cmd := FindCommand(name)
+	if cmd == nil {
+		return &ConfigError{fmt.Errorf("unknown command %q", name)}
+	}
+	if opts.Subcommand != "" && cmd.Name != "report" && cmd.Name != "notice" && cmd.Name != "verify" {
+		return &ConfigError{fmt.Errorf("the %s command has no subcommand %q", cmd.Name, opts.Subcommand)}
+	}
+	if opts.Schedule != "" && (cmd.Name != "sync" || opts.Interactive || opts.RetryFailed) {
+		return &ConfigError{errors.New("--schedule is only supported by the sync command, without --interactive and --retry-failed")}
+	}
+
+	if opts.Serve != "" && cmd.Name != "migrate" && cmd.Name != "server" {
+		return &ConfigError{errors.New("--serve is only supported by the migrate and server commands")}
+	}
+	if cmd.Name == "server" && (opts.Serve == "" || opts.Interactive || opts.RetryFailed) {
+		return &ConfigError{errors.New("the server command requires --serve, without --interactive and --retry-failed")}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return &ConfigError{err}
+	}
+	if opts.BreakLock && !cfg.Lock.Enabled() {
+		return &ConfigError{errors.New("--break-lock requires lock.path or lock.repository")}
+	}
+	if cfg.Git.TransferMode == config.TransferModeNative {
+		switch cmd.Name {
+		case "sync", "verify", "archive", "rollback", "unmigrate", "notice":
+			return &ConfigError{fmt.Errorf("the %s command is not supported with git.transfer_mode %s, the source repositories are moved", cmd.Name, config.TransferModeNative)}
+		}
+	}
+	if err := checkSteps(cfg); err != nil {
+		return &ConfigError{err}
+	}
+	if len(cfg.Source.Organizations) > 0 {
+		return executeOrganizations(ctx, cfg, opts)
+	}
+	if len(cfg.Targets) > 0 && cfg.Route == "" {
+		return executeTargets(ctx, cfg, opts)
+	}
+
+	m, err := newMigration(ctx, cfg, opts.Stop)
+	if err != nil {
+		return err
+	}
+	m.deleteTargets = opts.DeleteTargets
+	m.force = opts.Force
+	m.confirm = opts.Confirm
+	m.breakLock = opts.BreakLock
+	m.serve = opts.Serve
+	m.subcommand = opts.Subcommand
+	m.events, err = openEvents(m, opts.Events)
+	if err != nil {
+		return fmt.Errorf("--events: %v", err)
+	}
+	defer m.events.Close()
+	m.audit, err = openAudit(m)
+	if err != nil {
+		return fmt.Errorf("audit_log: %v", err)
+	}
+	defer m.audit.Close()
+
+	if opts.MetricsAddr != "" {
+		metrics.Serve(opts.MetricsAddr)
+	}
+
+	if opts.Schedule != "" {
+		return runScheduled(m, cmd, opts.Schedule, opts.HealthAddr)
+	}
+	if cmd.Name == "server" {
+		return runServer(m, opts.Serve)
+	}
+
+	repos, err := findRepositories(m)
+	if err != nil {
+		return err
+	}
+
+	if opts.RetryFailed {
+		repos, err = failedRepos(m, repos)
+		if err != nil {
+			return err
+		}
+		log.WithField("amount", len(repos)).Info("retrying the repositories that failed previously")
+	}
+
+	if opts.Interactive {
+		repos, err = confirmRepos(m, repos)
+		if err != nil {
+			return err
+		}
+		log.WithField("amount", len(repos)).Info("repositories confirmed")
+	}
+
+	if err := checkDestructive(m, cmd.Name, repos, true); err != nil {
+		return err
+	}
+
+	err = withLock(m, cmd.Name, func() error { return cmd.run(m, repos) })
+	if cmd.Name == "migrate" && m.Progress != nil {
+		printSummary(m, os.Stdout)
+	}
+	return err
+}
+
+// newMigration creates the clients of both sides. The configuration is
+// copied, so the run does not change the one of the caller.
+func newMigration(ctx context.Context, cfg *config.Configuration, stop <-chan struct{}) (*migration, error) {
+	c := *cfg
+	m := &migration{
+		Configuration: &c,
+		Source:        source{Source: c.Source},
+		Target:        target{Target: c.Target},
+		auth:          gitops.NewAuth(c.Git),
+		ctx:           ctx,
+		stop:          stop,
+		abort:         newRunAbort(),
+		teams:         &teamIndex{},
+		redactor:      newRedactor(cfg),
+		artifactsMu:   &sync.Mutex{},
+	}
+
+	var err error
+	m.overrides, err = loadOverrides(m)
+	if err != nil {
+		return nil, &ConfigError{fmt.Errorf("overrides_file: %v", err)}
+	}
+	m.manifest, err = loadManifest(m)
+	if err != nil {
+		return nil, &ConfigError{fmt.Errorf("manifest_file: %v", err)}
+	}
+	if m.refs, err = gitops.NewRefFilter(c.Git); err != nil {
+		return nil, &ConfigError{err}
+	}
+	if m.scrubber, err = newScrubber(c.Migrate.Scrub); err != nil {
+		return nil, &ConfigError{fmt.Errorf("migrate.scrub: %v", err)}
+	}
+
+	if m.Storage.S3.Enabled() {
+		m.artifacts = storage.NewS3(m.Storage.S3)
+	}
+
+	if m.StateFile != "" && !m.DryRun {
+		if err := restoreFile(m, stateKey, m.StateFile); err != nil {
+			return nil, err
+		}
+		m.State, err = loadState(m.StateFile)
+		if err != nil {
+			return nil, err
+		}
+		log.WithField("file", m.StateFile).WithField("repositories", len(m.State.Repos)).Info("using the state file")
+	}
+
+	if n := m.Throttle.APIRequestsPerMinute; n > 0 {
+		m.apiLimiters = map[string]*provider.Limiter{
+			"source": provider.NewLimiter(float64(n) / 60),
+			"target": provider.NewLimiter(float64(n) / 60),
+		}
+	}
+	if n := m.Throttle.MaxClones; n > 0 {
+		m.clones = make(chan struct{}, n)
+	}
+
+	if m.Source.CacheDir != "" {
+		if err := os.MkdirAll(m.Source.CacheDir, 0700); err != nil {
+			return nil, fmt.Errorf("source.cache_dir: %v", err)
+		}
+	}
+	m.Source.Transport, err = provider.NewTransport(m.HTTP, m.Source.Insecure, m.Source.CABundle, m.Source.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	m.Target.Transport, err = provider.NewTransport(m.HTTP, m.Target.Insecure, m.Target.CABundle, m.Target.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Source.Instance, m.Source.Tokens, err = github.NewClient(sourceEndpoint(m), m.Source.Token, m.Source.App, apiHTTPClient(m, "source", m.Source.Transport))
+	if err != nil {
+		return nil, err
+	}
+	m.Target.Instance, m.Target.Tokens, err = github.NewClient(targetEndpoint(m), m.Target.Token, m.Target.App, apiHTTPClient(m, "target", m.Target.Transport))
+	if err != nil {
+		return nil, err
+	}
+	m.Target.Provider = newTargetProvider(m)
+	installGitTransport(m)
+
+	log.WithField("url", m.Source.URL).Warn("source github")
+	log.WithField("url", m.Target.URL).Warn("target github")
+	if err := checkEndpoints(m); err != nil {
+		return nil, err
+	}
+
+	if err := resolveSourceOwner(m); err != nil {
+		return nil, err
+	}
+	m.Source.Provider = newSourceProvider(m)
+
+	return m, nil
+}
+
+func sourceEndpoint(cfg *migration) github.Endpoint {
+	return github.Endpoint{URL: cfg.Source.URL, UploadURL: cfg.Source.UploadURL, APIVersion: cfg.Source.APIVersion}
+}
+
+func targetEndpoint(cfg *migration) github.Endpoint {
+	return github.Endpoint{URL: cfg.Target.URL, UploadURL: cfg.Target.UploadURL, APIVersion: cfg.Target.APIVersion}
+}
+
+// checkEndpoints reads the root of the api of the GitHub sides before
+// anything else, so a wrong url fails the run with an error telling why.
+func checkEndpoints(cfg *migration) error {
+	if cfg.Source.Type == "" || cfg.Source.Type == config.SourceGitHub {
+		if err := github.Check(cfg.runContext(), cfg.Source.Instance, sourceEndpoint(cfg)); err != nil {
+			return fmt.Errorf("source.url: %v", err)
+		}
+	}
+	if cfg.Target.Type == "" || cfg.Target.Type == config.TargetGitHub {
+		if err := github.Check(cfg.runContext(), cfg.Target.Instance, targetEndpoint(cfg)); err != nil {
+			return fmt.Errorf("target.url: %v", err)
+		}
+	}
+	return nil
+}
+
+// apiHTTPClient retries the requests of an instance rejected by the rate
+// limits or by server errors, each attempt being throttled by
+// throttle.api_requests_per_minute. The reads of the source go through the
+// cache of source.cache_dir, when set, and the writes are recorded in the
+// audit log.
+func apiHTTPClient(cfg *migration, instance string, base http.RoundTripper) *http.Client {
+	if l := cfg.apiLimiters[instance]; l != nil {
+		base = provider.NewThrottledTransport(base, l)
+	}
+	c := provider.NewClient(instance, base, cfg.RateLimit.Retries, cfg.HTTP.Retries)
+	if instance == "source" && cfg.Source.CacheDir != "" {
+		c.Transport = provider.NewCacheTransport(c.Transport, cfg.Source.CacheDir)
+	}
+	c.Transport = &auditTransport{cfg: cfg, side: instance, base: c.Transport}
+	return c
+}
+
+// acquireClone waits for one of the throttle.max_clones slots, the returned
+// function releasing it.
+func (c *migration) acquireClone() func() {
+	if c.clones == nil {
+		return func() {}
+	}
+	c.clones <- struct{}{}
+	return func() { <-c.clones }
+}
+
+// runContext is cancelled to abort the run, every api call, clone and
+// push uses it.
+func (c *migration) runContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// stopping reports whether a shutdown was requested or the run aborted by
+// a failure_policy, the commands check it between repositories so the
+// current one is not interrupted.
+func (c *migration) stopping() bool {
+	select {
+	case <-c.stop:
+		return true
+	case <-c.abort.aborted():
+		return true
+	case <-c.runContext().Done():
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// limits of github.com: a file cannot exceed 100MB and a push 2GB
+const (
+	githubMaxFileSizeMB = 100
+	githubMaxPushSizeMB = 2048
+)
+
+type preflight struct {
+	Repo          string
+	SizeMB        int
+	LargestFile   string
+	LargestFileMB int
+	LFS           bool
+	Branches      int
+	Truncated     bool
+	Problems      []string
+}
+
+func (p *preflight) Passed() bool {
+	return len(p.Problems) == 0
+}
+
+func (p *preflight) fail(format string, args ...interface{}) {
+	p.Problems = append(p.Problems, fmt.Sprintf(format, args...))
+}
+
+// preflightLimits are the limits of the preflight section, the ones of
+// github.com by default when it is the target.
+func preflightLimits(cfg *migration) (sizeMB, fileSizeMB, branches int) {
+	p := cfg.Preflight
+	sizeMB, fileSizeMB, branches = p.MaxSizeMB, p.MaxFileSizeMB, p.MaxBranches
+	if cfg.Target.URL == "" && (cfg.Target.Type == "" || cfg.Target.Type == config.TargetGitHub) {
+		if sizeMB == 0 {
+			sizeMB = githubMaxPushSizeMB
+		}
+		if fileSizeMB == 0 {
+			fileSizeMB = githubMaxFileSizeMB
+		}
+	}
+	return sizeMB, fileSizeMB, branches
+}
+
+// analyzeRepo compares a source repository with the limits of the target
+// before anything is cloned. The files are the ones of the default branch,
+// older commits are not inspected.
+func analyzeRepo(cfg *migration, repo *gh.Repository) (*preflight, error) {
+	ctx := cfg.runContext()
+	src := cfg.Source
+	p := &preflight{Repo: *repo.Name, SizeMB: repo.GetSize() / 1024}
+	maxSize, maxFileSize, maxBranches := preflightLimits(cfg)
+	// the files removed by git.filter are not pushed
+	filtered := cfg.Git.Filter.MaxFileSizeMB > 0 && cfg.Git.Filter.MaxFileSizeMB <= maxFileSize
+
+	// the metadata read for the whole owner at once spares listing the refs
+	m := cfg.metadata[*repo.Name]
+	if m != nil {
+		p.Branches = m.Branches
+	} else {
+		refs, err := listRefs(ctx, src.Instance, src.Organization, *repo.Name)
+		if err != nil {
+			return nil, err
+		}
+		for ref := range refs {
+			if strings.HasPrefix(ref, "refs/heads/") {
+				p.Branches++
+			}
+		}
+	}
+
+	if repo.GetDefaultBranch() != "" && p.Branches > 0 {
+		tree, _, err := src.Instance.Git.GetTree(ctx, src.Organization, *repo.Name, repo.GetDefaultBranch(), true)
+		if err != nil {
+			return nil, err
+		}
+		p.Truncated = tree.GetTruncated()
+
+		largest := 0
+		for _, e := range tree.Entries {
+			if e.GetType() == "blob" && e.GetSize() > largest {
+				largest, p.LargestFile = e.GetSize(), e.GetPath()
+			}
+			if e.GetType() != "blob" || path.Base(e.GetPath()) != ".gitattributes" || p.LFS {
+				continue
+			}
+			if e.GetPath() == ".gitattributes" && m != nil {
+				p.LFS = m.LFS
+				continue
+			}
+			p.LFS, err = usesLFSFilter(cfg, repo, e.GetPath())
+			if err != nil {
+				return nil, err
+			}
+		}
+		p.LargestFileMB = largest / 1024 / 1024
+		if maxFileSize > 0 && largest > maxFileSize*1024*1024 && !filtered {
+			p.fail("%s is %dMB, the limit of the target is %dMB", p.LargestFile, p.LargestFileMB, maxFileSize)
+		}
+	}
+
+	if maxSize > 0 && p.SizeMB > maxSize {
+		p.fail("the repository is %dMB, the limit of the target is %dMB", p.SizeMB, maxSize)
+	}
+	if maxBranches > 0 && p.Branches > maxBranches {
+		p.fail("the repository has %d branches, the limit is %d", p.Branches, maxBranches)
+	}
+	if p.LFS && !cfg.Git.LFS {
+		p.fail("the repository uses lfs but git.lfs is disabled, the objects would not be transferred")
+	}
+
+	return p, nil
+}
+
+func usesLFSFilter(cfg *migration, repo *gh.Repository, file string) (bool, error) {
+	opts := &gh.RepositoryContentGetOptions{Ref: repo.GetDefaultBranch()}
+	c, _, resp, err := cfg.Source.Instance.Repositories.GetContents(cfg.runContext(), cfg.Source.Organization, *repo.Name, file, opts)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	content, err := c.GetContent()
+	return strings.Contains(content, "filter=lfs"), err
+}
+
+// preflightStep fails the repository before it is created when it would
+// exceed the limits of the target.
+func preflightStep(cfg *migration, repo *gh.Repository) error {
+	p, err := analyzeRepo(cfg, repo)
+	if err != nil {
+		return fmt.Errorf("preflight: %v", err)
+	}
+	if !p.Passed() {
+		return fmt.Errorf("preflight: %s", strings.Join(p.Problems, "; "))
+	}
+	return nil
+}
+
+func planPreflight(cfg *migration, repo *gh.Repository, l *log.Entry) {
+	p, err := analyzeRepo(cfg, repo)
+	if err != nil {
+		l.WithError(err).Error("[plan] the preflight checks failed")
+		return
+	}
+
+	l = l.WithField("size_mb", p.SizeMB).WithField("largest_file", p.LargestFile).WithField("largest_file_mb", p.LargestFileMB).
+		WithField("lfs", p.LFS).WithField("branches", p.Branches)
+	if p.Truncated {
+		l.Warn("[plan] the tree is too large to be listed, not every file was checked")
+	}
+	for _, problem := range p.Problems {
+		l.WithField("problem", problem).Warn("[plan] the repository would fail the preflight checks")
+	}
+	if p.Passed() {
+		l.Info("[plan] the repository passed the preflight checks")
+	}
+}
@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/utils/diff"
+)
+
+// previewContext is the number of unchanged lines around the changes.
+const previewContext = 3
+
+// runPreview prints the unified diff of the files the content rules would
+// change on each source repository, nothing being committed. The templates
+// point to the target repository, or to the address it would get when it
+// is not created yet.
+func runPreview(cfg *migration, repos []*gh.Repository) error {
+	if !cfg.Source.Content.Enabled() {
+		return errors.New("the notice preview command requires source.content")
+	}
+
+	failed, changed := 0, 0
+	for _, repo := range repos {
+		if cfg.stopping() {
+			break
+		}
+		l := log.WithField("repo", *repo.Name)
+
+		files, err := previewRepo(cfg, repo, os.Stdout)
+		if err != nil {
+			l.Error(err)
+			failed++
+			continue
+		}
+		if files == 0 {
+			l.Info("the content is already up to date")
+		}
+		changed += files
+	}
+
+	log.WithField("repositories", len(repos)).WithField("files", changed).Info("[plan] done, no changes were made")
+	if failed > 0 {
+		return partialError(failed, len(repos), "%d of %d repositories could not be previewed", failed, len(repos))
+	}
+	return nil
+}
+
+// previewRepo writes the diffs of one repository and returns the number of
+// files changed. The rules of the same file apply one after the other, as
+// when they are committed.
+func previewRepo(cfg *migration, source *gh.Repository, w io.Writer) (int, error) {
+	name := targetName(cfg, *source.Name)
+	target, err := existingRepo(cfg, name)
+	if err != nil {
+		return 0, err
+	}
+	if target == nil {
+		target = &gh.Repository{
+			Name:    gh.String(name),
+			HTMLURL: gh.String(fmt.Sprintf("%s/%s/%s", targetWebBase(cfg), cfg.Target.Organization, name)),
+		}
+	}
+
+	var paths []string
+	original, updated := map[string]string{}, map[string]string{}
+	for _, rule := range cfg.Source.Content.AllRules() {
+		content, ok := updated[rule.Path]
+		if !ok {
+			c, _, err := sourceContent(cfg, rule, source)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %v", rule.Path, err)
+			}
+			content = c
+			original[rule.Path] = c
+			paths = append(paths, rule.Path)
+		}
+		if updated[rule.Path], err = applyContentRule(rule, content, expandTemplate(rule.Template, source, target)); err != nil {
+			return 0, fmt.Errorf("%s: %v", rule.Path, err)
+		}
+	}
+
+	files := 0
+	for _, path := range paths {
+		d := unifiedDiff(original[path], updated[path], *source.Name+"/"+path)
+		if d == "" {
+			continue
+		}
+		fmt.Fprint(w, d)
+		files++
+	}
+	return files, nil
+}
+
+// diffLine is a line of a diff, op being ' ', '-' or '+'.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the diff of two versions of the file at path in the
+// unified format, empty when they are the same.
+func unifiedDiff(from, to, path string) string {
+	if from == to {
+		return ""
+	}
+
+	var lines []diffLine
+	for _, d := range diff.Do(from, to) {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		for _, t := range strings.SplitAfter(d.Text, "\n") {
+			if t != "" {
+				lines = append(lines, diffLine{op, t})
+			}
+		}
+	}
+
+	// the line numbers of both versions before each line
+	oldN, newN := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, dl := range lines {
+		oldN[i+1], newN[i+1] = oldN[i], newN[i]
+		if dl.op != '+' {
+			oldN[i+1]++
+		}
+		if dl.op != '-' {
+			newN[i+1]++
+		}
+	}
+
+	var b strings.Builder
+	from, to = "a/"+path, "b/"+path
+	if oldN[len(lines)] == 0 {
+		from = "/dev/null"
+	}
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", from, to)
+
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		// the hunk runs to the last change closer than twice the context
+		start, end := i-previewContext, i
+		if start < 0 {
+			start = 0
+		}
+		for j := i; j < len(lines) && j <= end+2*previewContext; j++ {
+			if lines[j].op != ' ' {
+				end = j
+			}
+		}
+		if end += previewContext + 1; end > len(lines) {
+			end = len(lines)
+		}
+
+		oldStart, newStart := oldN[start], newN[start]
+		oldCount, newCount := oldN[end]-oldStart, newN[end]-newStart
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, dl := range lines[start:end] {
+			b.WriteByte(dl.op)
+			b.WriteString(dl.text)
+			if !strings.HasSuffix(dl.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return b.String()
+}
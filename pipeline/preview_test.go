@@ -0,0 +1,21 @@
+package pipeline
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{"same", "a\n", "a\n", ""},
+		{"new file", "", "a\nb\n", "--- /dev/null\n+++ b/README.md\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"changed line", "a\nb\nc\n", "a\nB\nc\n", "--- a/README.md\n+++ b/README.md\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"no newline", "a\n", "a\nb", "--- a/README.md\n+++ b/README.md\n@@ -1,1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n"},
+	}
+	for _, tt := range tests {
+		if got := unifiedDiff(tt.from, tt.to, "README.md"); got != tt.want {
+			t.Errorf("%s: unifiedDiff =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
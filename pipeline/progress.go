@@ -0,0 +1,413 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	defaultProgressInterval = time.Minute
+	progressBarWidth        = 30
+)
+
+var gitPercent = regexp.MustCompile(`(\d+)%`)
+
+// repository statuses of the progress, along with the ones of the report
+const (
+	progressQueued  = "queued"
+	progressRunning = "running"
+)
+
+type repoProgress struct {
+	// correlation is the id of the attempt, in its logs, events, report
+	// entry and audit entries
+	correlation string
+	step        string
+	percent     int
+	status      string
+	steps       []string
+	errors      []string
+	started     time.Time
+	finished    time.Time
+
+	// the start of the current step, zero before the first one
+	stepStarted time.Time
+	stepFailed  bool
+}
+
+// Progress tracks the repositories of a run, rendering a progress bar on a
+// terminal or logging a summary periodically otherwise. Like the results,
+// a nil value silently ignores every call.
+type Progress struct {
+	mu      sync.Mutex
+	total   int
+	done    int
+	failed  int
+	started time.Time
+	order   []string
+	repos   map[string]*repoProgress
+	running map[string]*repoProgress
+	events  *eventStream
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func newProgress(names []string) *Progress {
+	p := &Progress{
+		total:   len(names),
+		started: time.Now(),
+		order:   names,
+		repos:   map[string]*repoProgress{},
+		running: map[string]*repoProgress{},
+		stop:    make(chan struct{}),
+	}
+	for _, name := range names {
+		p.repos[name] = &repoProgress{status: progressQueued}
+	}
+	return p
+}
+
+// Start records the start of a repository with the correlation id of the
+// attempt, a retried one being counted once.
+func (p *Progress) Start(repo, correlation string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.repos[repo]; ok && !r.finished.IsZero() {
+		p.done--
+		if r.status == report.StatusFailed {
+			p.failed--
+		}
+	}
+	r := &repoProgress{correlation: correlation, step: "starting", status: progressRunning, started: time.Now()}
+	p.repos[repo] = r
+	p.running[repo] = r
+	p.emit(repo, "", eventStarted, 0, nil)
+}
+
+// emit sends an event of the repository with the correlation id of its
+// attempt, p.mu held.
+func (p *Progress) emit(repo, step, status string, d time.Duration, err error) {
+	var correlation string
+	if r, ok := p.repos[repo]; ok {
+		correlation = r.correlation
+	}
+	p.events.emit(repo, correlation, step, status, d, err)
+}
+
+// Queue marks a finished repository as queued again.
+func (p *Progress) Queue(repo string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.repos[repo]; ok {
+		r.status = progressQueued
+		p.emit(repo, "", eventQueued, 0, nil)
+	}
+}
+
+// Step records the step being performed on a repository.
+func (p *Progress) Step(repo, step string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.running[repo]; ok {
+		p.endStep(repo, r, nil)
+		r.step, r.percent = step, 0
+		r.steps = append(r.steps, step)
+		r.stepStarted, r.stepFailed = time.Now(), false
+		p.emit(repo, step, eventStarted, 0, nil)
+	}
+}
+
+// endStep records the end of the current step of a repository, failed
+// with err, unless it already failed.
+func (p *Progress) endStep(repo string, r *repoProgress, err error) {
+	if r.stepStarted.IsZero() || r.stepFailed {
+		return
+	}
+	status := eventCompleted
+	if err != nil {
+		status = eventFailed
+	}
+	p.emit(repo, r.step, status, time.Since(r.stepStarted), err)
+}
+
+// Fail records the error of a step of a repository.
+func (p *Progress) Fail(repo, step string, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.repos[repo]; ok {
+		r.errors = append(r.errors, fmt.Sprintf("%s: %v", step, err))
+		var d time.Duration
+		if step == r.step && !r.stepStarted.IsZero() {
+			d, r.stepFailed = time.Since(r.stepStarted), true
+		}
+		p.emit(repo, step, eventFailed, d, err)
+	}
+}
+
+// Skip records a step already completed by a previous run.
+func (p *Progress) Skip(repo, step string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(repo, step, eventSkipped, 0, nil)
+}
+
+// Status is the status of a repository, empty when it is not part of the
+// run.
+func (p *Progress) Status(repo string) string {
+	if p == nil {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.repos[repo]; ok {
+		return r.status
+	}
+	return ""
+}
+
+// StepOf returns the step being performed on a repository.
+func (p *Progress) StepOf(repo string) string {
+	if p == nil {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.running[repo]; ok {
+		return r.step
+	}
+	return ""
+}
+
+func (p *Progress) Finish(repo string, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.running[repo]; ok {
+		r.finished = time.Now()
+		r.status = repoStatus(err)
+		if err != nil && err != errRepoSkipped {
+			r.errors = append(r.errors, err.Error())
+			p.endStep(repo, r, err)
+		} else {
+			p.endStep(repo, r, nil)
+			if err == nil && len(r.errors) > 0 {
+				r.status = report.StatusPartial
+			}
+		}
+		p.emit(repo, "", r.status, r.finished.Sub(r.started), err)
+	}
+	delete(p.running, repo)
+	p.done++
+	if err != nil && err != errRepoSkipped {
+		p.failed++
+	}
+}
+
+// progressRepo is a repository of the progress snapshot.
+type progressRepo struct {
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Step     string   `json:"step,omitempty"`
+	Percent  int      `json:"percent,omitempty"`
+	Steps    []string `json:"steps,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Duration string   `json:"duration,omitempty"`
+}
+
+// progressSnapshot is the state of the run served by the dashboard.
+type progressSnapshot struct {
+	Total    int            `json:"total"`
+	Done     int            `json:"done"`
+	Failed   int            `json:"failed"`
+	Elapsed  string         `json:"elapsed"`
+	ETA      string         `json:"eta"`
+	PerHour  float64        `json:"repositories_per_hour"`
+	Repos    []progressRepo `json:"repositories"`
+	Finished bool           `json:"finished"`
+}
+
+// snapshot copies the state of the run, the errors redacted by redact.
+func (p *Progress) snapshot(redact func(string) string) progressSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	elapsed := time.Since(p.started)
+	s := progressSnapshot{
+		Total:    p.total,
+		Done:     p.done,
+		Failed:   p.failed,
+		Elapsed:  elapsed.Round(time.Second).String(),
+		ETA:      p.eta().String(),
+		Finished: p.done == p.total,
+	}
+	if hours := elapsed.Hours(); hours > 0 {
+		s.PerHour = float64(int(float64(p.done)/hours*10)) / 10
+	}
+	for _, name := range p.order {
+		r := p.repos[name]
+		repo := progressRepo{Name: name, Status: r.status, Steps: r.steps}
+		if r.status == progressRunning {
+			repo.Step, repo.Percent = r.step, r.percent
+			repo.Duration = time.Since(r.started).Round(time.Second).String()
+		} else if !r.finished.IsZero() {
+			repo.Duration = r.finished.Sub(r.started).Round(time.Second).String()
+		}
+		for _, e := range r.errors {
+			repo.Errors = append(repo.Errors, redact(e))
+		}
+		s.Repos = append(s.Repos, repo)
+	}
+	return s
+}
+
+// gitProgress receives the progress messages of the git server, e.g.
+// "Receiving objects:  45% (450/1000)", and keeps the percentage.
+type gitProgress struct {
+	p    *Progress
+	repo string
+}
+
+func (g *gitProgress) Write(b []byte) (int, error) {
+	m := gitPercent.FindAllSubmatch(b, -1)
+	if len(m) == 0 {
+		return len(b), nil
+	}
+	percent, _ := strconv.Atoi(string(m[len(m)-1][1]))
+
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	if r, ok := g.p.running[g.repo]; ok {
+		r.percent = percent
+	}
+	return len(b), nil
+}
+
+// Writer returns the progress writer of the git operations of a repository.
+func (p *Progress) Writer(repo string) io.Writer {
+	if p == nil {
+		return nil
+	}
+	return &gitProgress{p: p, repo: repo}
+}
+
+func (p *Progress) eta() time.Duration {
+	if p.done == 0 {
+		return 0
+	}
+	elapsed := time.Since(p.started)
+	return time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done)).Round(time.Second)
+}
+
+func (p *Progress) current() string {
+	var names []string
+	for name := range p.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		r := p.running[name]
+		if r.percent > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %s %d%%", name, r.step, r.percent))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s: %s", name, r.step))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (p *Progress) render(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	filled := 0
+	if p.total > 0 {
+		filled = progressBarWidth * p.done / p.total
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Fprintf(w, "\r\033[K[%s] %d/%d repositories, %d failed, elapsed %s, eta %s  %s", bar, p.done, p.total, p.failed,
+		time.Since(p.started).Round(time.Second), p.eta(), p.current())
+}
+
+func (p *Progress) logSummary() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	log.WithField("done", fmt.Sprintf("%d/%d", p.done, p.total)).WithField("failed", p.failed).
+		WithField("elapsed", time.Since(p.started).Round(time.Second).String()).WithField("eta", p.eta().String()).
+		WithField("running", p.current()).Info("progress")
+}
+
+// Run renders the progress until Stop is called, every second on a
+// terminal or every interval in the logs.
+func (p *Progress) Run(interval time.Duration) {
+	if p == nil {
+		return
+	}
+	tty := terminal.IsTerminal(int(os.Stderr.Fd()))
+	if tty {
+		interval = time.Second
+	} else if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if tty {
+					p.render(os.Stderr)
+				} else {
+					p.logSummary()
+				}
+			case <-p.stop:
+				if tty {
+					p.render(os.Stderr)
+					fmt.Fprintln(os.Stderr)
+				}
+				p.logSummary()
+				return
+			}
+		}
+	}()
+}
+
+func (p *Progress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.stopped.Wait()
+}
@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/url"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// customProperty is the definition of a custom repository property of an
+// organization, go-github does not know them yet.
+type customProperty struct {
+	PropertyName     string      `json:"property_name,omitempty"`
+	ValueType        string      `json:"value_type"`
+	Required         bool        `json:"required"`
+	DefaultValue     interface{} `json:"default_value,omitempty"`
+	Description      *string     `json:"description,omitempty"`
+	AllowedValues    []string    `json:"allowed_values,omitempty"`
+	ValuesEditableBy *string     `json:"values_editable_by,omitempty"`
+}
+
+// propertyValue is the value of a custom property for a repository: a
+// string, a list of strings or nil when unset.
+type propertyValue struct {
+	PropertyName string      `json:"property_name"`
+	Value        interface{} `json:"value"`
+}
+
+// migratePropertySchema defines the custom properties of the source
+// organization that the target organization does not have, so the values
+// of the repositories can be set. The existing definitions are kept.
+func migratePropertySchema(cfg *migration) error {
+	ctx := cfg.runContext()
+
+	var source, target []customProperty
+	if _, err := github.Request(ctx, cfg.Source.Instance, "GET", fmt.Sprintf("orgs/%s/properties/schema", cfg.Source.Organization), "", nil, &source); err != nil {
+		return fmt.Errorf("listing the custom properties of the source: %v", err)
+	}
+	if _, err := github.Request(ctx, cfg.Target.Instance, "GET", fmt.Sprintf("orgs/%s/properties/schema", cfg.Target.Organization), "", nil, &target); err != nil {
+		return fmt.Errorf("listing the custom properties of the target: %v", err)
+	}
+
+	defined := map[string]bool{}
+	for _, p := range target {
+		defined[p.PropertyName] = true
+	}
+
+	for _, p := range source {
+		l := log.WithField("property", p.PropertyName)
+		if defined[p.PropertyName] {
+			l.Info("the custom property is already defined on the target, skipping")
+			continue
+		}
+		name := p.PropertyName
+		p.PropertyName = ""
+		if _, err := github.Request(ctx, cfg.Target.Instance, "PUT", fmt.Sprintf("orgs/%s/properties/schema/%s", cfg.Target.Organization, url.PathEscape(name)), "", p, nil); err != nil {
+			return fmt.Errorf("custom property %s: %v", name, err)
+		}
+		l.WithField("type", p.ValueType).Info("a custom property was defined successfully")
+	}
+
+	return nil
+}
+
+func migrateCustomProperties(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	var values []propertyValue
+	if _, err := github.Request(ctx, cfg.Source.Instance, "GET", fmt.Sprintf("repos/%s/%s/properties/values", cfg.Source.Organization, *source.Name), "", nil, &values); err != nil {
+		return err
+	}
+
+	var set []propertyValue
+	for _, v := range values {
+		if v.Value != nil {
+			set = append(set, v)
+		}
+	}
+	if len(set) == 0 {
+		l.Info("the repository has no custom property, skipping")
+		return nil
+	}
+
+	body := struct {
+		Properties []propertyValue `json:"properties"`
+	}{set}
+	if _, err := github.Request(ctx, cfg.Target.Instance, "PATCH", fmt.Sprintf("repos/%s/%s/properties/values", cfg.Target.Organization, *target.Name), "", body, nil); err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(set)).Info("the custom properties were migrated successfully")
+	return nil
+}
@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+func listProtectedBranches(cfg *migration, client *gh.Client, owner, repo string) ([]string, error) {
+	opts := &gh.ListOptions{PerPage: 100}
+
+	var branches []string
+	for {
+		bb, resp, err := client.Repositories.ListBranches(cfg.runContext(), owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bb {
+			if b.GetProtected() {
+				branches = append(branches, b.GetName())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return branches, nil
+}
+
+func protectionRequest(cfg *migration, p *gh.Protection) *gh.ProtectionRequest {
+	req := &gh.ProtectionRequest{
+		RequiredStatusChecks: p.RequiredStatusChecks,
+	}
+	if c := p.RequiredStatusChecks; c != nil {
+		contexts := []string{}
+		for _, context := range c.Contexts {
+			contexts = append(contexts, mapStatusCheck(cfg, context))
+		}
+		req.RequiredStatusChecks = &gh.RequiredStatusChecks{Strict: c.Strict, Contexts: contexts}
+	}
+
+	if p.EnforceAdmins != nil {
+		req.EnforceAdmins = p.EnforceAdmins.Enabled
+	}
+
+	if r := p.RequiredPullRequestReviews; r != nil {
+		req.RequiredPullRequestReviews = &gh.PullRequestReviewsEnforcementRequest{
+			DismissStaleReviews:          r.DismissStaleReviews,
+			RequireCodeOwnerReviews:      r.RequireCodeOwnerReviews,
+			RequiredApprovingReviewCount: r.RequiredApprovingReviewCount,
+		}
+		if len(r.DismissalRestrictions.Users) > 0 || len(r.DismissalRestrictions.Teams) > 0 {
+			users := mapUsers(cfg, r.DismissalRestrictions.Users)
+			teams := mapTeams(cfg, r.DismissalRestrictions.Teams)
+			req.RequiredPullRequestReviews.DismissalRestrictionsRequest = &gh.DismissalRestrictionsRequest{
+				Users: &users,
+				Teams: &teams,
+			}
+		}
+	}
+
+	if p.Restrictions != nil {
+		req.Restrictions = &gh.BranchRestrictionsRequest{
+			Users: append([]string{}, mapUsers(cfg, p.Restrictions.Users)...),
+			Teams: append([]string{}, mapTeams(cfg, p.Restrictions.Teams)...),
+		}
+	}
+
+	return req
+}
+
+func migrateBranchProtections(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	branches, err := listProtectedBranches(cfg, cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return err
+	}
+
+	l.WithField("branches", branches).Info("migrating the branch protections...")
+
+	for _, b := range branches {
+		p, _, err := cfg.Source.Instance.Repositories.GetBranchProtection(ctx, cfg.Source.Organization, *source.Name, b)
+		if err != nil {
+			return fmt.Errorf("branch %s: %v", b, err)
+		}
+
+		tb := targetBranch(cfg, b)
+		if !branchExists(ctx, cfg.Target.Instance, cfg.Target.Organization, *target.Name, tb) {
+			l.WithField("branch", tb).Warn("the branch does not exist on the target, skipping its protection")
+			continue
+		}
+
+		_, _, err = cfg.Target.Instance.Repositories.UpdateBranchProtection(ctx, cfg.Target.Organization, *target.Name, tb, protectionRequest(cfg, p))
+		if err != nil {
+			return fmt.Errorf("branch %s: %v", b, err)
+		}
+
+		l.WithField("branch", b).Info("a branch protection was migrated successfully")
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider"
+	"github.com/leocomelli/ghmgr/provider/azuredevops"
+	"github.com/leocomelli/ghmgr/provider/bitbucket"
+	"github.com/leocomelli/ghmgr/provider/gitea"
+	"github.com/leocomelli/ghmgr/provider/github"
+	"github.com/leocomelli/ghmgr/provider/gitlab"
+	"github.com/leocomelli/ghmgr/provider/urls"
+)
+
+const defaultPageSize = 100
+
+// pageSize is the number of repositories listed per request, 100 being
+// the maximum accepted by the api.
+func pageSize(cfg *migration) int {
+	if cfg.Source.PageSize <= 0 {
+		return defaultPageSize
+	}
+	return cfg.Source.PageSize
+}
+
+func newSourceProvider(cfg *migration) provider.Source {
+	switch cfg.Source.Type {
+	case config.SourceBitbucket:
+		return bitbucket.NewSource(cfg.Source.URL, cfg.Source.Token, cfg.Source.Organization, pageSize(cfg),
+			apiHTTPClient(cfg, "source", cfg.Source.Transport))
+	case config.SourceURLs:
+		return urls.NewSource(cfg.Source.URLs, cfg.Source.URLsFile)
+	case config.SourceAzureDevOps:
+		return azuredevops.NewSource(cfg.Source.URL, cfg.Source.Token, cfg.Source.Organization, cfg.Source.NamePattern,
+			apiHTTPClient(cfg, "source", cfg.Source.Transport))
+	}
+	return github.NewSource(cfg.Source.Instance, cfg.Source.Organization, cfg.Source.User, pageSize(cfg))
+}
+
+func newTargetProvider(cfg *migration) provider.Target {
+	switch cfg.Target.Type {
+	case config.TargetGitLab:
+		return gitlab.NewTarget(cfg.Target.URL, cfg.Target.Token, cfg.Target.Organization, cfg.Git.LFS,
+			apiHTTPClient(cfg, "target", cfg.Target.Transport))
+	case config.TargetGitea:
+		return gitea.NewTarget(cfg.Target.URL, cfg.Target.Token, cfg.Target.Organization,
+			apiHTTPClient(cfg, "target", cfg.Target.Transport))
+	}
+	return github.NewTarget(cfg.Target.Instance, cfg.Target.Organization)
+}
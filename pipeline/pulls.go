@@ -0,0 +1,222 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+func listPullRequests(cfg *migration, repo *gh.Repository) ([]*gh.PullRequest, error) {
+	source := cfg.Source
+	opts := &gh.PullRequestListOptions{
+		State:       "all",
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: gh.ListOptions{PerPage: 100},
+	}
+
+	var pulls []*gh.PullRequest
+	for {
+		pp, resp, err := source.Instance.PullRequests.List(cfg.runContext(), source.Organization, *repo.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		pulls = append(pulls, pp...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return pulls, nil
+}
+
+func listReviewComments(cfg *migration, repo *gh.Repository, number int) ([]*gh.PullRequestComment, error) {
+	source := cfg.Source
+	opts := &gh.PullRequestListCommentsOptions{
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: gh.ListOptions{PerPage: 100},
+	}
+
+	var comments []*gh.PullRequestComment
+	for {
+		cc, resp, err := source.Instance.PullRequests.ListComments(cfg.runContext(), source.Organization, *repo.Name, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, cc...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return comments, nil
+}
+
+func branchExists(ctx context.Context, client *gh.Client, owner, repo, branch string) bool {
+	_, _, err := client.Repositories.GetBranch(ctx, owner, repo, branch)
+	return err == nil
+}
+
+func pullRequestStatus(pr *gh.PullRequest) string {
+	if !pr.GetMergedAt().IsZero() {
+		return fmt.Sprintf("merged on %s", pr.GetMergedAt().Format("2006-01-02"))
+	}
+	if pr.GetState() == "closed" {
+		return fmt.Sprintf("closed without merge on %s", pr.GetClosedAt().Format("2006-01-02"))
+	}
+	return "open"
+}
+
+// attributedComment is a comment along with the client posting it and the
+// date it was created on the source.
+type attributedComment struct {
+	client  *gh.Client
+	body    string
+	created time.Time
+}
+
+func migratePullRequests(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	pulls, err := listPullRequests(cfg, source)
+	if err != nil {
+		return err
+	}
+
+	migrated, err := listMigrated(cfg, target)
+	if err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(pulls)).WithField("migrated", len(migrated)).WithField("mode", cfg.Migrate.PullRequests).
+		Info("migrating the pull requests...")
+
+	for _, pr := range pulls {
+		if _, err := migratePullRequest(cfg, source, target, pr, migrated, l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migratePullRequest recreates the pull request, or an issue describing it,
+// with its comments, it returns its number on the target. A pull request
+// found in migrated only gets the comments missing on the target.
+func migratePullRequest(cfg *migration, source, target *gh.Repository, pr *gh.PullRequest, migrated migratedItems, l *log.Entry) (int, error) {
+	ctx := cfg.runContext()
+
+	client, header := attribute(cfg, pr.GetUser().GetLogin(), pr.GetCreatedAt(), pr.GetHTMLURL(), pr.GetBody())
+	// the issue of a pull request not recreated tells its status, the diff
+	// link pointing at the source, before the attribution marker
+	_, fallback := attributeWith(cfg, pr.GetUser().GetLogin(), pr.GetCreatedAt(), pr.GetHTMLURL(), pr.GetBody(),
+		fmt.Sprintf("\n\n---\n**Status:** %s\n**Branches:** `%s` → `%s`\n**Diff:** %s",
+			pullRequestStatus(pr), pr.GetHead().GetRef(), pr.GetBase().GetRef(), pr.GetDiffURL()))
+
+	number, isPull := 0, false
+	resumed := false
+	// the pull request and its issue carry the same attribution
+	if n, ok := migrated[attributedURL(fallback)]; ok {
+		l.WithField("source", pr.GetNumber()).WithField("target", n).Info("the pull request was already migrated, resuming its comments")
+		number, resumed = n, true
+	}
+	asPull := number == 0 && cfg.Migrate.PullRequests == config.PullRequestsAuto && pr.GetState() == "open" &&
+		branchExists(ctx, cfg.Target.Instance, cfg.Target.Organization, *target.Name, pr.GetHead().GetRef()) &&
+		branchExists(ctx, cfg.Target.Instance, cfg.Target.Organization, *target.Name, pr.GetBase().GetRef())
+
+	if asPull {
+		n, _, err := client.PullRequests.Create(ctx, cfg.Target.Organization, *target.Name, &gh.NewPullRequest{
+			Title: gh.String(cfg.scrubber.scrub(pr.GetTitle())),
+			Head:  gh.String(pr.GetHead().GetRef()),
+			Base:  gh.String(pr.GetBase().GetRef()),
+			Body:  gh.String(header),
+		})
+		if err != nil {
+			l.WithField("number", pr.GetNumber()).WithError(err).Warn("the pull request could not be recreated, using an issue instead")
+		} else {
+			number, isPull = n.GetNumber(), true
+		}
+	}
+
+	if number == 0 {
+		var labels []string
+		for _, lb := range pr.Labels {
+			labels = append(labels, lb.GetName())
+		}
+
+		n, _, err := client.Issues.Create(ctx, cfg.Target.Organization, *target.Name, &gh.IssueRequest{
+			Title:  gh.String(cfg.scrubber.scrub(fmt.Sprintf("[PR #%d] %s", pr.GetNumber(), pr.GetTitle()))),
+			Body:   gh.String(fallback),
+			Labels: &labels,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("pull request #%d: %v", pr.GetNumber(), err)
+		}
+		number = n.GetNumber()
+	}
+	cfg.references.record(*source.Name, pr.GetNumber(), number)
+
+	comments, err := listIssueComments(cfg, source, pr.GetNumber())
+	if err != nil {
+		return 0, fmt.Errorf("pull request #%d: %v", pr.GetNumber(), err)
+	}
+
+	var bodies []attributedComment
+	for _, c := range comments {
+		client, body := attribute(cfg, c.GetUser().GetLogin(), c.GetCreatedAt(), c.GetHTMLURL(), c.GetBody())
+		bodies = append(bodies, attributedComment{client, body, c.GetCreatedAt()})
+	}
+
+	reviews, err := listReviewComments(cfg, source, pr.GetNumber())
+	if err != nil {
+		return 0, fmt.Errorf("pull request #%d: %v", pr.GetNumber(), err)
+	}
+
+	for _, c := range reviews {
+		hunk := "```diff\n" + strings.TrimSpace(c.GetDiffHunk()) + "\n```"
+		content := fmt.Sprintf("**Review comment on `%s`**\n\n%s\n\n%s", c.GetPath(), hunk, c.GetBody())
+		client, body := attribute(cfg, c.GetUser().GetLogin(), c.GetCreatedAt(), c.GetHTMLURL(), content)
+		bodies = append(bodies, attributedComment{client, body, c.GetCreatedAt()})
+	}
+	// the conversation and the review comments are a single thread
+	sort.SliceStable(bodies, func(i, j int) bool { return bodies[i].created.Before(bodies[j].created) })
+
+	posted := map[string]bool{}
+	if resumed {
+		if posted, err = postedComments(cfg, target, number); err != nil {
+			return 0, fmt.Errorf("pull request #%d: %v", pr.GetNumber(), err)
+		}
+	}
+
+	for _, b := range bodies {
+		if posted[attributedURL(b.body)] {
+			continue
+		}
+		_, _, err := b.client.Issues.CreateComment(ctx, cfg.Target.Organization, *target.Name, number, &gh.IssueComment{
+			Body: gh.String(b.body),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("pull request #%d comment: %v", pr.GetNumber(), err)
+		}
+	}
+
+	if pr.GetState() == "closed" {
+		_, _, err := cfg.Target.Instance.Issues.Edit(ctx, cfg.Target.Organization, *target.Name, number, &gh.IssueRequest{
+			State: gh.String("closed"),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("pull request #%d: %v", pr.GetNumber(), err)
+		}
+	}
+
+	l.WithField("source", pr.GetNumber()).WithField("target", number).WithField("pull", isPull).
+		WithField("comments", len(bodies)).Info("a pull request was migrated successfully")
+	return number, nil
+}
@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github/githubtest"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMigratePullRequestsResume(t *testing.T) {
+	// the header, then the marker ending the body of the placeholder accounts
+	for _, placeholder := range []bool{false, true} {
+		testMigratePullRequestsResume(t, placeholder)
+	}
+}
+
+func testMigratePullRequestsResume(t *testing.T, placeholder bool) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	cfg.Migrate.PullRequests = config.PullRequestsIssues
+	m := newTestMigration(t, cfg)
+	if placeholder {
+		m.attribution = attributionClients{"alice": m.Target.Instance}
+	}
+
+	comment := func(path, created string) map[string]interface{} {
+		c := sourceIssue(1, path, path)
+		c["created_at"] = created
+		return c
+	}
+	f.source.Handle("GET", "repos/acme/api/pulls", func(w http.ResponseWriter, r *http.Request, path string) {
+		pr := sourceIssue(1, "pull/1", "feature")
+		pr["head"] = map[string]interface{}{"ref": "feature"}
+		pr["base"] = map[string]interface{}{"ref": "main"}
+		githubtest.Reply(w, http.StatusOK, []map[string]interface{}{pr})
+	})
+	f.source.Handle("GET", "repos/acme/api/issues/1/comments", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, []map[string]interface{}{
+			comment("pull/1#issuecomment-1", "2020-01-02T10:00:00Z"),
+			comment("pull/1#issuecomment-2", "2020-01-02T12:00:00Z"),
+		})
+	})
+	f.source.Handle("GET", "repos/acme/api/pulls/1/comments", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, []map[string]interface{}{
+			comment("pull/1#discussion_r1", "2020-01-02T11:00:00Z"),
+		})
+	})
+	tracker := newIssueTracker(f.target, "acme-new/api")
+	tracker.failBody = "pull/1#discussion_r1"
+
+	repo := &gh.Repository{Name: gh.String("api")}
+	if err := migratePullRequests(m, repo, repo, log.WithField("repo", "api")); err == nil {
+		t.Fatalf("placeholder %v: the failing review comment did not fail the step", placeholder)
+	}
+	if err := migratePullRequests(m, repo, repo, log.WithField("repo", "api")); err != nil {
+		t.Fatalf("placeholder %v: %v", placeholder, err)
+	}
+
+	if n := len(tracker.issues); n != 1 {
+		t.Fatalf("placeholder %v: %d issues on the target, want 1", placeholder, n)
+	}
+	// the review comment comes between the comments made before and after it
+	want := []string{"pull/1#issuecomment-1", "pull/1#discussion_r1", "pull/1#issuecomment-2"}
+	bodies := tracker.bodies(1)
+	if len(bodies) != len(want) {
+		t.Fatalf("placeholder %v: comments = %q, want %q", placeholder, bodies, want)
+	}
+	for i, w := range want {
+		if !strings.Contains(bodies[i], w) {
+			t.Errorf("placeholder %v: comment %d = %q, want %s", placeholder, i, bodies[i], w)
+		}
+	}
+}
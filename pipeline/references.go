@@ -0,0 +1,166 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+)
+
+var (
+	// shortRef is a reference to an issue of another repository, owner/repo#1
+	shortRef = regexp.MustCompile(`(^|[^\w/.-])([\w.-]+)/([\w.-]+)#(\d+)\b`)
+	// localRef is a reference to an issue of the same repository, #1, the
+	// html entities and the fragments of the urls being left out
+	localRef = regexp.MustCompile(`(^|[^\w&/#])#(\d+)\b`)
+)
+
+// referenceIndex maps the numbers of the issues, pull requests and
+// discussions of the repositories of the run, as they are created, to the
+// ones of the target.
+type referenceIndex struct {
+	mu      sync.Mutex
+	repos   map[string]bool
+	numbers map[string]map[int]int
+	urls    map[string]*regexp.Regexp
+}
+
+func newReferenceIndex(repos []*gh.Repository) *referenceIndex {
+	idx := &referenceIndex{repos: map[string]bool{}, numbers: map[string]map[int]int{}, urls: map[string]*regexp.Regexp{}}
+	for _, r := range repos {
+		idx.repos[strings.ToLower(r.GetName())] = true
+	}
+	return idx
+}
+
+// record maps the number of an item of the source repository to the one it
+// got on the target.
+func (idx *referenceIndex) record(repo string, from, to int) {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	repo = strings.ToLower(repo)
+	if idx.numbers[repo] == nil {
+		idx.numbers[repo] = map[int]int{}
+	}
+	idx.numbers[repo][from] = to
+}
+
+func (idx *referenceIndex) migrated(repo string) bool {
+	return idx.repos[strings.ToLower(repo)]
+}
+
+// lookup returns the target number of an item, the same number when the
+// numbers are preserved.
+func (idx *referenceIndex) lookup(cfg *migration, repo string, n int) (int, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if to, ok := idx.numbers[strings.ToLower(repo)][n]; ok {
+		return to, true
+	}
+	return n, cfg.Migrate.PreserveNumbers
+}
+
+// urlPattern matches the urls of the repositories of the source host,
+// with the number of an issue, pull request or discussion when they point
+// at one.
+func (idx *referenceIndex) urlPattern(base string) *regexp.Regexp {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	re, ok := idx.urls[base]
+	if !ok {
+		re = regexp.MustCompile(regexp.QuoteMeta(base) + `/([\w.-]+)/([\w.-]+)(?:/(issues|pull|discussions)/(\d+))?`)
+		idx.urls[base] = re
+	}
+	return re
+}
+
+// targetWebBase is the address of the web interface of the target.
+func targetWebBase(cfg *migration) string {
+	if cfg.Target.Type != "" && cfg.Target.Type != config.TargetGitHub {
+		return strings.TrimSuffix(cfg.Target.URL, "/")
+	}
+	u := cfg.Target.Instance.BaseURL
+	host := u.Host
+	if host == "api.github.com" {
+		host = "github.com"
+	}
+	return u.Scheme + "://" + host
+}
+
+// rewriteReferences points the urls, the owner/repo#1 and the #1 references
+// of a body posted from the source item at URL at the target: the
+// repositories of the run get their target name and the items their target
+// number. A reference to an item with no known number yet, e.g. created
+// after the one posted, is kept and recorded in the report.
+func rewriteReferences(cfg *migration, URL, body string) string {
+	idx := cfg.references
+	if idx == nil || body == "" {
+		return body
+	}
+	u, err := url.Parse(URL)
+	if err != nil {
+		return body
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return body
+	}
+	owner, repo := parts[0], parts[1]
+	isSource := func(o, r string) bool { return strings.EqualFold(o, owner) && idx.migrated(r) }
+	unresolved := func(ref string) {
+		cfg.Results.UnresolvedReference(repo, ref)
+	}
+	tgt := cfg.Target.Organization
+
+	re := idx.urlPattern(u.Scheme + "://" + u.Host)
+	body = re.ReplaceAllStringFunc(body, func(m string) string {
+		s := re.FindStringSubmatch(m)
+		if !isSource(s[1], s[2]) {
+			return m
+		}
+		to := fmt.Sprintf("%s/%s/%s", targetWebBase(cfg), tgt, targetName(cfg, s[2]))
+		if s[4] == "" {
+			return to
+		}
+		n, _ := strconv.Atoi(s[4])
+		number, ok := idx.lookup(cfg, s[2], n)
+		if !ok {
+			unresolved(m)
+			return m
+		}
+		return fmt.Sprintf("%s/%s/%d", to, s[3], number)
+	})
+
+	body = shortRef.ReplaceAllStringFunc(body, func(m string) string {
+		s := shortRef.FindStringSubmatch(m)
+		if !isSource(s[2], s[3]) {
+			return m
+		}
+		n, _ := strconv.Atoi(s[4])
+		number, ok := idx.lookup(cfg, s[3], n)
+		if !ok {
+			unresolved(strings.TrimPrefix(m, s[1]))
+			return m
+		}
+		return fmt.Sprintf("%s%s/%s#%d", s[1], tgt, targetName(cfg, s[3]), number)
+	})
+
+	return localRef.ReplaceAllStringFunc(body, func(m string) string {
+		s := localRef.FindStringSubmatch(m)
+		n, _ := strconv.Atoi(s[2])
+		number, ok := idx.lookup(cfg, repo, n)
+		if !ok {
+			unresolved("#" + s[2])
+			return m
+		}
+		return fmt.Sprintf("%s#%d", s[1], number)
+	})
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+func listReleases(ctx context.Context, client *gh.Client, owner, repo string) ([]*gh.RepositoryRelease, error) {
+	opts := &gh.ListOptions{PerPage: 100}
+
+	var releases []*gh.RepositoryRelease
+	for {
+		rr, resp, err := client.Repositories.ListReleases(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, rr...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return releases, nil
+}
+
+func downloadAsset(cfg *migration, repo *gh.Repository, id int64) (io.ReadCloser, error) {
+	rc, redirectURL, err := cfg.Source.Instance.Repositories.DownloadReleaseAsset(cfg.runContext(), cfg.Source.Organization, *repo.Name, id)
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		return rc, nil
+	}
+
+	client := &http.Client{Transport: cfg.Source.Transport}
+	resp, err := client.Get(redirectURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status downloading the asset: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func copyAsset(cfg *migration, source, target *gh.Repository, releaseID int64, asset gh.ReleaseAsset) error {
+	ctx := cfg.runContext()
+
+	rc, err := downloadAsset(cfg, source, asset.GetID())
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	u := fmt.Sprintf("repos/%s/%s/releases/%d/assets?name=%s", cfg.Target.Organization, *target.Name, releaseID, url.QueryEscape(asset.GetName()))
+	if asset.GetLabel() != "" {
+		u += "&label=" + url.QueryEscape(asset.GetLabel())
+	}
+
+	req, err := cfg.Target.Instance.NewUploadRequest(u, rc, int64(asset.GetSize()), asset.GetContentType())
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.Target.Instance.Do(ctx, req, new(gh.ReleaseAsset))
+	return err
+}
+
+func migrateReleases(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	releases, err := listReleases(ctx, cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return err
+	}
+
+	// the releases of a previous run are updated, their assets not copied again
+	existing, err := listReleases(ctx, cfg.Target.Instance, cfg.Target.Organization, *target.Name)
+	if err != nil {
+		return err
+	}
+	tags := map[string]*gh.RepositoryRelease{}
+	for _, rel := range existing {
+		tags[rel.GetTagName()] = rel
+	}
+
+	l.WithField("amount", len(releases)).Info("migrating the releases...")
+
+	// releases are listed newest first, recreate them in the original order
+	for i := len(releases) - 1; i >= 0; i-- {
+		rel := releases[i]
+		release := &gh.RepositoryRelease{
+			TagName:         rel.TagName,
+			TargetCommitish: rel.TargetCommitish,
+			Name:            rel.Name,
+			Body:            rel.Body,
+			Draft:           rel.Draft,
+			Prerelease:      rel.Prerelease,
+		}
+
+		var n *gh.RepositoryRelease
+		assets := map[string]bool{}
+		if e, ok := tags[rel.GetTagName()]; ok {
+			n, _, err = cfg.Target.Instance.Repositories.EditRelease(ctx, cfg.Target.Organization, *target.Name, e.GetID(), release)
+			for _, a := range e.Assets {
+				assets[a.GetName()] = true
+			}
+		} else {
+			n, _, err = cfg.Target.Instance.Repositories.CreateRelease(ctx, cfg.Target.Organization, *target.Name, release)
+		}
+		if err != nil {
+			return fmt.Errorf("release %s: %v", rel.GetTagName(), err)
+		}
+
+		for _, a := range rel.Assets {
+			if assets[a.GetName()] {
+				continue
+			}
+			l.WithField("release", rel.GetTagName()).WithField("asset", a.GetName()).WithField("size", a.GetSize()).
+				Info("copying the release asset...")
+
+			if err := copyAsset(cfg, source, target, n.GetID(), a); err != nil {
+				return fmt.Errorf("release %s asset %s: %v", rel.GetTagName(), a.GetName(), err)
+			}
+		}
+
+		l.WithField("tag", rel.GetTagName()).WithField("assets", len(rel.Assets)).Info("a release was migrated successfully")
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github/githubtest"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMigrateReleasesRerun(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	m := newTestMigration(t, cfg)
+
+	asset := map[string]interface{}{"id": 7, "name": "api.tar.gz", "size": 3}
+	f.source.Handle("GET", "repos/acme/api/releases", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, []map[string]interface{}{
+			{"id": 2, "tag_name": "v2", "name": "v2"},
+			{"id": 1, "tag_name": "v1", "name": "v1", "assets": []interface{}{asset}},
+		})
+	})
+	// v1 and its asset were migrated by a previous run
+	f.target.Handle("GET", "repos/acme-new/api/releases", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, []map[string]interface{}{
+			{"id": 10, "tag_name": "v1", "name": "v1", "assets": []interface{}{asset}},
+		})
+	})
+	f.target.Handle("PATCH", "repos/acme-new/api/releases/10", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, map[string]interface{}{"id": 10, "tag_name": "v1"})
+	})
+	f.target.Handle("POST", "repos/acme-new/api/releases", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusCreated, map[string]interface{}{"id": 11, "tag_name": "v2"})
+	})
+
+	repo := &gh.Repository{Name: gh.String("api")}
+	if err := migrateReleases(m, repo, repo, log.WithField("repo", "api")); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := f.target.Requests("POST"); len(rr) != 1 || !strings.Contains(rr[0].Body, `"tag_name":"v2"`) {
+		t.Errorf("created releases = %v, want v2 only", rr)
+	}
+	if rr := f.target.Requests("PATCH"); len(rr) != 1 {
+		t.Errorf("%d releases updated, want 1", len(rr))
+	}
+	for _, r := range f.source.Requests("GET") {
+		if strings.Contains(r.Path, "assets") {
+			t.Errorf("the asset already on the target was downloaded again: %s", r.Path)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+import (
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+)
+
+// targetName is the name of a repository on the target: the one of its
+// override, the one given in rename.map or the source name with
+// rename.prefix and rename.suffix.
+func targetName(cfg *migration, name string) string {
+	if n := cfg.overrides[name].Name; n != "" {
+		return n
+	}
+	if n, ok := cfg.Rename.Map[name]; ok {
+		return n
+	}
+	return cfg.Rename.Prefix + name + cfg.Rename.Suffix
+}
+
+// checkTargetNames fails when two repositories would get the same name on
+// the target, before anything is created.
+func checkTargetNames(cfg *migration, repos []*gh.Repository) error {
+	names := map[string]string{}
+	for _, r := range repos {
+		n := targetName(cfg, *r.Name)
+		if other, ok := names[n]; ok {
+			return fmt.Errorf("the repositories %s and %s would both be named %s on the target", other, *r.Name, n)
+		}
+		names[n] = *r.Name
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultRetryDelay = 30 * time.Second
+
+// migrateWithRetry retries a failed repository with an exponential backoff,
+// the steps already completed are skipped when the state file is used.
+func migrateWithRetry(cfg *migration, repo *gh.Repository, l *log.Entry) error {
+	delay := cfg.Retry.Delay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = migrateRepo(cfg, repo, l)
+		if err == nil || err == errRepoSkipped || attempt >= cfg.Retry.Attempts || cfg.stopping() {
+			break
+		}
+
+		wait := delay << uint(attempt)
+		l.WithError(err).WithField("attempt", attempt+1).WithField("wait", wait.String()).
+			Warn("the repository failed, retrying...")
+		select {
+		case <-time.After(wait):
+		case <-cfg.stop:
+		case <-cfg.abort.aborted():
+		case <-cfg.runContext().Done():
+		}
+	}
+
+	if err == errRepoSkipped {
+		return err
+	}
+	if err != nil {
+		abortOn(cfg, *repo.Name, err)
+		if serr := cfg.State.Fail(*repo.Name, errors.New(cfg.redactor.redact(err.Error()))); serr != nil {
+			l.Error(serr)
+		}
+		return err
+	}
+	return cfg.State.Succeed(*repo.Name)
+}
+
+// failedRepos keeps the repositories that failed in a previous run, as
+// recorded by the state file or, without it, by a JSON report.
+func failedRepos(cfg *migration, repos []*gh.Repository) ([]*gh.Repository, error) {
+	failed := map[string]bool{}
+
+	switch {
+	case cfg.State != nil:
+		for name, s := range cfg.State.Repos {
+			if s.Error != "" {
+				failed[name] = true
+			}
+		}
+	case cfg.Report.Path != "" && report.Format(cfg.Report.Path, cfg.Report.Format) == "json":
+		content, err := ioutil.ReadFile(cfg.Report.Path)
+		if err != nil {
+			return nil, err
+		}
+		var results []*report.RepoResult
+		if err := json.Unmarshal(content, &results); err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			if r.Status == report.StatusFailed {
+				failed[r.Name] = true
+			}
+		}
+	default:
+		return nil, errors.New("retrying the failed repositories requires the state_file or a json report")
+	}
+
+	var res []*gh.Repository
+	for _, r := range repos {
+		if failed[*r.Name] {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
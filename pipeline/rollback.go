@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// runRollback undoes the migration recorded in the state file: the source
+// repositories archived by it are unarchived and, with --delete-targets,
+// the repositories it created on the target are deleted. The repositories
+// that already existed on the target are kept.
+func runRollback(cfg *migration, repos []*gh.Repository) error {
+	if cfg.DryRun {
+		return errors.New("the rollback command does not support the dry-run mode")
+	}
+	if cfg.State == nil {
+		return errors.New("the rollback command requires the state_file option")
+	}
+
+	failed := 0
+	for _, repo := range repos {
+		if cfg.stopping() {
+			break
+		}
+		name := *repo.Name
+		if _, ok := cfg.State.Repos[name]; !ok {
+			continue
+		}
+		l := log.WithField("repo", name)
+
+		if err := rollbackRepo(cfg, repo, l); err != nil {
+			l.Error(err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return partialError(failed, len(repos), "the rollback of %d repositories failed", failed)
+	}
+	return nil
+}
+
+func rollbackRepo(cfg *migration, repo *gh.Repository, l *log.Entry) error {
+	name := *repo.Name
+
+	if cfg.State.Done(name, stepArchive) {
+		if err := unarchiveRepo(cfg, repo, l); err != nil {
+			return fmt.Errorf("unarchiving the source: %v", err)
+		}
+		if err := cfg.State.Uncomplete(name, stepArchive); err != nil {
+			return err
+		}
+	}
+
+	if !cfg.deleteTargets || !cfg.State.Done(name, stepCreate) {
+		return nil
+	}
+	if cfg.State.Done(name, stepReused) {
+		l.Warn("the repository already existed on the target, not deleting it")
+		return nil
+	}
+
+	target := targetName(cfg, name)
+	l.WithField("target", target).Info("deleting the target repository...")
+	if err := cfg.Target.Provider.Delete(cfg.runContext(), target); err != nil {
+		return fmt.Errorf("deleting the target: %v", err)
+	}
+	return cfg.State.Forget(name)
+}
+
+func unarchiveRepo(cfg *migration, repo *gh.Repository, l *log.Entry) error {
+	if cfg.Source.Type != "" && cfg.Source.Type != config.SourceGitHub {
+		return errors.New("the source repositories can only be unarchived on GitHub")
+	}
+
+	l.WithField("name", *repo.Name).Info("unarchiving the repository...")
+
+	opts := &gh.Repository{
+		Archived: gh.Bool(false),
+	}
+	_, _, err := cfg.Source.Instance.Repositories.Edit(cfg.runContext(), cfg.Source.Organization, *repo.Name, opts)
+	return err
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// executeTargets runs the command for each of targets in turn, with the
+// repositories routed to it, the failure of one not preventing the next
+// ones.
+func executeTargets(ctx context.Context, cfg *config.Configuration, opts Options) error {
+	if opts.Schedule != "" {
+		return errors.New("--schedule is not supported with targets")
+	}
+	if opts.Serve != "" {
+		return &ConfigError{errors.New("--serve is not supported with targets")}
+	}
+
+	var errs []error
+	var failed []string
+	for _, r := range cfg.Targets {
+		select {
+		case <-opts.Stop:
+			return fmt.Errorf("interrupted before the target %s", r.Name)
+		default:
+		}
+
+		l := log.WithField("route", r.Name).WithField("target", r.Organization)
+		l.Info("processing the target...")
+		if err := Execute(ctx, cfg.ForRoute(r), opts); err != nil {
+			l.WithError(err).Error("the target failed")
+			errs, failed = append(errs, err), append(failed, r.Name)
+		}
+	}
+	return combineErrors(errs, failed, len(cfg.Targets), "targets")
+}
+
+// routeOf returns the name of the target the repository is routed to: the
+// one of its override, else the first of targets matching its name or one
+// of its topics, else the default one. No name leaves it out of the run.
+func routeOf(cfg *migration, repo *gh.Repository) (string, error) {
+	if t := cfg.overrides[*repo.Name].Target; t != "" {
+		return t, nil
+	}
+
+	def := ""
+	for _, r := range cfg.Targets {
+		include, err := config.CompilePatterns(r.Include)
+		if err != nil {
+			return "", err
+		}
+		if matchAny(include, *repo.Name) {
+			return r.Name, nil
+		}
+		for _, t := range repo.Topics {
+			if contains(r.Topics, t) {
+				return r.Name, nil
+			}
+		}
+		if r.Default {
+			def = r.Name
+		}
+	}
+	return def, nil
+}
+
+// routeRepos keeps the repositories routed to the target of the run.
+func routeRepos(cfg *migration, repos []*gh.Repository) ([]*gh.Repository, error) {
+	var routed []*gh.Repository
+	for _, repo := range repos {
+		route, err := routeOf(cfg, repo)
+		if err != nil {
+			return nil, err
+		}
+		switch route {
+		case cfg.Route:
+			routed = append(routed, repo)
+		case "":
+			log.WithField("repo", *repo.Name).Debug("the repository is routed to no target, skipping")
+		}
+	}
+	return routed, nil
+}
@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// the rulesets api is not covered by go-github
+type ruleset struct {
+	ID           int64           `json:"id,omitempty"`
+	Name         string          `json:"name"`
+	Target       string          `json:"target,omitempty"`
+	Enforcement  string          `json:"enforcement"`
+	Conditions   json.RawMessage `json:"conditions,omitempty"`
+	BypassActors []bypassActor   `json:"bypass_actors"`
+	Rules        []rulesetRule   `json:"rules"`
+}
+
+type bypassActor struct {
+	ActorID    int64  `json:"actor_id"`
+	ActorType  string `json:"actor_type"`
+	BypassMode string `json:"bypass_mode"`
+}
+
+type rulesetRule struct {
+	Type       string                 `json:"type"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// listRulesets lists the rulesets of the repository itself, not the ones
+// inherited from its organization.
+func listRulesets(cfg *migration, client *gh.Client, owner, repo string) ([]ruleset, error) {
+	var rulesets []ruleset
+	for page := 1; ; page++ {
+		var list []ruleset
+		resp, err := github.Request(cfg.runContext(), client, "GET", fmt.Sprintf("repos/%s/%s/rulesets?includes_parents=false&per_page=100&page=%d", owner, repo, page), "", nil, &list)
+		if err != nil {
+			return nil, err
+		}
+		rulesets = append(rulesets, list...)
+		if resp.NextPage == 0 {
+			return rulesets, nil
+		}
+	}
+}
+
+// mapStatusCheck maps a status check context through
+// migrate.status_check_map, the contexts being named after the ci system.
+func mapStatusCheck(cfg *migration, context string) string {
+	if c, ok := cfg.Migrate.StatusCheckMap[context]; ok {
+		return c
+	}
+	return context
+}
+
+// rulesetRequest maps the ruleset of the source to the target: the status
+// checks through migrate.status_check_map, the teams allowed to bypass it
+// through team_map. The apps and the workflows of the source are known by
+// ids that do not exist on the target, they are dropped.
+func rulesetRequest(cfg *migration, rs ruleset, l *log.Entry) ruleset {
+	ctx := cfg.runContext()
+	l = l.WithField("ruleset", rs.Name)
+	req := ruleset{Name: rs.Name, Target: rs.Target, Enforcement: rs.Enforcement, Conditions: rs.Conditions, BypassActors: []bypassActor{}, Rules: []rulesetRule{}}
+
+	for _, a := range rs.BypassActors {
+		switch a.ActorType {
+		case "Team":
+			team, _, err := cfg.Source.Instance.Teams.GetTeam(ctx, a.ActorID)
+			if err != nil {
+				l.WithField("team", a.ActorID).WithError(err).Warn("the bypass team was not found on the source, skipping")
+				continue
+			}
+			slug := mapTeam(cfg, team.GetSlug())
+			t := &gh.Team{}
+			if _, err := github.Request(ctx, cfg.Target.Instance, "GET", fmt.Sprintf("orgs/%s/teams/%s", cfg.Target.Organization, slug), "", nil, t); err != nil {
+				l.WithField("team", slug).Warn("the bypass team was not found on the target, skipping")
+				continue
+			}
+			a.ActorID = t.GetID()
+		case "OrganizationAdmin", "RepositoryRole":
+		default:
+			l.WithField("actor_type", a.ActorType).WithField("actor_id", a.ActorID).Warn("the bypass actor cannot be mapped to the target, skipping")
+			continue
+		}
+		req.BypassActors = append(req.BypassActors, a)
+	}
+
+	for _, r := range rs.Rules {
+		switch r.Type {
+		case "workflows":
+			l.WithField("rule", r.Type).Warn("the rule refers to the workflows of source repositories, skipping")
+			continue
+		case "required_status_checks":
+			checks, _ := r.Parameters["required_status_checks"].([]interface{})
+			for _, c := range checks {
+				if check, ok := c.(map[string]interface{}); ok {
+					if context, ok := check["context"].(string); ok {
+						check["context"] = mapStatusCheck(cfg, context)
+					}
+					delete(check, "integration_id")
+				}
+			}
+		}
+		req.Rules = append(req.Rules, r)
+	}
+
+	return req
+}
+
+// migrateRulesets creates the rulesets of the source repository on the
+// target, updating the ones of the same name left by a previous run.
+func migrateRulesets(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	list, err := listRulesets(cfg, cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return err
+	}
+	existing, err := listRulesets(cfg, cfg.Target.Instance, cfg.Target.Organization, *target.Name)
+	if err != nil {
+		return err
+	}
+	ids := map[string]int64{}
+	for _, rs := range existing {
+		ids[rs.Name] = rs.ID
+	}
+
+	l.WithField("amount", len(list)).Info("migrating the rulesets...")
+
+	for _, item := range list {
+		// the listing does not include the rules
+		rs := ruleset{}
+		_, err := github.Request(ctx, cfg.Source.Instance, "GET", fmt.Sprintf("repos/%s/%s/rulesets/%d", cfg.Source.Organization, *source.Name, item.ID), "", nil, &rs)
+		if err != nil {
+			return fmt.Errorf("ruleset %s: %v", item.Name, err)
+		}
+
+		req := rulesetRequest(cfg, rs, l)
+		method, URL := "POST", fmt.Sprintf("repos/%s/%s/rulesets", cfg.Target.Organization, *target.Name)
+		if id, ok := ids[rs.Name]; ok {
+			method, URL = "PUT", fmt.Sprintf("%s/%d", URL, id)
+		}
+		if _, err := github.Request(ctx, cfg.Target.Instance, method, URL, "", req, nil); err != nil {
+			return fmt.Errorf("ruleset %s: %v", rs.Name, err)
+		}
+
+		l.WithField("ruleset", rs.Name).WithField("rules", len(req.Rules)).Info("a ruleset was migrated successfully")
+	}
+
+	return nil
+}
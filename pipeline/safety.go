@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// The destructive operations guarded by safety.
+const (
+	opForcePush = "force-push"
+	opDelete    = "delete"
+	opRecreate  = "recreate"
+	opArchive   = "archive"
+	opLockdown  = "lockdown"
+	opTombstone = "tombstone"
+)
+
+// destructiveOps lists the destructive operations the command would run
+// with the configuration.
+func destructiveOps(cfg *migration, command string) []string {
+	var ops []string
+	add := func(enabled bool, op string) {
+		if enabled {
+			ops = append(ops, op)
+		}
+	}
+	switch command {
+	case "migrate":
+		add(cfg.Target.OnExists == config.OnExistsPush, opForcePush)
+		add(cfg.Target.OnExists == config.OnExistsRecreate, opRecreate)
+		add(cfg.Source.Lockdown.Enabled(), opLockdown)
+		add(cfg.Source.Tombstone.Enabled(), opTombstone)
+		add(cfg.Source.Archive, opArchive)
+	case "sync":
+		add(cfg.Sync.Force, opForcePush)
+	case "archive":
+		add(true, opArchive)
+	case "notice":
+		add(cfg.subcommand == "" && cfg.Source.Lockdown.Enabled(), opLockdown)
+		add(cfg.subcommand == "" && cfg.Source.Tombstone.Enabled(), opTombstone)
+		add(cfg.subcommand == "" && cfg.Source.Archive, opArchive)
+	case "rollback":
+		add(cfg.deleteTargets, opDelete)
+	case "unmigrate":
+		add(true, opDelete)
+	}
+	return ops
+}
+
+// repoOwner is the organization or the user of the source repositories.
+func repoOwner(cfg *migration) string {
+	if cfg.Source.User != "" {
+		return cfg.Source.User
+	}
+	return cfg.Source.Organization
+}
+
+// confirmationToken identifies the destructive operations of a command on
+// the repositories, so a token confirms them until any of them changes.
+func confirmationToken(cfg *migration, command string, ops []string, repos []*gh.Repository) string {
+	names := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		names = append(names, *repo.Name)
+	}
+	sort.Strings(names)
+	h := sha256.Sum256([]byte(strings.Join([]string{
+		command, repoOwner(cfg), cfg.Target.Organization, strings.Join(ops, ","), strings.Join(names, ","),
+	}, "\n")))
+	return fmt.Sprintf("%x", h[:4])
+}
+
+// checkDestructive stops a command whose destructive operations were not
+// asked for with safety.confirm_destructive, then the repositories
+// safety.allow does not match or, without safety.allow, the run not
+// confirmed by --confirm or by typing the token in a terminal. The
+// unmigrate command asks for its own confirmation, unless --force.
+func checkDestructive(cfg *migration, command string, repos []*gh.Repository, canPrompt bool) error {
+	ops := destructiveOps(cfg, command)
+	if len(ops) == 0 || len(repos) == 0 || cfg.DryRun {
+		return nil
+	}
+	what := strings.Join(ops, ", ")
+	if !cfg.Safety.ConfirmDestructive {
+		return &ConfigError{fmt.Errorf("the %s command would run destructive operations (%s), set safety.confirm_destructive to allow them", command, what)}
+	}
+
+	if len(cfg.Safety.Allow) > 0 {
+		patterns, err := config.CompilePatterns(cfg.Safety.Allow)
+		if err != nil {
+			return &ConfigError{fmt.Errorf("safety.allow: %v", err)}
+		}
+		var denied []string
+		for _, repo := range repos {
+			if name := repoOwner(cfg) + "/" + *repo.Name; !matchAny(patterns, name) {
+				denied = append(denied, name)
+			}
+		}
+		if len(denied) > 0 {
+			return &ConfigError{fmt.Errorf("safety.allow does not match %d repositories the destructive operations (%s) would run on: %s",
+				len(denied), what, strings.Join(denied, ", "))}
+		}
+		return nil
+	}
+
+	if command == "unmigrate" && !cfg.force {
+		return nil
+	}
+	token := confirmationToken(cfg, command, ops, repos)
+	if cfg.confirm == token {
+		log.WithField("operations", what).WithField("repositories", len(repos)).Info("the destructive operations were confirmed")
+		return nil
+	}
+	if cfg.confirm != "" {
+		return &ConfigError{fmt.Errorf("--confirm %s does not match the destructive operations (%s) on the %d repositories, whose token is %s",
+			cfg.confirm, what, len(repos), token)}
+	}
+	if !canPrompt || !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return &ConfigError{fmt.Errorf("the destructive operations (%s) on the %d repositories require safety.allow, a terminal or --confirm %s",
+			what, len(repos), token)}
+	}
+
+	w := os.Stdout
+	fmt.Fprintf(w, "\nthe %s command will run %s on %d repositories of %s:\n\n", command, what, len(repos), repoOwner(cfg))
+	for i, repo := range repos {
+		fmt.Fprintf(w, "  %3d. %s\n", i+1, repo.GetName())
+	}
+	fmt.Fprintln(w)
+	answer, err := prompt(bufio.NewReader(os.Stdin), w, fmt.Sprintf("type %s to continue: ", token))
+	if err != nil {
+		return err
+	}
+	if answer != token {
+		return errAborted
+	}
+	return nil
+}
+
+// planDestructive logs the destructive operations of the plan, with the
+// token confirming them when safety.allow is empty.
+func planDestructive(cfg *migration, repos []*gh.Repository) {
+	ops := destructiveOps(cfg, "migrate")
+	if len(ops) == 0 {
+		return
+	}
+	l := log.WithField("operations", strings.Join(ops, ", "))
+	switch {
+	case !cfg.Safety.ConfirmDestructive:
+		l.Warn("[plan] the destructive operations would require safety.confirm_destructive")
+	case len(cfg.Safety.Allow) == 0:
+		l.WithField("token", confirmationToken(cfg, "migrate", ops, repos)).Info("[plan] the destructive operations would be confirmed by --confirm")
+	}
+}
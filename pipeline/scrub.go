@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/leocomelli/ghmgr/config"
+)
+
+const scrubbed = "[scrubbed]"
+
+// emailAddress matches the email addresses, the noreply ones included
+var emailAddress = regexp.MustCompile(`[\w.%+-]+@[\w-]+(?:\.[\w-]+)+`)
+
+// scrubRule replaces the matches of re, with the groups of the pattern
+// expanded in replacement.
+type scrubRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// scrubber redacts the content of migrate.scrub from the titles and bodies
+// posted on the target.
+type scrubber struct {
+	rules []scrubRule
+}
+
+// newScrubber compiles migrate.scrub, nil when it is disabled.
+func newScrubber(s config.Scrub) (*scrubber, error) {
+	if !s.Enabled() {
+		return nil, nil
+	}
+	replacement := s.Replacement
+	if replacement == "" {
+		replacement = scrubbed
+	}
+	literal := strings.Replace(replacement, "$", "$$", -1)
+
+	sc := &scrubber{}
+	// the addresses first, so their domains do not leave the user behind
+	if s.Emails {
+		sc.rules = append(sc.rules, scrubRule{emailAddress, literal})
+	}
+	for _, h := range s.Hostnames {
+		// the host and its subdomains, not the hosts merely ending alike
+		re, err := regexp.Compile(`(?i)(^|[^\w.-])(?:[\w-]+\.)*` + regexp.QuoteMeta(strings.Trim(h, ".")) + `\b`)
+		if err != nil {
+			return nil, err
+		}
+		sc.rules = append(sc.rules, scrubRule{re, "${1}" + literal})
+	}
+	for _, p := range s.Patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		r := scrubRule{re, literal}
+		if p.Replacement != "" {
+			r.replacement = p.Replacement
+		}
+		sc.rules = append(sc.rules, r)
+	}
+	return sc, nil
+}
+
+func (sc *scrubber) scrub(s string) string {
+	if sc == nil {
+		return s
+	}
+	for _, r := range sc.rules {
+		s = r.re.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
@@ -0,0 +1,178 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/ssh/terminal"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// secretPlaceholder is the value of the secrets missing from the secrets
+// file, so that the workflows fail on a wrong value instead of silently
+// running without the secret.
+const secretPlaceholder = "to be replaced after the migration"
+
+// secretValues maps a source repository name, or * for every repository,
+// to the values of its secrets.
+type secretValues map[string]map[string]string
+
+var promptMutex sync.Mutex
+
+type secretList struct {
+	Secrets []struct {
+		Name string `json:"name"`
+	} `json:"secrets"`
+}
+
+type publicKey struct {
+	KeyID string `json:"key_id"`
+	Key   string `json:"key"`
+}
+
+func loadSecrets(file string) (secretValues, error) {
+	values := secretValues{}
+	if file == "" {
+		return values, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return values, yaml.Unmarshal(content, &values)
+}
+
+func (v secretValues) lookup(repo, name string) (string, bool) {
+	if value, ok := v[repo][name]; ok {
+		return value, true
+	}
+	value, ok := v["*"][name]
+	return value, ok
+}
+
+func listSecrets(ctx context.Context, client *gh.Client, owner, repo string) ([]string, error) {
+	var names []string
+	for page := 1; ; page++ {
+		list := &secretList{}
+		resp, err := github.Request(ctx, client, "GET", fmt.Sprintf("repos/%s/%s/actions/secrets?per_page=100&page=%d", owner, repo, page), "", nil, list)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range list.Secrets {
+			names = append(names, s.Name)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+	return names, nil
+}
+
+// sealSecret encrypts value for the public key of the repository, as the
+// sealed boxes of libsodium.
+func sealSecret(key publicKey, value string) (string, error) {
+	k, err := base64.StdEncoding.DecodeString(key.Key)
+	if err != nil || len(k) != 32 {
+		return "", fmt.Errorf("invalid public key %s", key.KeyID)
+	}
+	var recipient [32]byte
+	copy(recipient[:], k)
+
+	public, private, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	h, err := blake2b.New(24, nil)
+	if err != nil {
+		return "", err
+	}
+	h.Write(public[:])
+	h.Write(recipient[:])
+	var nonce [24]byte
+	copy(nonce[:], h.Sum(nil))
+
+	sealed := box.Seal(public[:], []byte(value), &nonce, &recipient, private)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func promptSecret(repo, name string) (string, error) {
+	promptMutex.Lock()
+	defer promptMutex.Unlock()
+
+	fmt.Fprintf(os.Stderr, "value of the secret %s of %s (empty for a placeholder): ", name, repo)
+	value, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(value), err
+}
+
+// migrateSecrets creates the actions secrets of the source on the target,
+// the api never returns the values so they come from migrate.secrets_file,
+// from the terminal with migrate.secrets_prompt or are a placeholder.
+func migrateSecrets(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	names, err := listSecrets(cfg.runContext(), cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return err
+	}
+	existing, err := listSecrets(cfg.runContext(), cfg.Target.Instance, cfg.Target.Organization, *target.Name)
+	if err != nil {
+		return err
+	}
+	exists := map[string]bool{}
+	for _, n := range existing {
+		exists[n] = true
+	}
+
+	key := publicKey{}
+	if _, err := github.Request(cfg.runContext(), cfg.Target.Instance, "GET", fmt.Sprintf("repos/%s/%s/actions/secrets/public-key", cfg.Target.Organization, *target.Name), "", nil, &key); err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(names)).Info("migrating the secrets...")
+
+	prompt := cfg.Migrate.SecretsPrompt && terminal.IsTerminal(int(os.Stdin.Fd()))
+	for _, name := range names {
+		value, ok := cfg.secrets.lookup(*source.Name, name)
+		if !ok && prompt {
+			if value, err = promptSecret(*source.Name, name); err != nil {
+				return err
+			}
+			ok = value != ""
+		}
+		if !ok {
+			if exists[name] {
+				l.WithField("secret", name).Info("the secret already exists on the target, skipping")
+				continue
+			}
+			value = secretPlaceholder
+		}
+
+		encrypted, err := sealSecret(key, value)
+		if err != nil {
+			return err
+		}
+		_, err = github.Request(cfg.runContext(), cfg.Target.Instance, "PUT", fmt.Sprintf("repos/%s/%s/actions/secrets/%s", cfg.Target.Organization, *target.Name, name), "",
+			map[string]string{"encrypted_value": encrypted, "key_id": key.KeyID}, nil)
+		if err != nil {
+			return fmt.Errorf("secret %s: %v", name, err)
+		}
+
+		if !ok {
+			l.WithField("secret", name).Warn("the secret was created with a placeholder, its value must be set on the target")
+			continue
+		}
+		l.WithField("secret", name).Info("a secret was migrated successfully")
+	}
+
+	return nil
+}
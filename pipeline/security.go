@@ -0,0 +1,200 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// the locations of the Dependabot configuration, GitHub reads the first one
+var dependabotPaths = []string{".github/dependabot.yml", ".github/dependabot.yaml"}
+
+// codeqlAction is the action the code scanning workflows use.
+const codeqlAction = "github/codeql-action/"
+
+// analysisFeatures are the features of security_and_analysis copied, in
+// the order they must be enabled: secret scanning needs advanced security
+// on the private repositories, and the push protection secret scanning.
+var analysisFeatures = []string{"advanced_security", "secret_scanning", "secret_scanning_push_protection"}
+
+// the features of the report that are not a file
+const (
+	featureSecurityUpdates = "automated_security_fixes"
+	featureDefaultSetup    = "code_scanning_default_setup"
+)
+
+// securityAnalysis is the security_and_analysis field of a repository,
+// which go-github does not know yet, the status being enabled or disabled.
+type securityAnalysis struct {
+	SecurityAndAnalysis map[string]struct {
+		Status string `json:"status"`
+	} `json:"security_and_analysis"`
+}
+
+// defaultSetup is the code scanning default setup of a repository.
+type defaultSetup struct {
+	State      string `json:"state"`
+	QuerySuite string `json:"query_suite,omitempty"`
+}
+
+// migrateSecurity enables on the target the Dependabot security updates,
+// the security and analysis features and the code scanning default setup
+// enabled on the source, then commits the Dependabot configuration and the
+// code scanning workflows of the source missing on the target default
+// branch. A feature the target refuses, e.g. for lack of a license, is
+// logged and reported instead of failing the repository.
+func migrateSecurity(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	src, tgt := cfg.Source, cfg.Target
+
+	l.Info("migrating the security features...")
+
+	failed := func(feature string, err error) {
+		cfg.Results.SecurityFailure(*source.Name, feature)
+		l.WithField("feature", feature).WithError(err).Warn("the security feature could not be enabled on the target")
+	}
+
+	// the security updates require the vulnerability alerts, enabled by the settings step
+	resp, err := github.Request(ctx, src.Instance, "GET", fmt.Sprintf("repos/%s/%s/automated-security-fixes", src.Organization, *source.Name), "", nil, nil)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("security updates: %v", err)
+	}
+	if err == nil {
+		if _, err := github.Request(ctx, tgt.Instance, "PUT", fmt.Sprintf("repos/%s/%s/automated-security-fixes", tgt.Organization, *target.Name), "", nil, nil); err != nil {
+			failed(featureSecurityUpdates, err)
+		}
+	}
+
+	analysis := &securityAnalysis{}
+	if _, err := github.Request(ctx, src.Instance, "GET", fmt.Sprintf("repos/%s/%s", src.Organization, *source.Name), "", nil, analysis); err != nil {
+		return fmt.Errorf("security and analysis: %v", err)
+	}
+	for _, feature := range analysisFeatures {
+		if analysis.SecurityAndAnalysis[feature].Status != "enabled" {
+			continue
+		}
+		body := map[string]interface{}{"security_and_analysis": map[string]interface{}{feature: map[string]string{"status": "enabled"}}}
+		if _, err := github.Request(ctx, tgt.Instance, "PATCH", fmt.Sprintf("repos/%s/%s", tgt.Organization, *target.Name), "", body, nil); err != nil {
+			failed(feature, err)
+		}
+	}
+
+	setup := &defaultSetup{}
+	resp, err = github.Request(ctx, src.Instance, "GET", fmt.Sprintf("repos/%s/%s/code-scanning/default-setup", src.Organization, *source.Name), "", nil, setup)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("code scanning default setup: %v", err)
+	}
+	if err == nil && setup.State == "configured" {
+		// the languages are detected again from the content of the target
+		if _, err := github.Request(ctx, tgt.Instance, "PATCH", fmt.Sprintf("repos/%s/%s/code-scanning/default-setup", tgt.Organization, *target.Name), "", setup, nil); err != nil {
+			failed(featureDefaultSetup, err)
+		}
+	}
+
+	files, err := securityFiles(cfg, source)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		// the default branch is only known once pushed
+		if target, err = tgt.Provider.Get(ctx, *target.Name); err != nil {
+			return err
+		}
+		if err := ensureSecurityFiles(cfg, source, target, files, failed, l); err != nil {
+			return err
+		}
+	}
+
+	l.Info("the security features were migrated successfully")
+	return nil
+}
+
+// securityFiles returns the Dependabot configuration and the workflows
+// using the CodeQL action of the source default branch.
+func securityFiles(cfg *migration, source *gh.Repository) ([]*gh.RepositoryContent, error) {
+	ctx := cfg.runContext()
+	repos := cfg.Source.Instance.Repositories
+	owner := cfg.Source.Organization
+	opts := &gh.RepositoryContentGetOptions{Ref: source.GetDefaultBranch()}
+	var files []*gh.RepositoryContent
+
+	for _, file := range dependabotPaths {
+		c, _, resp, err := repos.GetContents(ctx, owner, *source.Name, file, opts)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if c != nil {
+			files = append(files, c)
+			break
+		}
+	}
+
+	_, dir, resp, err := repos.GetContents(ctx, owner, *source.Name, workflowsPath, opts)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return files, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", workflowsPath, err)
+	}
+	for _, f := range dir {
+		if f.GetType() != "file" || (path.Ext(f.GetName()) != ".yml" && path.Ext(f.GetName()) != ".yaml") {
+			continue
+		}
+		c, _, _, err := repos.GetContents(ctx, owner, *source.Name, f.GetPath(), opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.GetPath(), err)
+		}
+		content, err := c.GetContent()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.GetPath(), err)
+		}
+		if strings.Contains(content, codeqlAction) {
+			files = append(files, c)
+		}
+	}
+	return files, nil
+}
+
+// ensureSecurityFiles commits the files missing on the target default
+// branch, e.g. left out by git.filter, as they are on the source.
+func ensureSecurityFiles(cfg *migration, source, target *gh.Repository, files []*gh.RepositoryContent, failed func(string, error), l *log.Entry) error {
+	ctx := cfg.runContext()
+	tgt := cfg.Target
+	opts := &gh.RepositoryContentGetOptions{Ref: target.GetDefaultBranch()}
+
+	for _, c := range files {
+		file := c.GetPath()
+		_, _, resp, err := tgt.Instance.Repositories.GetContents(ctx, tgt.Organization, *target.Name, file, opts)
+		if err == nil {
+			continue
+		}
+		if resp == nil || resp.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+
+		content, err := c.GetContent()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		message, err := commitMessage(cfg, config.CommitSecurity, []string{file}, source, target)
+		if err != nil {
+			return err
+		}
+		options := fileOptions(cfg, message, []byte(content), "", target.GetDefaultBranch())
+		if err := commitFile(cfg, tgt.Instance, tgt.Organization, *target.Name, file, options); err != nil {
+			failed(file, err)
+			continue
+		}
+		l.WithField("filename", file).Info("a security file missing on the target was committed successfully")
+	}
+	return nil
+}
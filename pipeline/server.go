@@ -0,0 +1,313 @@
+package pipeline
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+)
+
+// the statuses of the migrations of the server
+const (
+	migrationQueued    = "queued"
+	migrationRunning   = "running"
+	migrationSucceeded = "succeeded"
+	migrationFailed    = "failed"
+)
+
+// serverQueueSize is the number of migrations waiting for their turn.
+const serverQueueSize = 100
+
+// serverMigration is a migration asked for to the server, along with its
+// progress once started.
+type serverMigration struct {
+	ID           string            `json:"id"`
+	Repositories []string          `json:"repositories"`
+	Status       string            `json:"status"`
+	Error        string            `json:"error,omitempty"`
+	Attempts     int               `json:"attempts"`
+	Created      time.Time         `json:"created"`
+	Updated      time.Time         `json:"updated"`
+	Progress     *progressSnapshot `json:"progress,omitempty"`
+
+	// repos are the repositories of the next attempt, the failed ones on
+	// a retry
+	repos    []string
+	progress *Progress
+}
+
+// server runs the migrations asked for through its rest api one at a
+// time, each listing its repositories among the ones of the source filters.
+type server struct {
+	cfg  *migration
+	jobs chan *serverMigration
+
+	mu         sync.Mutex
+	migrations map[string]*serverMigration
+}
+
+// runServer serves the rest api of the server command until SIGTERM or
+// SIGINT, which stop it after the repositories in progress.
+func runServer(cfg *migration, addr string) error {
+	s := &server{
+		cfg:        cfg,
+		jobs:       make(chan *serverMigration, serverQueueSize),
+		migrations: map[string]*serverMigration{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/migrations", s.create)
+	mux.HandleFunc("/migrations/", s.migration)
+	srv := &http.Server{Addr: addr, Handler: s.authorize(mux)}
+
+	go func() {
+		log.WithField("addr", addr).Info("serving the api")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("the api stopped")
+		}
+	}()
+
+	for {
+		select {
+		case m := <-s.jobs:
+			s.run(m)
+		case <-cfg.stop:
+			log.Info("stopped")
+			return srv.Close()
+		case <-cfg.runContext().Done():
+			log.Info("stopped")
+			return srv.Close()
+		}
+	}
+}
+
+// authorize refuses the requests of the pages of other sites and, without
+// the bearer server.token, the ones of other hosts.
+func (s *server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := requestAllowed(s.cfg.Server.Token, r); status != 0 {
+			http.Error(w, "the requests need server.token, or a request of this host", status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// create handles POST /migrations, queuing the migration of the
+// repositories of the body, e.g. {"repositories": ["repo1", "repo2"]}.
+func (s *server) create(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		http.Error(w, "the body must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	var req struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Repositories) == 0 {
+		http.Error(w, "repositories is required", http.StatusBadRequest)
+		return
+	}
+
+	id, err := randomID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	m := &serverMigration{ID: id, Repositories: req.Repositories, Created: now, Updated: now, repos: req.Repositories}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.queue(m); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	s.migrations[id] = m
+	log.WithField("migration", id).WithField("repositories", len(m.repos)).Info("a migration was queued")
+	s.write(w, http.StatusAccepted, m)
+}
+
+// migration handles GET /migrations/{id} and POST /migrations/{id}/retry.
+func (s *server) migration(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/migrations/")
+	id, action := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		id, action = rest[:i], rest[i+1:]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.migrations[id]
+	if !ok || action != "" && action != "retry" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.write(w, http.StatusOK, m)
+	case action == "retry" && r.Method == http.MethodPost:
+		if err := s.retry(m); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.WithField("migration", id).WithField("repositories", len(m.repos)).Info("the failed repositories of a migration were queued again")
+		s.write(w, http.StatusAccepted, m)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// retry queues the failed repositories of a finished migration again.
+func (s *server) retry(m *serverMigration) error {
+	if m.Status == migrationQueued || m.Status == migrationRunning {
+		return fmt.Errorf("the migration is %s", m.Status)
+	}
+
+	var failed []string
+	for _, name := range m.repos {
+		if m.progress.Status(name) == report.StatusFailed {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) == 0 && m.progress != nil {
+		return errors.New("none of the repositories of the migration failed")
+	}
+	if len(failed) == 0 {
+		// the migration failed before processing the repositories
+		failed = m.repos
+	}
+
+	repos := m.repos
+	m.repos = failed
+	if err := s.queue(m); err != nil {
+		m.repos = repos
+		return err
+	}
+	return nil
+}
+
+// queue adds the migration to the queue, with s.mu held.
+func (s *server) queue(m *serverMigration) error {
+	select {
+	case s.jobs <- m:
+	default:
+		return fmt.Errorf("%d migrations are already queued", serverQueueSize)
+	}
+	m.Status, m.Error, m.Updated = migrationQueued, "", time.Now()
+	return nil
+}
+
+// run migrates the repositories of the migration with a run of its own,
+// reading the state file again, so the steps completed before are skipped.
+func (s *server) run(m *serverMigration) {
+	s.mu.Lock()
+	m.Status, m.Updated = migrationRunning, time.Now()
+	m.Attempts++
+	m.progress = nil
+	repos, attempt := m.repos, m.Attempts
+	s.mu.Unlock()
+
+	l := log.WithField("migration", m.ID)
+	l.WithField("attempt", attempt).Info("starting the migration")
+	err := s.migrate(m, repos)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.Status, m.Updated = migrationSucceeded, time.Now()
+	if err == nil && m.progress != nil {
+		if failed := m.progress.snapshot(s.cfg.redactor.redact).Failed; failed > 0 {
+			err = fmt.Errorf("%d of %d repositories failed", failed, len(repos))
+		}
+	}
+	if err != nil {
+		m.Status, m.Error = migrationFailed, s.cfg.redactor.redact(err.Error())
+		l.WithError(err).Error("the migration failed")
+		return
+	}
+	l.Info("the migration succeeded")
+}
+
+func (s *server) migrate(m *serverMigration, names []string) error {
+	// the repositories asked for must pass the source filters, the limit
+	// of the command line runs aside
+	c := *s.cfg.Configuration
+	c.Source.Limit = 0
+	run, err := newMigration(s.cfg.ctx, &c, s.cfg.stop)
+	if err != nil {
+		return err
+	}
+	run.events = s.cfg.events
+	run.audit = s.cfg.audit
+	run.watchProgress = func(p *Progress) {
+		s.mu.Lock()
+		m.progress = p
+		s.mu.Unlock()
+	}
+
+	selected, err := findRepositories(run)
+	if err != nil {
+		return err
+	}
+	var repos []*gh.Repository
+	found := map[string]bool{}
+	for _, repo := range selected {
+		if contains(names, *repo.Name) {
+			repos = append(repos, repo)
+			found[*repo.Name] = true
+		}
+	}
+	var rejected []string
+	for _, name := range names {
+		if !found[name] {
+			rejected = append(rejected, name)
+		}
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("repositories rejected, not among the ones of the source filters: %s", strings.Join(rejected, ", "))
+	}
+	if err := checkDestructive(run, "migrate", repos, false); err != nil {
+		return err
+	}
+
+	return withLock(run, "migrate", func() error { return runMigrate(run, repos) })
+}
+
+// write encodes the migration along with its progress, with s.mu held.
+func (s *server) write(w http.ResponseWriter, status int, m *serverMigration) {
+	res := *m
+	if m.progress != nil {
+		snapshot := m.progress.snapshot(s.cfg.redactor.redact)
+		res.Progress = &snapshot
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// randomID identifies a migration of the server or an attempt of a
+// repository.
+func randomID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
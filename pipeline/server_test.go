@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/leocomelli/ghmgr/config"
+)
+
+func TestServerMigrateFilters(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	cfg.Source.Exclude = []string{"^api$"}
+	s := &server{cfg: newTestMigration(t, cfg)}
+
+	err := s.migrate(&serverMigration{}, []string{"api", "web"})
+	if err == nil || !strings.Contains(err.Error(), "rejected") || !strings.Contains(err.Error(), "api") {
+		t.Fatalf("excluded repository: %v, want api rejected", err)
+	}
+	if got := f.target.Repos(targetOrg); len(got) != 0 {
+		t.Fatalf("target repositories = %v, want none", got)
+	}
+
+	// the limit of the command line does not hide web, after api
+	cfg.Source.Exclude = nil
+	cfg.Source.Limit = 1
+	s = &server{cfg: newTestMigration(t, cfg)}
+	if err := s.migrate(&serverMigration{}, []string{"web"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.target.Repos(targetOrg), []string{"web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("target repositories = %v, want %v", got, want)
+	}
+}
+
+func TestServerAuthorization(t *testing.T) {
+	tests := []struct {
+		token, remote, origin, authorization, contentType string
+		status                                            int
+	}{
+		// without server.token, only this host queues migrations
+		{"", "127.0.0.1:1234", "", "", "application/json", http.StatusAccepted},
+		{"", "192.0.2.1:1234", "", "", "application/json", http.StatusForbidden},
+		{"s3cr3t", "192.0.2.1:1234", "", "Bearer wrong", "application/json", http.StatusUnauthorized},
+		{"s3cr3t", "192.0.2.1:1234", "", "Bearer s3cr3t", "application/json", http.StatusAccepted},
+		// the pages of the other sites never do, nor the bodies of a form
+		{"", "127.0.0.1:1234", "http://evil.example", "", "application/json", http.StatusForbidden},
+		{"", "127.0.0.1:1234", "", "", "text/plain", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		c := &config.Configuration{}
+		c.Server.Token = tt.token
+		s := &server{
+			cfg:        &migration{Configuration: c},
+			jobs:       make(chan *serverMigration, 1),
+			migrations: map[string]*serverMigration{},
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/migrations", strings.NewReader(`{"repositories": ["api"]}`))
+		r.RemoteAddr = tt.remote
+		r.Header.Set("Content-Type", tt.contentType)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		s.authorize(http.HandlerFunc(s.create)).ServeHTTP(w, r)
+
+		if w.Code != tt.status || (len(s.jobs) == 1) != (tt.status == http.StatusAccepted) {
+			t.Errorf("token %q, from %s, origin %q, %q, %s: status %d, queued %d, want %d",
+				tt.token, tt.remote, tt.origin, tt.authorization, tt.contentType, w.Code, len(s.jobs), tt.status)
+		}
+	}
+}
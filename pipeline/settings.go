@@ -0,0 +1,175 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const mediaTypeVulnerabilityAlerts = "application/vnd.github.dorian-preview+json"
+
+type extendedSettings struct {
+	DeleteBranchOnMerge *bool `json:"delete_branch_on_merge,omitempty"`
+}
+
+func override(value, o *bool) *bool {
+	if o != nil {
+		return o
+	}
+	return value
+}
+
+// repoOptions copies the settings of the source repository, the overrides of
+// target.settings take precedence.
+func repoOptions(cfg *migration, source *gh.Repository) *gh.Repository {
+	o := cfg.Target.Settings
+
+	opts := &gh.Repository{
+		Name:             gh.String(targetName(cfg, *source.Name)),
+		Description:      source.Description,
+		Homepage:         source.Homepage,
+		Private:          override(source.Private, o.Private),
+		HasIssues:        override(source.HasIssues, o.HasIssues),
+		HasProjects:      override(source.HasProjects, o.HasProjects),
+		HasWiki:          override(source.HasWiki, o.HasWiki),
+		AllowMergeCommit: override(source.AllowMergeCommit, o.AllowMergeCommit),
+		AllowRebaseMerge: override(source.AllowRebaseMerge, o.AllowRebaseMerge),
+		AllowSquashMerge: override(source.AllowSquashMerge, o.AllowSquashMerge),
+	}
+	if o.Homepage != nil {
+		opts.Homepage = o.Homepage
+	}
+
+	if d := cfg.overrides[*source.Name].Description; d != nil {
+		opts.Description = d
+	}
+	if v := repoVisibility(cfg, source); v != "" {
+		opts.Private = gh.Bool(v != config.VisibilityPublic)
+	}
+	if cfg.Target.Type == config.TargetGitea {
+		// the gitea target sets them along with the creation, the settings
+		// step relying on the GitHub api
+		opts.Topics = targetTopics(cfg, o.Topics, source.Topics)
+	}
+
+	return opts
+}
+
+// repoVisibility is the visibility of the override of the repository or the
+// one target.visibility_map gives to the visibility of the source, empty
+// when the target follows the private setting.
+func repoVisibility(cfg *migration, source *gh.Repository) string {
+	if v := cfg.overrides[*source.Name].Visibility; v != "" {
+		return v
+	}
+
+	// go-github does not know the visibility field, the internal
+	// repositories of the source are listed as private
+	v := config.VisibilityPublic
+	if source.GetPrivate() {
+		v = config.VisibilityPrivate
+	}
+	return cfg.Target.VisibilityMap[v]
+}
+
+func vulnerabilityAlerts(ctx context.Context, client *gh.Client, owner, repo string) (bool, error) {
+	resp, err := github.Request(ctx, client, "GET", fmt.Sprintf("repos/%s/%s/vulnerability-alerts", owner, repo), mediaTypeVulnerabilityAlerts, nil, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// invalidTopic matches the characters a topic cannot contain.
+var invalidTopic = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// migrationTopics are the topics target.tag_topics adds: migrated and
+// migrated-from-<organization>, the topics being limited to lowercase
+// letters, digits and hyphens.
+func migrationTopics(cfg *migration) []string {
+	org := invalidTopic.ReplaceAllString(strings.ToLower(cfg.Source.Organization), "-")
+	from := strings.Trim("migrated-from-"+org, "-")
+	if len(from) > 50 {
+		from = strings.TrimRight(from[:50], "-")
+	}
+	return []string{"migrated", from}
+}
+
+// targetTopics are the topics of target.settings.topics, or the ones of the
+// source without them, along with the ones of target.tag_topics.
+func targetTopics(cfg *migration, topics, source []string) []string {
+	if topics == nil {
+		topics = source
+	}
+	topics = append([]string{}, topics...)
+	if cfg.Target.TagTopics {
+		for _, t := range migrationTopics(cfg) {
+			if !contains(topics, t) {
+				topics = append(topics, t)
+			}
+		}
+	}
+	return topics
+}
+
+// migrateSettings applies the settings that can only be set once the
+// repository has content, like the vulnerability alerts.
+func migrateSettings(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	o := cfg.Target.Settings
+	src, tgt := cfg.Source, cfg.Target
+
+	l.Info("migrating the repository settings...")
+
+	topics := o.Topics
+	if topics == nil {
+		var err error
+		topics, _, err = src.Instance.Repositories.ListAllTopics(ctx, src.Organization, *source.Name)
+		if err != nil {
+			return fmt.Errorf("topics: %v", err)
+		}
+	}
+	topics = targetTopics(cfg, topics, nil)
+	if len(topics) > 0 {
+		if _, _, err := tgt.Instance.Repositories.ReplaceAllTopics(ctx, tgt.Organization, *target.Name, topics); err != nil {
+			return fmt.Errorf("topics: %v", err)
+		}
+	}
+
+	settings := &extendedSettings{}
+	if _, err := github.Request(ctx, src.Instance, "GET", fmt.Sprintf("repos/%s/%s", src.Organization, *source.Name), "", nil, settings); err != nil {
+		return err
+	}
+	settings.DeleteBranchOnMerge = override(settings.DeleteBranchOnMerge, o.DeleteBranchOnMerge)
+	if settings.DeleteBranchOnMerge != nil {
+		if _, err := github.Request(ctx, tgt.Instance, "PATCH", fmt.Sprintf("repos/%s/%s", tgt.Organization, *target.Name), "", settings, nil); err != nil {
+			return fmt.Errorf("delete branch on merge: %v", err)
+		}
+	}
+
+	alerts := o.VulnerabilityAlerts
+	if alerts == nil {
+		enabled, err := vulnerabilityAlerts(ctx, src.Instance, src.Organization, *source.Name)
+		if err != nil {
+			return fmt.Errorf("vulnerability alerts: %v", err)
+		}
+		alerts = gh.Bool(enabled)
+	}
+	method := "DELETE"
+	if *alerts {
+		method = "PUT"
+	}
+	if _, err := github.Request(ctx, tgt.Instance, method, fmt.Sprintf("repos/%s/%s/vulnerability-alerts", tgt.Organization, *target.Name), mediaTypeVulnerabilityAlerts, nil, nil); err != nil {
+		return fmt.Errorf("vulnerability alerts: %v", err)
+	}
+
+	l.WithField("topics", topics).Info("the repository settings were migrated successfully")
+	return nil
+}
@@ -0,0 +1,215 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	stepCreate        = "created"
+	stepPush          = "pushed"
+	stepInitialized   = "initialized"
+	stepTransferred   = "transferred"
+	stepExported      = "exported"
+	stepLFS           = "lfs"
+	stepSettings      = "settings"
+	stepSecurity      = "security"
+	stepVerify        = "verified"
+	stepWorkflows     = "workflows"
+	stepSubmodules    = "submodules"
+	stepCodeowners    = "codeowners"
+	stepWiki          = "wiki"
+	stepPages         = "pages"
+	stepReleases      = "releases"
+	stepTeams         = "teams"
+	stepOwnerTeam     = "owner_team"
+	stepCollaborators = "collaborators"
+	stepProtections   = "protections"
+	stepRulesets      = "rulesets"
+	stepTagProtection = "tag_protections"
+	stepSignedTags    = "signed_tags"
+	stepWebhooks      = "webhooks"
+	stepDeployKeys    = "deploy_keys"
+	stepAutolinks     = "autolinks"
+	stepProperties    = "custom_properties"
+	stepEnvironments  = "environments"
+	stepSecrets       = "secrets"
+	stepLabels        = "labels"
+	stepIssues        = "issues"
+	stepPulls         = "pull_requests"
+	stepDiscussions   = "discussions"
+	stepWatchers      = "watchers"
+	stepContent       = "content_updated"
+	stepLockdown      = "locked_down"
+	stepTombstone     = "tombstoned"
+	stepArchive       = "archived"
+	stepReused        = "reused"
+)
+
+type RepoState struct {
+	Steps map[string]time.Time `json:"steps"`
+	Error string               `json:"error,omitempty"`
+	// Clone is the path of the clone left on the disk, which the next runs
+	// update instead of cloning the repository again.
+	Clone string `json:"clone,omitempty"`
+}
+
+type State struct {
+	mu    sync.Mutex
+	path  string
+	Repos map[string]*RepoState `json:"repositories"`
+}
+
+func loadState(path string) (*State, error) {
+	s := &State{path: path, Repos: map[string]*RepoState{}}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, err
+	}
+	if s.Repos == nil {
+		s.Repos = map[string]*RepoState{}
+	}
+
+	return s, nil
+}
+
+// Done reports whether the step was already completed for the repository
+// in a previous run. A nil state never has completed steps.
+func (s *State) Done(repo, step string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.Repos[repo]
+	if !ok {
+		return false
+	}
+	_, ok = r.Steps[step]
+	return ok
+}
+
+// Complete marks the step as completed and persists the state file.
+func (s *State) Complete(repo, step string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.repo(repo).Steps[step] = time.Now()
+
+	return s.save()
+}
+
+// Fail records the error that aborted the repository, so it can be rerun
+// with --retry-failed.
+func (s *State) Fail(repo string, err error) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.repo(repo).Error = err.Error()
+	return s.save()
+}
+
+// Uncomplete marks the step as not completed, so a rerun performs it again.
+func (s *State) Uncomplete(repo, step string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.repo(repo).Steps, step)
+	return s.save()
+}
+
+// Forget removes the repository from the state, as if it was never
+// migrated.
+func (s *State) Forget(repo string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.Repos, repo)
+	return s.save()
+}
+
+// SetClone records the clone of the repository, none when path is empty.
+func (s *State) SetClone(repo, path string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.Repos[repo]; ok && r.Clone == path || !ok && path == "" {
+		return nil
+	}
+	s.repo(repo).Clone = path
+	return s.save()
+}
+
+// Clone returns the path of the clone recorded for the repository.
+func (s *State) Clone(repo string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.Repos[repo]; ok {
+		return r.Clone
+	}
+	return ""
+}
+
+func (s *State) Succeed(repo string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.repo(repo).Error = ""
+	return s.save()
+}
+
+func (s *State) repo(name string) *RepoState {
+	r, ok := s.Repos[name]
+	if !ok {
+		r = &RepoState{Steps: map[string]time.Time{}}
+		s.Repos[name] = r
+	}
+	return r
+}
+
+func (s *State) save() error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// repoStep is one of the optional steps run on a repository once pushed,
+// enabled by its option of the configuration.
+type repoStep struct {
+	name    string
+	enabled func(cfg *migration) bool
+	run     func(cfg *migration, source, target *gh.Repository, l *log.Entry) error
+}
+
+// repoSteps are the optional steps in their default order.
+var repoSteps = []repoStep{
+	// the owner team is granted its permission as soon as the repository is created
+	{stepOwnerTeam, func(cfg *migration) bool { return cfg.overrides.hasTeams() || cfg.Waves.HasTeams() }, grantOwnerTeam},
+	{stepSettings, func(cfg *migration) bool {
+		return (cfg.Target.Type == "" || cfg.Target.Type == config.TargetGitHub) && (cfg.Source.Type == "" || cfg.Source.Type == config.SourceGitHub)
+	}, migrateSettings},
+	{stepSecurity, func(cfg *migration) bool { return cfg.Migrate.Security }, migrateSecurity},
+	{stepVerify, func(cfg *migration) bool { return cfg.Verify }, func(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+		return verifyStep(cfg, source, l)
+	}},
+	{stepSignedTags, func(cfg *migration) bool { return cfg.Migrate.SignedTags }, verifySignedTags},
+	{stepWorkflows, func(cfg *migration) bool { return cfg.Migrate.Workflows }, rewriteWorkflows},
+	{stepSubmodules, func(cfg *migration) bool { return cfg.Migrate.Submodules }, rewriteSubmodules},
+	{stepCodeowners, func(cfg *migration) bool { return cfg.Migrate.Codeowners }, migrateCodeowners},
+	{stepWiki, func(cfg *migration) bool { return cfg.Migrate.Wikis }, migrateWiki},
+	{stepPages, func(cfg *migration) bool { return cfg.Migrate.Pages }, migratePages},
+	{stepReleases, func(cfg *migration) bool { return cfg.Migrate.Releases }, migrateReleases},
+	{stepTeams, func(cfg *migration) bool { return cfg.Migrate.Teams }, migrateTeamPermissions},
+	{stepCollaborators, func(cfg *migration) bool { return cfg.Migrate.Collaborators }, migrateCollaborators},
+	{stepProtections, func(cfg *migration) bool { return cfg.Migrate.Protections }, migrateBranchProtections},
+	{stepRulesets, func(cfg *migration) bool { return cfg.Migrate.Rulesets }, migrateRulesets},
+	{stepTagProtection, func(cfg *migration) bool { return cfg.Migrate.TagProtections }, migrateTagProtections},
+	{stepWebhooks, func(cfg *migration) bool { return cfg.Migrate.Webhooks }, migrateWebhooks},
+	{stepDeployKeys, func(cfg *migration) bool { return cfg.Migrate.DeployKeys }, migrateDeployKeys},
+	{stepAutolinks, func(cfg *migration) bool { return cfg.Migrate.Autolinks }, migrateAutolinks},
+	{stepProperties, func(cfg *migration) bool { return cfg.Migrate.CustomProperties }, migrateCustomProperties},
+	{stepEnvironments, func(cfg *migration) bool { return cfg.Migrate.Environments }, migrateEnvironments},
+	{stepSecrets, func(cfg *migration) bool { return cfg.Migrate.Secrets }, migrateSecrets},
+	{stepLabels, func(cfg *migration) bool { return cfg.Migrate.Labels }, migrateLabels},
+	{stepIssues, func(cfg *migration) bool { return cfg.Migrate.Issues }, migrateIssues},
+	// the pull requests are migrated along with the issues to keep their numbers
+	{stepPulls, func(cfg *migration) bool { return cfg.Migrate.PullRequests != "" && !cfg.Migrate.PreserveNumbers }, migratePullRequests},
+	{stepDiscussions, func(cfg *migration) bool { return cfg.Migrate.Discussions }, migrateDiscussions},
+	{stepWatchers, func(cfg *migration) bool { return cfg.Migrate.Watchers }, migrateWatchers},
+	{stepContent, func(cfg *migration) bool { return cfg.Source.Content.Enabled() }, updateContent},
+	{stepLockdown, func(cfg *migration) bool { return cfg.Source.Lockdown.Enabled() }, lockdownRepo},
+	{stepTombstone, func(cfg *migration) bool { return cfg.Source.Tombstone.Enabled() }, tombstoneRepo},
+	{stepArchive, func(cfg *migration) bool { return cfg.Source.Archive }, func(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+		return archiveRepo(cfg, source, l)
+	}},
+}
+
+// hookStep runs a command of hooks.steps as a step.
+func hookStep(name, command string) repoStep {
+	return repoStep{
+		name:    name,
+		enabled: func(cfg *migration) bool { return true },
+		run: func(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+			return runHook(cfg, command, hookEnv(cfg, source, target), l.WithField("step", name))
+		},
+	}
+}
+
+// orderedSteps are the enabled steps of the repository in the order of the
+// steps option, less the ones skipped by its override. Without the option,
+// the steps of hooks.steps run before the archive, sorted by name.
+func orderedSteps(cfg *migration, repo string) []repoStep {
+	var steps []repoStep
+	if len(cfg.Steps) == 0 {
+		var names []string
+		for name := range cfg.Hooks.Steps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, s := range repoSteps {
+			if s.name == stepArchive {
+				for _, name := range names {
+					steps = append(steps, hookStep(name, cfg.Hooks.Steps[name]))
+				}
+			}
+			steps = append(steps, s)
+		}
+	} else {
+		for _, name := range cfg.Steps {
+			if command, ok := cfg.Hooks.Steps[name]; ok {
+				steps = append(steps, hookStep(name, command))
+				continue
+			}
+			for _, s := range repoSteps {
+				if s.name == name {
+					steps = append(steps, s)
+				}
+			}
+		}
+	}
+
+	var enabled []repoStep
+	for _, s := range steps {
+		if s.enabled(cfg) && !cfg.overrides.skipped(repo, s.name) {
+			enabled = append(enabled, s)
+		}
+	}
+	return enabled
+}
+
+// checkSteps reports the names of the steps and failure_policy options that
+// are neither an optional step nor one of hooks.steps, the core steps being
+// also allowed by failure_policy.
+func checkSteps(c *config.Configuration) error {
+	for name := range c.Hooks.Steps {
+		for _, s := range repoSteps {
+			if s.name == name {
+				return fmt.Errorf("hooks.steps: %q is already the name of a step", name)
+			}
+		}
+	}
+
+	for i, name := range c.Steps {
+		if _, ok := c.Hooks.Steps[name]; ok {
+			continue
+		}
+		found := false
+		for _, s := range repoSteps {
+			found = found || s.name == name
+		}
+		if !found {
+			var names []string
+			for _, s := range repoSteps {
+				names = append(names, s.name)
+			}
+			return fmt.Errorf("steps: %q must be one of hooks.steps or %v", name, names)
+		}
+		for _, after := range []string{stepLockdown, stepTombstone, stepArchive} {
+			if name == stepVerify && contains(c.Steps[:i], after) {
+				return fmt.Errorf("steps: %q must come before %q", stepVerify, after)
+			}
+		}
+	}
+
+	for name, p := range c.FailurePolicy {
+		if contains(coreSteps, name) {
+			if p == config.FailureContinue {
+				return fmt.Errorf("failure_policy.%s: the next steps cannot run without it, must be %s or %s", name, config.FailureAbortRepo, config.FailureAbortRun)
+			}
+			continue
+		}
+		if _, ok := c.Hooks.Steps[name]; ok {
+			continue
+		}
+		found := false
+		for _, s := range repoSteps {
+			found = found || s.name == name
+		}
+		if !found {
+			return fmt.Errorf("failure_policy: %q must be one of %v, hooks.steps or a step", name, coreSteps)
+		}
+	}
+	return nil
+}
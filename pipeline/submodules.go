@@ -0,0 +1,221 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const gitmodulesPath = ".gitmodules"
+
+var submoduleURLPattern = regexp.MustCompile(`^(\s*url\s*=\s*)(\S+)\s*$`)
+
+// submoduleRewriter points the submodules of the source organization to the
+// repositories migrated to the target, keeping the ssh or https form of
+// each url.
+type submoduleRewriter struct {
+	cfg      *migration
+	prefixes map[string]string
+}
+
+func newSubmoduleRewriter(cfg *migration, source, target *gh.Repository) *submoduleRewriter {
+	prefixes := map[string]string{}
+	for _, urls := range [][2]string{
+		{source.GetSSHURL(), target.GetSSHURL()},
+		{source.GetCloneURL(), target.GetCloneURL()},
+		{source.GetHTMLURL(), target.GetHTMLURL()},
+	} {
+		from, to := ownerPrefix(urls[0]), ownerPrefix(urls[1])
+		if from != "" && to != "" {
+			prefixes[from] = to
+		}
+	}
+	return &submoduleRewriter{cfg: cfg, prefixes: prefixes}
+}
+
+// ownerPrefix is the url of a repository without its name, e.g.
+// git@github.com:org/ for git@github.com:org/repo.git.
+func ownerPrefix(URL string) string {
+	i := strings.LastIndex(URL, "/")
+	if i < 0 {
+		return ""
+	}
+	return URL[:i+1]
+}
+
+// rewriteURL returns the url unchanged when it is not a repository of the
+// source organization.
+func (s *submoduleRewriter) rewriteURL(URL string) string {
+	for from, to := range s.prefixes {
+		if !strings.HasPrefix(strings.ToLower(URL), strings.ToLower(from)) {
+			continue
+		}
+		name := URL[len(from):]
+		if strings.Contains(name, "/") {
+			continue
+		}
+		suffix := ""
+		if strings.HasSuffix(name, ".git") {
+			name, suffix = strings.TrimSuffix(name, ".git"), ".git"
+		}
+		return to + targetName(s.cfg, name) + suffix
+	}
+	return URL
+}
+
+func (s *submoduleRewriter) rewrite(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if m := submoduleURLPattern.FindStringSubmatch(line); m != nil {
+			lines[i] = m[1] + s.rewriteURL(m[2])
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// submoduleNames are the repositories of the source organization used as
+// submodules in content, according to the prefixes of the urls of the
+// source repository.
+func submoduleNames(source *gh.Repository, content string) []string {
+	var prefixes []string
+	for _, u := range []string{source.GetSSHURL(), source.GetCloneURL(), source.GetHTMLURL()} {
+		if p := ownerPrefix(u); p != "" {
+			prefixes = append(prefixes, strings.ToLower(p))
+		}
+	}
+
+	var names []string
+	for _, line := range strings.Split(content, "\n") {
+		m := submoduleURLPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for _, p := range prefixes {
+			if name := m[2]; strings.HasPrefix(strings.ToLower(name), p) && !strings.Contains(name[len(p):], "/") {
+				names = append(names, strings.TrimSuffix(name[len(p):], ".git"))
+				break
+			}
+		}
+	}
+	return names
+}
+
+// orderBySubmodules moves the repositories used as submodules before the
+// ones using them, so their targets exist first. The order of the
+// repositories is kept otherwise.
+func orderBySubmodules(cfg *migration, repos []*gh.Repository) ([]*gh.Repository, error) {
+	deps, err := submoduleDeps(cfg, repos)
+	if err != nil {
+		return nil, err
+	}
+	return orderByDeps(repos, deps), nil
+}
+
+// submoduleDeps maps the repositories to the other repositories of the run
+// they include as submodules.
+func submoduleDeps(cfg *migration, repos []*gh.Repository) (map[string][]string, error) {
+	ctx := cfg.runContext()
+
+	index := map[string]*gh.Repository{}
+	for _, r := range repos {
+		index[*r.Name] = r
+	}
+
+	deps := map[string][]string{}
+	for _, r := range repos {
+		c, _, resp, err := cfg.Source.Instance.Repositories.GetContents(ctx, cfg.Source.Organization, *r.Name, gitmodulesPath, nil)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", *r.Name, err)
+		}
+		content, err := c.GetContent()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", *r.Name, err)
+		}
+		for _, name := range submoduleNames(r, content) {
+			if _, ok := index[name]; ok && name != *r.Name {
+				deps[*r.Name] = append(deps[*r.Name], name)
+			}
+		}
+	}
+
+	return deps, nil
+}
+
+// orderByDeps moves the dependencies of each repository, names of other
+// repositories of the run, before it.
+func orderByDeps(repos []*gh.Repository, deps map[string][]string) []*gh.Repository {
+	index := map[string]*gh.Repository{}
+	for _, r := range repos {
+		index[*r.Name] = r
+	}
+
+	var ordered []*gh.Repository
+	visited := map[string]bool{}
+	var visit func(r *gh.Repository)
+	visit = func(r *gh.Repository) {
+		// a cycle is broken where it is found
+		if visited[*r.Name] {
+			return
+		}
+		visited[*r.Name] = true
+		for _, name := range deps[*r.Name] {
+			visit(index[name])
+		}
+		ordered = append(ordered, r)
+	}
+	for _, r := range repos {
+		visit(r)
+	}
+	return ordered
+}
+
+// rewriteSubmodules commits the rewritten .gitmodules file on the default
+// branch of the target, after the push.
+func rewriteSubmodules(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	repos := cfg.Target.Instance.Repositories
+
+	// the default branch is only known once pushed
+	target, err := cfg.Target.Provider.Get(ctx, *target.Name)
+	if err != nil {
+		return err
+	}
+	opts := &gh.RepositoryContentGetOptions{Ref: target.GetDefaultBranch()}
+
+	c, _, resp, err := repos.GetContents(ctx, cfg.Target.Organization, *target.Name, gitmodulesPath, opts)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	content, err := c.GetContent()
+	if err != nil {
+		return err
+	}
+
+	rewritten := newSubmoduleRewriter(cfg, source, target).rewrite(content)
+	if rewritten == content {
+		return nil
+	}
+
+	message, err := commitMessage(cfg, config.CommitSubmodules, []string{gitmodulesPath}, source, target)
+	if err != nil {
+		return err
+	}
+	options := fileOptions(cfg, message, []byte(rewritten), c.GetSHA(), target.GetDefaultBranch())
+	if err := commitFile(cfg, cfg.Target.Instance, cfg.Target.Organization, *target.Name, gitmodulesPath, options); err != nil {
+		return err
+	}
+
+	l.Info("the submodules were rewritten successfully")
+	return nil
+}
@@ -0,0 +1,272 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/gitops"
+	"github.com/leocomelli/ghmgr/metrics"
+	log "github.com/sirupsen/logrus"
+	git "gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+var (
+	errNotMigrated = errors.New("the repository was not migrated yet, skipping")
+	errUpToDate    = errors.New("the target is up to date, nothing to clone")
+)
+
+// syncRefs are the refs kept in step, the same ones pushed by the migration.
+func syncRefs(cfg *migration, repo *gh.Repository) []string {
+	if cfg.Git.Mirror {
+		return []string{"refs/heads/*", "refs/tags/*", "refs/notes/*"}
+	}
+	return []string{"refs/heads/" + repo.GetDefaultBranch()}
+}
+
+// openClone reuses the clone of the migration, creating an empty one when
+// it was removed, and makes sure both remotes are configured.
+func openClone(cfg *migration, path, sourceURL, targetURL string, sizeKB int) (*git.Repository, error) {
+	if gitops.InMemory(cfg.Git, sizeKB) {
+		g, err := gitops.Init(path, true)
+		if err != nil {
+			return nil, err
+		}
+		return g, addRemotes(cfg, g, sourceURL, targetURL)
+	}
+
+	g, err := git.PlainOpen(path)
+	if err == git.ErrRepositoryNotExists {
+		g, err = git.PlainInit(path, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return g, addRemotes(cfg, g, sourceURL, targetURL)
+}
+
+// upToDate compares the refs advertised by the source and the target
+// before anything is cloned: the target is up to date when each ref synced
+// points at the same object there, under its git.branch_map name. The refs
+// only found on the target do not count, the sync leaves them.
+func upToDate(cfg *migration, repo, target *gh.Repository, auth, targetAuth transport.AuthMethod) (bool, error) {
+	sourceRefs, err := gitops.ListRemote(repoURL(cfg, repo), auth)
+	if err != nil {
+		return false, fmt.Errorf("source: %v", err)
+	}
+	targetRefs, err := gitops.ListRemote(repoURL(cfg, target), targetAuth)
+	if err != nil {
+		return false, fmt.Errorf("target: %v", err)
+	}
+
+	heads := map[string]plumbing.Hash{}
+	for _, r := range targetRefs {
+		heads[r.Name().String()] = r.Hash()
+	}
+	patterns := syncRefs(cfg, repo)
+	for _, r := range sourceRefs {
+		name := r.Name().String()
+		if r.Type() != plumbing.HashReference || !matchRef(patterns, name) || cfg.Git.Mirror && !cfg.refs.Match(name) {
+			continue
+		}
+		if heads[targetRef(cfg, name)] != r.Hash() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchRef tells whether the ref is one of refs, which can end with a
+// wildcard like the refspecs.
+func matchRef(refs []string, ref string) bool {
+	for _, r := range refs {
+		if r == ref || strings.HasSuffix(r, "*") && strings.HasPrefix(ref, strings.TrimSuffix(r, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func addRemotes(cfg *migration, g *git.Repository, sourceURL, targetURL string) error {
+	remotes := map[string]string{git.DefaultRemoteName: sourceURL, cfg.Git.RemoteName: targetURL}
+	for name, URL := range remotes {
+		_, err := g.CreateRemote(&gitconfig.RemoteConfig{Name: name, URLs: []string{URL}})
+		if err != nil && err != git.ErrRemoteExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncRepo fetches the new commits of the source and pushes them to the
+// target, the push is rejected when a ref does not fast-forward unless
+// sync.force is set. A target already up to date is skipped without
+// cloning, with errUpToDate.
+func syncRepo(cfg *migration, repo *gh.Repository, l *log.Entry) error {
+	target, err := existingRepo(cfg, targetName(cfg, *repo.Name))
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return errNotMigrated
+	}
+	if repo.GetDefaultBranch() == "" {
+		// some providers only return it for a single repository
+		if repo, err = cfg.Source.Provider.Get(cfg.runContext(), *repo.Name); err != nil {
+			return err
+		}
+	}
+	if repo.GetDefaultBranch() == "" {
+		// a plain git url says nothing about it, the migration pushed the
+		// default branch of the clone
+		repo.DefaultBranch = target.DefaultBranch
+	}
+
+	auth, err := gitAuth(cfg, cfg.Source.Tokens, cfg.Source.Username, l)
+	if err != nil {
+		return err
+	}
+	targetAuth := auth
+	if useHTTPS(cfg) {
+		targetAuth, err = gitAuth(cfg, cfg.Target.Tokens, "", l)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch same, err := upToDate(cfg, repo, target, auth, targetAuth); {
+	case err != nil:
+		l.WithError(err).Warn("the refs of the source and the target cannot be compared, fetching anyway")
+	case same:
+		return errUpToDate
+	}
+
+	if !gitops.InMemory(cfg.Git, repo.GetSize()) {
+		restoreClone(cfg, clonePath(cfg, *repo.Name), l)
+	}
+	g, err := openClone(cfg, clonePath(cfg, *repo.Name), repoURL(cfg, repo), repoURL(cfg, target), repo.GetSize())
+	if err != nil {
+		return err
+	}
+
+	refs, tags := syncRefs(cfg, repo), git.AllTags
+	if cfg.Git.Mirror && cfg.refs != nil {
+		if refs, err = cfg.refs.Remote(repoURL(cfg, repo), auth); err != nil {
+			return fmt.Errorf("listing the refs of the source: %v", err)
+		}
+		tags = git.NoTags
+	}
+	if len(refs) == 0 {
+		l.Warn("no ref is selected by git.refspecs, git.branches and git.tags, nothing is synced")
+		return nil
+	}
+
+	var fetch, push []gitconfig.RefSpec
+	for _, ref := range refs {
+		fetch = append(fetch, gitconfig.RefSpec("+"+ref+":"+ref))
+		spec := ref + ":" + ref
+		if cfg.Sync.Force {
+			spec = "+" + spec
+		}
+		push = append(push, gitconfig.RefSpec(spec))
+	}
+
+	l.Info("fetching the new commits from the source...")
+	start := time.Now()
+	err = g.FetchContext(cfg.runContext(), &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   fetch,
+		Auth:       auth,
+		Tags:       tags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("fetching the source: %v", err)
+	}
+	metrics.GitDuration.Since(start, "fetch")
+
+	if len(cfg.Git.BranchMap) > 0 {
+		if push, err = gitops.ExpandRefSpecs(g, push, renameRef(cfg)); err != nil {
+			return fmt.Errorf("listing the refs to push: %v", err)
+		}
+	}
+
+	l.WithField("force", cfg.Sync.Force).Info("pushing the new commits to the target...")
+	start = time.Now()
+	opts := &git.PushOptions{
+		RemoteName: cfg.Git.RemoteName,
+		RefSpecs:   push,
+		Auth:       targetAuth,
+	}
+	err = g.PushContext(cfg.runContext(), opts)
+	metrics.GitDuration.Since(start, "push")
+	if err == git.NoErrAlreadyUpToDate {
+		l.Info("the target is up to date")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("pushing to the target: %v", err)
+	}
+	auditPush(cfg, "target", cfg.Target.Organization+"/"+target.GetName(), g, opts)
+
+	if cfg.Git.LFS {
+		if err := migrateLFS(cfg, g, repo, target, l); err != nil {
+			return err
+		}
+	}
+
+	storeClone(cfg, clonePath(cfg, *repo.Name), l)
+	cleanupClone(cfg, *repo.Name, l)
+
+	l.Info("the repository was synced successfully")
+	return nil
+}
+
+func runSync(cfg *migration, repos []*gh.Repository) error {
+	if cfg.Git.Filter.Enabled() {
+		return errors.New("the sync command cannot push the history rewritten by git.filter")
+	}
+
+	failed, current := 0, 0
+	for _, repo := range repos {
+		if cfg.stopping() {
+			break
+		}
+		l := log.WithField("repo", *repo.Name)
+
+		if cfg.DryRun {
+			l.WithField("target", targetName(cfg, *repo.Name)).Info("[plan] the new commits would be pushed to the target")
+			continue
+		}
+
+		err := syncRepo(cfg, repo, l)
+		switch err {
+		case errNotMigrated:
+			l.Warn(err)
+			continue
+		case errUpToDate:
+			l.Info(err)
+			current++
+			err = nil
+		}
+		metrics.Repos.Add(1, repoStatus(err))
+		if err != nil {
+			l.Error(err)
+			failed++
+		}
+	}
+
+	if current > 0 {
+		log.WithField("up_to_date", current).WithField("total", len(repos)).Info("the targets up to date were not cloned")
+	}
+
+	if failed > 0 {
+		return partialError(failed, len(repos), "%d of %d repositories could not be synced", failed, len(repos))
+	}
+	return nil
+}
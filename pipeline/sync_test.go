@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyncUpToDate(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	cfg.Git.Mirror = true
+	execute(t, cfg, Options{Command: "migrate"})
+
+	m := newTestMigration(t, cfg)
+	ctx := m.runContext()
+	source, err := m.Source.Provider.Get(ctx, "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := existingRepo(m, "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(want bool) {
+		t.Helper()
+		same, err := upToDate(m, source, target, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same != want {
+			t.Errorf("upToDate = %v, want %v", same, want)
+		}
+	}
+
+	check(true)
+
+	f.git.Commit(sourceOrg, "api", "develop", map[string]string{"CHANGELOG.md": "# changes\n"})
+	check(false)
+
+	execute(t, cfg, Options{Command: "sync"})
+	if got, want := f.git.Refs(targetOrg, "api"), f.git.Refs(sourceOrg, "api"); !reflect.DeepEqual(got, want) {
+		t.Errorf("target refs = %v, want %v", got, want)
+	}
+	check(true)
+
+	// the refs left out by git.branches do not count
+	f.git.Commit(sourceOrg, "api", "develop", map[string]string{"CHANGELOG.md": "# more changes\n"})
+	cfg.Git.Branches = []string{"main"}
+	m = newTestMigration(t, cfg)
+	check(true)
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// tagProtection is a tag protection rule, which go-github does not know.
+type tagProtection struct {
+	ID      int64  `json:"id,omitempty"`
+	Pattern string `json:"pattern"`
+}
+
+func listTagProtections(cfg *migration, client *gh.Client, owner, repo string) ([]tagProtection, error) {
+	var list []tagProtection
+	_, err := github.Request(cfg.runContext(), client, "GET", fmt.Sprintf("repos/%s/%s/tags/protection", owner, repo), "", nil, &list)
+	return list, err
+}
+
+// migrateTagProtections creates the tag protection rules of the source
+// repository on the target, the patterns already protected there being
+// left as they are.
+func migrateTagProtections(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	list, err := listTagProtections(cfg, cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return err
+	}
+	existing, err := listTagProtections(cfg, cfg.Target.Instance, cfg.Target.Organization, *target.Name)
+	if err != nil {
+		return fmt.Errorf("the target does not support the tag protections, the rulesets replace them: %v", err)
+	}
+	protected := map[string]bool{}
+	for _, p := range existing {
+		protected[p.Pattern] = true
+	}
+
+	l.WithField("amount", len(list)).Info("migrating the tag protections...")
+
+	for _, p := range list {
+		if protected[p.Pattern] {
+			l.WithField("pattern", p.Pattern).Debug("the tags are already protected on the target")
+			continue
+		}
+		body := tagProtection{Pattern: p.Pattern}
+		if _, err := github.Request(ctx, cfg.Target.Instance, "POST", fmt.Sprintf("repos/%s/%s/tags/protection", cfg.Target.Organization, *target.Name), "", body, nil); err != nil {
+			return fmt.Errorf("tag protection %s: %v", p.Pattern, err)
+		}
+		l.WithField("pattern", p.Pattern).Info("a tag protection was migrated successfully")
+	}
+
+	return nil
+}
+
+// annotatedTags returns the sha of the tag objects of a repository by tag
+// name, the lightweight tags pointing at a commit being left out.
+func annotatedTags(cfg *migration, client *gh.Client, owner, repo string) (map[string]string, error) {
+	opts := &gh.ReferenceListOptions{Type: "tags", ListOptions: gh.ListOptions{PerPage: 100}}
+	tags := map[string]string{}
+	for {
+		refs, resp, err := client.Git.ListRefs(cfg.runContext(), owner, repo, opts)
+		// an empty repository or one without tags
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusConflict) {
+			return tags, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range refs {
+			if r.GetObject().GetType() == "tag" {
+				tags[strings.TrimPrefix(r.GetRef(), "refs/tags/")] = r.GetObject().GetSHA()
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return tags, nil
+}
+
+// verifySignedTags checks the signed tags of the source on the target. The
+// sha of a tag object is the one of its bytes, signature included, so the
+// same sha on both sides proves the tag intact; a tag pushed with another
+// sha was rewritten, e.g. by git.filter, and lost its signature. The
+// signature of an intact tag may still not verify on the target, when the
+// key of the tagger is not known there. Such tags are logged and reported
+// without failing the repository.
+func verifySignedTags(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	src, tgt := cfg.Source, cfg.Target
+
+	sourceTags, err := annotatedTags(cfg, src.Instance, src.Organization, *source.Name)
+	if err != nil {
+		return fmt.Errorf("source tags: %v", err)
+	}
+	targetTags, err := annotatedTags(cfg, tgt.Instance, tgt.Organization, *target.Name)
+	if err != nil {
+		return fmt.Errorf("target tags: %v", err)
+	}
+
+	var names []string
+	for name := range sourceTags {
+		if cfg.refs.Match("refs/tags/" + name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	l.WithField("amount", len(names)).Info("verifying the signed tags...")
+
+	signed, flagged := 0, 0
+	flag := func(name, problem string) {
+		flagged++
+		cfg.Results.UnverifiedTag(*source.Name, name)
+		l.WithField("tag", name).Warn(problem)
+	}
+	for _, name := range names {
+		tag, _, err := src.Instance.Git.GetTag(ctx, src.Organization, *source.Name, sourceTags[name])
+		if err != nil {
+			return fmt.Errorf("tag %s: %v", name, err)
+		}
+		if tag.GetVerification().GetSignature() == "" {
+			continue
+		}
+		signed++
+
+		sha, ok := targetTags[name]
+		switch {
+		case !ok:
+			flag(name, "the signed tag is missing on the target")
+			continue
+		case sha != sourceTags[name]:
+			flag(name, "the signed tag was rewritten on the target, its signature is lost")
+			continue
+		}
+
+		pushed, _, err := tgt.Instance.Git.GetTag(ctx, tgt.Organization, *target.Name, sha)
+		if err != nil {
+			return fmt.Errorf("tag %s: %v", name, err)
+		}
+		if v := pushed.GetVerification(); !v.GetVerified() && tag.GetVerification().GetVerified() {
+			flag(name, fmt.Sprintf("the signature of the tag does not verify on the target (%s), the key of the tagger is probably not known there", v.GetReason()))
+		}
+	}
+
+	if flagged > 0 {
+		l.WithField("signed", signed).WithField("unverified", flagged).Warn("some signed tags do not verify on the target")
+		return nil
+	}
+	l.WithField("signed", signed).Info("the signed tags verify on the target")
+	return nil
+}
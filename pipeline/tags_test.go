@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github/githubtest"
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+)
+
+// stubTags serves the tags of a repository, name being the tag and sha
+// the one of its tag object, whose signature verifies when verified.
+func stubTags(s *githubtest.Server, owner, repo string, tags map[string]string, verified map[string]bool) {
+	s.Handle("GET", "repos/"+owner+"/"+repo+"/git/refs/tags", func(w http.ResponseWriter, r *http.Request, path string) {
+		refs := []map[string]interface{}{
+			{"ref": "refs/tags/lightweight", "object": map[string]string{"type": "commit", "sha": strings.Repeat("c", 40)}},
+		}
+		for name, sha := range tags {
+			refs = append(refs, map[string]interface{}{"ref": "refs/tags/" + name, "object": map[string]string{"type": "tag", "sha": sha}})
+		}
+		githubtest.Reply(w, http.StatusOK, refs)
+	})
+	s.Handle("GET", "repos/"+owner+"/"+repo+"/git/tags/*", func(w http.ResponseWriter, r *http.Request, path string) {
+		sha := path[strings.LastIndex(path, "/")+1:]
+		reason := "valid"
+		if !verified[sha] {
+			reason = "unknown_key"
+		}
+		githubtest.Reply(w, http.StatusOK, map[string]interface{}{
+			"sha":          sha,
+			"verification": map[string]interface{}{"verified": verified[sha], "reason": reason, "signature": "-----BEGIN PGP SIGNATURE-----"},
+		})
+	})
+}
+
+func TestVerifySignedTags(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	f.target.AddRepo(targetOrg, "api", nil)
+	sha := func(c string) string { return strings.Repeat(c, 40) }
+
+	stubTags(f.source, sourceOrg, "api",
+		map[string]string{"v1": sha("1"), "v2": sha("2"), "v3": sha("3"), "v4": sha("4")},
+		map[string]bool{sha("1"): true, sha("2"): true, sha("3"): true, sha("4"): true})
+	// v2 rewritten, v3 missing and the key of v4 unknown
+	stubTags(f.target, targetOrg, "api",
+		map[string]string{"v1": sha("1"), "v2": sha("5"), "v4": sha("4")},
+		map[string]bool{sha("1"): true})
+
+	m := newTestMigration(t, f.config(t))
+	m.Results = report.New()
+	repo := &gh.Repository{Name: gh.String("api")}
+	if err := verifySignedTags(m, repo, repo, log.WithField("repo", "api")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := m.Results.Repos[0].Tags, []string{"v2", "v3", "v4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unverified tags = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,288 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// teamIndex caches the ids of the target teams by slug, it is shared by
+// every worker.
+type teamIndex struct {
+	mu  sync.Mutex
+	ids map[string]int64
+}
+
+func listTeams(ctx context.Context, client *gh.Client, org string) ([]*gh.Team, error) {
+	opts := &gh.ListOptions{PerPage: 100}
+
+	var teams []*gh.Team
+	for {
+		tt, resp, err := client.Teams.ListTeams(ctx, org, opts)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, tt...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return teams, nil
+}
+
+func listTeamMembers(ctx context.Context, client *gh.Client, team int64, role string) ([]*gh.User, error) {
+	opts := &gh.TeamListTeamMembersOptions{Role: role, ListOptions: gh.ListOptions{PerPage: 100}}
+
+	var users []*gh.User
+	for {
+		uu, resp, err := client.Teams.ListTeamMembers(ctx, team, opts)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, uu...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return users, nil
+}
+
+func (t *teamIndex) load(cfg *migration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.ids != nil {
+		return nil
+	}
+
+	teams, err := listTeams(cfg.runContext(), cfg.Target.Instance, cfg.Target.Organization)
+	if err != nil {
+		return err
+	}
+
+	t.ids = map[string]int64{}
+	for _, team := range teams {
+		t.ids[team.GetSlug()] = team.GetID()
+	}
+	return nil
+}
+
+func (t *teamIndex) get(slug string) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id, ok := t.ids[slug]
+	return id, ok
+}
+
+func (t *teamIndex) set(slug string, id int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ids[slug] = id
+}
+
+// sortTeams orders the teams so every parent is created before its children.
+func sortTeams(teams []*gh.Team) []*gh.Team {
+	var sorted []*gh.Team
+	done := map[int64]bool{}
+
+	for len(sorted) < len(teams) {
+		progress := false
+		for _, t := range teams {
+			if done[t.GetID()] {
+				continue
+			}
+			if p := t.GetParent(); p != nil && !done[p.GetID()] {
+				continue
+			}
+			done[t.GetID()] = true
+			sorted = append(sorted, t)
+			progress = true
+		}
+		if !progress {
+			// the parent is not visible to the token, keep the rest as they are
+			for _, t := range teams {
+				if !done[t.GetID()] {
+					done[t.GetID()] = true
+					sorted = append(sorted, t)
+				}
+			}
+		}
+	}
+
+	return sorted
+}
+
+// migrateTeams recreates the teams of the source organization with their
+// hierarchy and members, it runs once before the repositories.
+func migrateTeams(cfg *migration) error {
+	ctx := cfg.runContext()
+	l := log.WithField("organization", cfg.Target.Organization)
+
+	if err := cfg.teams.load(cfg); err != nil {
+		return err
+	}
+
+	teams, err := listTeams(ctx, cfg.Source.Instance, cfg.Source.Organization)
+	if err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(teams)).Info("migrating the teams...")
+
+	for _, t := range sortTeams(teams) {
+		slug := mapTeam(cfg, t.GetSlug())
+
+		id, ok := cfg.teams.get(slug)
+		if !ok {
+			name := t.GetName()
+			if slug != t.GetSlug() {
+				name = slug
+			}
+
+			team := gh.NewTeam{
+				Name:        name,
+				Description: t.Description,
+				Privacy:     t.Privacy,
+			}
+			if p := t.GetParent(); p != nil {
+				if parent, ok := cfg.teams.get(mapTeam(cfg, p.GetSlug())); ok {
+					team.ParentTeamID = gh.Int64(parent)
+				}
+			}
+
+			n, _, err := cfg.Target.Instance.Teams.CreateTeam(ctx, cfg.Target.Organization, team)
+			if err != nil {
+				return fmt.Errorf("team %s: %v", t.GetSlug(), err)
+			}
+			id = n.GetID()
+			cfg.teams.set(n.GetSlug(), id)
+			l.WithField("team", n.GetSlug()).Info("a team was created successfully")
+		}
+
+		for _, role := range []string{"maintainer", "member"} {
+			members, err := listTeamMembers(ctx, cfg.Source.Instance, t.GetID(), role)
+			if err != nil {
+				return fmt.Errorf("team %s: %v", t.GetSlug(), err)
+			}
+			for _, m := range members {
+				login := mapUser(cfg, m.GetLogin())
+				_, _, err := cfg.Target.Instance.Teams.AddTeamMembership(ctx, id, login, &gh.TeamAddTeamMembershipOptions{Role: role})
+				if err != nil {
+					l.WithField("team", slug).WithField("user", login).WithError(err).Warn("the member could not be added to the team")
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// listRepoTeams returns the teams of the source repository along with
+// their permission.
+func listRepoTeams(cfg *migration, source *gh.Repository) ([]*gh.Team, error) {
+	opts := &gh.ListOptions{PerPage: 100}
+	var teams []*gh.Team
+	for {
+		tt, resp, err := cfg.Source.Instance.Repositories.ListTeams(cfg.runContext(), cfg.Source.Organization, *source.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, tt...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return teams, nil
+}
+
+func migrateTeamPermissions(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	if err := cfg.teams.load(cfg); err != nil {
+		return err
+	}
+
+	teams, err := listRepoTeams(cfg, source)
+	if err != nil {
+		return err
+	}
+
+	l.WithField("amount", len(teams)).Info("migrating the team permissions...")
+
+	for _, t := range teams {
+		slug := mapTeam(cfg, t.GetSlug())
+		id, ok := cfg.teams.get(slug)
+		if !ok {
+			l.WithField("team", slug).Warn("the team does not exist on the target, skipping its permission")
+			continue
+		}
+
+		_, err := cfg.Target.Instance.Teams.AddTeamRepo(ctx, id, cfg.Target.Organization, *target.Name, &gh.TeamAddTeamRepoOptions{
+			Permission: t.GetPermission(),
+		})
+		if err != nil {
+			return fmt.Errorf("team %s: %v", slug, err)
+		}
+	}
+
+	return nil
+}
+
+// ownerTeam returns the team owning the repository on the target and its
+// permission: the team of its override, e.g. a column of the manifest, or
+// else the one of its group of waves.groups.
+func ownerTeam(cfg *migration, repo *gh.Repository) (string, string) {
+	permission := func(p string) string {
+		if p == "" {
+			return config.TeamAdmin
+		}
+		return p
+	}
+	if o := cfg.overrides[*repo.Name]; o.Team != "" {
+		return o.Team, permission(o.TeamPermission)
+	}
+	for _, g := range cfg.Waves.Groups {
+		// the patterns were validated with the configuration
+		include, _ := config.CompilePatterns(g.Include)
+		if matchWave(g, include, repo) {
+			return g.Team, permission(g.TeamPermission)
+		}
+	}
+	return "", ""
+}
+
+// grantOwnerTeam grants its permission on the target to the owner team of
+// the repository, right after the creation so the repository is not owned
+// by the account of the migration alone.
+func grantOwnerTeam(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	slug, permission := ownerTeam(cfg, source)
+	if slug == "" {
+		return nil
+	}
+
+	if err := cfg.teams.load(cfg); err != nil {
+		return err
+	}
+	id, ok := cfg.teams.get(slug)
+	if !ok {
+		return fmt.Errorf("the team %s does not exist on the target", slug)
+	}
+
+	_, err := cfg.Target.Instance.Teams.AddTeamRepo(cfg.runContext(), id, cfg.Target.Organization, *target.Name, &gh.TeamAddTeamRepoOptions{
+		Permission: permission,
+	})
+	if err != nil {
+		return fmt.Errorf("team %s: %v", slug, err)
+	}
+	l.WithField("team", slug).WithField("permission", permission).Info("the owner team was granted its permission")
+	return nil
+}
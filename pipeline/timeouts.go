@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchdogGrace is the time given to a repository to return once its
+// timeout expired, the worker moving on without it afterwards.
+const watchdogGrace = time.Minute
+
+// timeoutContext bounds ctx by d, a zero d meaning no limit.
+func timeoutContext(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// withTimeout returns a copy of the run whose operations are cancelled
+// after d, the clients, the state and the results being shared.
+func (c *migration) withTimeout(d time.Duration) (*migration, context.CancelFunc) {
+	if d <= 0 {
+		return c, func() {}
+	}
+	ctx, cancel := context.WithTimeout(c.runContext(), d)
+	rc := *c
+	rc.ctx = ctx
+	return &rc, cancel
+}
+
+// timedOut tells the operation that exceeded its timeout d apart from the
+// other errors.
+func timedOut(ctx context.Context, what string, d time.Duration, err error) error {
+	if err != nil && d > 0 && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %s", what, d)
+	}
+	return err
+}
+
+// watchRepo migrates the repository within timeouts.repo. Its operations
+// are cancelled once the timeout expires and, when it is stuck in one that
+// does not stop, the worker moves on after watchdogGrace. The state keeps
+// the steps completed so far, so the next run resumes the repository.
+func watchRepo(cfg *migration, repo *gh.Repository, l *log.Entry) error {
+	d := cfg.Timeouts.Repo
+	if d <= 0 {
+		return migrateWithRetry(cfg, repo, l)
+	}
+	rc, cancel := cfg.withTimeout(d)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- migrateWithRetry(rc, repo, l)
+	}()
+
+	var err error
+	stuck := false
+	select {
+	case err = <-done:
+	case <-rc.runContext().Done():
+		select {
+		case err = <-done:
+		case <-time.After(watchdogGrace):
+			l.WithField("grace", watchdogGrace.String()).Warn("the repository did not stop after its timeout, moving on")
+			stuck = true
+		}
+	}
+	if !stuck && (err == nil || rc.runContext().Err() != context.DeadlineExceeded) {
+		return err
+	}
+
+	err = fmt.Errorf("the repository timed out after %s while %s", d, cfg.Progress.StepOf(*repo.Name))
+	if serr := cfg.State.Fail(*repo.Name, err); serr != nil {
+		l.Error(serr)
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// the defaults of source.tombstone
+const (
+	tombstonePath     = "README.md"
+	tombstoneBranch   = "moved"
+	tombstoneTemplate = "# This repository has moved\n\n" +
+		"{{name}} now lives at {{target_url}}, this copy is kept read-only.\n\n" +
+		"Point your clones to the new location with:\n\n" +
+		"```\ngit remote set-url origin {{target_url}}.git\n```\n"
+)
+
+// tombstoneRepo leaves the page of source.tombstone on the source, pointing
+// to the target: the default branch gets it as its readme, or a branch of
+// its own becomes the default one.
+func tombstoneRepo(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	t := cfg.Source.Tombstone
+	path, template := t.Path, t.Template
+	if path == "" {
+		path = tombstonePath
+	}
+	if template == "" {
+		template = tombstoneTemplate
+	}
+	page := expandTemplate(template, source, target)
+
+	if t.Mode == config.TombstoneBranch {
+		return tombstoneBranchRepo(cfg, source, target, path, template, page, l)
+	}
+
+	rule := config.ContentRule{Path: path, Mode: config.ContentReplace}
+	content, sha, err := sourceContent(cfg, rule, source)
+	if err != nil {
+		return err
+	}
+	if sha != "" && tombstoneInPlace(template, content, source, target) {
+		l.WithField("filename", path).Info("the tombstone is already in place, skipping")
+		return nil
+	}
+
+	message, err := commitMessage(cfg, config.CommitTombstone, []string{path}, source, target)
+	if err != nil {
+		return err
+	}
+	src := cfg.Source
+	if err := commitFile(cfg, src.Instance, src.Organization, *source.Name, path, fileOptions(cfg, message, []byte(page), sha, "")); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	l.WithField("filename", path).Info("the readme of the source was replaced by the tombstone")
+	return nil
+}
+
+// tombstoneInPlace tells whether content is the page of template, whatever
+// the day its {{date}} was expanded on: a rerun on a later day does not
+// commit the page again.
+func tombstoneInPlace(template, content string, source, target *gh.Repository) bool {
+	const day = "\x00date\x00"
+	parts := strings.Split(expandTemplate(strings.Replace(template, "{{date}}", day, -1), source, target), day)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, `\d{4}-\d{2}-\d{2}`) + "$").MatchString(content)
+}
+
+// tombstoneBranchRepo commits the page alone on a branch without history,
+// made the default branch of the source. The branch is committed again
+// when the page changed.
+func tombstoneBranchRepo(cfg *migration, source, target *gh.Repository, path, template, page string, l *log.Entry) error {
+	ctx := cfg.runContext()
+	src := cfg.Source
+	branch := cfg.Source.Tombstone.Branch
+	if branch == "" {
+		branch = tombstoneBranch
+	}
+
+	tree, _, err := src.Instance.Git.CreateTree(ctx, src.Organization, *source.Name, "", []gh.TreeEntry{
+		{Path: gh.String(path), Mode: gh.String("100644"), Type: gh.String("blob"), Content: gh.String(page)},
+	})
+	if err != nil {
+		return fmt.Errorf("tree: %v", err)
+	}
+
+	ref, resp, err := src.Instance.Git.GetRef(ctx, src.Organization, *source.Name, "heads/"+branch)
+	exists := err == nil
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("branch %s: %v", branch, err)
+	}
+
+	changed := !exists
+	if exists {
+		tip, _, err := src.Instance.Git.GetCommit(ctx, src.Organization, *source.Name, ref.GetObject().GetSHA())
+		if err != nil {
+			return fmt.Errorf("branch %s: %v", branch, err)
+		}
+		if changed = tip.GetTree().GetSHA() != tree.GetSHA(); changed {
+			// the same page expanded on another day keeps its tree
+			c, _, _, err := src.Instance.Repositories.GetContents(ctx, src.Organization, *source.Name, path, &gh.RepositoryContentGetOptions{Ref: branch})
+			if err == nil {
+				content, err := c.GetContent()
+				changed = err != nil || !tombstoneInPlace(template, content, source, target)
+			}
+		}
+	}
+
+	if changed {
+		message, err := commitMessage(cfg, config.CommitTombstone, []string{path}, source, target)
+		if err != nil {
+			return err
+		}
+		author, committer := commitAuthors(cfg)
+		commit, _, err := src.Instance.Git.CreateCommit(ctx, src.Organization, *source.Name, &gh.Commit{
+			Message:   gh.String(message),
+			Tree:      &gh.Tree{SHA: tree.SHA},
+			Author:    author,
+			Committer: committer,
+		})
+		if err != nil {
+			return fmt.Errorf("commit: %v", err)
+		}
+		update := &gh.Reference{Ref: gh.String("refs/heads/" + branch), Object: &gh.GitObject{SHA: commit.SHA}}
+		if exists {
+			// the branch has no other history than the tombstone
+			_, _, err = src.Instance.Git.UpdateRef(ctx, src.Organization, *source.Name, update, true)
+		} else {
+			_, _, err = src.Instance.Git.CreateRef(ctx, src.Organization, *source.Name, update)
+		}
+		if err != nil {
+			return fmt.Errorf("branch %s: %v", branch, err)
+		}
+		l.WithField("branch", branch).Info("the tombstone was committed")
+	}
+
+	if source.GetDefaultBranch() == branch {
+		return nil
+	}
+	_, _, err = src.Instance.Repositories.Edit(ctx, src.Organization, *source.Name, &gh.Repository{DefaultBranch: gh.String(branch)})
+	if err != nil {
+		return fmt.Errorf("default branch: %v", err)
+	}
+	l.WithField("branch", branch).WithField("previous", source.GetDefaultBranch()).Info("the tombstone branch is the default branch of the source")
+	return nil
+}
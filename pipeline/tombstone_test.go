@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/provider/github/githubtest"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestTombstoneReadme(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	cfg.Source.Tombstone = config.Tombstone{Mode: config.TombstoneReadme, Template: "moved to {{target_url}}\n"}
+	m := newTestMigration(t, cfg)
+
+	source := &gh.Repository{Name: gh.String("api"), DefaultBranch: gh.String("main")}
+	target := &gh.Repository{Name: gh.String("api"), HTMLURL: gh.String("https://github.com/acme-new/api")}
+	for i := 0; i < 2; i++ {
+		if err := tombstoneRepo(m, source, target, log.WithField("repo", "api")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := f.source.Repo(sourceOrg, "api").Files["README.md"], "moved to https://github.com/acme-new/api\n"; got != want {
+		t.Errorf("README.md = %q, want %q", got, want)
+	}
+	// the second run finds the tombstone in place
+	if n := len(f.source.Requests("PUT")); n != 1 {
+		t.Errorf("%d commits, want 1", n)
+	}
+}
+
+func TestTombstoneRerun(t *testing.T) {
+	defer func() { templateNow = time.Now }()
+	// the default page, then one telling the day it moved
+	for _, template := range []string{"", "moved on {{date}}\n"} {
+		f := newFakes(t, "organization.json")
+		cfg := f.config(t)
+		cfg.Source.Tombstone = config.Tombstone{Mode: config.TombstoneReadme, Template: template}
+		m := newTestMigration(t, cfg)
+
+		source := &gh.Repository{Name: gh.String("api"), DefaultBranch: gh.String("main")}
+		target := &gh.Repository{Name: gh.String("api"), HTMLURL: gh.String("https://github.com/acme-new/api")}
+		for _, day := range []string{"2020-01-02", "2020-01-03"} {
+			templateNow = func() time.Time { d, _ := time.Parse("2006-01-02", day); return d }
+			if err := tombstoneRepo(m, source, target, log.WithField("repo", "api")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if n := len(f.source.Requests("PUT")); n != 1 {
+			t.Errorf("template %q: %d commits, want 1", template, n)
+		}
+	}
+}
+
+func TestTombstoneBranchRerun(t *testing.T) {
+	defer func() { templateNow = time.Now }()
+	templateNow = func() time.Time { return time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC) }
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	cfg.Source.Tombstone = config.Tombstone{Mode: config.TombstoneBranch, Template: "moved on {{date}}\n"}
+	m := newTestMigration(t, cfg)
+
+	// the branch has the page committed the day before, so another tree
+	f.source.Handle("POST", "repos/acme/api/git/trees", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusCreated, map[string]string{"sha": strings.Repeat("t", 40)})
+	})
+	f.source.Handle("GET", "repos/acme/api/git/refs/heads/moved", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, map[string]interface{}{"ref": "refs/heads/moved", "object": map[string]string{"sha": strings.Repeat("c", 40)}})
+	})
+	f.source.Handle("GET", "repos/acme/api/git/commits/*", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, map[string]interface{}{"sha": strings.Repeat("c", 40), "tree": map[string]string{"sha": strings.Repeat("o", 40)}})
+	})
+	f.source.Handle("GET", "repos/acme/api/contents/README.md", func(w http.ResponseWriter, r *http.Request, path string) {
+		if ref := r.URL.Query().Get("ref"); ref != "moved" {
+			t.Errorf("ref = %q, want the tombstone branch", ref)
+		}
+		githubtest.Reply(w, http.StatusOK, map[string]string{"type": "file", "encoding": "base64",
+			"content": base64.StdEncoding.EncodeToString([]byte("moved on 2020-01-02\n"))})
+	})
+
+	source := &gh.Repository{Name: gh.String("api"), DefaultBranch: gh.String("moved")}
+	target := &gh.Repository{Name: gh.String("api"), HTMLURL: gh.String("https://github.com/acme-new/api")}
+	if err := tombstoneRepo(m, source, target, log.WithField("repo", "api")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range f.source.Requests("POST") {
+		if r.Path == "repos/acme/api/git/commits" {
+			t.Errorf("the page of the day before was committed again")
+		}
+	}
+}
+
+func TestTombstoneBranch(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	cfg.Source.Tombstone = config.Tombstone{Mode: config.TombstoneBranch}
+	m := newTestMigration(t, cfg)
+
+	f.source.Handle("POST", "repos/acme/api/git/trees", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusCreated, map[string]string{"sha": strings.Repeat("t", 40)})
+	})
+	f.source.Handle("GET", "repos/acme/api/git/refs/heads/moved", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+	})
+	f.source.Handle("POST", "repos/acme/api/git/commits", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusCreated, map[string]string{"sha": strings.Repeat("c", 40)})
+	})
+	f.source.Handle("POST", "repos/acme/api/git/refs", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusCreated, map[string]string{"ref": "refs/heads/moved"})
+	})
+
+	source := &gh.Repository{Name: gh.String("api"), DefaultBranch: gh.String("main")}
+	target := &gh.Repository{Name: gh.String("api"), HTMLURL: gh.String("https://github.com/acme-new/api")}
+	if err := tombstoneRepo(m, source, target, log.WithField("repo", "api")); err != nil {
+		t.Fatal(err)
+	}
+
+	var tree, commit string
+	for _, r := range f.source.Requests("POST") {
+		switch r.Path {
+		case "repos/acme/api/git/trees":
+			tree = r.Body
+		case "repos/acme/api/git/commits":
+			commit = r.Body
+		}
+	}
+	if !strings.Contains(tree, `"path":"README.md"`) || !strings.Contains(tree, "https://github.com/acme-new/api") {
+		t.Errorf("tree = %s, want the readme pointing to the target", tree)
+	}
+	// a commit without parents starts a new history
+	if strings.Contains(commit, "parents") || !strings.Contains(commit, "moved to https://github.com/acme-new/api") {
+		t.Errorf("commit = %s, want a root commit", commit)
+	}
+	if got := f.source.Repo(sourceOrg, "api").Fields["default_branch"]; got != "moved" {
+		t.Errorf("default_branch = %v, want moved", got)
+	}
+}
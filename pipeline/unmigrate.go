@@ -0,0 +1,297 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"github.com/leocomelli/ghmgr/report"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// runUnmigrate cleans up a trial run recorded in the state file or the
+// json report: the repositories it created on the target are deleted, the
+// content updates of the sources are reverted and the sources unarchived.
+// The repositories are confirmed first, unless --force.
+func runUnmigrate(cfg *migration, repos []*gh.Repository) error {
+	if cfg.DryRun {
+		return errors.New("the unmigrate command does not support the dry-run mode")
+	}
+	done, err := completedSteps(cfg)
+	if err != nil {
+		return err
+	}
+
+	var selected []*gh.Repository
+	for _, repo := range repos {
+		if len(done[*repo.Name]) > 0 {
+			selected = append(selected, repo)
+		}
+	}
+	if len(selected) == 0 {
+		log.Info("the run changed none of the repositories, nothing to clean up")
+		return nil
+	}
+
+	if !cfg.force {
+		if err := confirmUnmigrate(cfg, selected, done); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, repo := range selected {
+		if cfg.stopping() {
+			break
+		}
+		l := log.WithField("repo", *repo.Name)
+		if err := unmigrateRepo(cfg, repo, done[*repo.Name], l); err != nil {
+			l.Error(err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return partialError(failed, len(selected), "the cleanup of %d of %d repositories failed", failed, len(selected))
+	}
+	return nil
+}
+
+// completedSteps are the steps completed for each repository, according to
+// the state file or else the json report.
+func completedSteps(cfg *migration) (map[string]map[string]bool, error) {
+	done := map[string]map[string]bool{}
+
+	switch {
+	case cfg.State != nil:
+		for name, s := range cfg.State.Repos {
+			done[name] = map[string]bool{}
+			for step := range s.Steps {
+				done[name][step] = true
+			}
+		}
+	case cfg.Report.Path != "" && report.Format(cfg.Report.Path, cfg.Report.Format) == "json":
+		content, err := ioutil.ReadFile(cfg.Report.Path)
+		if err != nil {
+			return nil, err
+		}
+		var results []*report.RepoResult
+		if err := json.Unmarshal(content, &results); err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			done[r.Name] = map[string]bool{}
+			for _, step := range r.Steps {
+				done[r.Name][step] = true
+			}
+		}
+	default:
+		return nil, errors.New("the unmigrate command requires the state_file or a json report")
+	}
+
+	return done, nil
+}
+
+// unmigrateActions describes what the cleanup of the repository does.
+func unmigrateActions(cfg *migration, name string, done map[string]bool) []string {
+	var actions []string
+	if done[stepCreate] && !done[stepReused] {
+		actions = append(actions, fmt.Sprintf("delete %s/%s", cfg.Target.Organization, targetName(cfg, name)))
+	}
+	if done[stepContent] {
+		actions = append(actions, "revert the content update")
+	}
+	if done[stepArchive] {
+		actions = append(actions, "unarchive the source")
+	}
+	return actions
+}
+
+func confirmUnmigrate(cfg *migration, repos []*gh.Repository, done map[string]map[string]bool) error {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("the unmigrate command requires a terminal to confirm the cleanup, or --force")
+	}
+
+	r := bufio.NewReader(os.Stdin)
+	w := os.Stdout
+
+	fmt.Fprintf(w, "\n%d repositories will be cleaned up:\n\n", len(repos))
+	for i, repo := range repos {
+		actions := unmigrateActions(cfg, *repo.Name, done[*repo.Name])
+		if len(actions) == 0 {
+			actions = []string{"nothing to undo"}
+		}
+		fmt.Fprintf(w, "  %3d. %s: %s\n", i+1, repo.GetName(), strings.Join(actions, ", "))
+	}
+	fmt.Fprintln(w)
+
+	answer, err := prompt(r, w, "the deleted repositories cannot be restored, type yes to continue: ")
+	if err != nil {
+		return err
+	}
+	if answer != "yes" {
+		return errAborted
+	}
+	return nil
+}
+
+// unmigrateRepo undoes the steps of the repository, the source first, so a
+// failure leaves the target still there to retry. The repositories that
+// already existed on the target are kept.
+func unmigrateRepo(cfg *migration, repo *gh.Repository, done map[string]bool, l *log.Entry) error {
+	name := *repo.Name
+
+	if done[stepArchive] {
+		if err := unarchiveRepo(cfg, repo, l); err != nil {
+			return fmt.Errorf("unarchiving the source: %v", err)
+		}
+		if err := cfg.State.Uncomplete(name, stepArchive); err != nil {
+			return err
+		}
+	}
+
+	if done[stepLockdown] {
+		l.Warn("the lockdown of the source is not reverted, its permissions, description and issue are left as they are")
+	}
+
+	if done[stepTombstone] {
+		l.Warn("the tombstone of the source is not reverted, its readme or default branch is left as it is")
+	}
+
+	if done[stepContent] {
+		if err := revertContent(cfg, repo, l); err != nil {
+			return fmt.Errorf("reverting the content: %v", err)
+		}
+		if err := cfg.State.Uncomplete(name, stepContent); err != nil {
+			return err
+		}
+	}
+
+	if !done[stepCreate] {
+		return nil
+	}
+	if done[stepReused] {
+		l.Warn("the repository already existed on the target, not deleting it")
+		return nil
+	}
+
+	target := targetName(cfg, name)
+	l.WithField("target", target).Info("deleting the target repository...")
+	if err := cfg.Target.Provider.Delete(cfg.runContext(), target); err != nil {
+		return fmt.Errorf("deleting the target: %v", err)
+	}
+	return cfg.State.Forget(name)
+}
+
+// revertContent restores the files of the content rules as they were
+// before the content update, the files it created being deleted. A file
+// changed since then is left untouched. The pull request opened for a
+// protected default branch is closed instead, along with its branch.
+func revertContent(cfg *migration, repo *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	src := cfg.Source
+
+	prs, _, err := src.Instance.PullRequests.List(ctx, src.Organization, *repo.Name, &gh.PullRequestListOptions{
+		State: "open",
+		Head:  src.Organization + ":" + contentBranch,
+	})
+	if err != nil {
+		return err
+	}
+	for _, pr := range prs {
+		if _, _, err := src.Instance.PullRequests.Edit(ctx, src.Organization, *repo.Name, pr.GetNumber(), &gh.PullRequest{State: gh.String("closed")}); err != nil {
+			return fmt.Errorf("closing the pull request #%d: %v", pr.GetNumber(), err)
+		}
+		if _, err := src.Instance.Git.DeleteRef(ctx, src.Organization, *repo.Name, "heads/"+contentBranch); err != nil {
+			return fmt.Errorf("deleting the branch %s: %v", contentBranch, err)
+		}
+		l.WithField("url", pr.GetHTMLURL()).Info("the pull request of the content update was closed")
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, rule := range src.Content.AllRules() {
+		if seen[rule.Path] {
+			continue
+		}
+		seen[rule.Path] = true
+		if err := revertContentFile(cfg, repo, rule.Path, l.WithField("filename", rule.Path)); err != nil {
+			return fmt.Errorf("%s: %v", rule.Path, err)
+		}
+	}
+	return nil
+}
+
+// isContentCommit reports whether the commit is one of the content
+// updates, authored by git.commit_author with the api or the git method.
+func isContentCommit(cfg *migration, c *gh.RepositoryCommit) bool {
+	return c.GetCommit().GetAuthor().GetEmail() == cfg.Git.Email
+}
+
+func revertContentFile(cfg *migration, repo *gh.Repository, path string, l *log.Entry) error {
+	ctx := cfg.runContext()
+	src := cfg.Source
+	branch := repo.GetDefaultBranch()
+
+	commits, _, err := src.Instance.Repositories.ListCommits(ctx, src.Organization, *repo.Name, &gh.CommitsListOptions{
+		SHA:         branch,
+		Path:        path,
+		ListOptions: gh.ListOptions{PerPage: 100},
+	})
+	if err != nil {
+		return err
+	}
+
+	// the oldest of the content updates made in a row, several rules
+	// possibly updating the same file
+	var first *gh.RepositoryCommit
+	for _, c := range commits {
+		if !isContentCommit(cfg, c) {
+			break
+		}
+		first = c
+	}
+	if first == nil {
+		l.Warn("the file was changed since the content update, not reverting it")
+		return nil
+	}
+
+	current, _, _, err := src.Instance.Repositories.GetContents(ctx, src.Organization, *repo.Name, path, &gh.RepositoryContentGetOptions{Ref: branch})
+	if err != nil {
+		return err
+	}
+	message, err := commitMessage(cfg, config.CommitRevert, []string{path}, repo, nil)
+	if err != nil {
+		return err
+	}
+	options := fileOptions(cfg, message, nil, current.GetSHA(), branch)
+
+	var previous *gh.RepositoryContent
+	var resp *gh.Response
+	if len(first.Parents) > 0 {
+		previous, _, resp, err = src.Instance.Repositories.GetContents(ctx, src.Organization, *repo.Name, path, &gh.RepositoryContentGetOptions{Ref: first.Parents[0].GetSHA()})
+	}
+	switch {
+	case len(first.Parents) == 0 || err != nil && resp != nil && resp.StatusCode == http.StatusNotFound:
+		l.Info("the file was created by the content update, deleting it...")
+		return removeFile(cfg, src.Instance, src.Organization, *repo.Name, path, options)
+	case err != nil:
+		return err
+	}
+
+	content, err := previous.GetContent()
+	if err != nil {
+		return err
+	}
+	options.Content = []byte(content)
+	l.WithField("commit", first.GetSHA()).Info("restoring the file as it was before the content update...")
+	return commitFile(cfg, src.Instance, src.Organization, *repo.Name, path, options)
+}
@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+type verification struct {
+	Repo     string
+	Refs     int
+	Problems []string
+}
+
+func (v *verification) Passed() bool {
+	return len(v.Problems) == 0
+}
+
+func (v *verification) fail(format string, args ...interface{}) {
+	v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+}
+
+// listRefs returns the SHA of every branch and tag, keyed by the full ref
+// name. Empty repositories have no refs.
+func listRefs(ctx context.Context, client *gh.Client, owner, repo string) (map[string]string, error) {
+	opts := &gh.ReferenceListOptions{ListOptions: gh.ListOptions{PerPage: 100}}
+
+	refs := map[string]string{}
+	for {
+		rr, resp, err := client.Git.ListRefs(ctx, owner, repo, opts)
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			return refs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rr {
+			if strings.HasPrefix(r.GetRef(), "refs/heads/") || strings.HasPrefix(r.GetRef(), "refs/tags/") {
+				refs[r.GetRef()] = r.GetObject().GetSHA()
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return refs, nil
+}
+
+func verifyRepo(cfg *migration, source *gh.Repository) (*verification, error) {
+	v := &verification{Repo: *source.Name}
+
+	target, _, err := cfg.Target.Instance.Repositories.Get(cfg.runContext(), cfg.Target.Organization, targetName(cfg, *source.Name))
+	if err != nil {
+		v.fail("the repository was not found on the target: %v", err)
+		return v, nil
+	}
+
+	sourceRefs, err := listRefs(cfg.runContext(), cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return nil, err
+	}
+	targetRefs, err := listRefs(cfg.runContext(), cfg.Target.Instance, cfg.Target.Organization, *target.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty source has nothing pushed, its target may be initialized
+	if len(sourceRefs) == 0 {
+		return v, nil
+	}
+
+	// without mirror mode only the default branch is pushed
+	if !cfg.Git.Mirror {
+		ref := "refs/heads/" + source.GetDefaultBranch()
+		sourceRefs = map[string]string{ref: sourceRefs[ref]}
+	}
+	for ref := range sourceRefs {
+		if !cfg.refs.Match(ref) {
+			delete(sourceRefs, ref)
+		}
+	}
+
+	var names []string
+	for ref := range sourceRefs {
+		names = append(names, ref)
+	}
+	sort.Strings(names)
+
+	for _, ref := range names {
+		sha, ok := targetRefs[targetRef(cfg, ref)]
+		switch {
+		case !ok:
+			v.fail("%s is missing on the target", targetRef(cfg, ref))
+		case sha != sourceRefs[ref]:
+			v.fail("%s differs: source %s, target %s", targetRef(cfg, ref), sourceRefs[ref], sha)
+		}
+	}
+	v.Refs = len(sourceRefs)
+
+	if cfg.Git.Mirror && len(targetRefs) != len(sourceRefs) {
+		v.fail("ref count differs: source %d, target %d", len(sourceRefs), len(targetRefs))
+	}
+
+	if cfg.refs.Match("refs/heads/"+source.GetDefaultBranch()) && targetBranch(cfg, source.GetDefaultBranch()) != target.GetDefaultBranch() {
+		v.fail("default branch differs: source %s, target %s", targetBranch(cfg, source.GetDefaultBranch()), target.GetDefaultBranch())
+	}
+
+	return v, nil
+}
+
+func verifyStep(cfg *migration, source *gh.Repository, l *log.Entry) error {
+	l.Info("verifying the target refs...")
+
+	v, err := verifyRepo(cfg, source)
+	if err != nil {
+		return err
+	}
+	if !v.Passed() {
+		return fmt.Errorf("verification failed: %s", strings.Join(v.Problems, "; "))
+	}
+
+	l.WithField("refs", v.Refs).Info("the repository was verified successfully")
+	return nil
+}
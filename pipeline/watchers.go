@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	watchersIssueTitle = "This repository was migrated, watch and star it again"
+	watchersIssueBody  = "This repository was migrated from %s, where it was watched or starred by the users below. " +
+		"The stars and the subscriptions cannot be migrated: watch or star it again to keep following it.\n\n%s"
+)
+
+func listStargazers(cfg *migration, repo *gh.Repository) ([]string, error) {
+	opts := &gh.ListOptions{PerPage: 100}
+
+	var logins []string
+	for {
+		ss, resp, err := cfg.Source.Instance.Activity.ListStargazers(cfg.runContext(), cfg.Source.Organization, *repo.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range ss {
+			logins = append(logins, s.GetUser().GetLogin())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return logins, nil
+}
+
+func listWatchers(cfg *migration, repo *gh.Repository) ([]string, error) {
+	opts := &gh.ListOptions{PerPage: 100}
+
+	var logins []string
+	for {
+		uu, resp, err := cfg.Source.Instance.Activity.ListWatchers(cfg.runContext(), cfg.Source.Organization, *repo.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range uu {
+			logins = append(logins, u.GetLogin())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return logins, nil
+}
+
+// migrateWatchers records the stargazers and the watchers of the source in
+// the report, as they cannot be recreated, and with migrate.watchers_issue
+// mentions them, mapped through user_map, in an issue of the target.
+func migrateWatchers(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	stargazers, err := listStargazers(cfg, source)
+	if err != nil {
+		return fmt.Errorf("stargazers: %v", err)
+	}
+	watchers, err := listWatchers(cfg, source)
+	if err != nil {
+		return fmt.Errorf("watchers: %v", err)
+	}
+	cfg.Results.SetWatchers(*source.Name, stargazers, watchers)
+	l.WithField("stargazers", len(stargazers)).WithField("watchers", len(watchers)).Info("the stargazers and watchers were listed")
+
+	if !cfg.Migrate.WatchersIssue {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var mentions []string
+	for _, login := range append(watchers, stargazers...) {
+		login = mapUser(cfg, login)
+		if seen[login] {
+			continue
+		}
+		seen[login] = true
+		mentions = append(mentions, "- @"+login)
+	}
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	issue, _, err := cfg.Target.Instance.Issues.Create(cfg.runContext(), cfg.Target.Organization, *target.Name, &gh.IssueRequest{
+		Title: gh.String(watchersIssueTitle),
+		Body:  gh.String(fmt.Sprintf(watchersIssueBody, source.GetHTMLURL(), strings.Join(mentions, "\n"))),
+	})
+	if err != nil {
+		return fmt.Errorf("watchers issue: %v", err)
+	}
+
+	l.WithField("issue", issue.GetHTMLURL()).WithField("users", len(mentions)).Info("the watchers issue was opened")
+	return nil
+}
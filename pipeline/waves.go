@@ -0,0 +1,191 @@
+package pipeline
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// remainingWave holds the repositories matching none of waves.groups.
+const remainingWave = "remaining"
+
+// wave is a group of repositories migrated before the next one starts.
+type wave struct {
+	name  string
+	repos []*gh.Repository
+}
+
+// planWaves splits the repositories into the waves of waves.groups or of
+// their dependencies, keeping their order within each wave. Without waves
+// they all belong to a single one.
+func planWaves(cfg *migration, repos []*gh.Repository) ([]wave, error) {
+	switch {
+	case len(cfg.Waves.Groups) > 0:
+		return groupWaves(cfg, repos)
+	case cfg.Waves.Dependencies:
+		return dependencyWaves(cfg, repos)
+	}
+	return []wave{{repos: repos}}, nil
+}
+
+// groupWaves puts each repository in the first of waves.groups it matches,
+// the other ones in a last wave.
+func groupWaves(cfg *migration, repos []*gh.Repository) ([]wave, error) {
+	waves := make([]wave, len(cfg.Waves.Groups)+1)
+	patterns := make([][]*regexp.Regexp, len(cfg.Waves.Groups))
+	for i, g := range cfg.Waves.Groups {
+		waves[i].name = g.Name
+		var err error
+		if patterns[i], err = config.CompilePatterns(g.Include); err != nil {
+			return nil, fmt.Errorf("waves.groups[%d].include: %v", i, err)
+		}
+	}
+	waves[len(waves)-1].name = remainingWave
+
+	for _, repo := range repos {
+		i := 0
+		for ; i < len(cfg.Waves.Groups); i++ {
+			if matchWave(cfg.Waves.Groups[i], patterns[i], repo) {
+				break
+			}
+		}
+		waves[i].repos = append(waves[i].repos, repo)
+	}
+	return nonEmptyWaves(waves), nil
+}
+
+func matchWave(g config.Wave, include []*regexp.Regexp, repo *gh.Repository) bool {
+	if matchAny(include, *repo.Name) {
+		return true
+	}
+	for _, t := range repo.Topics {
+		if contains(g.Topics, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyWaves puts each repository in the wave following the ones of
+// the repositories it depends on: its parent when it is a fork, and the
+// repositories it includes as submodules. A cycle is broken where it is
+// found.
+func dependencyWaves(cfg *migration, repos []*gh.Repository) ([]wave, error) {
+	deps, err := submoduleDeps(cfg, repos)
+	if err != nil {
+		return nil, fmt.Errorf("listing the submodules: %v", err)
+	}
+	parents := cfg.forks
+	if parents == nil {
+		if parents, err = forkParents(cfg, repos); err != nil {
+			return nil, fmt.Errorf("listing the parents of the forks: %v", err)
+		}
+	}
+	for fork, parent := range parents {
+		deps[fork] = append(deps[fork], parent)
+	}
+
+	levels := map[string]int{}
+	visiting := map[string]bool{}
+	var level func(name string) int
+	level = func(name string) int {
+		if l, ok := levels[name]; ok {
+			return l
+		}
+		if visiting[name] {
+			return 0
+		}
+		visiting[name] = true
+		l := 0
+		for _, dep := range deps[name] {
+			if d := level(dep) + 1; d > l {
+				l = d
+			}
+		}
+		levels[name] = l
+		return l
+	}
+
+	var waves []wave
+	for _, repo := range repos {
+		l := level(*repo.Name)
+		for len(waves) <= l {
+			waves = append(waves, wave{name: strconv.Itoa(len(waves) + 1)})
+		}
+		waves[l].repos = append(waves[l].repos, repo)
+	}
+	return waves, nil
+}
+
+func nonEmptyWaves(waves []wave) []wave {
+	var res []wave
+	for _, w := range waves {
+		if len(w.repos) > 0 {
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+// logWaves lists the repositories of each wave.
+func logWaves(waves []wave) {
+	for i, w := range waves {
+		var names []string
+		for _, repo := range w.repos {
+			names = append(names, *repo.Name)
+		}
+		log.WithField("wave", w.name).WithField("index", fmt.Sprintf("%d/%d", i+1, len(waves))).
+			WithField("repositories", strings.Join(names, ",")).Info("[plan] the wave would migrate these repositories")
+	}
+}
+
+// checkWaveConfirm fails before the first wave when the waves cannot be
+// confirmed.
+func checkWaveConfirm(cfg *migration, waves []wave) error {
+	if cfg.Waves.Confirm && len(waves) > 1 && !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("waves.confirm requires a terminal")
+	}
+	return nil
+}
+
+// confirmWave asks whether to go on with the next wave, with
+// waves.confirm.
+func confirmWave(cfg *migration, done, next wave, summary Event) bool {
+	if !cfg.Waves.Confirm {
+		return true
+	}
+	fmt.Fprintf(os.Stdout, "\nthe wave %s finished: %d succeeded, %d failed, %d skipped so far\n", done.name, summary.Succeeded, summary.Failed, summary.Skipped)
+	answer, err := prompt(bufio.NewReader(os.Stdin), os.Stdout, fmt.Sprintf("migrate the wave %s, %d repositories? [y/N] ", next.name, len(next.repos)))
+	if err != nil {
+		log.WithError(err).Error("reading the confirmation of the wave")
+		return false
+	}
+	return answer == "y" || answer == "yes"
+}
+
+// flattenWaves lists the repositories of the waves in their order.
+func flattenWaves(waves []wave) []*gh.Repository {
+	var repos []*gh.Repository
+	for _, w := range waves {
+		repos = append(repos, w.repos...)
+	}
+	return repos
+}
+
+// checkpointWave writes the report and stores the state file once a wave
+// is over, so they stay whole whatever happens to the next one.
+func checkpointWave(cfg *migration, w wave) {
+	log.WithField("wave", w.name).Info("the wave finished")
+	if err := writeReport(cfg); err != nil {
+		log.WithError(err).Error("writing the report of the wave")
+	}
+}
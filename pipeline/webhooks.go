@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const maskedSecret = "********"
+
+// rewriteHookURL replaces the longest prefix of migrate.webhook_url_map
+// matching the url, e.g. https://ci.old/jenkins/ before https://ci.old/.
+func rewriteHookURL(cfg *migration, URL string) string {
+	longest := ""
+	for from := range cfg.Migrate.WebhookURLMap {
+		if strings.HasPrefix(URL, from) && len(from) > len(longest) {
+			longest = from
+		}
+	}
+	if longest == "" {
+		return URL
+	}
+	return cfg.Migrate.WebhookURLMap[longest] + strings.TrimPrefix(URL, longest)
+}
+
+func listHooks(ctx context.Context, client *gh.Client, owner, repo string) ([]*gh.Hook, error) {
+	opts := &gh.ListOptions{PerPage: 100}
+
+	var hooks []*gh.Hook
+	for {
+		hh, resp, err := client.Repositories.ListHooks(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hh...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return hooks, nil
+}
+
+func migrateWebhooks(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+
+	hooks, err := listHooks(ctx, cfg.Source.Instance, cfg.Source.Organization, *source.Name)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listHooks(ctx, cfg.Target.Instance, cfg.Target.Organization, *target.Name)
+	if err != nil {
+		return err
+	}
+	urls := map[string]bool{}
+	for _, h := range existing {
+		if URL, ok := h.Config["url"].(string); ok {
+			urls[URL] = true
+		}
+	}
+
+	l.WithField("amount", len(hooks)).Info("migrating the webhooks...")
+
+	for _, h := range hooks {
+		hookConfig := map[string]interface{}{}
+		for k, v := range h.Config {
+			hookConfig[k] = v
+		}
+
+		URL, _ := hookConfig["url"].(string)
+		URL = rewriteHookURL(cfg, URL)
+		hookConfig["url"] = URL
+		if urls[URL] {
+			l.WithField("url", URL).Info("the webhook already exists, skipping")
+			continue
+		}
+
+		if secret, ok := hookConfig["secret"].(string); ok && secret == maskedSecret {
+			delete(hookConfig, "secret")
+			l.WithField("url", hookConfig["url"]).Warn("the webhook secret cannot be read from the source, it must be set again on the target")
+		}
+
+		_, _, err := cfg.Target.Instance.Repositories.CreateHook(ctx, cfg.Target.Organization, *target.Name, &gh.Hook{
+			Name:   gh.String(h.GetName()),
+			Events: h.Events,
+			Active: h.Active,
+			Config: hookConfig,
+		})
+		if err != nil {
+			return fmt.Errorf("webhook %d: %v", h.GetID(), err)
+		}
+
+		l.WithField("url", hookConfig["url"]).WithField("events", h.Events).Info("a webhook was migrated successfully")
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/provider/github/githubtest"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMigrateWebhooksRerun(t *testing.T) {
+	f := newFakes(t, "organization.json")
+	cfg := f.config(t)
+	cfg.Migrate.WebhookURLMap = map[string]string{
+		"https://ci.old/":         "https://ci.new/",
+		"https://ci.old/jenkins/": "https://jenkins.new/",
+	}
+	m := newTestMigration(t, cfg)
+
+	f.source.Handle("GET", "repos/acme/api/hooks", func(w http.ResponseWriter, r *http.Request, path string) {
+		githubtest.Reply(w, http.StatusOK, []map[string]interface{}{
+			{"id": 1, "name": "web", "events": []string{"push"}, "config": map[string]interface{}{"url": "https://ci.old/jenkins/hook"}},
+			{"id": 2, "name": "web", "events": []string{"push"}, "config": map[string]interface{}{"url": "https://ci.old/hook"}},
+		})
+	})
+	// the target answers a duplicate webhook with 422, as GitHub does
+	var mu sync.Mutex
+	var created []map[string]interface{}
+	f.target.Handle("GET", "repos/acme-new/api/hooks", func(w http.ResponseWriter, r *http.Request, path string) {
+		mu.Lock()
+		defer mu.Unlock()
+		hooks := []map[string]interface{}{}
+		for i, h := range created {
+			hooks = append(hooks, map[string]interface{}{"id": 10 + i, "name": "web", "config": h["config"]})
+		}
+		githubtest.Reply(w, http.StatusOK, hooks)
+	})
+	f.target.Handle("POST", "repos/acme-new/api/hooks", func(w http.ResponseWriter, r *http.Request, path string) {
+		mu.Lock()
+		defer mu.Unlock()
+		var h map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&h)
+		URL := h["config"].(map[string]interface{})["url"]
+		for _, c := range created {
+			if c["config"].(map[string]interface{})["url"] == URL {
+				githubtest.Reply(w, http.StatusUnprocessableEntity, map[string]string{"message": "Hook already exists on this repository"})
+				return
+			}
+		}
+		created = append(created, h)
+		githubtest.Reply(w, http.StatusCreated, map[string]interface{}{"id": 10 + len(created)})
+	})
+
+	repo := &gh.Repository{Name: gh.String("api")}
+	for run := 1; run <= 2; run++ {
+		if err := migrateWebhooks(m, repo, repo, log.WithField("repo", "api")); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+
+	if len(created) != 2 {
+		t.Fatalf("%d webhooks created, want 2", len(created))
+	}
+	for i, want := range []string{"https://jenkins.new/hook", "https://ci.new/hook"} {
+		if got := created[i]["config"].(map[string]interface{})["url"]; got != want {
+			t.Errorf("webhook %d: url = %v, want %s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/gitops"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+func wikiURL(URL string) string {
+	return strings.TrimSuffix(URL, ".git") + ".wiki.git"
+}
+
+func migrateWiki(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	if !source.GetHasWiki() {
+		return nil
+	}
+
+	if !target.GetHasWiki() {
+		l.Info("enabling the wiki on the target...")
+		_, _, err := cfg.Target.Instance.Repositories.Edit(cfg.runContext(), cfg.Target.Organization, *target.Name, &gh.Repository{
+			Name:    target.Name,
+			HasWiki: gh.Bool(true),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	l.Info("migrating the wiki...")
+
+	name := *source.Name + ".wiki"
+	_, err := transfer(cfg, wikiURL(repoURL(cfg, source)), wikiURL(repoURL(cfg, target)), name, "", 0, l)
+	if err == transport.ErrRepositoryNotFound || err == transport.ErrEmptyRemoteRepository {
+		// the wiki repository only exists once the first page is created
+		l.WithError(err).Warn("the wiki has no pages on the source or was never initialized on the target, skipping")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	gitops.Cleanup(cfg.Git, clonePath(cfg, name), l)
+
+	l.Info("the wiki was migrated successfully")
+	return nil
+}
@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const workflowsPath = ".github/workflows"
+
+var (
+	usesPattern   = regexp.MustCompile(`(uses:\s*['"]?)([\w.-]+)/([\w.-]+)`)
+	runsOnPattern = regexp.MustCompile(`^(\s*)(-\s+)?runs-on:(.*)$`)
+	labelPattern  = regexp.MustCompile(`[\w.-]+`)
+)
+
+// workflowRules are read from migrate.workflow_rules: the organizations
+// and runner labels to rename and the regular expressions to replace in
+// the workflow files.
+type workflowRules struct {
+	Organizations map[string]string
+	Runners       map[string]string
+	Replace       []struct {
+		Pattern     string
+		Replacement string
+		re          *regexp.Regexp
+	}
+}
+
+func loadWorkflowRules(cfg *migration) (*workflowRules, error) {
+	rules := &workflowRules{}
+	if cfg.Migrate.WorkflowRules != "" {
+		content, err := ioutil.ReadFile(cfg.Migrate.WorkflowRules)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(content, rules); err != nil {
+			return nil, err
+		}
+	}
+
+	if rules.Organizations == nil {
+		rules.Organizations = map[string]string{}
+	}
+	if _, ok := rules.Organizations[cfg.Source.Organization]; !ok {
+		rules.Organizations[cfg.Source.Organization] = cfg.Target.Organization
+	}
+
+	for i, r := range rules.Replace {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("replace %q: %v", r.Pattern, err)
+		}
+		rules.Replace[i].re = re
+	}
+	return rules, nil
+}
+
+// rewriteUses points the actions and reusable workflows of the renamed
+// organizations to the target, applying the repository renames of the
+// source organization.
+func (r *workflowRules) rewriteUses(cfg *migration, line string) string {
+	return usesPattern.ReplaceAllStringFunc(line, func(m string) string {
+		parts := usesPattern.FindStringSubmatch(m)
+		owner, repo := parts[2], parts[3]
+		to, ok := r.Organizations[owner]
+		if !ok {
+			return m
+		}
+		if owner == cfg.Source.Organization {
+			repo = targetName(cfg, repo)
+		}
+		return parts[1] + to + "/" + repo
+	})
+}
+
+func (r *workflowRules) rewriteLabels(value string) string {
+	return labelPattern.ReplaceAllStringFunc(value, func(label string) string {
+		if to, ok := r.Runners[label]; ok {
+			return to
+		}
+		return label
+	})
+}
+
+func (r *workflowRules) rewrite(cfg *migration, content string) string {
+	lines := strings.Split(content, "\n")
+
+	// the indentation of a runs-on key whose labels are listed on the
+	// following lines, -1 outside of such a list
+	runsOn := -1
+	for i, line := range lines {
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case runsOnPattern.MatchString(line):
+			m := runsOnPattern.FindStringSubmatch(line)
+			if strings.TrimSpace(m[3]) == "" {
+				runsOn = indent
+				continue
+			}
+			lines[i] = m[1] + m[2] + "runs-on:" + r.rewriteLabels(m[3])
+			runsOn = -1
+			continue
+		case runsOn >= 0 && indent > runsOn && strings.HasPrefix(trimmed, "-"):
+			lines[i] = line[:indent] + r.rewriteLabels(line[indent:])
+			continue
+		case trimmed != "":
+			runsOn = -1
+		}
+
+		lines[i] = r.rewriteUses(cfg, line)
+	}
+
+	content = strings.Join(lines, "\n")
+	for _, rr := range r.Replace {
+		content = rr.re.ReplaceAllString(content, rr.Replacement)
+	}
+	return content
+}
+
+// rewriteWorkflows commits the rewritten workflow files on the default
+// branch of the target, after the push.
+func rewriteWorkflows(cfg *migration, source, target *gh.Repository, l *log.Entry) error {
+	ctx := cfg.runContext()
+	repos := cfg.Target.Instance.Repositories
+
+	// the default branch is only known once pushed
+	target, err := cfg.Target.Provider.Get(cfg.runContext(), *target.Name)
+	if err != nil {
+		return err
+	}
+	opts := &gh.RepositoryContentGetOptions{Ref: target.GetDefaultBranch()}
+
+	_, dir, resp, err := repos.GetContents(ctx, cfg.Target.Organization, *target.Name, workflowsPath, opts)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+
+	for _, f := range dir {
+		if f.GetType() != "file" || (path.Ext(f.GetName()) != ".yml" && path.Ext(f.GetName()) != ".yaml") {
+			continue
+		}
+
+		c, _, _, err := repos.GetContents(ctx, cfg.Target.Organization, *target.Name, f.GetPath(), opts)
+		if err != nil {
+			return err
+		}
+		content, err := c.GetContent()
+		if err != nil {
+			return err
+		}
+
+		rewritten := cfg.workflowRules.rewrite(cfg, content)
+		if rewritten == content {
+			continue
+		}
+
+		message, err := commitMessage(cfg, config.CommitWorkflows, []string{f.GetPath()}, source, target)
+		if err != nil {
+			return err
+		}
+		options := fileOptions(cfg, message, []byte(rewritten), c.GetSHA(), target.GetDefaultBranch())
+		if err := commitFile(cfg, cfg.Target.Instance, cfg.Target.Organization, *target.Name, f.GetPath(), options); err != nil {
+			return fmt.Errorf("%s: %v", f.GetPath(), err)
+		}
+
+		l.WithField("filename", f.GetPath()).Info("a workflow was rewritten successfully")
+	}
+
+	return nil
+}
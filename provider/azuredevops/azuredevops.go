@@ -0,0 +1,176 @@
+// Package azuredevops implements a source provider listing the git
+// repositories of the projects of an Azure DevOps organization.
+package azuredevops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	gh "github.com/google/go-github/github"
+)
+
+// DefaultURL is the one of Azure DevOps Services, the one of an Azure
+// DevOps Server being https://server/collection.
+const DefaultURL = "https://dev.azure.com"
+
+// DefaultNamePattern names the repositories after their project, so the
+// ones of several projects sharing a name stay apart.
+const DefaultNamePattern = "{project}-{repo}"
+
+// apiVersion is the version of the api sent with every request.
+const apiVersion = "7.0"
+
+// Source lists the repositories of every project of the organization
+// given in source.organization.
+type Source struct {
+	baseURL string
+	token   string
+	pattern string
+	client  *http.Client
+
+	mu    sync.Mutex
+	repos map[string]*adoRepo
+}
+
+type adoRepo struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	DefaultBranch string `json:"defaultBranch"`
+	Size          int64  `json:"size"`
+	RemoteURL     string `json:"remoteUrl"`
+	SSHURL        string `json:"sshUrl"`
+	WebURL        string `json:"webUrl"`
+	IsDisabled    bool   `json:"isDisabled"`
+	Project       struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	} `json:"project"`
+}
+
+// NewSource returns the source of the repositories of organization on the
+// instance at URL, named after pattern, where {project} and {repo} are
+// replaced by the names of the project and of the repository.
+func NewSource(URL, token, organization, pattern string, client *http.Client) *Source {
+	if URL == "" {
+		URL = DefaultURL
+	}
+	if pattern == "" {
+		pattern = DefaultNamePattern
+	}
+	return &Source{
+		baseURL: strings.TrimSuffix(URL, "/") + "/" + url.PathEscape(organization) + "/",
+		token:   token,
+		pattern: pattern,
+		client:  client,
+	}
+}
+
+func (s *Source) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequest("GET", s.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	// the personal access tokens are sent as the password of any user
+	req.SetBasicAuth("", s.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("azure devops GET %s: %s", path, resp.Status)
+	}
+	// a rejected token is redirected to the sign in page
+	if t := resp.Header.Get("Content-Type"); !strings.HasPrefix(t, "application/json") {
+		return fmt.Errorf("azure devops GET %s: answered with %q rather than json, the token was probably rejected", path, t)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// invalidName matches the characters a name of a GitHub repository cannot
+// contain, e.g. the spaces of the names of the projects.
+var invalidName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// name is the name of a repository after the pattern.
+func (s *Source) name(r *adoRepo) string {
+	n := strings.NewReplacer("{project}", r.Project.Name, "{repo}", r.Name).Replace(s.pattern)
+	return strings.Trim(invalidName.ReplaceAllString(n, "-"), "-")
+}
+
+// repository describes an Azure DevOps repository with the go-github type,
+// the repositories of the private projects being private.
+func (s *Source) repository(r *adoRepo) *gh.Repository {
+	return &gh.Repository{
+		Name:          gh.String(s.name(r)),
+		FullName:      gh.String(r.Project.Name + "/" + r.Name),
+		Description:   gh.String(r.Project.Description),
+		Private:       gh.Bool(r.Project.Visibility != "public"),
+		DefaultBranch: gh.String(strings.TrimPrefix(r.DefaultBranch, "refs/heads/")),
+		Size:          gh.Int(int(r.Size / 1024)),
+		CloneURL:      gh.String(r.RemoteURL),
+		SSHURL:        gh.String(r.SSHURL),
+		HTMLURL:       gh.String(r.WebURL),
+	}
+}
+
+// List lists the repositories of every project at once, the disabled ones
+// being left out as they cannot be cloned.
+func (s *Source) List(ctx context.Context) ([]*gh.Repository, error) {
+	var page struct {
+		Value []*adoRepo `json:"value"`
+	}
+	if err := s.get(ctx, "_apis/git/repositories?api-version="+apiVersion, &page); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repos = map[string]*adoRepo{}
+	var repos []*gh.Repository
+	for _, r := range page.Value {
+		if r.IsDisabled {
+			continue
+		}
+		s.repos[s.name(r)] = r
+		repos = append(repos, s.repository(r))
+	}
+	return repos, nil
+}
+
+// Get reads the repository again, the name of the pattern being looked up
+// in the listing.
+func (s *Source) Get(ctx context.Context, name string) (*gh.Repository, error) {
+	s.mu.Lock()
+	listed := s.repos[name]
+	s.mu.Unlock()
+	if listed == nil {
+		if _, err := s.List(ctx); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		listed = s.repos[name]
+		s.mu.Unlock()
+		if listed == nil {
+			return nil, fmt.Errorf("azure devops: %s is not a repository of the organization", name)
+		}
+	}
+
+	r := &adoRepo{}
+	path := fmt.Sprintf("%s/_apis/git/repositories/%s?api-version=%s", url.PathEscape(listed.Project.Name), listed.ID, apiVersion)
+	if err := s.get(ctx, path, r); err != nil {
+		return nil, err
+	}
+	// the project of the listing is kept, the name depending on it
+	r.Project = listed.Project
+	return s.repository(r), nil
+}
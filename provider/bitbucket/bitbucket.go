@@ -0,0 +1,145 @@
+// Package bitbucket implements a source provider listing the repositories
+// of a Bitbucket Server project.
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+)
+
+// Source lists the repositories of the Bitbucket Server project given in
+// source.organization, its key.
+type Source struct {
+	baseURL  string
+	token    string
+	project  string
+	pageSize int
+	client   *http.Client
+}
+
+type bitbucketLink struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type bitbucketRepo struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+	Links       struct {
+		Clone []bitbucketLink `json:"clone"`
+		Self  []bitbucketLink `json:"self"`
+	} `json:"links"`
+}
+
+// NewSource returns the source of the repositories of project on the
+// instance at URL.
+func NewSource(URL, token, project string, pageSize int, client *http.Client) *Source {
+	return &Source{
+		baseURL:  strings.TrimSuffix(URL, "/") + "/rest/api/1.0/",
+		token:    token,
+		project:  project,
+		pageSize: pageSize,
+		client:   client,
+	}
+}
+
+func (s *Source) get(ctx context.Context, path string, v interface{}) (int, error) {
+	req, err := http.NewRequest("GET", s.baseURL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("bitbucket GET %s: %s", path, resp.Status)
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (s *Source) repoPath(slug string) string {
+	return fmt.Sprintf("projects/%s/repos/%s", url.PathEscape(s.project), url.PathEscape(slug))
+}
+
+// repository describes a Bitbucket repository with the go-github type, the
+// slug is used as the name.
+func (s *Source) repository(b *bitbucketRepo) *gh.Repository {
+	r := &gh.Repository{
+		Name:        gh.String(b.Slug),
+		FullName:    gh.String(s.project + "/" + b.Slug),
+		Description: gh.String(b.Description),
+		Private:     gh.Bool(!b.Public),
+	}
+	for _, l := range b.Links.Clone {
+		switch l.Name {
+		case "http":
+			r.CloneURL = gh.String(l.Href)
+		case "ssh":
+			r.SSHURL = gh.String(l.Href)
+		}
+	}
+	if len(b.Links.Self) > 0 {
+		r.HTMLURL = gh.String(b.Links.Self[0].Href)
+	}
+	return r
+}
+
+func (s *Source) List(ctx context.Context) ([]*gh.Repository, error) {
+	var repos []*gh.Repository
+	start := 0
+	for {
+		var page struct {
+			Values        []*bitbucketRepo `json:"values"`
+			IsLastPage    bool             `json:"isLastPage"`
+			NextPageStart int              `json:"nextPageStart"`
+		}
+		path := fmt.Sprintf("projects/%s/repos?limit=%d&start=%d", url.PathEscape(s.project), s.pageSize, start)
+		if _, err := s.get(ctx, path, &page); err != nil {
+			return nil, err
+		}
+		for _, b := range page.Values {
+			repos = append(repos, s.repository(b))
+		}
+		if page.IsLastPage {
+			break
+		}
+		start = page.NextPageStart
+	}
+
+	return repos, nil
+}
+
+// Get also looks up the default branch, which is not part of the listing.
+func (s *Source) Get(ctx context.Context, name string) (*gh.Repository, error) {
+	b := &bitbucketRepo{}
+	if _, err := s.get(ctx, s.repoPath(name), b); err != nil {
+		return nil, err
+	}
+	r := s.repository(b)
+
+	var branch struct {
+		DisplayID string `json:"displayId"`
+	}
+	status, err := s.get(ctx, s.repoPath(name)+"/branches/default", &branch)
+	if err != nil && status != http.StatusNoContent && status != http.StatusNotFound {
+		return nil, err
+	}
+	if branch.DisplayID != "" {
+		r.DefaultBranch = gh.String(branch.DisplayID)
+	}
+	return r, nil
+}
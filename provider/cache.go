@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cachedResponse is a response stored by the cache, along with the
+// validators sent back by the next request of the same url.
+type cachedResponse struct {
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// cacheTransport stores the json responses of the GET requests carrying
+// an ETag or a Last-Modified header in dir, one file per request, so the
+// next runs send them as conditional requests. An unchanged response is
+// answered with a 304, which the GitHub api does not count against the
+// rate limit, and read from the file.
+type cacheTransport struct {
+	dir  string
+	base http.RoundTripper
+}
+
+// NewCacheTransport caches the responses of base in dir, which must exist.
+func NewCacheTransport(base http.RoundTripper, dir string) http.RoundTripper {
+	return &cacheTransport{dir: dir, base: base}
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	path := t.path(req)
+	cached := t.load(path)
+	if cached != nil {
+		r := new(http.Request)
+		*r = *req
+		r.Header = req.Header.Clone()
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			r.Header.Set("If-Modified-Since", modified)
+		}
+		req = r
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		log.WithField("url", req.URL.Path).Debug("the cached response is still valid")
+		return cached.response(req, resp.Header), nil
+	}
+	if resp.StatusCode != http.StatusOK || !cacheable(resp) {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.store(path, &cachedResponse{URL: req.URL.String(), Header: resp.Header, Body: body})
+	return resp, nil
+}
+
+// path is the file of a request, named after its url and the headers the
+// content depends on. The token is left out, its responses being
+// validated by the instance anyway.
+func (t *cacheTransport) path(req *http.Request) string {
+	h := sha256.New()
+	for _, s := range []string{req.URL.String(), req.Header.Get("Accept"), req.Header.Get("X-GitHub-Api-Version")} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return filepath.Join(t.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// load returns nil when the request has no usable response in the cache.
+func (t *cacheTransport) load(path string) *cachedResponse {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var c cachedResponse
+	if err := json.Unmarshal(content, &c); err != nil {
+		log.WithField("file", path).WithError(err).Warn("ignoring an invalid cached response")
+		return nil
+	}
+	return &c
+}
+
+// store writes the file through a temporary one of its own, so the
+// concurrent runs and workers sharing the cache never read half of it.
+func (t *cacheTransport) store(path string, c *cachedResponse) {
+	content, err := json.Marshal(c)
+	if err == nil {
+		err = writeCacheFile(t.dir, path, content)
+	}
+	if err != nil {
+		log.WithField("file", path).WithError(err).Warn("the response could not be cached")
+	}
+}
+
+func writeCacheFile(dir, path string, content []byte) error {
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// response is the cached response of req, with the headers of the 304
+// other than the ones of the content, e.g. the rate limits.
+func (c *cachedResponse) response(req *http.Request, fresh http.Header) *http.Response {
+	header := c.Header.Clone()
+	for k, v := range fresh {
+		if !strings.HasPrefix(k, "Content-") {
+			header[k] = v
+		}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// cacheable tells whether the response is json with a validator, the
+// downloads of the release assets and of the archives being left out.
+func cacheable(resp *http.Response) bool {
+	if resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" {
+		return false
+	}
+	t, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return t == "application/json"
+}
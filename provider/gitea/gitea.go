@@ -0,0 +1,198 @@
+// Package gitea implements a target provider creating the repositories on
+// a Gitea or Forgejo instance, both serving the same api.
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	gh "github.com/google/go-github/github"
+)
+
+// Target creates the repositories in the organization given in
+// target.organization, created on the first repository when missing.
+type Target struct {
+	baseURL      string
+	token        string
+	organization string
+	client       *http.Client
+
+	once   sync.Once
+	orgErr error
+}
+
+type giteaRepository struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	FullName      string `json:"full_name"`
+	Description   string `json:"description"`
+	Private       bool   `json:"private"`
+	DefaultBranch string `json:"default_branch"`
+	CloneURL      string `json:"clone_url"`
+	SSHURL        string `json:"ssh_url"`
+	HTMLURL       string `json:"html_url"`
+}
+
+// NewTarget returns the target of the repositories of organization on the
+// instance at URL.
+func NewTarget(URL, token, organization string, client *http.Client) *Target {
+	return &Target{
+		baseURL:      strings.TrimSuffix(URL, "/") + "/api/v1/",
+		token:        token,
+		organization: organization,
+		client:       client,
+	}
+}
+
+// do sends a request to the gitea api, it returns the status code so a
+// missing resource can be told apart from the other errors.
+func (t *Target) do(ctx context.Context, method, path string, body, v interface{}) (int, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest(method, t.baseURL+path, &buf)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "token "+t.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return resp.StatusCode, fmt.Errorf("gitea %s %s: %s %s", method, path, resp.Status, e.Message)
+	}
+	if v != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp.StatusCode, nil
+}
+
+func (t *Target) repoPath(name string) string {
+	return "repos/" + url.PathEscape(t.organization) + "/" + url.PathEscape(name)
+}
+
+// ensureOrganization creates the organization unless it exists, once.
+func (t *Target) ensureOrganization(ctx context.Context) error {
+	t.once.Do(func() {
+		path := "orgs/" + url.PathEscape(t.organization)
+		status, err := t.do(ctx, "GET", path, nil, nil)
+		if status != http.StatusNotFound {
+			t.orgErr = err
+			return
+		}
+		_, t.orgErr = t.do(ctx, "POST", "orgs", map[string]interface{}{"username": t.organization}, nil)
+	})
+	return t.orgErr
+}
+
+func (r *giteaRepository) repository() *gh.Repository {
+	return &gh.Repository{
+		ID:            gh.Int64(r.ID),
+		Name:          gh.String(r.Name),
+		FullName:      gh.String(r.FullName),
+		Description:   gh.String(r.Description),
+		Private:       gh.Bool(r.Private),
+		DefaultBranch: gh.String(r.DefaultBranch),
+		CloneURL:      gh.String(r.CloneURL),
+		SSHURL:        gh.String(r.SSHURL),
+		HTMLURL:       gh.String(r.HTMLURL),
+		URL:           gh.String(r.HTMLURL),
+	}
+}
+
+func (t *Target) Get(ctx context.Context, name string) (*gh.Repository, error) {
+	r := &giteaRepository{}
+	status, err := t.do(ctx, "GET", t.repoPath(name), nil, r)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.repository(), nil
+}
+
+// Create creates the repository then applies the settings the creation
+// does not take, and the topics of opts. Gitea has no internal
+// repositories, they are created as private ones.
+func (t *Target) Create(ctx context.Context, source, opts *gh.Repository, visibility string) (*gh.Repository, error) {
+	if err := t.ensureOrganization(ctx); err != nil {
+		return nil, err
+	}
+
+	private := opts.GetPrivate()
+	if visibility != "" {
+		private = visibility != "public"
+	}
+	body := map[string]interface{}{
+		"name":           opts.GetName(),
+		"description":    opts.GetDescription(),
+		"private":        private,
+		"default_branch": source.GetDefaultBranch(),
+		"auto_init":      opts.GetAutoInit(),
+	}
+	if opts.GetAutoInit() {
+		body["readme"] = "Default"
+		body["gitignores"] = opts.GetGitignoreTemplate()
+		body["license"] = opts.GetLicenseTemplate()
+	}
+	r := &giteaRepository{}
+	if _, err := t.do(ctx, "POST", "orgs/"+url.PathEscape(t.organization)+"/repos", body, r); err != nil {
+		return nil, err
+	}
+
+	// the settings the source does not tell keep the defaults of the instance
+	settings := map[string]interface{}{}
+	if opts.Homepage != nil {
+		settings["website"] = *opts.Homepage
+	}
+	if opts.HasIssues != nil {
+		settings["has_issues"] = *opts.HasIssues
+	}
+	if opts.HasWiki != nil {
+		settings["has_wiki"] = *opts.HasWiki
+	}
+	if len(settings) > 0 {
+		if _, err := t.do(ctx, "PATCH", t.repoPath(r.Name), settings, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.Topics) > 0 {
+		if _, err := t.do(ctx, "PUT", t.repoPath(r.Name)+"/topics", map[string]interface{}{"topics": opts.Topics}, nil); err != nil {
+			return nil, fmt.Errorf("topics: %v", err)
+		}
+	}
+	return r.repository(), nil
+}
+
+func (t *Target) Delete(ctx context.Context, name string) error {
+	_, err := t.do(ctx, "DELETE", t.repoPath(name), nil, nil)
+	return err
+}
+
+func (t *Target) SetDefaultBranch(ctx context.Context, name, branch string) error {
+	_, err := t.do(ctx, "PATCH", t.repoPath(name), map[string]interface{}{"default_branch": branch}, nil)
+	return err
+}
@@ -0,0 +1,48 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+)
+
+// Request performs a request to an endpoint that is not covered by the
+// go-github client, accept overrides the media type when it is not empty.
+func Request(ctx context.Context, client *gh.Client, method, URL, accept string, body, v interface{}) (*gh.Response, error) {
+	req, err := client.NewRequest(method, URL, body)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return client.Do(ctx, req, v)
+}
+
+// GraphQL runs a query of the GraphQL API, for what the REST API does not
+// offer, decoding its data in v.
+func GraphQL(ctx context.Context, client *gh.Client, query string, variables map[string]interface{}, v interface{}) error {
+	URL := "graphql"
+	if strings.HasSuffix(client.BaseURL.Path, "/api/v3/") {
+		URL = "/api/graphql"
+	}
+
+	body := map[string]interface{}{"query": query, "variables": variables}
+	var result struct {
+		Data   json.RawMessage
+		Errors []struct{ Message string }
+	}
+	if _, err := Request(ctx, client, "POST", URL, "", body, &result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("graphql: %s", result.Errors[0].Message)
+	}
+	if v == nil || len(result.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(result.Data, v)
+}
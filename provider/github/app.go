@@ -0,0 +1,130 @@
+package github
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/leocomelli/ghmgr/config"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const mediaTypeIntegrationPreview = "application/vnd.github.machine-man-preview+json"
+
+// appTokenSource issues installation tokens, which expire after an hour.
+// It is wrapped in an oauth2.ReuseTokenSource, so a new one is requested
+// only when the current token is about to expire.
+type appTokenSource struct {
+	app    config.AppAuth
+	key    *rsa.PrivateKey
+	URL    string
+	client *http.Client
+}
+
+func parsePrivateKey(path string) (*rsa.PrivateKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a pem encoded key", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a rsa key", path)
+	}
+	return rsaKey, nil
+}
+
+// jwt signs the token used to authenticate as the app itself.
+func (s *appTokenSource) jwt() (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": s.app.ID,
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt()
+	if err != nil {
+		return nil, err
+	}
+
+	URL := fmt.Sprintf("%sapp/installations/%d/access_tokens", s.URL, s.app.InstallationID)
+	req, err := http.NewRequest("POST", URL, bytes.NewReader(nil))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeIntegrationPreview)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("installation token for app %d: %s", s.app.ID, resp.Status)
+	}
+
+	var t struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, err
+	}
+
+	log.WithField("app", s.app.ID).WithField("expires_at", t.ExpiresAt).Debug("a new installation token was issued")
+	return &oauth2.Token{AccessToken: t.Token, TokenType: "token", Expiry: t.ExpiresAt}, nil
+}
+
+func newTokenSource(token string, app config.AppAuth, e Endpoint, client *http.Client) (oauth2.TokenSource, error) {
+	if !app.Enabled() {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+	}
+
+	key, err := parsePrivateKey(app.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	base, _ := e.urls()
+	return oauth2.ReuseTokenSource(nil, &appTokenSource{
+		app:    app,
+		key:    key,
+		URL:    base,
+		client: client,
+	}), nil
+}
@@ -0,0 +1,133 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+)
+
+// Endpoint is where the api of an instance is served, github.com when URL
+// is empty.
+type Endpoint struct {
+	// URL is the one of the instance, with or without the /api/v3 path of
+	// GitHub Enterprise
+	URL string
+	// UploadURL defaults to the /api/uploads path of the instance
+	UploadURL string
+	// APIVersion is sent as X-GitHub-Api-Version, the default version of
+	// the instance being used without it
+	APIVersion string
+}
+
+// public tells whether the endpoint is github.com rather than an instance
+// of GitHub Enterprise.
+func (e Endpoint) public() bool {
+	if e.URL == "" {
+		return true
+	}
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == "github.com" || host == "api.github.com"
+}
+
+// urls returns the base and upload URLs of the api of the endpoint: the
+// /api/v3 path is added to the URL of an instance when missing, the /api
+// path alone being completed.
+func (e Endpoint) urls() (string, string) {
+	if e.public() {
+		return "https://api.github.com/", "https://uploads.github.com/"
+	}
+
+	base := strings.TrimSuffix(e.URL, "/")
+	switch {
+	case strings.HasSuffix(base, "/api/v3"):
+	case strings.HasSuffix(base, "/api"):
+		base += "/v3"
+	default:
+		base += "/api/v3"
+	}
+	base += "/"
+
+	upload := e.UploadURL
+	if upload == "" {
+		upload = strings.TrimSuffix(base, "v3/") + "uploads/"
+	} else if !strings.HasSuffix(upload, "/") {
+		upload += "/"
+	}
+	return base, upload
+}
+
+// apiVersionTransport adds the X-GitHub-Api-Version header to the
+// requests.
+type apiVersionTransport struct {
+	version string
+	next    http.RoundTripper
+}
+
+func (t *apiVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("X-GitHub-Api-Version", t.version)
+	return t.next.RoundTrip(r)
+}
+
+// withAPIVersion returns a copy of client sending the api version, client
+// itself without one.
+func withAPIVersion(client *http.Client, version string) *http.Client {
+	if version == "" {
+		return client
+	}
+	c := *client
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.Transport = &apiVersionTransport{version: version, next: next}
+	return &c
+}
+
+// Check reads the root of the api, telling a wrong URL, the one of a web
+// page or of another service, or a rejected token or api version apart
+// from an instance that cannot be reached.
+func Check(ctx context.Context, client *gh.Client, e Endpoint) error {
+	base := client.BaseURL.String()
+	req, err := client.NewRequest("GET", "", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(ctx, req, nil)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+
+	switch {
+	case status == http.StatusNotFound:
+		return fmt.Errorf("%s is not the api of a GitHub instance (404), the url is the one of the instance, e.g. https://github.example.com", base)
+	case status == http.StatusUnauthorized:
+		return fmt.Errorf("%s rejected the token (401)", base)
+	case status == http.StatusBadRequest && e.APIVersion != "":
+		return fmt.Errorf("%s rejected the api version %s: %v", base, e.APIVersion, err)
+	case err != nil && status == 0:
+		return fmt.Errorf("%s cannot be reached: %v", base, err)
+	case err != nil:
+		return fmt.Errorf("%s: %v", base, err)
+	}
+
+	if t, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); t != "application/json" {
+		return fmt.Errorf("%s answered with %q rather than json, the url is probably the one of a web page rather than of a GitHub instance", base, t)
+	}
+	return nil
+}
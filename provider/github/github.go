@@ -0,0 +1,160 @@
+// Package github implements the source and the target providers of the
+// GitHub and GitHub Enterprise instances.
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+	"github.com/leocomelli/ghmgr/config"
+	"golang.org/x/oauth2"
+)
+
+// NewClient returns the client of the api of the endpoint, authenticated
+// with the token or as an installation of app. Every request is sent with
+// client.
+func NewClient(e Endpoint, token string, app config.AppAuth, client *http.Client) (*gh.Client, oauth2.TokenSource, error) {
+	client = withAPIVersion(client, e.APIVersion)
+	ts, err := newTokenSource(token, app, e, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := context.WithValue(oauth2.NoContext, oauth2.HTTPClient, client)
+	tc := oauth2.NewClient(ctx, ts)
+
+	if e.URL == "" {
+		return gh.NewClient(tc), ts, nil
+	}
+	base, upload := e.urls()
+	c, err := gh.NewEnterpriseClient(base, upload, tc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, ts, nil
+}
+
+// Source lists the repositories of an organization, or of a user when user
+// is set, owner being the same user then.
+type Source struct {
+	client   *gh.Client
+	owner    string
+	user     string
+	pageSize int
+}
+
+func NewSource(client *gh.Client, owner, user string, pageSize int) *Source {
+	return &Source{client: client, owner: owner, user: user, pageSize: pageSize}
+}
+
+func (s *Source) List(ctx context.Context) ([]*gh.Repository, error) {
+	if s.user != "" {
+		return s.listUserRepositories(ctx)
+	}
+	return s.listOrgRepositories(ctx)
+}
+
+func (s *Source) Get(ctx context.Context, name string) (*gh.Repository, error) {
+	r, _, err := s.client.Repositories.Get(ctx, s.owner, name)
+	return r, err
+}
+
+func (s *Source) listOrgRepositories(ctx context.Context) ([]*gh.Repository, error) {
+	opts := &gh.RepositoryListByOrgOptions{
+		ListOptions: gh.ListOptions{PerPage: s.pageSize},
+	}
+
+	var repos []*gh.Repository
+	for {
+		rr, resp, err := s.client.Repositories.ListByOrg(ctx, s.owner, opts)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, rr...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return repos, nil
+}
+
+// listUserRepositories lists the repositories owned by the user. The
+// private ones are only visible when the token belongs to that same user.
+func (s *Source) listUserRepositories(ctx context.Context) ([]*gh.Repository, error) {
+	u, _, err := s.client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("authenticated user: %v", err)
+	}
+
+	user, opts := s.user, &gh.RepositoryListOptions{
+		Type:        "owner",
+		ListOptions: gh.ListOptions{PerPage: s.pageSize},
+	}
+	if strings.EqualFold(u.GetLogin(), s.user) {
+		user, opts.Type, opts.Affiliation = "", "", "owner"
+	}
+
+	var repos []*gh.Repository
+	for {
+		rr, resp, err := s.client.Repositories.List(ctx, user, opts)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, rr...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return repos, nil
+}
+
+// Target creates the repositories in an organization.
+type Target struct {
+	client       *gh.Client
+	organization string
+}
+
+func NewTarget(client *gh.Client, organization string) *Target {
+	return &Target{client: client, organization: organization}
+}
+
+func (t *Target) Get(ctx context.Context, name string) (*gh.Repository, error) {
+	r, resp, err := t.client.Repositories.Get(ctx, t.organization, name)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	return r, err
+}
+
+func (t *Target) Create(ctx context.Context, source, opts *gh.Repository, visibility string) (*gh.Repository, error) {
+	if visibility != config.VisibilityInternal {
+		r, _, err := t.client.Repositories.Create(ctx, t.organization, opts)
+		return r, err
+	}
+
+	// go-github does not know the visibility field, internal repositories
+	// are only visible to the members of the enterprise
+	body := struct {
+		*gh.Repository
+		Visibility string `json:"visibility"`
+	}{opts, visibility}
+	r := &gh.Repository{}
+	_, err := Request(ctx, t.client, "POST", fmt.Sprintf("orgs/%s/repos", t.organization), "", body, r)
+	return r, err
+}
+
+func (t *Target) Delete(ctx context.Context, name string) error {
+	_, err := t.client.Repositories.Delete(ctx, t.organization, name)
+	return err
+}
+
+func (t *Target) SetDefaultBranch(ctx context.Context, name, branch string) error {
+	_, _, err := t.client.Repositories.Edit(ctx, t.organization, name, &gh.Repository{Name: gh.String(name), DefaultBranch: gh.String(branch)})
+	return err
+}
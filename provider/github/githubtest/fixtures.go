@@ -0,0 +1,86 @@
+package githubtest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Fixture describes the organizations of an instance, in the json files of
+// the testdata directories: each repository has its json fields and the
+// files of each of its branches.
+type Fixture struct {
+	Organizations map[string]map[string]FixtureRepo `json:"organizations"`
+}
+
+// FixtureRepo is a repository of a fixture.
+type FixtureRepo struct {
+	Fields              map[string]interface{}       `json:"fields"`
+	Topics              []string                     `json:"topics"`
+	VulnerabilityAlerts bool                         `json:"vulnerability_alerts"`
+	Protected           []string                     `json:"protected"`
+	Branches            map[string]map[string]string `json:"branches"`
+}
+
+// LoadFixture creates the organizations and repositories of a fixture
+// file. The branches are committed with Commit when it is set, e.g. to a
+// gittest server, the files of the default branch being served by the
+// contents api either way.
+func (s *Server) LoadFixture(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f Fixture
+	if err := json.Unmarshal(content, &f); err != nil {
+		return err
+	}
+
+	for org, repos := range f.Organizations {
+		s.AddOrg(org)
+		for name, fr := range repos {
+			r := s.AddRepo(org, name, fr.Fields)
+
+			s.mu.Lock()
+			r.Topics = fr.Topics
+			r.VulnerabilityAlerts = fr.VulnerabilityAlerts
+			for _, b := range fr.Protected {
+				r.Protected[b] = true
+			}
+			defaultBranch, _ := r.Fields["default_branch"].(string)
+			for _, branch := range branchOrder(fr.Branches, defaultBranch) {
+				files := fr.Branches[branch]
+				sha := strings.Repeat("0", 40)
+				if s.Commit != nil {
+					s.mu.Unlock()
+					sha = s.Commit(org, name, branch, files)
+					s.mu.Lock()
+				}
+				r.Branches[branch] = sha
+				if branch == defaultBranch {
+					for p, c := range files {
+						r.Files[p] = c
+					}
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// branchOrder sorts the branches, the default one first.
+func branchOrder(branches map[string]map[string]string, defaultBranch string) []string {
+	var names []string
+	for name := range branches {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == defaultBranch) != (names[j] == defaultBranch) {
+			return names[i] == defaultBranch
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
@@ -0,0 +1,479 @@
+// Package githubtest serves a fake GitHub api for the tests: the
+// organizations and their repositories are kept in memory, the requests
+// the server does not know are answered with 404 and recorded, so a test
+// sees what the code under test needs without reaching a real instance.
+package githubtest
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Repo is a repository of the fake instance.
+type Repo struct {
+	Owner string
+	Name  string
+	// Fields are the json fields of the repository, as the api returns them.
+	Fields map[string]interface{}
+	Topics []string
+	// VulnerabilityAlerts are the Dependabot alerts, enabled or not.
+	VulnerabilityAlerts bool
+	// Branches are the sha of the head of each branch, Protected the
+	// branches with a protection.
+	Branches  map[string]string
+	Protected map[string]bool
+	// Files are the content of the files of the default branch by path.
+	Files map[string]string
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// HandlerFunc answers a request the test stubs, path being the one of the
+// api without its /api/v3/ prefix.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request, path string)
+
+// Server is a fake GitHub instance, its URL being the one of source.url or
+// target.url.
+type Server struct {
+	*httptest.Server
+	// OnCreate is called when a repository is created through the api,
+	// e.g. to create its git remote.
+	OnCreate func(r *Repo)
+	// GitURL is the clone url of a repository, the one of the instance by
+	// default.
+	GitURL func(owner, name string) string
+	// Commit commits the files of the branches of the fixtures, returning
+	// the sha of the commit.
+	Commit func(owner, name, branch string, files map[string]string) string
+
+	t        testing.TB
+	mu       sync.Mutex
+	orgs     map[string]bool
+	repos    map[string]*Repo
+	handlers map[string]HandlerFunc
+	requests []Request
+	nextID   int64
+}
+
+// NewServer starts a fake instance, closed at the end of the test. The
+// requests it does not know fail the test.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		t:        t,
+		orgs:     map[string]bool{},
+		repos:    map[string]*Repo{},
+		handlers: map[string]HandlerFunc{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func key(owner, name string) string {
+	return strings.ToLower(owner + "/" + name)
+}
+
+// AddOrg creates an organization without repositories.
+func (s *Server) AddOrg(org string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orgs[strings.ToLower(org)] = true
+}
+
+// AddRepo creates a repository in the organization owner, fields being
+// the json fields other than the ones every repository has.
+func (s *Server) AddRepo(owner, name string, fields map[string]interface{}) *Repo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addRepo(owner, name, fields)
+}
+
+func (s *Server) addRepo(owner, name string, fields map[string]interface{}) *Repo {
+	s.orgs[strings.ToLower(owner)] = true
+	s.nextID++
+
+	cloneURL := fmt.Sprintf("%s/%s/%s.git", s.URL, owner, name)
+	if s.GitURL != nil {
+		cloneURL = s.GitURL(owner, name)
+	}
+	r := &Repo{
+		Owner: owner,
+		Name:  name,
+		Fields: map[string]interface{}{
+			"id":             s.nextID,
+			"name":           name,
+			"full_name":      owner + "/" + name,
+			"owner":          map[string]interface{}{"login": owner, "type": "Organization"},
+			"html_url":       fmt.Sprintf("%s/%s/%s", s.URL, owner, name),
+			"clone_url":      cloneURL,
+			"ssh_url":        cloneURL,
+			"default_branch": "main",
+			"private":        false,
+			"visibility":     "public",
+			"has_issues":     true,
+			"has_projects":   true,
+			"has_wiki":       true,
+			"size":           1,
+		},
+		Branches:  map[string]string{},
+		Protected: map[string]bool{},
+		Files:     map[string]string{},
+	}
+	for k, v := range fields {
+		r.Fields[k] = v
+	}
+	s.repos[key(owner, name)] = r
+	return r
+}
+
+// Repo returns a repository of the instance, nil when it does not exist.
+func (s *Server) Repo(owner, name string) *Repo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.repos[key(owner, name)]
+}
+
+// Repos returns the names of the repositories of an organization, sorted.
+func (s *Server) Repos(owner string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for _, r := range s.repos {
+		if strings.EqualFold(r.Owner, owner) {
+			names = append(names, r.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Handle stubs the requests of method to path, e.g. "repos/org/name/hooks",
+// a * segment matching any value. The stubs take precedence over the
+// routes of the server.
+func (s *Server) Handle(method, path string, h HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method+" "+strings.Trim(path, "/")] = h
+}
+
+// Requests returns the requests received so far, those of method only
+// when it is not empty.
+func (s *Server) Requests(method string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rr []Request
+	for _, r := range s.requests {
+		if method == "" || r.Method == method {
+			rr = append(rr, r)
+		}
+	}
+	return rr
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v3"), "/")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: path, Body: string(body)})
+	h := s.handler(r.Method, path)
+	s.mu.Unlock()
+
+	if h != nil {
+		r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		h(w, r, path)
+		return
+	}
+
+	s.mu.Lock()
+	status, v := s.route(r.Method, strings.Split(path, "/"), body)
+	s.mu.Unlock()
+	if status == 0 {
+		s.t.Errorf("githubtest: unexpected request %s %s", r.Method, r.URL.Path)
+		status, v = http.StatusNotFound, notFound
+	}
+	Reply(w, status, v)
+}
+
+func (s *Server) handler(method, path string) HandlerFunc {
+	if h, ok := s.handlers[method+" "+path]; ok {
+		return h
+	}
+	segments := strings.Split(path, "/")
+	for k, h := range s.handlers {
+		pattern := strings.Split(strings.SplitN(k, " ", 2)[1], "/")
+		if !strings.HasPrefix(k, method+" ") || len(pattern) != len(segments) {
+			continue
+		}
+		match := true
+		for i := range pattern {
+			if pattern[i] != "*" && pattern[i] != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return h
+		}
+	}
+	return nil
+}
+
+var notFound = map[string]string{"message": "Not Found"}
+
+// Reply writes the json of v with the status.
+func Reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// route answers the requests the server knows, a 0 status for the others.
+// The lists fit in a single page.
+func (s *Server) route(method string, p []string, body []byte) (int, interface{}) {
+	switch {
+	case len(p) == 1 && p[0] == "" && method == "GET":
+		return http.StatusOK, map[string]string{"current_user_url": s.URL + "/api/v3/user"}
+	case len(p) == 1 && p[0] == "rate_limit" && method == "GET":
+		core := map[string]int64{"limit": 5000, "remaining": int64(5000 - len(s.requests)), "reset": time.Now().Add(time.Hour).Unix()}
+		return http.StatusOK, map[string]interface{}{"resources": map[string]interface{}{"core": core}}
+	case len(p) == 1 && p[0] == "user" && method == "GET":
+		return http.StatusOK, map[string]interface{}{"login": "ghmgr", "type": "User"}
+	case len(p) == 2 && (p[0] == "orgs" || p[0] == "users") && method == "GET":
+		if !s.orgs[strings.ToLower(p[1])] {
+			return http.StatusNotFound, notFound
+		}
+		kind := "Organization"
+		if p[0] == "users" {
+			kind = "User"
+		}
+		return http.StatusOK, map[string]interface{}{"login": p[1], "type": kind}
+	case len(p) == 3 && (p[0] == "orgs" || p[0] == "users") && p[2] == "repos":
+		return s.orgRepos(method, p[1], body)
+	case len(p) >= 3 && p[0] == "repos":
+		r := s.repos[key(p[1], p[2])]
+		if r == nil {
+			return http.StatusNotFound, notFound
+		}
+		return s.repo(method, r, p[3:], body)
+	}
+	return 0, nil
+}
+
+func (s *Server) orgRepos(method, owner string, body []byte) (int, interface{}) {
+	switch method {
+	case "GET":
+		if !s.orgs[strings.ToLower(owner)] {
+			return http.StatusNotFound, notFound
+		}
+		list := []map[string]interface{}{}
+		for _, k := range s.sortedKeys() {
+			if r := s.repos[k]; strings.EqualFold(r.Owner, owner) {
+				list = append(list, r.Fields)
+			}
+		}
+		return http.StatusOK, list
+	case "POST":
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return http.StatusBadRequest, map[string]string{"message": err.Error()}
+		}
+		name, _ := fields["name"].(string)
+		if s.repos[key(owner, name)] != nil {
+			return http.StatusUnprocessableEntity, map[string]string{"message": "Repository creation failed: name already exists on this account"}
+		}
+		if fields["private"] == true && fields["visibility"] == nil {
+			fields["visibility"] = "private"
+		}
+		r := s.addRepo(owner, name, fields)
+		if s.OnCreate != nil {
+			s.OnCreate(r)
+		}
+		return http.StatusCreated, r.Fields
+	}
+	return 0, nil
+}
+
+func (s *Server) sortedKeys() []string {
+	var keys []string
+	for k := range s.repos {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) repo(method string, r *Repo, p []string, body []byte) (int, interface{}) {
+	if len(p) == 0 {
+		switch method {
+		case "GET":
+			return http.StatusOK, r.Fields
+		case "PATCH":
+			fields := map[string]interface{}{}
+			if err := json.Unmarshal(body, &fields); err != nil {
+				return http.StatusBadRequest, map[string]string{"message": err.Error()}
+			}
+			for k, v := range fields {
+				r.Fields[k] = v
+			}
+			if name, ok := fields["name"].(string); ok && name != r.Name {
+				delete(s.repos, key(r.Owner, r.Name))
+				r.Name = name
+				s.repos[key(r.Owner, r.Name)] = r
+			}
+			return http.StatusOK, r.Fields
+		case "DELETE":
+			delete(s.repos, key(r.Owner, r.Name))
+			return http.StatusNoContent, nil
+		}
+		return 0, nil
+	}
+
+	switch {
+	case p[0] == "topics" && len(p) == 1:
+		if method == "PUT" {
+			var v struct{ Names []string }
+			json.Unmarshal(body, &v)
+			r.Topics = v.Names
+		}
+		topics := r.Topics
+		if topics == nil {
+			topics = []string{}
+		}
+		return http.StatusOK, map[string][]string{"names": topics}
+	case p[0] == "vulnerability-alerts" && len(p) == 1:
+		switch method {
+		case "PUT":
+			r.VulnerabilityAlerts = true
+		case "DELETE":
+			r.VulnerabilityAlerts = false
+		case "GET":
+			if !r.VulnerabilityAlerts {
+				return http.StatusNotFound, notFound
+			}
+		}
+		return http.StatusNoContent, nil
+	case p[0] == "branches" && method == "GET":
+		return s.branches(r, p[1:])
+	case p[0] == "contents" && len(p) > 1:
+		return s.contents(method, r, strings.Join(p[1:], "/"), body)
+	}
+	return 0, nil
+}
+
+func (s *Server) branches(r *Repo, p []string) (int, interface{}) {
+	branch := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":      name,
+			"commit":    map[string]string{"sha": r.Branches[name]},
+			"protected": r.Protected[name],
+		}
+	}
+	if len(p) == 0 {
+		var names []string
+		for name := range r.Branches {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := []map[string]interface{}{}
+		for _, name := range names {
+			list = append(list, branch(name))
+		}
+		return http.StatusOK, list
+	}
+	name := strings.Join(p, "/")
+	if _, ok := r.Branches[name]; !ok {
+		return http.StatusNotFound, map[string]string{"message": "Branch not found"}
+	}
+	return http.StatusOK, branch(name)
+}
+
+func (s *Server) contents(method string, r *Repo, file string, body []byte) (int, interface{}) {
+	content := func(file string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":     "file",
+			"name":     file[strings.LastIndex(file, "/")+1:],
+			"path":     file,
+			"sha":      blobSHA(r.Files[file]),
+			"encoding": "base64",
+			"content":  base64.StdEncoding.EncodeToString([]byte(r.Files[file])),
+		}
+	}
+
+	switch method {
+	case "GET":
+		if _, ok := r.Files[file]; ok {
+			return http.StatusOK, content(file)
+		}
+		// a directory lists its files
+		list := []map[string]interface{}{}
+		for _, f := range sortedFiles(r.Files) {
+			if strings.HasPrefix(f, file+"/") && !strings.Contains(f[len(file)+1:], "/") {
+				c := content(f)
+				delete(c, "content")
+				list = append(list, c)
+			}
+		}
+		if len(list) == 0 {
+			return http.StatusNotFound, notFound
+		}
+		return http.StatusOK, list
+	case "PUT", "DELETE":
+		var v struct {
+			Content []byte
+			SHA     string
+		}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return http.StatusBadRequest, map[string]string{"message": err.Error()}
+		}
+		old, exists := r.Files[file]
+		if exists && v.SHA != blobSHA(old) || !exists && v.SHA != "" {
+			return http.StatusConflict, map[string]string{"message": fmt.Sprintf("%s does not match", v.SHA)}
+		}
+		if method == "DELETE" {
+			delete(r.Files, file)
+			return http.StatusOK, map[string]interface{}{"content": nil}
+		}
+		r.Files[file] = string(v.Content)
+		status := http.StatusCreated
+		if exists {
+			status = http.StatusOK
+		}
+		return status, map[string]interface{}{"content": content(file)}
+	}
+	return 0, nil
+}
+
+func sortedFiles(files map[string]string) []string {
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// blobSHA is the git sha of the blob of a file, the contents api
+// identifies its versions with it.
+func blobSHA(content string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("blob %d\x00%s", len(content), content))))
+}
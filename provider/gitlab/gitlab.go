@@ -0,0 +1,174 @@
+// Package gitlab implements a target provider creating the repositories as
+// GitLab projects.
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	gh "github.com/google/go-github/github"
+)
+
+// Target creates the repositories as projects of the group given in
+// target.organization, which may be a subgroup such as "platform/legacy".
+type Target struct {
+	baseURL string
+	token   string
+	group   string
+	lfs     bool
+	client  *http.Client
+
+	once         sync.Once
+	namespaceID  int
+	namespaceErr error
+}
+
+type gitlabProject struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	Visibility        string `json:"visibility"`
+	DefaultBranch     string `json:"default_branch"`
+	HTTPURLToRepo     string `json:"http_url_to_repo"`
+	SSHURLToRepo      string `json:"ssh_url_to_repo"`
+	WebURL            string `json:"web_url"`
+}
+
+// NewTarget returns the target of the projects of group on the instance at
+// URL, lfs enabling Git LFS on the new projects.
+func NewTarget(URL, token, group string, lfs bool, client *http.Client) *Target {
+	return &Target{
+		baseURL: strings.TrimSuffix(URL, "/") + "/api/v4/",
+		token:   token,
+		group:   group,
+		lfs:     lfs,
+		client:  client,
+	}
+}
+
+// do sends a request to the gitlab api, it returns the status code so a
+// missing resource can be told apart from the other errors.
+func (t *Target) do(ctx context.Context, method, path string, body, v interface{}) (int, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest(method, t.baseURL+path, &buf)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", t.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Message interface{} `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return resp.StatusCode, fmt.Errorf("gitlab %s %s: %s %v", method, path, resp.Status, e.Message)
+	}
+	if v != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp.StatusCode, nil
+}
+
+func (t *Target) projectPath(name string) string {
+	return "projects/" + url.PathEscape(t.group+"/"+name)
+}
+
+func (t *Target) namespace(ctx context.Context) (int, error) {
+	t.once.Do(func() {
+		var ns struct {
+			ID int `json:"id"`
+		}
+		_, t.namespaceErr = t.do(ctx, "GET", "namespaces/"+url.PathEscape(t.group), nil, &ns)
+		t.namespaceID = ns.ID
+	})
+	return t.namespaceID, t.namespaceErr
+}
+
+func (p *gitlabProject) repository() *gh.Repository {
+	return &gh.Repository{
+		Name:          gh.String(p.Name),
+		FullName:      gh.String(p.PathWithNamespace),
+		Private:       gh.Bool(p.Visibility != "public"),
+		DefaultBranch: gh.String(p.DefaultBranch),
+		CloneURL:      gh.String(p.HTTPURLToRepo),
+		SSHURL:        gh.String(p.SSHURLToRepo),
+		HTMLURL:       gh.String(p.WebURL),
+		URL:           gh.String(p.WebURL),
+	}
+}
+
+func (t *Target) Get(ctx context.Context, name string) (*gh.Repository, error) {
+	p := &gitlabProject{}
+	status, err := t.do(ctx, "GET", t.projectPath(name), nil, p)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.repository(), nil
+}
+
+func (t *Target) Create(ctx context.Context, source, opts *gh.Repository, visibility string) (*gh.Repository, error) {
+	id, err := t.namespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if visibility == "" {
+		visibility = "public"
+		if opts.GetPrivate() {
+			visibility = "private"
+		}
+	}
+
+	p := &gitlabProject{}
+	_, err = t.do(ctx, "POST", "projects", map[string]interface{}{
+		"name":                   opts.GetName(),
+		"path":                   opts.GetName(),
+		"namespace_id":           id,
+		"description":            opts.GetDescription(),
+		"visibility":             visibility,
+		"issues_enabled":         opts.GetHasIssues(),
+		"wiki_enabled":           opts.GetHasWiki(),
+		"lfs_enabled":            t.lfs,
+		"default_branch":         source.GetDefaultBranch(),
+		"merge_method":           "merge",
+		"initialize_with_readme": opts.GetAutoInit(),
+	}, p)
+	if err != nil {
+		return nil, err
+	}
+	return p.repository(), nil
+}
+
+func (t *Target) Delete(ctx context.Context, name string) error {
+	_, err := t.do(ctx, "DELETE", t.projectPath(name), nil, nil)
+	return err
+}
+
+func (t *Target) SetDefaultBranch(ctx context.Context, name, branch string) error {
+	_, err := t.do(ctx, "PUT", t.projectPath(name), map[string]interface{}{"default_branch": branch}, nil)
+	return err
+}
@@ -0,0 +1,32 @@
+// Package provider defines the sources and the targets of a migration,
+// along with the http transports shared by their clients. Whatever the
+// provider, the repositories are described with the go-github type.
+package provider
+
+import (
+	"context"
+
+	gh "github.com/google/go-github/github"
+)
+
+// Source lists the repositories to migrate, described like the ones of
+// the targets.
+type Source interface {
+	List(ctx context.Context) ([]*gh.Repository, error)
+	// Get returns the repository with its default branch and settings.
+	Get(ctx context.Context, name string) (*gh.Repository, error)
+}
+
+// Target creates the repositories on the target, described with at least
+// the name, the urls and the default branch.
+type Target interface {
+	// Get returns nil when the repository does not exist.
+	Get(ctx context.Context, name string) (*gh.Repository, error)
+	// Create creates the repository described by opts, the settings
+	// computed from the source repository. visibility is one of the
+	// config.Visibility values, or empty to follow opts.Private.
+	Create(ctx context.Context, source, opts *gh.Repository, visibility string) (*gh.Repository, error)
+	Delete(ctx context.Context, name string) error
+	// SetDefaultBranch makes branch, already pushed, the default one.
+	SetDefaultBranch(ctx context.Context, name, branch string) error
+}
@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leocomelli/ghmgr/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRateLimitRetries = 5
+	maxBackoff              = time.Minute
+)
+
+// rateLimitTransport pauses and retries requests rejected by the primary
+// or the secondary (abuse detection) rate limits of the GitHub API. The
+// idempotent requests are also retried on network and 5xx errors, up to
+// serverRetries times.
+type rateLimitTransport struct {
+	instance      string
+	base          http.RoundTripper
+	retries       int
+	serverRetries int
+}
+
+// NewClient retries the requests of an instance, source or target, rejected
+// by the rate limits or by server errors. The retries default to 5 and 3.
+func NewClient(instance string, base http.RoundTripper, retries, serverRetries int) *http.Client {
+	if retries <= 0 {
+		retries = defaultRateLimitRetries
+	}
+	if serverRetries <= 0 {
+		serverRetries = defaultHTTPRetries
+	}
+
+	return &http.Client{
+		Transport: &rateLimitTransport{
+			instance:      instance,
+			retries:       retries,
+			serverRetries: serverRetries,
+			base:          base,
+		}}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		// streamed bodies (e.g. release assets) cannot be sent again
+		replayable := req.Body == nil || req.GetBody != nil
+		retryable := replayable && idempotent(req.Method) && attempt < t.serverRetries
+
+		resp, err := t.base.RoundTrip(req)
+		t.record(resp, err)
+		if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+			if !retryable || req.Context().Err() != nil {
+				return resp, err
+			}
+			wait := backoff(attempt)
+			if err == nil {
+				resp.Body.Close()
+				err = fmt.Errorf("%s", resp.Status)
+			}
+			log.WithField("url", req.URL.Path).WithField("wait", wait.String()).WithField("attempt", attempt+1).
+				WithError(err).Warn("request failed, waiting before retrying...")
+
+			select {
+			case <-time.After(wait):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+			continue
+		}
+
+		wait, limited := rateLimitWait(resp, attempt)
+		if !limited || attempt >= t.retries || !replayable {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+
+		log.WithField("url", req.URL.Path).WithField("wait", wait.String()).WithField("attempt", attempt+1).
+			Warn("rate limit reached, waiting before retrying...")
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// record updates the api metrics with a response.
+func (t *rateLimitTransport) record(resp *http.Response, err error) {
+	if err != nil {
+		metrics.APIRequests.Add(1, t.instance, "error")
+		return
+	}
+	metrics.APIRequests.Add(1, t.instance, strconv.Itoa(resp.StatusCode))
+	if v, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		metrics.RateLimitRemaining.Set(float64(v), t.instance)
+	}
+}
+
+func rateLimitWait(resp *http.Response, attempt int) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if s, err := strconv.Atoi(v); err == nil {
+			return time.Duration(s) * time.Second, true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			wait := time.Until(time.Unix(reset, 0)) + time.Second
+			if wait < time.Second {
+				wait = time.Second
+			}
+			return wait, true
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || isAbuseResponse(resp) {
+		return backoff(attempt), true
+	}
+
+	return 0, false
+}
+
+func isAbuseResponse(resp *http.Response) bool {
+	content, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(content))
+	if err != nil {
+		return false
+	}
+
+	body := strings.ToLower(string(content))
+	return strings.Contains(body, "abuse") || strings.Contains(body, "secondary rate limit")
+}
+
+func backoff(attempt int) time.Duration {
+	wait := time.Second << uint(attempt)
+	if wait > maxBackoff || wait <= 0 {
+		return maxBackoff
+	}
+	return wait
+}
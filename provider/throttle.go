@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limiter spaces out the units taken, requests or bytes, to a rate per
+// second shared by every goroutine.
+type Limiter struct {
+	mu   sync.Mutex
+	unit float64
+	next time.Time
+}
+
+func NewLimiter(perSecond float64) *Limiter {
+	return &Limiter{unit: float64(time.Second) / perSecond}
+}
+
+// Wait blocks until n units can be taken, or ctx is done, returning its
+// error then.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) * l.unit))
+	l.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledTransport waits for the limiter before each request.
+type throttledTransport struct {
+	base    http.RoundTripper
+	limiter *Limiter
+}
+
+func NewThrottledTransport(base http.RoundTripper, l *Limiter) http.RoundTripper {
+	return &throttledTransport{base: base, limiter: l}
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context(), 1); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// bandwidthTransport limits the bytes sent and received, the limiter being
+// taken for every chunk of the bodies.
+type bandwidthTransport struct {
+	base    http.RoundTripper
+	limiter *Limiter
+}
+
+func NewBandwidthTransport(base http.RoundTripper, l *Limiter) http.RoundTripper {
+	return &bandwidthTransport{base: base, limiter: l}
+}
+
+func (t *bandwidthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		r := *req
+		r.Body = &limitedBody{ReadCloser: req.Body, ctx: req.Context(), limiter: t.limiter}
+		req = &r
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, ctx: req.Context(), limiter: t.limiter}
+	return resp, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *Limiter
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := b.limiter.Wait(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
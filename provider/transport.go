@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/leocomelli/ghmgr/config"
+)
+
+const (
+	defaultHTTPTimeout = 2 * time.Minute
+	defaultHTTPRetries = 3
+)
+
+// NewTransport verifies the certificates of an endpoint against the system
+// roots plus the certificates of caBundle, unless insecure is set. The
+// timeout bounds the wait for the response headers only, so big downloads
+// and uploads are not interrupted. The requests go through proxy, an http(s)
+// or socks5 URL, none with config.ProxyDirect and the one of the HTTPS_PROXY
+// and NO_PROXY variables without it.
+func NewTransport(h config.HTTPSettings, insecure bool, caBundle, proxy string) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+
+	switch proxy {
+	case "":
+	case config.ProxyDirect:
+		t.Proxy = nil
+	default:
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	t.ResponseHeaderTimeout = h.Timeout
+	if t.ResponseHeaderTimeout <= 0 {
+		t.ResponseHeaderTimeout = defaultHTTPTimeout
+	}
+	if h.MaxIdleConns > 0 {
+		t.MaxIdleConns = h.MaxIdleConns
+		t.MaxIdleConnsPerHost = h.MaxIdleConns
+	}
+	if h.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = h.IdleConnTimeout
+	}
+
+	if caBundle == "" {
+		return t, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	content, err := ioutil.ReadFile(caBundle)
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("%s: no certificate was found", caBundle)
+	}
+	t.TLSClientConfig.RootCAs = pool
+
+	return t, nil
+}
+
+// HostTransport sends each request with the transport of the instance it
+// targets, for the clients shared by the source and the target.
+type HostTransport struct {
+	hosts map[string]http.RoundTripper
+}
+
+func NewHostTransport() *HostTransport {
+	return &HostTransport{hosts: map[string]http.RoundTripper{}}
+}
+
+func (t *HostTransport) Add(URL string, rt http.RoundTripper) {
+	if URL == "" {
+		t.hosts["github.com"] = rt
+		t.hosts["api.github.com"] = rt
+		return
+	}
+	if u, err := url.Parse(URL); err == nil {
+		t.hosts[u.Hostname()] = rt
+	}
+}
+
+func (t *HostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt, ok := t.hosts[req.URL.Hostname()]; ok {
+		return rt.RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -0,0 +1,106 @@
+// Package urls implements a source provider migrating a list of git urls
+// from any git server.
+package urls
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	gh "github.com/google/go-github/github"
+)
+
+// Source migrates the git repositories listed in source.urls and in
+// source.urls_file, one per line.
+type Source struct {
+	urls []string
+	file string
+}
+
+func NewSource(urls []string, file string) *Source {
+	return &Source{urls: urls, file: file}
+}
+
+func readURLsFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var urls []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, s.Err()
+}
+
+// repoName is the last element of the url without the .git suffix, e.g.
+// "tools" for "ssh://git@gerrit.mycompany.com:29418/platform/tools.git".
+func repoName(URL string) string {
+	URL = strings.TrimSuffix(strings.TrimSuffix(URL, "/"), ".git")
+	if i := strings.LastIndexAny(URL, "/:"); i >= 0 {
+		return URL[i+1:]
+	}
+	return path.Base(URL)
+}
+
+// repository describes a git url with the go-github type, the same url
+// being used whatever git.protocol is. The repositories are private on
+// the target unless target.settings.private says otherwise.
+func (s *Source) repository(URL string) *gh.Repository {
+	return &gh.Repository{
+		Name:     gh.String(repoName(URL)),
+		FullName: gh.String(repoName(URL)),
+		Private:  gh.Bool(true),
+		CloneURL: gh.String(URL),
+		SSHURL:   gh.String(URL),
+		HTMLURL:  gh.String(URL),
+	}
+}
+
+func (s *Source) list() ([]string, error) {
+	urls := s.urls
+	if s.file != "" {
+		more, err := readURLsFile(s.file)
+		if err != nil {
+			return nil, fmt.Errorf("source.urls_file: %v", err)
+		}
+		urls = append(urls, more...)
+	}
+	return urls, nil
+}
+
+func (s *Source) List(ctx context.Context) ([]*gh.Repository, error) {
+	urls, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []*gh.Repository
+	for _, u := range urls {
+		repos = append(repos, s.repository(u))
+	}
+	return repos, nil
+}
+
+func (s *Source) Get(ctx context.Context, name string) (*gh.Repository, error) {
+	urls, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range urls {
+		if repoName(u) == name {
+			return s.repository(u), nil
+		}
+	}
+	return nil, fmt.Errorf("the repository %s is not in the url list", name)
+}
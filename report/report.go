@@ -0,0 +1,395 @@
+// Package report collects the outcome of every repository of a run and
+// writes it as json, csv or markdown.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusPartial   = "partial"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// states of the source repositories that could not be pushed as usual
+const (
+	SourceEmpty                = "empty"
+	SourceWikiOnly             = "wiki_only"
+	SourceMissingDefaultBranch = "missing_default_branch"
+)
+
+// Metadata describes a source repository before its migration.
+type Metadata struct {
+	SizeKB           int      `json:"size_kb"`
+	Branches         int      `json:"branches"`
+	Issues           int      `json:"issues"`
+	OpenIssues       int      `json:"open_issues"`
+	PullRequests     int      `json:"pull_requests"`
+	OpenPullRequests int      `json:"open_pull_requests"`
+	Protections      int      `json:"protections"`
+	Topics           []string `json:"topics,omitempty"`
+	// LFS tells whether the .gitattributes file at the root of the
+	// default branch tracks files with lfs
+	LFS bool `json:"lfs"`
+}
+
+type RepoResult struct {
+	Name      string   `json:"name"`
+	Status    string   `json:"status"`
+	Duration  string   `json:"duration"`
+	Steps     []string `json:"steps"`
+	Errors    []string `json:"errors,omitempty"`
+	Unmapped  []string `json:"unmapped_users,omitempty"`
+	TargetURL string   `json:"target_url,omitempty"`
+	PagesURL  string   `json:"pages_url,omitempty"`
+	Owners    []string `json:"unresolved_owners,omitempty"`
+	Source    string   `json:"source_state,omitempty"`
+	ForkOf    string   `json:"fork_of,omitempty"`
+	Renamed   []string `json:"renamed_branches,omitempty"`
+	Stars     []string `json:"stargazers,omitempty"`
+	Watchers  []string `json:"watchers,omitempty"`
+	// CorrelationID is the id of the last attempt, in its logs, events and
+	// audit entries
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Metadata      *Metadata `json:"metadata,omitempty"`
+	// References are the references to the source in the migrated bodies
+	// that could not be pointed at the target
+	References []string `json:"unresolved_references,omitempty"`
+	// Security are the security features that could not be enabled on the
+	// target
+	Security []string `json:"security_failures,omitempty"`
+	// Tags are the signed tags whose signature does not verify on the
+	// target
+	Tags    []string `json:"unverified_tags,omitempty"`
+	started time.Time
+}
+
+// Results collects the outcome of every repository during a run. Like the
+// state, a nil value silently ignores every call.
+type Results struct {
+	mu    sync.Mutex
+	Repos []*RepoResult
+	index map[string]*RepoResult
+	// Redact hides the secrets of the errors recorded, when set.
+	Redact func(string) string
+}
+
+func New() *Results {
+	return &Results{index: map[string]*RepoResult{}}
+}
+
+func (r *Results) redact(s string) string {
+	if r.Redact == nil {
+		return s
+	}
+	return r.Redact(s)
+}
+
+func (r *Results) get(repo string) *RepoResult {
+	res, ok := r.index[repo]
+	if !ok {
+		res = &RepoResult{Name: repo, started: time.Now()}
+		r.index[repo] = res
+		r.Repos = append(r.Repos, res)
+	}
+	return res
+}
+
+func (r *Results) Start(repo string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(repo)
+}
+
+// Retry forgets the outcome of a repository about to run again.
+func (r *Results) Retry(repo string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.get(repo) = RepoResult{Name: repo, started: time.Now()}
+}
+
+func (r *Results) Step(repo, step string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.get(repo)
+	res.Steps = append(res.Steps, step)
+}
+
+func (r *Results) Fail(repo, step string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.get(repo)
+	res.Errors = append(res.Errors, r.redact(fmt.Sprintf("%s: %v", step, err)))
+}
+
+func (r *Results) Unmapped(repo, login string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.get(repo)
+	for _, u := range res.Unmapped {
+		if u == login {
+			return
+		}
+	}
+	res.Unmapped = append(res.Unmapped, login)
+}
+
+// UnresolvedOwner records a code owner of the repository that does not
+// exist on the target.
+func (r *Results) UnresolvedOwner(repo, owner string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.get(repo)
+	for _, o := range res.Owners {
+		if o == owner {
+			return
+		}
+	}
+	res.Owners = append(res.Owners, owner)
+}
+
+// UnresolvedReference records a reference to the source in a migrated
+// body that could not be rewritten for the target.
+func (r *Results) UnresolvedReference(repo, ref string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.get(repo)
+	for _, o := range res.References {
+		if o == ref {
+			return
+		}
+	}
+	res.References = append(res.References, ref)
+}
+
+// SecurityFailure records a security feature of the source that could not
+// be enabled on the target.
+func (r *Results) SecurityFailure(repo, feature string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.get(repo)
+	for _, f := range res.Security {
+		if f == feature {
+			return
+		}
+	}
+	res.Security = append(res.Security, feature)
+}
+
+// UnverifiedTag records a signed tag of the source whose signature does not
+// verify on the target.
+func (r *Results) UnverifiedTag(repo, tag string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.get(repo)
+	for _, t := range res.Tags {
+		if t == tag {
+			return
+		}
+	}
+	res.Tags = append(res.Tags, tag)
+}
+
+func (r *Results) SetTargetURL(repo, URL string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(repo).TargetURL = URL
+}
+
+func (r *Results) SetSourceState(repo, state string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(repo).Source = state
+}
+
+func (r *Results) SetForkOf(repo, parent string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(repo).ForkOf = parent
+}
+
+// SetRenamedBranches records the branches pushed under a new name, as
+// old:new.
+func (r *Results) SetRenamedBranches(repo string, branches []string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(repo).Renamed = branches
+}
+
+// SetWatchers records the stargazers and the watchers of the source, which
+// cannot be migrated.
+func (r *Results) SetWatchers(repo string, stargazers, watchers []string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(repo).Stars, r.get(repo).Watchers = stargazers, watchers
+}
+
+func (r *Results) SetPagesURL(repo, URL string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(repo).PagesURL = URL
+}
+
+func (r *Results) SetCorrelationID(repo, id string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(repo).CorrelationID = id
+}
+
+// SetMetadata records what the source repository held before the migration.
+func (r *Results) SetMetadata(repo string, m *Metadata) {
+	if r == nil || m == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(repo).Metadata = m
+}
+
+// Finish computes the final status of the repository, err is the error that
+// aborted it, if any.
+func (r *Results) Finish(repo string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.get(repo)
+	res.Duration = time.Since(res.started).Round(time.Second).String()
+
+	switch {
+	case err != nil:
+		res.Status = StatusFailed
+		res.Errors = append(res.Errors, r.redact(err.Error()))
+	case len(res.Errors) > 0:
+		res.Status = StatusPartial
+	default:
+		res.Status = StatusSucceeded
+	}
+}
+
+// Skip marks the repository as skipped, e.g. because it already exists on
+// the target.
+func (r *Results) Skip(repo string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.get(repo)
+	res.Duration = time.Since(res.started).Round(time.Second).String()
+	res.Status = StatusSkipped
+}
+
+// Format is the format of the report, given or guessed from the extension
+// of path, json by default.
+func Format(path, format string) string {
+	if format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".md", ".markdown":
+		return "markdown"
+	}
+	return "json"
+}
+
+// Write writes the results to path, in one of the formats accepted by
+// Format.
+func (r *Results) Write(path, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch Format(path, format) {
+	case "json":
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r.Repos)
+	case "csv":
+		w := csv.NewWriter(f)
+		w.Write([]string{"name", "status", "duration", "steps", "errors", "target_url", "unmapped_users", "pages_url", "unresolved_owners", "source_state", "fork_of", "renamed_branches", "stargazers", "watchers", "correlation_id", "unresolved_references", "security_failures", "unverified_tags"})
+		for _, res := range r.Repos {
+			w.Write([]string{res.Name, res.Status, res.Duration, strings.Join(res.Steps, ";"), strings.Join(res.Errors, ";"), res.TargetURL, strings.Join(res.Unmapped, ";"), res.PagesURL, strings.Join(res.Owners, ";"), res.Source, res.ForkOf, strings.Join(res.Renamed, ";"),
+				strings.Join(res.Stars, ";"), strings.Join(res.Watchers, ";"), res.CorrelationID, strings.Join(res.References, ";"), strings.Join(res.Security, ";"), strings.Join(res.Tags, ";")})
+		}
+		w.Flush()
+		err = w.Error()
+	case "markdown":
+		fmt.Fprintln(f, "| repository | status | duration | steps | errors | target | unmapped users | pages | unresolved owners | source | fork of | renamed branches | stargazers | watchers | correlation id | unresolved references | security failures | unverified tags |")
+		fmt.Fprintln(f, "|------------|--------|----------|-------|--------|--------|----------------|-------|-------------------|--------|---------|------------------|------------|----------|----------------|-----------------------|-------------------|-----------------|")
+		for _, res := range r.Repos {
+			fmt.Fprintf(f, "| %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s |\n", res.Name, res.Status, res.Duration, strings.Join(res.Steps, ", "),
+				strings.Replace(strings.Join(res.Errors, "<br>"), "|", "\\|", -1), res.TargetURL, strings.Join(res.Unmapped, ", "), res.PagesURL, strings.Join(res.Owners, ", "), res.Source, res.ForkOf, strings.Join(res.Renamed, ", "),
+				strings.Join(res.Stars, ", "), strings.Join(res.Watchers, ", "), res.CorrelationID, strings.Join(res.References, ", "), strings.Join(res.Security, ", "), strings.Join(res.Tags, ", "))
+		}
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leocomelli/ghmgr/config"
+)
+
+const (
+	defaultRegion = "us-east-1"
+	// the body is streamed, it is not part of the signature
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// s3Store puts the objects with the path style urls understood by AWS and
+// by the compatible services alike, signed with signature version 4.
+type s3Store struct {
+	config.S3Storage
+	token  string
+	client *http.Client
+}
+
+func NewS3(s config.S3Storage) Store {
+	if s.Region == "" {
+		s.Region = defaultRegion
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.Region)
+	}
+	s.AccessKey = config.EnvOrDefault("AWS_ACCESS_KEY_ID", s.AccessKey)
+	s.SecretKey = config.EnvOrDefault("AWS_SECRET_ACCESS_KEY", s.SecretKey)
+	return &s3Store{S3Storage: s, token: os.Getenv("AWS_SESSION_TOKEN"), client: &http.Client{}}
+}
+
+func (s *s3Store) objectURL(key string) string {
+	return strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + path.Join(s.Prefix, key)
+}
+
+func (s *s3Store) Location(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.Bucket, path.Join(s.Prefix, key))
+}
+
+func (s *s3Store) Put(ctx context.Context, key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", s.objectURL(key), f)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = info.Size()
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s %s", s.Location(key), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *s3Store) Get(ctx context.Context, key, file string) (bool, error) {
+	req, err := http.NewRequest("GET", s.objectURL(key), nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return false, fmt.Errorf("%s: %s %s", s.Location(key), resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return false, err
+	}
+	return true, writeFile(file, resp.Body)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	h := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(h[:])
+}
+
+// escapePath encodes every segment of the path as the signature expects,
+// the slashes being kept.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = strings.Replace(url.PathEscape(s), "+", "%2B", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sign adds the authorization header of the signature version 4 to req.
+func (s *s3Store) sign(req *http.Request, now time.Time) {
+	date := now.Format("20060102")
+	stamp := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           stamp,
+	}
+	if s.token != "" {
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = s.token
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[h] + "\n")
+	}
+	signed := strings.Join(headers, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signed,
+		unsignedPayload,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.Region)
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", stamp, scope, sha256Hex(canonical)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKey, scope, signed, signature))
+}
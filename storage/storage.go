@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/leocomelli/ghmgr/config"
+)
+
+// Store keeps the files of a run under keys, slash separated paths.
+type Store interface {
+	// Put stores the file at path under key.
+	Put(ctx context.Context, key, path string) error
+	// Get writes the file of key to path, it reports false when there is
+	// no such key.
+	Get(ctx context.Context, key, path string) (bool, error)
+	// Location is where key is stored, for the logs and the reports.
+	Location(key string) string
+}
+
+// New returns the bucket of s.S3 when it is set, the directory of s.Path
+// otherwise.
+func New(s config.Storage) (Store, error) {
+	if s.S3.Enabled() {
+		return NewS3(s.S3), nil
+	}
+	return &local{dir: s.Path}, nil
+}
+
+type local struct {
+	dir string
+}
+
+func (l *local) Location(key string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(key))
+}
+
+func (l *local) Put(ctx context.Context, key, path string) error {
+	return copyFile(path, l.Location(key))
+}
+
+func (l *local) Get(ctx context.Context, key, path string) (bool, error) {
+	if _, err := os.Stat(l.Location(key)); os.IsNotExist(err) {
+		return false, nil
+	}
+	return true, copyFile(l.Location(key), path)
+}
+
+func copyFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dest, in)
+}
+
+// writeFile writes r to path through a temporary file, so an interrupted
+// copy never leaves a truncated file behind.
+func writeFile(path string, r io.Reader) error {
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}